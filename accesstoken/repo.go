@@ -0,0 +1,90 @@
+package accesstoken
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
+)
+
+const (
+	DefaultAccessTokenPayloadLength = 32
+
+	// DefaultAccessTokenValidityWindow is the lifetime of access tokens if
+	// none is configured.
+	DefaultAccessTokenValidityWindow = time.Hour
+)
+
+var (
+	ErrorInvalidClientID = errors.New("invalid client ID")
+
+	ErrorInvalidToken = errors.New("invalid token")
+)
+
+// AccessToken holds what dex knows about an access token it issued. Access
+// tokens are opaque to clients; resource servers learn about them from dex.
+type AccessToken struct {
+	// UserID is the dex user the token was issued for. It is empty for
+	// tokens issued to a client acting on its own behalf.
+	UserID      string
+	ClientID    string
+	ConnectorID string
+
+	// Scope is the scope granted to the token.
+	Scope scope.Scopes
+
+	// Groups the user belonged to when the token was issued, if the groups
+	// scope was granted.
+	Groups []string
+
+	// Claims are the claims the client requested from the UserInfo
+	// endpoint in the 'claims' parameter of the authentication request.
+	Claims session.ClaimRequests
+
+	// Resources are the resource servers the token is restricted to, which
+	// make up its audience. A token without resources is for dex's own
+	// endpoints, such as UserInfo.
+	Resources []string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type AccessTokenGenerator func() (string, error)
+
+func (g AccessTokenGenerator) Generate() (string, error) {
+	return g()
+}
+
+func DefaultAccessTokenGenerator() (string, error) {
+	b := make([]byte, DefaultAccessTokenPayloadLength)
+	n, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	if n != DefaultAccessTokenPayloadLength {
+		return "", errors.New("unable to read enough random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type AccessTokenRepo interface {
+	// Create stores a new access token with the given properties. On success
+	// the token will be returned.
+	Create(tok AccessToken) (string, error)
+
+	// Get returns the access token, or ErrorInvalidToken if the token is
+	// unknown or has expired.
+	Get(token string) (*AccessToken, error)
+
+	// Revoke deletes the access token. It returns ErrorInvalidToken if the
+	// token is unknown.
+	Revoke(token string) error
+
+	// RevokeTokensForClient revokes all tokens issued for the userID for the
+	// provided client.
+	RevokeTokensForClient(userID, clientID string) error
+}
@@ -89,6 +89,9 @@ var (
 		adminschema.ErrorInvalidLogoURI:     errorMaker("bad_request", "invalid logoURI.", http.StatusBadRequest),
 		adminschema.ErrorInvalidClientURI:   errorMaker("bad_request", "invalid clientURI.", http.StatusBadRequest),
 		adminschema.ErrorNoRedirectURI:      errorMaker("bad_request", "invalid redirectURI.", http.StatusBadRequest),
+
+		adminschema.ErrorInvalidPostLogoutRedirectURI: errorMaker("bad_request", "invalid postLogoutRedirectURI.", http.StatusBadRequest),
+		adminschema.ErrorInvalidRefreshTokenDuration:  errorMaker("bad_request", "invalid refreshTokenLifetime or refreshTokenIdleTimeout.", http.StatusBadRequest),
 	}
 )
 
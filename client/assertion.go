@@ -0,0 +1,17 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrorClientAssertionReplayed = errors.New("client assertion was already used")
+
+// ClientAssertionRepo remembers the JWTs clients authenticated with, so that
+// each can only be used once (RFC 7523 Section 3).
+type ClientAssertionRepo interface {
+	// Use records that the client used the assertion identified by jti,
+	// until the assertion expires. It returns ErrorClientAssertionReplayed
+	// if the client already used it.
+	Use(clientID, jti string, expiresAt time.Time) error
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/coreos/go-oidc/jose"
+)
+
+// reservedClaims identify the token and the user; claim mappings may neither
+// read nor write them.
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true,
+	"nbf": true, "jti": true, "nonce": true, "azp": true, "auth_time": true,
+	"acr": true, "amr": true, "at_hash": true, "c_hash": true, "act": true,
+}
+
+// claimTemplateFuncs are the functions available to claim templates in
+// addition to the builtin ones of text/template.
+var claimTemplateFuncs = template.FuncMap{
+	"localpart": func(email string) string {
+		if i := strings.LastIndex(email, "@"); i >= 0 {
+			return email[:i]
+		}
+		return email
+	},
+	"domain": func(email string) string {
+		if i := strings.LastIndex(email, "@"); i >= 0 {
+			return email[i+1:]
+		}
+		return ""
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// compiledClaimMappings holds the filters and templates of claim mappings,
+// compiled when the mappings are validated, so that applying a mapping to
+// each token doesn't compile them again.
+var compiledClaimMappings = struct {
+	sync.Mutex
+	filters   map[string]*regexp.Regexp
+	templates map[string]*template.Template
+}{
+	filters:   make(map[string]*regexp.Regexp),
+	templates: make(map[string]*template.Template),
+}
+
+// ClaimMapping reshapes a claim of the ID tokens and UserInfo responses
+// issued to a client. The value of the claim is taken from the claim From,
+// the constant Value or the Template, in that order; without any of them,
+// the claim is modified in place.
+//
+// For example, the following mappings rename the groups of the user starting
+// with "app-" to "roles", add the local part of the user's email as
+// "username", and a constant "tenant":
+//
+//	[
+//		{"claim": "roles", "from": "groups", "filter": "^app-"},
+//		{"claim": "username", "template": "{{localpart .email}}"},
+//		{"claim": "tenant", "value": "acme"}
+//	]
+type ClaimMapping struct {
+	// Claim is the claim the mapping sets.
+	Claim string `json:"claim"`
+
+	// From renames the claim From to Claim.
+	From string `json:"from,omitempty"`
+
+	// Value sets the claim to a constant.
+	Value interface{} `json:"value,omitempty"`
+
+	// Template sets the claim to the output of a text/template executed
+	// with the other claims, such as "{{localpart .email}}". The claim is
+	// left out if the template refers to claims the user doesn't have.
+	Template string `json:"template,omitempty"`
+
+	// Filter is a regular expression; only the values of a list of strings,
+	// such as groups, which match it are kept.
+	Filter string `json:"filter,omitempty"`
+
+	// Prefix is prepended to a string, or to each value of a list of
+	// strings.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Valid checks that the mapping names a claim it may set, takes the value
+// from at most one source, and that its filter and template parse.
+func (m ClaimMapping) Valid() error {
+	if m.Claim == "" {
+		return errors.New("claim mappings must name a claim")
+	}
+	if reservedClaims[m.Claim] || reservedClaims[m.From] {
+		return fmt.Errorf("claim mapping of %q may not map a reserved claim", m.Claim)
+	}
+	sources := 0
+	for _, set := range []bool{m.From != "", m.Value != nil, m.Template != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("claim mapping of %q must have only one of from, value and template", m.Claim)
+	}
+	if m.Filter != "" {
+		if _, err := m.filter(); err != nil {
+			return fmt.Errorf("invalid filter of claim mapping of %q: %v", m.Claim, err)
+		}
+	}
+	if m.Template != "" {
+		tmpl, err := m.template()
+		if err != nil {
+			return fmt.Errorf("invalid template of claim mapping of %q: %v", m.Claim, err)
+		}
+		for _, c := range templateClaims(tmpl.Tree.Root) {
+			if reservedClaims[c] {
+				return fmt.Errorf("template of claim mapping of %q may not read the reserved claim %q", m.Claim, c)
+			}
+		}
+	}
+	return nil
+}
+
+func (m ClaimMapping) filter() (*regexp.Regexp, error) {
+	compiledClaimMappings.Lock()
+	defer compiledClaimMappings.Unlock()
+	if re, ok := compiledClaimMappings.filters[m.Filter]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(m.Filter)
+	if err != nil {
+		return nil, err
+	}
+	compiledClaimMappings.filters[m.Filter] = re
+	return re, nil
+}
+
+func (m ClaimMapping) template() (*template.Template, error) {
+	compiledClaimMappings.Lock()
+	defer compiledClaimMappings.Unlock()
+	if tmpl, ok := compiledClaimMappings.templates[m.Template]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New("claim").Funcs(claimTemplateFuncs).Option("missingkey=error").Parse(m.Template)
+	if err != nil {
+		return nil, err
+	}
+	compiledClaimMappings.templates[m.Template] = tmpl
+	return tmpl, nil
+}
+
+// Apply sets the claim of the mapping in claims. Claims the mapping can't be
+// applied to, such as those the user doesn't have, are left alone.
+func (m ClaimMapping) Apply(claims jose.Claims) {
+	var v interface{}
+	switch {
+	case m.From != "":
+		var ok bool
+		if v, ok = claims[m.From]; !ok {
+			return
+		}
+		delete(claims, m.From)
+	case m.Value != nil:
+		v = m.Value
+	case m.Template != "":
+		tmpl, err := m.template()
+		if err != nil {
+			return
+		}
+		// Templates only see the claims mappings may read, however
+		// they refer to them.
+		data := make(map[string]interface{}, len(claims))
+		for k, v := range claims {
+			if !reservedClaims[k] {
+				data[k] = v
+			}
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil || b.Len() == 0 {
+			return
+		}
+		// Missing claims looked up with index print as "<no value>".
+		if strings.Contains(b.String(), "<no value>") {
+			return
+		}
+		v = b.String()
+	default:
+		var ok bool
+		if v, ok = claims[m.Claim]; !ok {
+			return
+		}
+	}
+
+	if m.Filter != "" {
+		re, err := m.filter()
+		if err != nil {
+			return
+		}
+		if vs, ok := stringValues(v); ok {
+			filtered := []string{}
+			for _, s := range vs {
+				if re.MatchString(s) {
+					filtered = append(filtered, s)
+				}
+			}
+			v = filtered
+		}
+	}
+	if m.Prefix != "" {
+		switch val := v.(type) {
+		case string:
+			v = m.Prefix + val
+		default:
+			if vs, ok := stringValues(v); ok {
+				prefixed := make([]string, len(vs))
+				for i, s := range vs {
+					prefixed[i] = m.Prefix + s
+				}
+				v = prefixed
+			}
+		}
+	}
+	claims[m.Claim] = v
+}
+
+// ValidClaimMappings checks each of the claim mappings of a client.
+func ValidClaimMappings(mappings []ClaimMapping) error {
+	for _, m := range mappings {
+		if err := m.Valid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyClaimMappings applies the claim mappings of a client to claims, in
+// order, so later mappings see the claims set by earlier ones.
+func ApplyClaimMappings(claims jose.Claims, mappings []ClaimMapping) {
+	for _, m := range mappings {
+		m.Apply(claims)
+	}
+}
+
+// templateClaims returns the claims a template refers to by name, such as
+// email in "{{localpart .email}}".
+func templateClaims(n parse.Node) []string {
+	var claims []string
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, c := range n.Nodes {
+				claims = append(claims, templateClaims(c)...)
+			}
+		}
+	case *parse.ActionNode:
+		claims = templateClaims(n.Pipe)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, c := range n.Cmds {
+				claims = append(claims, templateClaims(c)...)
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			claims = append(claims, templateClaims(a)...)
+		}
+	case *parse.ChainNode:
+		claims = templateClaims(n.Node)
+	case *parse.FieldNode:
+		claims = n.Ident[:1]
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			claims = n.Ident[1:2]
+		}
+	case *parse.IfNode:
+		claims = branchClaims(&n.BranchNode)
+	case *parse.RangeNode:
+		claims = branchClaims(&n.BranchNode)
+	case *parse.WithNode:
+		claims = branchClaims(&n.BranchNode)
+	case *parse.TemplateNode:
+		claims = templateClaims(n.Pipe)
+	}
+	return claims
+}
+
+func branchClaims(n *parse.BranchNode) []string {
+	claims := templateClaims(n.Pipe)
+	claims = append(claims, templateClaims(n.List)...)
+	return append(claims, templateClaims(n.ElseList)...)
+}
+
+// stringValues returns the values of a list of strings, which may have been
+// decoded from JSON.
+func stringValues(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, false
+			}
+			vs[i] = s
+		}
+		return vs, true
+	}
+	return nil, false
+}
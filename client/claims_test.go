@@ -0,0 +1,177 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestClaimMappingValid(t *testing.T) {
+	tests := []struct {
+		mapping ClaimMapping
+		wantErr bool
+	}{
+		{
+			mapping: ClaimMapping{Claim: "groups", Prefix: "oidc:", Filter: "^app-"},
+		},
+		{
+			mapping: ClaimMapping{Claim: "roles", From: "groups"},
+		},
+		{
+			mapping: ClaimMapping{Claim: "username", Template: "{{localpart .email}}"},
+		},
+		{
+			mapping: ClaimMapping{Claim: "tenant", Value: "acme"},
+		},
+		{
+			mapping: ClaimMapping{Prefix: "oidc:"},
+			wantErr: true,
+		},
+		// reserved claims can't be set or renamed
+		{
+			mapping: ClaimMapping{Claim: "sub", Template: "{{.email}}"},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "subject", From: "sub"},
+			wantErr: true,
+		},
+		// nor read by templates
+		{
+			mapping: ClaimMapping{Claim: "user", Template: "{{.sub}}"},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "user", Template: "{{if .email}}{{$.sub}}{{end}}"},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "user", Template: "{{with .address}}{{.country}}{{end}}"},
+		},
+		{
+			mapping: ClaimMapping{Claim: "roles", From: "groups", Value: "admin"},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "roles", Filter: "("},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "username", Template: "{{localpart .email"},
+			wantErr: true,
+		},
+		{
+			mapping: ClaimMapping{Claim: "username", Template: "{{nosuchfunc .email}}"},
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		err := tt.mapping.Valid()
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestClaimMappingCompiledOnce(t *testing.T) {
+	m := ClaimMapping{Claim: "username", Template: "{{lower .email}}", Filter: "^app-"}
+	if err := m.Valid(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	re1, _ := m.filter()
+	re2, _ := m.filter()
+	if re1 == nil || re1 != re2 {
+		t.Errorf("want the filter compiled once, got %p and %p", re1, re2)
+	}
+	tmpl1, _ := m.template()
+	tmpl2, _ := m.template()
+	if tmpl1 == nil || tmpl1 != tmpl2 {
+		t.Errorf("want the template compiled once, got %p and %p", tmpl1, tmpl2)
+	}
+}
+
+func TestApplyClaimMappings(t *testing.T) {
+	tests := []struct {
+		mappings []ClaimMapping
+		want     jose.Claims
+	}{
+		{
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups": []string{"admins", "app-viewers"},
+			},
+		},
+		{
+			mappings: []ClaimMapping{{Claim: "groups", Prefix: "oidc:"}},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups": []string{"oidc:admins", "oidc:app-viewers"},
+			},
+		},
+		{
+			mappings: []ClaimMapping{{Claim: "roles", From: "groups", Filter: "^app-"}},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"roles": []string{"app-viewers"},
+			},
+		},
+		{
+			mappings: []ClaimMapping{
+				{Claim: "username", Template: "{{localpart .email}}"},
+				{Claim: "tenant", Value: "acme"},
+			},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups":   []string{"admins", "app-viewers"},
+				"username": "elroy",
+				"tenant":   "acme",
+			},
+		},
+		// later mappings see the claims of earlier ones
+		{
+			mappings: []ClaimMapping{
+				{Claim: "username", Template: "{{localpart .email}}"},
+				{Claim: "username", Prefix: "example:"},
+			},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups":   []string{"admins", "app-viewers"},
+				"username": "example:elroy",
+			},
+		},
+		// claims the user doesn't have are left out
+		{
+			mappings: []ClaimMapping{
+				{Claim: "nickname", Template: "{{.name}}"},
+				{Claim: "roles", From: "entitlements"},
+			},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups": []string{"admins", "app-viewers"},
+			},
+		},
+		// templates can't read reserved claims
+		{
+			mappings: []ClaimMapping{
+				{Claim: "user", Template: `{{index . "sub"}}`},
+			},
+			want: jose.Claims{
+				"sub": "elroy-id", "email": "elroy@example.com",
+				"groups": []string{"admins", "app-viewers"},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		claims := jose.Claims{
+			"sub": "elroy-id", "email": "elroy@example.com",
+			"groups": []string{"admins", "app-viewers"},
+		}
+		ApplyClaimMappings(claims, tt.mappings)
+		if diff := pretty.Compare(tt.want, claims); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
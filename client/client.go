@@ -4,14 +4,21 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"reflect"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/coreos/dex/pkg/jwe"
 	"github.com/coreos/dex/repo"
+	"github.com/coreos/dex/signing"
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 )
 
@@ -31,6 +38,10 @@ var (
 
 	ErrorMissingRedirectURI = errors.New("no client redirect url given")
 
+	ErrorInvalidPostLogoutRedirectURL = errors.New("not a valid post logout redirect url for the given client")
+
+	ErrorSectorIdentifierRequired = errors.New("pairwise clients redirecting to several hosts must have a sector_identifier_uri")
+
 	ErrorNotFound = errors.New("no data found")
 )
 
@@ -67,6 +78,99 @@ type Client struct {
 	Metadata    oidc.ClientMetadata
 	Admin       bool
 	Public      bool
+
+	// PostLogoutRedirectURIs are the URLs the end-user may be redirected to
+	// after logging out (OpenID Connect RP-Initiated Logout 1.0, Section 3.1).
+	// They are not part of oidc.ClientMetadata, so they are kept here.
+	PostLogoutRedirectURIs []url.URL
+
+	// RefreshTokenIdleTimeout and RefreshTokenLifetime override the server's
+	// refresh token expiry for this client when non-zero.
+	RefreshTokenIdleTimeout time.Duration
+	RefreshTokenLifetime    time.Duration
+
+	// DisableRefreshTokenRotation makes refreshing keep the client's refresh
+	// token instead of replacing it, which also disables reuse detection.
+	DisableRefreshTokenRotation bool
+
+	// PasswordGrantConnectorID names the connector the client may log users
+	// in with using the resource owner password credentials grant. The
+	// grant is disabled for the client when it is empty.
+	PasswordGrantConnectorID string
+
+	// ClaimMappings reshape the claims of the client's ID tokens and
+	// UserInfo responses.
+	ClaimMappings []ClaimMapping
+}
+
+// ValidPostLogoutRedirectURL returns the passed in URL if it is one of the
+// client's registered post logout redirect URLs, and returns an error
+// otherwise. Unlike redirect URLs there is no default: the end-user is only
+// redirected if the client asks for it.
+func (c Client) ValidPostLogoutRedirectURL(u *url.URL) (url.URL, error) {
+	if u == nil {
+		return url.URL{}, ErrorInvalidPostLogoutRedirectURL
+	}
+	for _, pu := range c.PostLogoutRedirectURIs {
+		if reflect.DeepEqual(pu, *u) {
+			return pu, nil
+		}
+	}
+	return url.URL{}, ErrorInvalidPostLogoutRedirectURL
+}
+
+// SectorIdentifier returns the identifier of the group of clients, called a
+// sector, which know a user by the same pairwise subject identifier: the host
+// of the client's sector_identifier_uri, or else of its redirect URIs (OpenID
+// Connect Core 1.0 Section 8.1). Clients without such a host, like those
+// redirecting out of band, are a sector of their own.
+func (c Client) SectorIdentifier() string {
+	if u := c.Metadata.SectorIdentifierURI; u != nil {
+		return hostname(*u)
+	}
+	for _, u := range c.Metadata.RedirectURIs {
+		if h := hostname(u); h != "" {
+			return h
+		}
+	}
+	return c.Credentials.ID
+}
+
+// hostname returns the host of u without its port, like url.URL.Hostname,
+// which needs Go 1.8.
+func hostname(u url.URL) string {
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+}
+
+// Pairwise reports whether the client is issued pairwise subject identifiers
+// instead of the users' IDs.
+func (c Client) Pairwise() bool {
+	return c.Metadata.SubjectType == oidc.SubjectTypePairwise
+}
+
+// ValidSubjectType checks the subject_type of the client metadata. Pairwise
+// clients without a sector_identifier_uri must redirect to a single host,
+// which then identifies their sector.
+func ValidSubjectType(m oidc.ClientMetadata) error {
+	switch m.SubjectType {
+	case "", oidc.SubjectTypePublic:
+		return nil
+	case oidc.SubjectTypePairwise:
+	default:
+		return fmt.Errorf("unsupported subject_type %q", m.SubjectType)
+	}
+	if m.SectorIdentifierURI != nil {
+		return nil
+	}
+	for _, u := range m.RedirectURIs {
+		if hostname(u) != hostname(m.RedirectURIs[0]) {
+			return ErrorSectorIdentifierRequired
+		}
+	}
+	return nil
 }
 
 func (c Client) ValidRedirectURL(u *url.URL) (url.URL, error) {
@@ -111,8 +215,21 @@ type ClientRepo interface {
 	// in a ClientCredentials struct along with the provided ID.
 	New(tx repo.Transaction, client Client) (*oidc.ClientCredentials, error)
 
+	// Update replaces the client's properties. The stored secret is kept if
+	// the client's credentials carry none.
 	Update(tx repo.Transaction, client Client) error
 
+	// Delete removes the client and its trusted peers.
+	Delete(tx repo.Transaction, clientID string) error
+
+	// GetRegistrationAccessToken returns the hashed registration access
+	// token of a dynamically registered client, or nil if it has none.
+	GetRegistrationAccessToken(tx repo.Transaction, clientID string) ([]byte, error)
+
+	// SetRegistrationAccessToken sets the hashed registration access token of
+	// the client.
+	SetRegistrationAccessToken(tx repo.Transaction, clientID string, hashed []byte) error
+
 	// GetTrustedPeers returns the list of clients authorized to mint ID token for the given client.
 	GetTrustedPeers(tx repo.Transaction, clientID string) ([]string, error)
 
@@ -159,6 +276,42 @@ func ClientsFromReader(r io.Reader) ([]LoadableClient, error) {
 		Admin        bool     `json:"admin"`
 		Public       bool     `json:"public"`
 		TrustedPeers []string `json:"trustedPeers"`
+
+		PostLogoutRedirectURLs []string `json:"postLogoutRedirectURLs"`
+
+		// Durations, such as "720h".
+		RefreshTokenIdleTimeout string `json:"refreshTokenIdleTimeout"`
+		RefreshTokenLifetime    string `json:"refreshTokenLifetime"`
+
+		DisableRefreshTokenRotation bool `json:"disableRefreshTokenRotation"`
+
+		PasswordGrantConnector string `json:"passwordGrantConnector"`
+
+		ClaimMappings []ClaimMapping `json:"claimMappings"`
+
+		// Clients authenticating with private_key_jwt register their keys
+		// by value or by reference.
+		TokenEndpointAuthMethod string       `json:"tokenEndpointAuthMethod"`
+		JWKSURI                 string       `json:"jwksURI"`
+		JWKS                    *jose.JWKSet `json:"jwks"`
+
+		// Clients sending signed request objects may register where dex
+		// fetches them from, and require that all their requests be signed.
+		RequestURIs             []string `json:"requestURIs"`
+		RequestObjectSigningAlg string   `json:"requestObjectSigningAlg"`
+
+		// The algorithm of the client's ID tokens, RS256 by default.
+		IDTokenSignedResponseAlg string `json:"idTokenSignedResponseAlg"`
+
+		// Clients which registered their keys may have their ID tokens
+		// encrypted. The encryption defaults to A128CBC-HS256.
+		IDTokenEncryptedResponseAlg string `json:"idTokenEncryptedResponseAlg"`
+		IDTokenEncryptedResponseEnc string `json:"idTokenEncryptedResponseEnc"`
+
+		// Pairwise clients are given their own subject identifiers, shared
+		// with the clients of the same sector.
+		SubjectType         string `json:"subjectType"`
+		SectorIdentifierURI string `json:"sectorIdentifierURI"`
 	}
 	if err := json.NewDecoder(r).Decode(&c); err != nil {
 		return nil, err
@@ -179,6 +332,98 @@ func ClientsFromReader(r io.Reader) ([]LoadableClient, error) {
 			}
 			redirectURIs[j] = *uri
 		}
+		var postLogoutRedirectURIs []url.URL
+		for _, u := range client.PostLogoutRedirectURLs {
+			uri, err := url.Parse(u)
+			if err != nil {
+				return nil, err
+			}
+			postLogoutRedirectURIs = append(postLogoutRedirectURIs, *uri)
+		}
+		refreshTokenIdleTimeout, err := parseClientDuration(client.RefreshTokenIdleTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid refreshTokenIdleTimeout for client %s: %v", client.ID, err)
+		}
+		refreshTokenLifetime, err := parseClientDuration(client.RefreshTokenLifetime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid refreshTokenLifetime for client %s: %v", client.ID, err)
+		}
+
+		var jwksURI *url.URL
+		if client.JWKSURI != "" {
+			if jwksURI, err = url.Parse(client.JWKSURI); err != nil {
+				return nil, err
+			}
+		}
+		if client.TokenEndpointAuthMethod == oauth2.AuthMethodPrivateKeyJWT && jwksURI == nil && client.JWKS == nil {
+			return nil, fmt.Errorf("client %s uses private_key_jwt but has no jwks or jwksURI", client.ID)
+		}
+		var requestURIs []url.URL
+		for _, u := range client.RequestURIs {
+			uri, err := url.Parse(u)
+			if err != nil {
+				return nil, err
+			}
+			requestURIs = append(requestURIs, *uri)
+		}
+		if client.RequestObjectSigningAlg != "" && jwksURI == nil && client.JWKS == nil {
+			return nil, fmt.Errorf("client %s signs request objects but has no jwks or jwksURI", client.ID)
+		}
+		if alg := client.IDTokenSignedResponseAlg; alg != "" && alg != jose.AlgRS256 && !signing.Supported(alg) {
+			return nil, fmt.Errorf("unsupported idTokenSignedResponseAlg %q for client %s", alg, client.ID)
+		}
+		idTokenEncryption := oidc.JWAOptions{
+			EncryptionAlg: client.IDTokenEncryptedResponseAlg,
+			EncryptionEnc: client.IDTokenEncryptedResponseEnc,
+		}
+		if idTokenEncryption.EncryptionAlg != "" {
+			if !contains(jwe.Algs, idTokenEncryption.EncryptionAlg) {
+				return nil, fmt.Errorf("unsupported idTokenEncryptedResponseAlg %q for client %s", idTokenEncryption.EncryptionAlg, client.ID)
+			}
+			if idTokenEncryption.EncryptionEnc == "" {
+				idTokenEncryption.EncryptionEnc = jose.EncA128CBCHS256
+			}
+			if !contains(jwe.Encs, idTokenEncryption.EncryptionEnc) {
+				return nil, fmt.Errorf("unsupported idTokenEncryptedResponseEnc %q for client %s", idTokenEncryption.EncryptionEnc, client.ID)
+			}
+			if jwksURI == nil && client.JWKS == nil {
+				return nil, fmt.Errorf("client %s encrypts ID tokens but has no jwks or jwksURI", client.ID)
+			}
+		} else if idTokenEncryption.EncryptionEnc != "" {
+			return nil, fmt.Errorf("client %s has an idTokenEncryptedResponseEnc but no idTokenEncryptedResponseAlg", client.ID)
+		}
+		var sectorIdentifierURI *url.URL
+		if client.SectorIdentifierURI != "" {
+			if sectorIdentifierURI, err = url.Parse(client.SectorIdentifierURI); err != nil {
+				return nil, err
+			}
+		}
+
+		metadata := oidc.ClientMetadata{
+			RedirectURIs: redirectURIs,
+
+			TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+			JWKSURI:                 jwksURI,
+			JWKS:                    client.JWKS,
+
+			RequestURIs:          requestURIs,
+			RequestObjectOptions: oidc.JWAOptions{SigningAlg: client.RequestObjectSigningAlg},
+
+			IDTokenResponseOptions: oidc.JWAOptions{
+				SigningAlg:    client.IDTokenSignedResponseAlg,
+				EncryptionAlg: idTokenEncryption.EncryptionAlg,
+				EncryptionEnc: idTokenEncryption.EncryptionEnc,
+			},
+
+			SubjectType:         client.SubjectType,
+			SectorIdentifierURI: sectorIdentifierURI,
+		}
+		if err := ValidSubjectType(metadata); err != nil {
+			return nil, fmt.Errorf("invalid subjectType for client %s: %v", client.ID, err)
+		}
+		if err := ValidClaimMappings(client.ClaimMappings); err != nil {
+			return nil, fmt.Errorf("invalid claimMappings for client %s: %v", client.ID, err)
+		}
 
 		clients[i] = LoadableClient{
 			Client: Client{
@@ -186,14 +431,47 @@ func ClientsFromReader(r io.Reader) ([]LoadableClient, error) {
 					ID:     client.ID,
 					Secret: client.Secret,
 				},
-				Metadata: oidc.ClientMetadata{
-					RedirectURIs: redirectURIs,
-				},
+				Metadata: metadata,
+
 				Admin:  client.Admin,
 				Public: client.Public,
+
+				PostLogoutRedirectURIs:  postLogoutRedirectURIs,
+				RefreshTokenIdleTimeout: refreshTokenIdleTimeout,
+				RefreshTokenLifetime:    refreshTokenLifetime,
+
+				DisableRefreshTokenRotation: client.DisableRefreshTokenRotation,
+
+				PasswordGrantConnectorID: client.PasswordGrantConnector,
+
+				ClaimMappings: client.ClaimMappings,
 			},
 			TrustedPeers: client.TrustedPeers,
 		}
 	}
 	return clients, nil
 }
+
+// parseClientDuration parses an optional, non-negative duration.
+func parseClientDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("duration must not be negative")
+	}
+	return d, nil
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
@@ -42,6 +43,132 @@ var (
   "public": true
 }`
 
+	logoutClient = `{ 
+  "id": "logout_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "postLogoutRedirectURLs": ["https://client.example.com/logged-out"]
+}`
+
+	refreshExpiryClient = `{ 
+  "id": "refresh_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "refreshTokenIdleTimeout": "24h",
+  "refreshTokenLifetime": "720h"
+}`
+
+	badRefreshExpiryClient = `{ 
+  "id": "refresh_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "refreshTokenLifetime": "a month"
+}`
+
+	passwordGrantClient = `{ 
+  "id": "legacy_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "passwordGrantConnector": "local"
+}`
+
+	privateKeyJWTClient = `{ 
+  "id": "jwt_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "tokenEndpointAuthMethod": "private_key_jwt",
+  "jwksURI": "https://client.example.com/keys"
+}`
+
+	requestObjectClient = `{ 
+  "id": "jar_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "jwksURI": "https://client.example.com/keys",
+  "requestURIs": ["https://client.example.com/request.jwt"],
+  "requestObjectSigningAlg": "RS256"
+}`
+
+	noKeysRequestObjectClient = `{ 
+  "id": "jar_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "requestObjectSigningAlg": "RS256"
+}`
+
+	es256Client = `{ 
+  "id": "mobile_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "idTokenSignedResponseAlg": "ES256"
+}`
+
+	encryptedIDTokenClient = `{ 
+  "id": "mobile_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "jwksURI": "https://client.example.com/keys",
+  "idTokenEncryptedResponseAlg": "RSA-OAEP-256"
+}`
+
+	noKeysEncryptedIDTokenClient = `{ 
+  "id": "mobile_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "idTokenEncryptedResponseAlg": "RSA-OAEP-256"
+}`
+
+	pairwiseClient = `{ 
+  "id": "pairwise_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://a.example.com/callback", "https://b.example.com/callback"],
+  "subjectType": "pairwise",
+  "sectorIdentifierURI": "https://sector.example.com/uris.json"
+}`
+
+	claimMappingsClient = `{ 
+  "id": "kubernetes",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "claimMappings": [{"claim": "groups", "prefix": "oidc:"}]
+}`
+
+	badClaimMappingsClient = `{ 
+  "id": "kubernetes",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "claimMappings": [{"claim": "roles", "from": "groups", "filter": "("}]
+}`
+
+	noSectorPairwiseClient = `{ 
+  "id": "pairwise_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://a.example.com/callback", "https://b.example.com/callback"],
+  "subjectType": "pairwise"
+}`
+
+	encOnlyIDTokenClient = `{ 
+  "id": "mobile_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "jwksURI": "https://client.example.com/keys",
+  "idTokenEncryptedResponseEnc": "A128GCM"
+}`
+
+	badIDTokenAlgClient = `{ 
+  "id": "mobile_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "idTokenSignedResponseAlg": "none"
+}`
+
+	noKeysPrivateKeyJWTClient = `{ 
+  "id": "jwt_client",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com/callback"],
+  "tokenEndpointAuthMethod": "private_key_jwt"
+}`
+
 	badURLClient = `{ 
   "id": "my_id",
   "secret": "` + goodSecret1 + `",
@@ -166,6 +293,237 @@ func TestClientsFromReader(t *testing.T) {
 				},
 			},
 		},
+		{
+			json: "[" + logoutClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "logout_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+						},
+						PostLogoutRedirectURIs: []url.URL{
+							mustParseURL(t, "https://client.example.com/logged-out"),
+						},
+					},
+				},
+			},
+		},
+		{
+			json: "[" + refreshExpiryClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "refresh_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+						},
+						RefreshTokenIdleTimeout: 24 * time.Hour,
+						RefreshTokenLifetime:    720 * time.Hour,
+					},
+				},
+			},
+		},
+		{
+			json: "[" + passwordGrantClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "legacy_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+						},
+						PasswordGrantConnectorID: "local",
+					},
+				},
+			},
+		},
+		{
+			json: "[" + privateKeyJWTClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "jwt_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+							TokenEndpointAuthMethod: "private_key_jwt",
+							JWKSURI: func() *url.URL {
+								u := mustParseURL(t, "https://client.example.com/keys")
+								return &u
+							}(),
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + noKeysPrivateKeyJWTClient + "]",
+			wantErr: true,
+		},
+		{
+			json: "[" + requestObjectClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "jar_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+							JWKSURI: func() *url.URL {
+								u := mustParseURL(t, "https://client.example.com/keys")
+								return &u
+							}(),
+							RequestURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/request.jwt"),
+							},
+							RequestObjectOptions: oidc.JWAOptions{SigningAlg: "RS256"},
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + noKeysRequestObjectClient + "]",
+			wantErr: true,
+		},
+		{
+			json: "[" + es256Client + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "mobile_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+							IDTokenResponseOptions: oidc.JWAOptions{SigningAlg: "ES256"},
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + badIDTokenAlgClient + "]",
+			wantErr: true,
+		},
+		{
+			json: "[" + encryptedIDTokenClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "mobile_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+							JWKSURI: func() *url.URL {
+								u := mustParseURL(t, "https://client.example.com/keys")
+								return &u
+							}(),
+							IDTokenResponseOptions: oidc.JWAOptions{
+								EncryptionAlg: "RSA-OAEP-256",
+								EncryptionEnc: "A128CBC-HS256",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + noKeysEncryptedIDTokenClient + "]",
+			wantErr: true,
+		},
+		{
+			json:    "[" + encOnlyIDTokenClient + "]",
+			wantErr: true,
+		},
+		{
+			json: "[" + pairwiseClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "pairwise_client",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://a.example.com/callback"),
+								mustParseURL(t, "https://b.example.com/callback"),
+							},
+							SubjectType: "pairwise",
+							SectorIdentifierURI: func() *url.URL {
+								u := mustParseURL(t, "https://sector.example.com/uris.json")
+								return &u
+							}(),
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + noSectorPairwiseClient + "]",
+			wantErr: true,
+		},
+		{
+			json: "[" + claimMappingsClient + "]",
+			want: []LoadableClient{
+				{
+					Client: Client{
+						Credentials: oidc.ClientCredentials{
+							ID:     "kubernetes",
+							Secret: goodSecret1,
+						},
+						Metadata: oidc.ClientMetadata{
+							RedirectURIs: []url.URL{
+								mustParseURL(t, "https://client.example.com/callback"),
+							},
+						},
+						ClaimMappings: []ClaimMapping{
+							{Claim: "groups", Prefix: "oidc:"},
+						},
+					},
+				},
+			},
+		},
+		{
+			json:    "[" + badClaimMappingsClient + "]",
+			wantErr: true,
+		},
+		{
+			json:    "[" + badRefreshExpiryClient + "]",
+			wantErr: true,
+		},
 		{
 			json:    "[" + badURLClient + "]",
 			wantErr: true,
@@ -306,3 +664,53 @@ func mustParseURL(t *testing.T, s string) url.URL {
 	}
 	return *u
 }
+
+func TestClientSectorIdentifier(t *testing.T) {
+	sectorURL := mustParseURL(t, "https://sector.example.com:8443/uris.json")
+	tests := []struct {
+		client Client
+		want   string
+	}{
+		{
+			client: Client{
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs: []url.URL{mustParseURL(t, "https://client.example.com:8080/callback")},
+				},
+			},
+			want: "client.example.com",
+		},
+		{
+			client: Client{
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs:        []url.URL{mustParseURL(t, "https://client.example.com/callback")},
+					SectorIdentifierURI: &sectorURL,
+				},
+			},
+			want: "sector.example.com",
+		},
+		{
+			client: Client{
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs: []url.URL{mustParseURL(t, "https://[::1]/callback")},
+				},
+			},
+			want: "::1",
+		},
+		// out of band clients are a sector of their own
+		{
+			client: Client{
+				Credentials: oidc.ClientCredentials{ID: "oob_client"},
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs: []url.URL{mustParseURL(t, OOBRedirectURI)},
+				},
+			},
+			want: "oob_client",
+		},
+	}
+
+	for i, tt := range tests {
+		if got := tt.client.SectorIdentifier(); got != tt.want {
+			t.Errorf("case %d: want %q, got %q", i, tt.want, got)
+		}
+	}
+}
@@ -188,6 +188,85 @@ func (m *ClientManager) Authenticate(creds oidc.ClientCredentials) (bool, error)
 	return ok, nil
 }
 
+// UpdateMetadata replaces the metadata of the client. The metadata is
+// validated as for new clients.
+func (m *ClientManager) UpdateMetadata(clientID string, metadata oidc.ClientMetadata) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c, err := m.clientRepo.Get(tx, clientID)
+	if err != nil {
+		return err
+	}
+	c.Metadata = metadata
+	if err := validateClient(c); err != nil {
+		return err
+	}
+	if err := m.clientRepo.Update(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the client, along with the tokens, grants and pending
+// requests of the client.
+func (m *ClientManager) Delete(clientID string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.clientRepo.Delete(tx, clientID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewRegistrationAccessToken issues the client a registration access token
+// for managing its registration (RFC 7592), replacing any it had before.
+func (m *ClientManager) NewRegistrationAccessToken(clientID string) (string, error) {
+	b, err := m.secretGenerator()
+	if err != nil {
+		return "", err
+	}
+	token := base64.URLEncoding.EncodeToString(b)
+	hashed, err := client.HashSecret(oidc.ClientCredentials{ID: clientID, Secret: token})
+	if err != nil {
+		return "", err
+	}
+	if err := m.clientRepo.SetRegistrationAccessToken(nil, clientID, hashed); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AuthenticateRegistrationAccessToken reports whether token is the
+// registration access token of the client. Clients which were not registered
+// dynamically have none.
+func (m *ClientManager) AuthenticateRegistrationAccessToken(clientID, token string) (bool, error) {
+	hashed, err := m.clientRepo.GetRegistrationAccessToken(nil, clientID)
+	if err == client.ErrorNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if hashed == nil {
+		log.Errorf("no registration access token found for client ID: %v", clientID)
+		return false, nil
+	}
+
+	dec, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		log.Errorf("error decoding registration access token: %v", err)
+		return false, nil
+	}
+	return CompareHashAndPassword(hashed, dec) == nil, nil
+}
+
 func (m *ClientManager) addClientCredentials(cli *client.Client) error {
 	var seed string
 	if cli.Public {
@@ -250,6 +329,9 @@ func validateClient(cli client.Client) error {
 	if err != nil {
 		return client.ValidationError{Err: err}
 	}
+	if err := client.ValidClaimMappings(cli.ClaimMappings); err != nil {
+		return client.ValidationError{Err: err}
+	}
 	return nil
 }
 
@@ -122,6 +122,105 @@ func TestSetDexAdmin(t *testing.T) {
 	if admin {
 		t.Errorf("expected admin to be false")
 	}
+
+	// Updating the client must keep its secret.
+	ok, err := f.mgr.Authenticate(oidc.ClientCredentials{ID: "client.example.com", Secret: goodSecret})
+	if err != nil || !ok {
+		t.Errorf("expected the client to authenticate with its secret, got ok=%t err=%v", ok, err)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	tests := []struct {
+		metadata oidc.ClientMetadata
+		wantErr  bool
+	}{
+		{
+			metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					{Scheme: "https", Host: "client.example.com", Path: "/callback"},
+				},
+				ClientName: "Example",
+			},
+		},
+		{
+			metadata: oidc.ClientMetadata{},
+			wantErr:  true,
+		},
+	}
+
+	for i, tt := range tests {
+		f := makeTestFixtures()
+		err := f.mgr.UpdateMetadata("client.example.com", tt.metadata)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("case %d: want err=%t, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		md, err := f.mgr.Metadata("client.example.com")
+		if err != nil {
+			t.Errorf("case %d: unexpected err: %v", i, err)
+			continue
+		}
+		if md.ClientName != tt.metadata.ClientName || md.RedirectURIs[0] != tt.metadata.RedirectURIs[0] {
+			t.Errorf("case %d: want metadata=%#v, got %#v", i, tt.metadata, md)
+		}
+		admin, _ := f.mgr.IsDexAdmin("client.example.com")
+		if !admin {
+			t.Errorf("case %d: expected admin to be kept", i)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := makeTestFixtures()
+	if err := f.mgr.Delete("client.example.com"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := f.mgr.Get("client.example.com"); err != client.ErrorNotFound {
+		t.Errorf("want deleted client not found, got err=%v", err)
+	}
+	if err := f.mgr.Delete("client.example.com"); err != client.ErrorNotFound {
+		t.Errorf("want deleting unknown client to fail, got err=%v", err)
+	}
+}
+
+func TestRegistrationAccessToken(t *testing.T) {
+	f := makeTestFixtures()
+
+	// Clients loaded from a file were not registered dynamically.
+	ok, err := f.mgr.AuthenticateRegistrationAccessToken("client.example.com", goodSecret)
+	if err != nil || ok {
+		t.Errorf("want no registration access token, got ok=%t err=%v", ok, err)
+	}
+
+	token, err := f.mgr.NewRegistrationAccessToken("client.example.com")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		clientID string
+		token    string
+		want     bool
+	}{
+		{"client.example.com", token, true},
+		{"client.example.com", token + "fluff", false},
+		{"client.example.com", "", false},
+		{"other.example.com", token, false},
+	}
+	for i, tt := range tests {
+		ok, err := f.mgr.AuthenticateRegistrationAccessToken(tt.clientID, tt.token)
+		if err != nil {
+			t.Errorf("case %d: unexpected err: %v", i, err)
+			continue
+		}
+		if ok != tt.want {
+			t.Errorf("case %d: want ok=%t, got %t", i, tt.want, ok)
+		}
+	}
 }
 
 func TestAuthenticate(t *testing.T) {
@@ -218,3 +317,31 @@ func TestValidateClient(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateClientClaimMappings(t *testing.T) {
+	tests := []struct {
+		mappings []client.ClaimMapping
+		wantErr  bool
+	}{
+		{
+			mappings: []client.ClaimMapping{{Claim: "groups", Prefix: "oidc:"}},
+		},
+		{
+			mappings: []client.ClaimMapping{{Claim: "aud", Value: "other"}},
+			wantErr:  true,
+		},
+	}
+
+	for i, tt := range tests {
+		cli := client.Client{
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{mustParseURL("http://auth.google.com")},
+			},
+			ClaimMappings: tt.mappings,
+		}
+		err := validateClient(cli)
+		if _, ok := err.(client.ValidationError); ok != tt.wantErr {
+			t.Errorf("case %d: want ValidationError=%t, got %v", i, tt.wantErr, err)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
 	"github.com/coreos/dex/server"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/dex/user/manager"
 )
 
@@ -150,8 +151,14 @@ func main() {
 		time.Sleep(sleep)
 	}
 
+	sigRepo, err := db.NewSigningKeySetRepo(dbc, keySecrets.BytesSlice()...)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
 	krot := key.NewPrivateKeyRotator(kRepo, *keyPeriod)
-	s := server.NewAdminServer(adminAPI, krot, adminAPISecret.String())
+	srot := signing.NewKeyRotator(sigRepo, *keyPeriod, signing.Algs...)
+	s := server.NewAdminServer(adminAPI, krot, srot, adminAPISecret.String())
 	h := s.HTTPHandler()
 	httpsrv := &http.Server{
 		Addr:    adminURL.Host,
@@ -166,5 +173,6 @@ func main() {
 	}()
 
 	gc.Run()
+	srot.Run()
 	<-krot.Run()
 }
@@ -14,12 +14,14 @@ import (
 	"github.com/coreos/pkg/flagutil"
 	"github.com/gorilla/handlers"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	pflag "github.com/coreos/dex/pkg/flag"
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
 	"github.com/coreos/dex/server"
+	"github.com/coreos/dex/session"
 )
 
 var version = "DEV"
@@ -54,6 +56,14 @@ func main() {
 	// Client credentials administration
 	apiUseClientCredentials := fs.Bool("api-use-client-credentials", false, "Forces API to authenticate using client credentials instead of ID token. Clients must be 'admin clients' to use the API.")
 
+	accessTokenValidity := fs.Duration("access-token-validity", accesstoken.DefaultAccessTokenValidityWindow, "How long access tokens issued by dex are valid for")
+	ssoSessionValidity := fs.Duration("sso-session-validity", session.DefaultBrowserSessionValidityWindow, "How long users stay logged in to dex, and can log in to further clients without entering their credentials again")
+	refreshTokenIdleTimeout := fs.Duration("refresh-token-idle-timeout", 0, "How long refresh tokens may go unused before they expire; 0 means they never expire from disuse. Clients may set their own.")
+	refreshTokenLifetime := fs.Duration("refresh-token-lifetime", 0, "How long refresh tokens are valid after the user authorized the client, however often they are used; 0 means no limit. Clients may set their own.")
+	pairwiseSubjectSalt := fs.String("pairwise-subject-salt", "", "Secret hashed into the subject identifiers of clients with the pairwise subject type; pairwise clients are not supported without it")
+	resourceServers := fs.String("resource-servers", "", "JSON file containing the resource servers clients may request audience-restricted access tokens for")
+	logoutRevokesRefreshTokens := fs.Bool("logout-revokes-refresh-tokens", false, "When a client logs a user out, also revoke the refresh tokens the user granted the client")
+
 	noDB := fs.Bool("no-db", false, "manage entities in-process w/o any encryption, used only for single-node testing")
 
 	// UI-related:
@@ -151,6 +161,13 @@ func main() {
 		EnableClientRegistration:     *enableClientRegistration,
 		EnableClientCredentialAccess: *apiUseClientCredentials,
 		RegisterOnFirstLogin:         *registerOnFirstLogin,
+		AccessTokenValidityWindow:    *accessTokenValidity,
+		BrowserSessionValidityWindow: *ssoSessionValidity,
+		RevokeRefreshTokensOnLogout:  *logoutRevokesRefreshTokens,
+		RefreshTokenIdleTimeout:      *refreshTokenIdleTimeout,
+		RefreshTokenLifetime:         *refreshTokenLifetime,
+		PairwiseSubjectSalt:          *pairwiseSubjectSalt,
+		ResourceServersFile:          *resourceServers,
 	}
 
 	if *noDB {
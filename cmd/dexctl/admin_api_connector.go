@@ -45,24 +45,17 @@ func newAdminAPIConnector(adminApiURL string, adminAPIKey string, caFile string)
 	return adminAPIConnector, nil
 }
 
-func (d *AdminAPIConnector) NewClient(meta oidc.ClientMetadata) (*oidc.ClientCredentials, error) {
-	if err := meta.Valid(); err != nil {
+func (d *AdminAPIConnector) NewClient(cli client.Client) (*oidc.ClientCredentials, error) {
+	if err := cli.Metadata.Valid(); err != nil {
 		return nil, err
 	}
-	cli := client.Client{
-		Metadata: meta,
-	}
 	credential := &oidc.ClientCredentials{}
 	service, err := adminschema.NewWithBasePath(d.client, d.baseURL)
 	if err != nil {
 		return credential, nil
 	}
-	urls := make([]string, len(cli.Metadata.RedirectURIs))
-	for i, url := range cli.Metadata.RedirectURIs {
-		urls[i] = url.String()
-	}
-	c := &adminschema.Client{RedirectURIs: urls}
-	createClientRequest := &adminschema.ClientCreateRequest{Client: c}
+	c := adminschema.MapClientToSchemaClient(cli)
+	createClientRequest := &adminschema.ClientCreateRequest{Client: &c}
 	response, err := service.Client.Create(createClientRequest).Do()
 	if err != nil {
 		return credential, err
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"net/url"
+	"os"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/spf13/cobra"
+
+	"github.com/coreos/dex/client"
 )
 
 var (
@@ -15,10 +20,27 @@ var (
 		Example: `  dexctl new-client --base-url=${OVER_LORD_URL} --api-key=${ADMIN_API_KEY} 'https://example.com/callback'`,
 		Run:     wrapRun(runNewClient),
 	}
+
+	newClientFlags struct {
+		postLogoutRedirectURLs  []string
+		refreshTokenLifetime    time.Duration
+		refreshTokenIdleTimeout time.Duration
+
+		disableRefreshTokenRotation bool
+		passwordGrantConnector      string
+		claimMappings               string
+	}
 )
 
 func init() {
 	rootCmd.AddCommand(cmdNewClient)
+
+	cmdNewClient.Flags().StringSliceVar(&newClientFlags.postLogoutRedirectURLs, "post-logout-redirect-url", nil, "URL the end-user may be redirected to after logging out. May be repeated.")
+	cmdNewClient.Flags().DurationVar(&newClientFlags.refreshTokenLifetime, "refresh-token-lifetime", 0, "How long the client's refresh tokens are valid after they are issued. Defaults to the server's setting.")
+	cmdNewClient.Flags().DurationVar(&newClientFlags.refreshTokenIdleTimeout, "refresh-token-idle-timeout", 0, "How long the client's refresh tokens are valid without being used. Defaults to the server's setting.")
+	cmdNewClient.Flags().BoolVar(&newClientFlags.disableRefreshTokenRotation, "disable-refresh-token-rotation", false, "Keep the client's refresh token when it is used, instead of issuing a new one.")
+	cmdNewClient.Flags().StringVar(&newClientFlags.passwordGrantConnector, "password-grant-connector", "", "ID of the connector the client may log users in with using the resource owner password credentials grant.")
+	cmdNewClient.Flags().StringVar(&newClientFlags.claimMappings, "claim-mappings", "", "Local file containing a JSON array of claim mappings for the client's ID tokens and UserInfo responses.")
 }
 
 func runNewClient(cmd *cobra.Command, args []string) int {
@@ -36,10 +58,43 @@ func runNewClient(cmd *cobra.Command, args []string) int {
 		}
 		redirectURLs[i] = *u
 	}
+	if newClientFlags.refreshTokenLifetime < 0 || newClientFlags.refreshTokenIdleTimeout < 0 {
+		stderr("Refresh token durations must not be negative.")
+		return 2
+	}
+	cli := client.Client{
+		Metadata:                oidc.ClientMetadata{RedirectURIs: redirectURLs},
+		RefreshTokenLifetime:    newClientFlags.refreshTokenLifetime,
+		RefreshTokenIdleTimeout: newClientFlags.refreshTokenIdleTimeout,
+
+		DisableRefreshTokenRotation: newClientFlags.disableRefreshTokenRotation,
+		PasswordGrantConnectorID:    newClientFlags.passwordGrantConnector,
+	}
+	for _, ua := range newClientFlags.postLogoutRedirectURLs {
+		u, err := url.Parse(ua)
+		if err != nil {
+			stderr("Malformed URL %q: %v", ua, err)
+			return 1
+		}
+		cli.PostLogoutRedirectURIs = append(cli.PostLogoutRedirectURIs, *u)
+	}
+	if newClientFlags.claimMappings != "" {
+		f, err := os.Open(newClientFlags.claimMappings)
+		if err != nil {
+			stderr("Unable to open specified file: %v", err)
+			return 1
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(&cli.ClaimMappings); err != nil {
+			stderr("Unable to decode claim mappings: %v", err)
+			return 1
+		}
+	}
+
 	var clientCredential *oidc.ClientCredentials
 	if isDBURLPresent() {
 		dbConnector := getDBConnector()
-		if cc, err := dbConnector.NewClient(oidc.ClientMetadata{RedirectURIs: redirectURLs}); err != nil {
+		if cc, err := dbConnector.NewClient(cli); err != nil {
 			stderr("Failed creating new client: %v", err)
 			return 1
 		} else {
@@ -48,7 +103,7 @@ func runNewClient(cmd *cobra.Command, args []string) int {
 
 	} else {
 		adminAPIConnector := getAdminAPIConnector()
-		if cc, err := adminAPIConnector.NewClient(oidc.ClientMetadata{RedirectURIs: redirectURLs}); err != nil {
+		if cc, err := adminAPIConnector.NewClient(cli); err != nil {
 			stderr("Failed creating new client: %v", err)
 			return 1
 		} else {
@@ -27,13 +27,10 @@ type dbConnector struct {
 	cfgRepo   *db.ConnectorConfigRepo
 }
 
-func (d *dbConnector) NewClient(meta oidc.ClientMetadata) (*oidc.ClientCredentials, error) {
-	if err := meta.Valid(); err != nil {
+func (d *dbConnector) NewClient(cli client.Client) (*oidc.ClientCredentials, error) {
+	if err := cli.Metadata.Valid(); err != nil {
 		return nil, err
 	}
-	cli := client.Client{
-		Metadata: meta,
-	}
 	return d.ciManager.New(cli, nil)
 }
 
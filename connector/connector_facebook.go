@@ -3,6 +3,7 @@ package connector
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/coreos/dex/user"
 	chttp "github.com/coreos/go-oidc/http"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
@@ -16,7 +17,7 @@ const (
 	FacebookConnectorType    = "facebook"
 	facebookConnectorAuthURL = "https://www.facebook.com/dialog/oauth"
 	facebookTokenURL         = "https://graph.facebook.com/v2.3/oauth/access_token"
-	facebookGraphAPIURL      = "https://graph.facebook.com/me?fields=id,name,email"
+	facebookGraphAPIURL      = "https://graph.facebook.com/me?fields=id,name,email,first_name,last_name,picture"
 )
 
 type FacebookConnectorConfig struct {
@@ -37,7 +38,7 @@ func (cfg *FacebookConnectorConfig) ConnectorType() string {
 	return FacebookConnectorType
 }
 
-func (cfg *FacebookConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *FacebookConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 	oauth2Conn, err := newFacebookConnector(cfg.ClientID, cfg.ClientSecret, ns.String())
 	if err != nil {
@@ -108,20 +109,27 @@ func (err facebookErr) Error() string {
 	return fmt.Sprintf("facebook: %s", err.ErrorMessage.Message)
 }
 
-func (c *facebookOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
-	var user struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
+func (c *facebookOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, user.Profile, error) {
+	var u struct {
+		ID        string `json:"id"`
+		Email     string `json:"email"`
+		Name      string `json:"name"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Picture   struct {
+			Data struct {
+				URL string `json:"url"`
+			} `json:"data"`
+		} `json:"picture"`
 	}
 
 	req, err := http.NewRequest("GET", facebookGraphAPIURL, nil)
 	if err != nil {
-		return oidc.Identity{}, err
+		return oidc.Identity{}, user.Profile{}, err
 	}
 	resp, err := cli.Do(req)
 	if err != nil {
-		return oidc.Identity{}, fmt.Errorf("get: %v", err)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("get: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -129,20 +137,26 @@ func (c *facebookOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, err
 	case resp.StatusCode >= 400 && resp.StatusCode < 600:
 		var authErr facebookErr
 		if err := json.NewDecoder(resp.Body).Decode(&authErr); err != nil {
-			return oidc.Identity{}, oauth2.NewError(oauth2.ErrorAccessDenied)
+			return oidc.Identity{}, user.Profile{}, oauth2.NewError(oauth2.ErrorAccessDenied)
 		}
-		return oidc.Identity{}, authErr
+		return oidc.Identity{}, user.Profile{}, authErr
 	case resp.StatusCode == http.StatusOK:
 	default:
-		return oidc.Identity{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return oidc.Identity{}, fmt.Errorf("decode body: %v", err)
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("decode body: %v", err)
 	}
 
-	return oidc.Identity{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
-	}, nil
+	ident := oidc.Identity{
+		ID:    u.ID,
+		Name:  u.Name,
+		Email: u.Email,
+	}
+	profile := user.Profile{
+		GivenName:  u.FirstName,
+		FamilyName: u.LastName,
+		Picture:    u.Picture.Data.URL,
+	}
+	return ident, profile, nil
 }
@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 	"net/http"
 	"testing"
@@ -9,7 +10,10 @@ import (
 var facebookUser1 = `{
 	"id":"testUser1",
 	"name":"testUser1Fname testUser1Lname",
-	"email":  "testUser1@facebook.com"
+	"first_name":"testUser1Fname",
+	"last_name":"testUser1Lname",
+	"email":  "testUser1@facebook.com",
+	"picture": {"data": {"url": "https://graph.facebook.com/testUser1/picture"}}
 	}`
 
 var facebookUser2 = `{
@@ -38,6 +42,11 @@ func TestFacebookIdentity(t *testing.T) {
 				ID:    "testUser1",
 				Email: "testUser1@facebook.com",
 			},
+			wantProfile: user.Profile{
+				GivenName:  "testUser1Fname",
+				FamilyName: "testUser1Lname",
+				Picture:    "https://graph.facebook.com/testUser1/picture",
+			},
 		},
 		{
 			urlResps: map[string]response{
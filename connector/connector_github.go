@@ -9,6 +9,7 @@ import (
 	"path"
 	"strconv"
 
+	"github.com/coreos/dex/user"
 	chttp "github.com/coreos/go-oidc/http"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
@@ -39,7 +40,7 @@ func (cfg *GitHubConnectorConfig) ConnectorType() string {
 	return GitHubConnectorType
 }
 
-func (cfg *GitHubConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *GitHubConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 	oauth2Conn, err := newGitHubConnector(cfg.ClientID, cfg.ClientSecret, ns.String())
 	if err != nil {
@@ -94,14 +95,14 @@ func (c *githubOAuth2Connector) Client() *oauth2.Client {
 	return c.client
 }
 
-func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
+func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, user.Profile, error) {
 	req, err := http.NewRequest("GET", githubAPIUserURL, nil)
 	if err != nil {
-		return oidc.Identity{}, err
+		return oidc.Identity{}, user.Profile{}, err
 	}
 	resp, err := cli.Do(req)
 	if err != nil {
-		return oidc.Identity{}, fmt.Errorf("get: %v", err)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("get: %v", err)
 	}
 	defer resp.Body.Close()
 	switch {
@@ -109,31 +110,37 @@ func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error
 		// attempt to decode error from github
 		var authErr githubError
 		if err := json.NewDecoder(resp.Body).Decode(&authErr); err != nil {
-			return oidc.Identity{}, oauth2.NewError(oauth2.ErrorAccessDenied)
+			return oidc.Identity{}, user.Profile{}, oauth2.NewError(oauth2.ErrorAccessDenied)
 		}
-		return oidc.Identity{}, authErr
+		return oidc.Identity{}, user.Profile{}, authErr
 	case resp.StatusCode == http.StatusOK:
 	default:
-		return oidc.Identity{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
 	}
-	var user struct {
-		Login string `json:"login"`
-		ID    int64  `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
+	var u struct {
+		Login     string `json:"login"`
+		ID        int64  `json:"id"`
+		Email     string `json:"email"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return oidc.Identity{}, fmt.Errorf("getting user info: %v", err)
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("getting user info: %v", err)
 	}
-	name := user.Name
+	name := u.Name
 	if name == "" {
-		name = user.Login
+		name = u.Login
 	}
-	return oidc.Identity{
-		ID:    strconv.FormatInt(user.ID, 10),
+	ident := oidc.Identity{
+		ID:    strconv.FormatInt(u.ID, 10),
 		Name:  name,
-		Email: user.Email,
-	}, nil
+		Email: u.Email,
+	}
+	profile := user.Profile{
+		PreferredUsername: u.Login,
+		Picture:           u.AvatarURL,
+	}
+	return ident, profile, nil
 }
 
 func (c *githubOAuth2Connector) Healthy() error {
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 
 	"gopkg.in/ldap.v2"
@@ -100,7 +101,7 @@ func (cfg *LDAPConnectorConfig) ConnectorType() string {
 type LDAPConnector struct {
 	id        string
 	namespace url.URL
-	loginFunc oidc.LoginFunc
+	loginFunc LoginFunc
 	loginTpl  *template.Template
 
 	baseDN         string
@@ -121,7 +122,7 @@ type LDAPConnector struct {
 
 const defaultPoolCheckTimer = 7200 * time.Second
 
-func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 	tpl := tpls.Lookup(LDAPLoginPageTemplateName)
 	if tpl == nil {
@@ -282,6 +283,10 @@ func (c *LDAPConnector) TrustedEmailProvider() bool {
 	return true
 }
 
+func (c *LDAPConnector) AuthMethods() []string {
+	return []string{"pwd"}
+}
+
 // A LDAPPool is a Connection Pool for LDAP connections. Use Do() to request connections
 // from the pool.
 type LDAPPool struct {
@@ -476,9 +481,10 @@ func (c *LDAPConnector) Groups(fullUserID string) ([]string, error) {
 	return groups, err
 }
 
-func (c *LDAPConnector) Identity(username, password string) (*oidc.Identity, error) {
+func (c *LDAPConnector) Identity(username, password string) (*oidc.Identity, user.Profile, error) {
 	var (
 		identity *oidc.Identity
+		profile  user.Profile
 		err      error
 	)
 	if c.searchBeforeAuth {
@@ -495,7 +501,7 @@ func (c *LDAPConnector) Identity(username, password string) (*oidc.Identity, err
 				BaseDN:     c.baseDN,
 				Scope:      c.searchScope,
 				Filter:     filter,
-				Attributes: []string{c.nameAttribute, c.emailAttribute},
+				Attributes: []string{c.nameAttribute, c.emailAttribute, "givenName", "sn", "uid", "preferredLanguage"},
 			}
 			resp, err := conn.Search(req)
 			if err != nil {
@@ -522,6 +528,7 @@ func (c *LDAPConnector) Identity(username, password string) (*oidc.Identity, err
 				Name:  entry.GetAttributeValue(c.nameAttribute),
 				Email: email,
 			}
+			profile = ldapProfile(entry)
 
 			// Attempt to bind as the end user.
 			return conn.Bind(entry.DN, password)
@@ -560,11 +567,23 @@ func (c *LDAPConnector) Identity(username, password string) (*oidc.Identity, err
 				Name:  entry.GetAttributeValue(c.nameAttribute),
 				Email: email,
 			}
+			profile = ldapProfile(entry)
 			return nil
 		})
 	}
 	if err != nil {
-		return nil, err
+		return nil, user.Profile{}, err
+	}
+	return identity, profile, nil
+}
+
+// ldapProfile returns the profile of a user from the standard attributes of
+// their entry (RFC 2798).
+func ldapProfile(entry *ldap.Entry) user.Profile {
+	return user.Profile{
+		GivenName:         entry.GetAttributeValue("givenName"),
+		FamilyName:        entry.GetAttributeValue("sn"),
+		PreferredUsername: entry.GetAttributeValue("uid"),
+		Locale:            entry.GetAttributeValue("preferredLanguage"),
 	}
-	return identity, nil
 }
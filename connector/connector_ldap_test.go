@@ -4,13 +4,11 @@ import (
 	"html/template"
 	"net/url"
 	"testing"
-
-	"github.com/coreos/go-oidc/oidc"
 )
 
 var (
 	ns        url.URL
-	lf        oidc.LoginFunc
+	lf        LoginFunc
 	templates *template.Template
 )
 
@@ -32,7 +32,7 @@ func (cfg *LocalConnectorConfig) ConnectorType() string {
 	return LocalConnectorType
 }
 
-func (cfg *LocalConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *LocalConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	tpl := tpls.Lookup(LoginPageTemplateName)
 	if tpl == nil {
 		return nil, fmt.Errorf("unable to find necessary HTML template")
@@ -52,7 +52,7 @@ type LocalConnector struct {
 	id        string
 	idp       *LocalIdentityProvider
 	namespace url.URL
-	loginFunc oidc.LoginFunc
+	loginFunc LoginFunc
 	loginTpl  *template.Template
 }
 
@@ -87,7 +87,7 @@ func (c *LocalConnector) LoginURL(sessionKey, prompt string) (string, error) {
 
 func (c *LocalConnector) Handler(errorURL url.URL) http.Handler {
 	route := path.Join(c.namespace.Path, "/login")
-	return handlePasswordLogin(c.loginFunc, c.loginTpl, c.idp, route, errorURL)
+	return handlePasswordLogin(c.loginFunc, c.loginTpl, c, route, errorURL)
 }
 
 func (c *LocalConnector) Sync() chan struct{} {
@@ -98,6 +98,15 @@ func (c *LocalConnector) TrustedEmailProvider() bool {
 	return false
 }
 
+func (c *LocalConnector) AuthMethods() []string {
+	return []string{"pwd"}
+}
+
+func (c *LocalConnector) Identity(email, password string) (*oidc.Identity, user.Profile, error) {
+	ident, err := c.idp.Identity(email, password)
+	return ident, user.Profile{}, err
+}
+
 type LocalIdentityProvider struct {
 	PasswordInfoRepo user.PasswordInfoRepo
 	UserRepo         user.UserRepo
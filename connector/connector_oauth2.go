@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
 	chttp "github.com/coreos/go-oidc/http"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
@@ -15,8 +16,9 @@ type oauth2Connector interface {
 	Client() *oauth2.Client
 
 	// Identity uses a HTTP client authenticated as the end user to construct
-	// an OIDC identity for that user.
-	Identity(cli chttp.Client) (oidc.Identity, error)
+	// an OIDC identity for that user, along with what the provider knows
+	// about their profile.
+	Identity(cli chttp.Client) (oidc.Identity, user.Profile, error)
 
 	// Healthy it should attempt to determine if the connector's credientials
 	// are valid.
@@ -27,7 +29,7 @@ type oauth2Connector interface {
 
 type OAuth2Connector struct {
 	id        string
-	loginFunc oidc.LoginFunc
+	loginFunc LoginFunc
 	cbURL     url.URL
 	conn      oauth2Connector
 }
@@ -57,7 +59,7 @@ func (c *OAuth2Connector) Handler(errorURL url.URL) http.Handler {
 	return c.handleCallbackFunc(c.loginFunc, errorURL)
 }
 
-func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL) http.HandlerFunc {
+func (c *OAuth2Connector) handleCallbackFunc(lf LoginFunc, errorURL url.URL) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
@@ -84,7 +86,7 @@ func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL
 			redirectError(w, errorURL, q)
 			return
 		}
-		ident, err := c.conn.Identity(newAuthenticatedClient(token, http.DefaultClient))
+		ident, profile, err := c.conn.Identity(newAuthenticatedClient(token, http.DefaultClient))
 		if err != nil {
 			log.Errorf("Unable to retrieve identity: %v", err)
 			q.Set("error", oauth2.ErrorUnsupportedResponseType)
@@ -92,7 +94,7 @@ func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL
 			redirectError(w, errorURL, q)
 			return
 		}
-		redirectURL, err := lf(ident, sessionKey)
+		redirectURL, err := lf(w, ident, profile, Authentication{}, sessionKey)
 		if err != nil {
 			log.Errorf("Unable to log in %#v: %v", ident, err)
 			q.Set("error", oauth2.ErrorAccessDenied)
@@ -8,6 +8,8 @@ import (
 
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
+	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -29,6 +31,11 @@ type OIDCConnectorConfig struct {
 	ClientSecret         string `json:"clientSecret"`
 	TrustedEmailProvider bool   `json:"trustedEmailProvider"`
 	EmailClaim           string `json:"emailClaim"`
+
+	// AuthMethods are the methods the upstream provider authenticates
+	// users with, e.g. ["pwd", "otp", "mfa"] for a provider enforcing a
+	// second factor.
+	AuthMethods []string `json:"authMethods,omitempty"`
 }
 
 func (cfg *OIDCConnectorConfig) ConnectorID() string {
@@ -43,13 +50,14 @@ type OIDCConnector struct {
 	id                   string
 	issuerURL            string
 	cbURL                url.URL
-	loginFunc            oidc.LoginFunc
+	loginFunc            LoginFunc
 	client               *oidc.Client
 	trustedEmailProvider bool
 	emailClaim           string
+	authMethods          []string
 }
 
-func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 
 	ccfg := oidc.ClientConfig{
@@ -73,6 +81,7 @@ func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *t
 		client:               cl,
 		trustedEmailProvider: cfg.TrustedEmailProvider,
 		emailClaim:           cfg.EmailClaim,
+		authMethods:          cfg.AuthMethods,
 	}
 	return idpc, nil
 }
@@ -106,13 +115,17 @@ func (c *OIDCConnector) TrustedEmailProvider() bool {
 	return c.trustedEmailProvider
 }
 
+func (c *OIDCConnector) AuthMethods() []string {
+	return c.authMethods
+}
+
 func redirectError(w http.ResponseWriter, errorURL url.URL, q url.Values) {
 	redirectURL := phttp.MergeQuery(errorURL, q)
 	w.Header().Set("Location", redirectURL.String())
 	w.WriteHeader(http.StatusSeeOther)
 }
 
-func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL) http.HandlerFunc {
+func (c *OIDCConnector) handleCallbackFunc(lf LoginFunc, errorURL url.URL) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
@@ -189,7 +202,7 @@ func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL)
 			return
 		}
 
-		redirectURL, err := lf(*ident, sessionKey)
+		redirectURL, err := lf(w, *ident, profileFromClaims(claims), authenticationFromClaims(claims), sessionKey)
 		if err != nil {
 			log.Errorf("Unable to log in %#v: %v", *ident, err)
 			q.Set("error", oauth2.ErrorAccessDenied)
@@ -203,3 +216,28 @@ func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL)
 		return
 	}
 }
+
+// profileFromClaims returns the profile of the user an upstream ID token was
+// issued for.
+func profileFromClaims(claims jose.Claims) user.Profile {
+	str := func(name string) string {
+		s, _, _ := claims.StringClaim(name)
+		return s
+	}
+	return user.Profile{
+		GivenName:         str("given_name"),
+		FamilyName:        str("family_name"),
+		PreferredUsername: str("preferred_username"),
+		Picture:           str("picture"),
+		Locale:            str("locale"),
+	}
+}
+
+// authenticationFromClaims returns how the upstream identity provider
+// authenticated the user its ID token was issued for.
+func authenticationFromClaims(claims jose.Claims) Authentication {
+	var auth Authentication
+	auth.AMR, _, _ = claims.StringsClaim("amr")
+	auth.ACR, _, _ = claims.StringClaim("acr")
+	return auth
+}
@@ -7,11 +7,16 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/user"
 )
 
 func TestLoginURL(t *testing.T) {
-	lf := func(ident oidc.Identity, sessionKey string) (redirectURL string, err error) { return }
+	lf := func(w http.ResponseWriter, ident oidc.Identity, profile user.Profile, auth Authentication, sessionKey string) (redirectURL string, err error) {
+		return
+	}
 
 	tests := []struct {
 		cid    string
@@ -142,3 +147,73 @@ func TestRedirectError(t *testing.T) {
 		t.Errorf("Incorrect Location header: want=%s got=%s", wantLoc, gotLoc)
 	}
 }
+
+func TestProfileFromClaims(t *testing.T) {
+	tests := []struct {
+		claims jose.Claims
+		want   user.Profile
+	}{
+		{
+			claims: jose.Claims{"sub": "elroy-id"},
+		},
+		{
+			claims: jose.Claims{
+				"sub":                "elroy-id",
+				"given_name":         "Elroy",
+				"family_name":        "Jetson",
+				"preferred_username": "elroy",
+				"picture":            "https://example.com/elroy.png",
+				"locale":             "en-US",
+			},
+			want: user.Profile{
+				GivenName:         "Elroy",
+				FamilyName:        "Jetson",
+				PreferredUsername: "elroy",
+				Picture:           "https://example.com/elroy.png",
+				Locale:            "en-US",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		if got := profileFromClaims(tt.claims); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("case %d: want %#v, got %#v", i, tt.want, got)
+		}
+	}
+}
+
+func TestAuthenticationFromClaims(t *testing.T) {
+	tests := []struct {
+		claims jose.Claims
+		want   Authentication
+	}{
+		{
+			claims: jose.Claims{"sub": "elroy-id"},
+		},
+		{
+			claims: jose.Claims{
+				"sub": "elroy-id",
+				"amr": []interface{}{"pwd", "otp"},
+				"acr": "2",
+			},
+			want: Authentication{
+				AMR: []string{"pwd", "otp"},
+				ACR: "2",
+			},
+		},
+		// malformed claims are ignored
+		{
+			claims: jose.Claims{
+				"sub": "elroy-id",
+				"amr": "pwd",
+				"acr": 2,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		if got := authenticationFromClaims(tt.claims); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("case %d: want %#v, got %#v", i, tt.want, got)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"path"
 
+	"github.com/coreos/dex/user"
 	chttp "github.com/coreos/go-oidc/http"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
@@ -49,7 +50,7 @@ func (cfg *UAAConnectorConfig) ConnectorType() string {
 	return UAAConnectorType
 }
 
-func (cfg *UAAConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *UAAConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	uaaBaseURL, err := url.ParseRequestURI(cfg.ServerURL)
 	if err != nil {
 		return nil, fmt.Errorf("Invalid configuration. UAA URL is invalid: %v", err)
@@ -82,16 +83,16 @@ func (c *uaaOAuth2Connector) Healthy() error {
 	return nil
 }
 
-func (c *uaaOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
+func (c *uaaOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, user.Profile, error) {
 	uaaUserInfoURL := *c.uaaBaseURL
 	uaaUserInfoURL.Path = path.Join(uaaUserInfoURL.Path, "/userinfo")
 	req, err := http.NewRequest("GET", uaaUserInfoURL.String(), nil)
 	if err != nil {
-		return oidc.Identity{}, err
+		return oidc.Identity{}, user.Profile{}, err
 	}
 	resp, err := cli.Do(req)
 	if err != nil {
-		return oidc.Identity{}, fmt.Errorf("get: %v", err)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("get: %v", err)
 	}
 	defer resp.Body.Close()
 	switch {
@@ -99,31 +100,39 @@ func (c *uaaOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
 		// attempt to decode error from UAA
 		var authErr uaaError
 		if err := json.NewDecoder(resp.Body).Decode(&authErr); err != nil {
-			return oidc.Identity{}, oauth2.NewError(oauth2.ErrorAccessDenied)
+			return oidc.Identity{}, user.Profile{}, oauth2.NewError(oauth2.ErrorAccessDenied)
 		}
-		return oidc.Identity{}, authErr
+		return oidc.Identity{}, user.Profile{}, authErr
 	case resp.StatusCode == http.StatusOK:
 	default:
-		return oidc.Identity{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
 	}
-	var user struct {
-		UserID   string `json:"user_id"`
-		Email    string `json:"email"`
-		Name     string `json:"name"`
-		UserName string `json:"user_name"`
+	var u struct {
+		UserID     string `json:"user_id"`
+		Email      string `json:"email"`
+		Name       string `json:"name"`
+		UserName   string `json:"user_name"`
+		GivenName  string `json:"given_name"`
+		FamilyName string `json:"family_name"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return oidc.Identity{}, fmt.Errorf("getting user info: %v", err)
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return oidc.Identity{}, user.Profile{}, fmt.Errorf("getting user info: %v", err)
 	}
-	name := user.Name
+	name := u.Name
 	if name == "" {
-		name = user.UserName
+		name = u.UserName
 	}
-	return oidc.Identity{
-		ID:    user.UserID,
+	ident := oidc.Identity{
+		ID:    u.UserID,
 		Name:  name,
-		Email: user.Email,
-	}, nil
+		Email: u.Email,
+	}
+	profile := user.Profile{
+		GivenName:         u.GivenName,
+		FamilyName:        u.FamilyName,
+		PreferredUsername: u.UserName,
+	}
+	return ident, profile, nil
 }
 
 func (c *uaaOAuth2Connector) TrustedEmailProvider() bool {
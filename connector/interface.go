@@ -7,12 +7,32 @@ import (
 	"net/url"
 
 	"github.com/coreos/dex/repo"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/coreos/pkg/health"
 )
 
 var ErrorNotFound = errors.New("connector not found in repository")
 
+// LoginFunc associates the remote identity of a user with a dex session key,
+// and returns the URL the user should be redirected to. profile holds what the
+// upstream identity provider reported about the user besides their identity,
+// and auth how it authenticated them; their attributes are empty if unknown.
+// w is the response to the user-agent, on which dex sets its single sign-on
+// cookie.
+type LoginFunc func(w http.ResponseWriter, ident oidc.Identity, profile user.Profile, auth Authentication, sessionKey string) (string, error)
+
+// Authentication is how the upstream identity provider reported it
+// authenticated a user, e.g. in the "amr" and "acr" claims of its ID token.
+// If it is empty, the methods of the connector's AuthMethods apply.
+type Authentication struct {
+	// AMR are the methods the user authenticated with.
+	AMR []string
+
+	// ACR is the authentication context class the authentication met.
+	ACR string
+}
+
 type Connector interface {
 	// ID returns the ID of the ConnectorConfig used to create the Connector.
 	ID() string
@@ -57,7 +77,7 @@ type ConnectorConfig interface {
 	//
 	// Additional templates are passed for connectors that require rendering HTML
 	// pages, such as the "local" connector.
-	Connector(ns url.URL, loginFunc oidc.LoginFunc, tpls *template.Template) (Connector, error)
+	Connector(ns url.URL, loginFunc LoginFunc, tpls *template.Template) (Connector, error)
 }
 
 // GroupsConnector is a strategy for mapping a user to a set of groups. This is optionally
@@ -66,6 +86,13 @@ type GroupsConnector interface {
 	Groups(fullUserID string) ([]string, error)
 }
 
+// AuthMethodsConnector reports the methods users are authenticated with, as
+// values of the "amr" claim (RFC 8176). This is optionally implemented by some
+// connectors; the methods of other connectors are unknown.
+type AuthMethodsConnector interface {
+	AuthMethods() []string
+}
+
 type ConnectorConfigRepo interface {
 	All() ([]ConnectorConfig, error)
 	GetConnectorByID(repo.Transaction, string) (ConnectorConfig, error)
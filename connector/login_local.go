@@ -8,6 +8,7 @@ import (
 
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -20,10 +21,19 @@ func redirectPostError(w http.ResponseWriter, errorURL url.URL, q url.Values) {
 
 // passwordLoginProvider is a provider which requires a username and password to identify the user.
 type passwordLoginProvider interface {
-	Identity(email, password string) (*oidc.Identity, error)
+	Identity(email, password string) (*oidc.Identity, user.Profile, error)
 }
 
-func handlePasswordLogin(lf oidc.LoginFunc, tpl *template.Template, idp passwordLoginProvider, localErrorPath string, errorURL url.URL) http.HandlerFunc {
+// PasswordConnector is a connector which identifies users by a username and
+// password it is given directly, rather than through a login page. This is
+// optionally implemented by some connectors, and is required by the resource
+// owner password credentials grant.
+type PasswordConnector interface {
+	Connector
+	passwordLoginProvider
+}
+
+func handlePasswordLogin(lf LoginFunc, tpl *template.Template, idp passwordLoginProvider, localErrorPath string, errorURL url.URL) http.HandlerFunc {
 	handleGET := func(w http.ResponseWriter, r *http.Request, errMsg string) {
 		q := r.URL.Query()
 		sessionKey := q.Get("session_key")
@@ -58,7 +68,7 @@ func handlePasswordLogin(lf oidc.LoginFunc, tpl *template.Template, idp password
 			return
 		}
 
-		ident, err := idp.Identity(userid, password)
+		ident, profile, err := idp.Identity(userid, password)
 		if err != nil {
 			handleGET(w, r, "invalid login")
 			return
@@ -73,7 +83,7 @@ func handlePasswordLogin(lf oidc.LoginFunc, tpl *template.Template, idp password
 			return
 		}
 
-		redirectURL, err := lf(*ident, sessionKey)
+		redirectURL, err := lf(w, *ident, profile, Authentication{}, sessionKey)
 		if err != nil {
 			log.Errorf("Unable to log in %#v: %v", *ident, err)
 			q.Set("error", oauth2.ErrorAccessDenied)
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	accessTokenTableName = "access_token"
+)
+
+func init() {
+	register(table{
+		name:    accessTokenTableName,
+		model:   accessTokenModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+// accessTokenModel is keyed by the SHA-256 hash of the token. Unlike refresh
+// tokens, access tokens are presented on every API call, so they are hashed
+// with a fast hash; their payload is random so a slow hash adds nothing.
+type accessTokenModel struct {
+	ID          string `db:"id"`
+	UserID      string `db:"user_id"`
+	ClientID    string `db:"client_id"`
+	ConnectorID string `db:"connector_id"`
+	Scopes      string `db:"scopes"`
+	Groups      string `db:"groups"`
+	Claims      string `db:"claims"`
+	Resources   string `db:"resources"`
+	CreatedAt   int64  `db:"created_at"`
+	ExpiresAt   int64  `db:"expires_at"`
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *accessTokenModel) accessToken() (*accesstoken.AccessToken, error) {
+	tok := accesstoken.AccessToken{
+		UserID:      m.UserID,
+		ClientID:    m.ClientID,
+		ConnectorID: m.ConnectorID,
+		Resources:   strings.Fields(m.Resources),
+		CreatedAt:   time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt:   time.Unix(m.ExpiresAt, 0).UTC(),
+	}
+	if len(m.Scopes) > 0 {
+		tok.Scope = strings.Split(m.Scopes, " ")
+	}
+	if m.Groups != "" {
+		if err := json.Unmarshal([]byte(m.Groups), &tok.Groups); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal groups: %v", err)
+		}
+	}
+	if m.Claims != "" {
+		if err := json.Unmarshal([]byte(m.Claims), &tok.Claims); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claims: %v", err)
+		}
+	}
+	return &tok, nil
+}
+
+func NewAccessTokenRepo(dbm *gorp.DbMap) accesstoken.AccessTokenRepo {
+	return NewAccessTokenRepoWithClock(dbm, clockwork.NewRealClock())
+}
+
+func NewAccessTokenRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) accesstoken.AccessTokenRepo {
+	return newAccessTokenRepo(dbm, clock)
+}
+
+func newAccessTokenRepo(dbm *gorp.DbMap, clock clockwork.Clock) *accessTokenRepo {
+	return &accessTokenRepo{
+		db:             &db{dbm},
+		tokenGenerator: accesstoken.DefaultAccessTokenGenerator,
+		clock:          clock,
+	}
+}
+
+type accessTokenRepo struct {
+	*db
+	tokenGenerator accesstoken.AccessTokenGenerator
+	clock          clockwork.Clock
+}
+
+func (r *accessTokenRepo) Create(tok accesstoken.AccessToken) (string, error) {
+	if tok.ClientID == "" {
+		return "", accesstoken.ErrorInvalidClientID
+	}
+
+	token, err := r.tokenGenerator.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	record := &accessTokenModel{
+		ID:          hashAccessToken(token),
+		UserID:      tok.UserID,
+		ClientID:    tok.ClientID,
+		ConnectorID: tok.ConnectorID,
+		Scopes:      strings.Join(tok.Scope, " "),
+		Resources:   strings.Join(tok.Resources, " "),
+		CreatedAt:   tok.CreatedAt.Unix(),
+		ExpiresAt:   tok.ExpiresAt.Unix(),
+	}
+	if tok.Groups != nil {
+		data, err := json.Marshal(tok.Groups)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal groups: %v", err)
+		}
+		record.Groups = string(data)
+	}
+	if tok.Claims != nil {
+		data, err := json.Marshal(tok.Claims)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal claims: %v", err)
+		}
+		record.Claims = string(data)
+	}
+	if err := r.executor(nil).Insert(record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (r *accessTokenRepo) Get(token string) (*accesstoken.AccessToken, error) {
+	if token == "" {
+		return nil, accesstoken.ErrorInvalidToken
+	}
+
+	m, err := r.executor(nil).Get(accessTokenModel{}, hashAccessToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, accesstoken.ErrorInvalidToken
+	}
+
+	record, ok := m.(*accessTokenModel)
+	if !ok {
+		log.Errorf("expected accessTokenModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	tok, err := record.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	if !tok.ExpiresAt.After(r.clock.Now()) {
+		return nil, accesstoken.ErrorInvalidToken
+	}
+	return tok, nil
+}
+
+func (r *accessTokenRepo) Revoke(token string) error {
+	if token == "" {
+		return accesstoken.ErrorInvalidToken
+	}
+
+	qt := r.quote(accessTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1", qt)
+	res, err := r.executor(nil).Exec(q, hashAccessToken(token))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return accesstoken.ErrorInvalidToken
+	}
+	return nil
+}
+
+func (r *accessTokenRepo) RevokeTokensForClient(userID, clientID string) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND client_id = $2", r.quote(accessTokenTableName))
+	_, err := r.executor(nil).Exec(q, userID, clientID)
+	return err
+}
+
+func (r *accessTokenRepo) purge() error {
+	qt := r.quote(accessTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, accessTokenTableName)
+	return nil
+}
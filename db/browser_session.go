@@ -0,0 +1,178 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+const (
+	browserSessionTableName = "browser_session"
+)
+
+func init() {
+	register(table{
+		name:    browserSessionTableName,
+		model:   browserSessionModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type browserSessionModel struct {
+	ID          string `db:"id"`
+	UserID      string `db:"user_id"`
+	ConnectorID string `db:"connector_id"`
+	Identity    string `db:"identity"`
+	AuthTime    int64  `db:"auth_time"`
+	AMR         string `db:"amr"`
+	ACR         string `db:"acr"`
+	CreatedAt   int64  `db:"created_at"`
+	ExpiresAt   int64  `db:"expires_at"`
+}
+
+func (m *browserSessionModel) browserSession() (*session.BrowserSession, error) {
+	var ident oidc.Identity
+	if err := json.Unmarshal([]byte(m.Identity), &ident); err != nil {
+		return nil, err
+	}
+	// See sessionModel.session.
+	if ident.ExpiresAt.IsZero() {
+		ident.ExpiresAt = time.Time{}
+	}
+
+	bs := session.BrowserSession{
+		ID:          m.ID,
+		UserID:      m.UserID,
+		ConnectorID: m.ConnectorID,
+		Identity:    ident,
+		AMR:         strings.Fields(m.AMR),
+		ACR:         m.ACR,
+		CreatedAt:   time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt:   time.Unix(m.ExpiresAt, 0).UTC(),
+	}
+	if m.AuthTime != 0 {
+		bs.AuthTime = time.Unix(m.AuthTime, 0).UTC()
+	}
+	return &bs, nil
+}
+
+func newBrowserSessionModel(bs *session.BrowserSession) (*browserSessionModel, error) {
+	b, err := json.Marshal(bs.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	m := browserSessionModel{
+		ID:          bs.ID,
+		UserID:      bs.UserID,
+		ConnectorID: bs.ConnectorID,
+		Identity:    string(b),
+		AMR:         strings.Join(bs.AMR, " "),
+		ACR:         bs.ACR,
+		CreatedAt:   bs.CreatedAt.Unix(),
+		ExpiresAt:   bs.ExpiresAt.Unix(),
+	}
+	if !bs.AuthTime.IsZero() {
+		m.AuthTime = bs.AuthTime.Unix()
+	}
+	return &m, nil
+}
+
+func NewBrowserSessionRepo(dbm *gorp.DbMap) *BrowserSessionRepo {
+	return NewBrowserSessionRepoWithClock(dbm, clockwork.NewRealClock())
+}
+
+func NewBrowserSessionRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) *BrowserSessionRepo {
+	return &BrowserSessionRepo{db: &db{dbm}, clock: clock}
+}
+
+type BrowserSessionRepo struct {
+	*db
+	clock clockwork.Clock
+}
+
+func (r *BrowserSessionRepo) Get(id string) (*session.BrowserSession, error) {
+	m, err := r.executor(nil).Get(browserSessionModel{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, session.ErrorBrowserSessionNotFound
+	}
+
+	bm, ok := m.(*browserSessionModel)
+	if !ok {
+		log.Errorf("expected browserSessionModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	bs, err := bm.browserSession()
+	if err != nil {
+		return nil, err
+	}
+	if !bs.ExpiresAt.After(r.clock.Now()) {
+		return nil, session.ErrorBrowserSessionNotFound
+	}
+	return bs, nil
+}
+
+func (r *BrowserSessionRepo) Create(bs session.BrowserSession) error {
+	m, err := newBrowserSessionModel(&bs)
+	if err != nil {
+		return err
+	}
+	return r.executor(nil).Insert(m)
+}
+
+func (r *BrowserSessionRepo) Update(bs session.BrowserSession) error {
+	m, err := newBrowserSessionModel(&bs)
+	if err != nil {
+		return err
+	}
+	n, err := r.executor(nil).Update(m)
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return session.ErrorBrowserSessionNotFound
+	}
+	return nil
+}
+
+func (r *BrowserSessionRepo) Delete(id string) error {
+	qt := r.quote(browserSessionTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1", qt)
+	_, err := r.executor(nil).Exec(q, id)
+	return err
+}
+
+func (r *BrowserSessionRepo) purge() error {
+	qt := r.quote(browserSessionTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, browserSessionTableName)
+	return nil
+}
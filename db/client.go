@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/go-gorp/gorp"
@@ -45,9 +46,12 @@ func init() {
 }
 
 func newClientModel(cli client.Client) (*clientModel, error) {
-	hashed, err := client.HashSecret(cli.Credentials)
-	if err != nil {
-		return nil, err
+	var hashed []byte
+	if cli.Credentials.Secret != "" {
+		var err error
+		if hashed, err = client.HashSecret(cli.Credentials); err != nil {
+			return nil, err
+		}
 	}
 
 	if cli.Public {
@@ -70,6 +74,33 @@ func newClientModel(cli client.Client) (*clientModel, error) {
 		Metadata: string(bmeta),
 		DexAdmin: cli.Admin,
 		Public:   cli.Public,
+
+		RefreshTokenIdleTimeout: int64(cli.RefreshTokenIdleTimeout / time.Second),
+		RefreshTokenLifetime:    int64(cli.RefreshTokenLifetime / time.Second),
+
+		DisableRefreshTokenRotation: cli.DisableRefreshTokenRotation,
+
+		PasswordGrantConnectorID: cli.PasswordGrantConnectorID,
+	}
+
+	if len(cli.ClaimMappings) > 0 {
+		b, err := json.Marshal(cli.ClaimMappings)
+		if err != nil {
+			return nil, err
+		}
+		cim.ClaimMappings = string(b)
+	}
+
+	if len(cli.PostLogoutRedirectURIs) > 0 {
+		uris := make([]string, len(cli.PostLogoutRedirectURIs))
+		for i, u := range cli.PostLogoutRedirectURIs {
+			uris[i] = u.String()
+		}
+		b, err := json.Marshal(uris)
+		if err != nil {
+			return nil, err
+		}
+		cim.PostLogoutRedirectURIs = string(b)
 	}
 
 	return &cim, nil
@@ -81,6 +112,24 @@ type clientModel struct {
 	Metadata string `db:"metadata"`
 	DexAdmin bool   `db:"dex_admin"`
 	Public   bool   `db:"public"`
+
+	// PostLogoutRedirectURIs is a JSON array of URLs, or empty.
+	PostLogoutRedirectURIs string `db:"post_logout_redirect_uris"`
+
+	// Refresh token expiry overrides in seconds, or zero.
+	RefreshTokenIdleTimeout int64 `db:"refresh_token_idle_timeout"`
+	RefreshTokenLifetime    int64 `db:"refresh_token_lifetime"`
+
+	DisableRefreshTokenRotation bool `db:"disable_refresh_token_rotation"`
+
+	PasswordGrantConnectorID string `db:"password_grant_connector_id"`
+
+	// ClaimMappings is a JSON array of claim mappings, or empty.
+	ClaimMappings string `db:"claim_mappings"`
+
+	// RegistrationAccessToken is the hashed registration access token of
+	// dynamically registered clients, or nil.
+	RegistrationAccessToken []byte `db:"registration_access_token"`
 }
 
 type trustedPeerModel struct {
@@ -95,6 +144,13 @@ func (m *clientModel) Client() (*client.Client, error) {
 		},
 		Admin:  m.DexAdmin,
 		Public: m.Public,
+
+		RefreshTokenIdleTimeout: time.Duration(m.RefreshTokenIdleTimeout) * time.Second,
+		RefreshTokenLifetime:    time.Duration(m.RefreshTokenLifetime) * time.Second,
+
+		DisableRefreshTokenRotation: m.DisableRefreshTokenRotation,
+
+		PasswordGrantConnectorID: m.PasswordGrantConnectorID,
 	}
 
 	if err := json.Unmarshal([]byte(m.Metadata), &ci.Metadata); err != nil {
@@ -105,6 +161,26 @@ func (m *clientModel) Client() (*client.Client, error) {
 		ci.Metadata.RedirectURIs = []url.URL{}
 	}
 
+	if m.ClaimMappings != "" {
+		if err := json.Unmarshal([]byte(m.ClaimMappings), &ci.ClaimMappings); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.PostLogoutRedirectURIs != "" {
+		var uris []string
+		if err := json.Unmarshal([]byte(m.PostLogoutRedirectURIs), &uris); err != nil {
+			return nil, err
+		}
+		for _, s := range uris {
+			u, err := url.Parse(s)
+			if err != nil {
+				return nil, err
+			}
+			ci.PostLogoutRedirectURIs = append(ci.PostLogoutRedirectURIs, *u)
+		}
+	}
+
 	return &ci, nil
 }
 
@@ -153,6 +229,59 @@ func (r *clientRepo) GetSecret(tx repo.Transaction, clientID string) ([]byte, er
 	return m.Secret, nil
 }
 
+// GetRegistrationAccessToken returns the hashed registration access token of
+// the client, or nil if it has none.
+func (r *clientRepo) GetRegistrationAccessToken(tx repo.Transaction, clientID string) ([]byte, error) {
+	m, err := r.getModel(tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return m.RegistrationAccessToken, nil
+}
+
+func (r *clientRepo) SetRegistrationAccessToken(tx repo.Transaction, clientID string, hashed []byte) error {
+	m, err := r.getModel(tx, clientID)
+	if err != nil {
+		return err
+	}
+	m.RegistrationAccessToken = hashed
+	_, err = r.executor(tx).Update(m)
+	return err
+}
+
+// clientDataTableNames are the tables holding what was issued to or requested
+// by a client, which is deleted along with it (RFC 7592 Section 2.3).
+var clientDataTableNames = []string{
+	trustedPeerTableName,
+	accessTokenTableName,
+	refreshTokenTableName,
+	grantTableName,
+	deviceCodeTableName,
+	pushedAuthRequestTableName,
+	clientAssertionTableName,
+}
+
+func (r *clientRepo) Delete(tx repo.Transaction, clientID string) error {
+	ex := r.executor(tx)
+	for _, table := range clientDataTableNames {
+		if _, err := ex.Exec(fmt.Sprintf("DELETE FROM %s WHERE client_id = $1", r.quote(table)), clientID); err != nil {
+			return err
+		}
+	}
+	res, err := ex.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", r.quote(clientTableName)), clientID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return client.ErrorNotFound
+	}
+	return nil
+}
+
 func (r *clientRepo) Update(tx repo.Transaction, cli client.Client) error {
 	if cli.Credentials.ID == "" {
 		return client.ErrorNotFound
@@ -290,10 +419,20 @@ func (r *clientRepo) getModel(tx repo.Transaction, clientID string) (*clientMode
 
 func (r *clientRepo) update(tx repo.Transaction, cli client.Client) error {
 	ex := r.executor(tx)
+	old, err := r.getModel(tx, cli.Credentials.ID)
+	if err != nil {
+		return err
+	}
 	cm, err := newClientModel(cli)
 	if err != nil {
 		return err
 	}
+	// Clients read from the repo carry no secret; keep the stored one
+	// unless a new one is given.
+	if cli.Credentials.Secret == "" {
+		cm.Secret = old.Secret
+	}
+	cm.RegistrationAccessToken = old.RegistrationAccessToken
 	_, err = ex.Update(cm)
 	return err
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	clientAssertionTableName = "client_assertion"
+)
+
+func init() {
+	register(table{
+		name:    clientAssertionTableName,
+		model:   clientAssertionModel{},
+		autoinc: false,
+		pkey:    []string{"client_id", "jti"},
+	})
+}
+
+type clientAssertionModel struct {
+	ClientID  string `db:"client_id"`
+	JTI       string `db:"jti"`
+	ExpiresAt int64  `db:"expires_at"`
+}
+
+func NewClientAssertionRepo(dbm *gorp.DbMap) *ClientAssertionRepo {
+	return NewClientAssertionRepoWithClock(dbm, clockwork.NewRealClock())
+}
+
+func NewClientAssertionRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) *ClientAssertionRepo {
+	return &ClientAssertionRepo{db: &db{dbm}, clock: clock}
+}
+
+type ClientAssertionRepo struct {
+	*db
+	clock clockwork.Clock
+}
+
+func (r *ClientAssertionRepo) Use(clientID, jti string, expiresAt time.Time) error {
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := r.executor(tx)
+
+	// An expired assertion which was not purged yet doesn't stop the jti
+	// from being used again.
+	qt := r.quote(clientAssertionTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE client_id = $1 AND jti = $2 AND expires_at < $3", qt)
+	if _, err := exec.Exec(q, clientID, jti, r.clock.Now().Unix()); err != nil {
+		return err
+	}
+
+	m := &clientAssertionModel{
+		ClientID:  clientID,
+		JTI:       jti,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	if err := exec.Insert(m); err != nil {
+		if isAlreadyExistsErr(err) {
+			return client.ErrorClientAssertionReplayed
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ClientAssertionRepo) purge() error {
+	qt := r.quote(clientAssertionTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, clientAssertionTableName)
+	return nil
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/device"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	deviceCodeTableName = "device_code"
+)
+
+func init() {
+	register(table{
+		name:    deviceCodeTableName,
+		model:   deviceCodeModel{},
+		autoinc: false,
+		pkey:    []string{"user_code"},
+	})
+}
+
+// deviceCodeModel is keyed by the user code. Like access tokens, device codes
+// are stored as their SHA-256 hash.
+type deviceCodeModel struct {
+	UserCode     string `db:"user_code"`
+	CodeHash     string `db:"code_hash"`
+	ClientID     string `db:"client_id"`
+	Scopes       string `db:"scopes"`
+	State        string `db:"state"`
+	SessionID    string `db:"session_id"`
+	Interval     int64  `db:"poll_interval"`
+	LastPolledAt int64  `db:"last_polled_at"`
+	CreatedAt    int64  `db:"created_at"`
+	ExpiresAt    int64  `db:"expires_at"`
+}
+
+func hashDeviceCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *deviceCodeModel) deviceCode() *device.DeviceCode {
+	dc := device.DeviceCode{
+		UserCode:  m.UserCode,
+		ClientID:  m.ClientID,
+		State:     device.DeviceCodeState(m.State),
+		SessionID: m.SessionID,
+		Interval:  time.Duration(m.Interval) * time.Second,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt: time.Unix(m.ExpiresAt, 0).UTC(),
+	}
+	if m.LastPolledAt != 0 {
+		dc.LastPolledAt = time.Unix(m.LastPolledAt, 0).UTC()
+	}
+	if len(m.Scopes) > 0 {
+		dc.Scope = strings.Split(m.Scopes, " ")
+	}
+	return &dc
+}
+
+func newDeviceCodeModel(dc device.DeviceCode, codeHash string) *deviceCodeModel {
+	m := &deviceCodeModel{
+		UserCode:  dc.UserCode,
+		CodeHash:  codeHash,
+		ClientID:  dc.ClientID,
+		Scopes:    strings.Join(dc.Scope, " "),
+		State:     string(dc.State),
+		SessionID: dc.SessionID,
+		Interval:  int64(dc.Interval / time.Second),
+		CreatedAt: dc.CreatedAt.Unix(),
+		ExpiresAt: dc.ExpiresAt.Unix(),
+	}
+	if !dc.LastPolledAt.IsZero() {
+		m.LastPolledAt = dc.LastPolledAt.Unix()
+	}
+	return m
+}
+
+func NewDeviceCodeRepo(dbm *gorp.DbMap) device.DeviceCodeRepo {
+	return NewDeviceCodeRepoWithClock(dbm, clockwork.NewRealClock())
+}
+
+func NewDeviceCodeRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) device.DeviceCodeRepo {
+	return newDeviceCodeRepo(dbm, clock)
+}
+
+func newDeviceCodeRepo(dbm *gorp.DbMap, clock clockwork.Clock) *deviceCodeRepo {
+	return &deviceCodeRepo{
+		db:            &db{dbm},
+		codeGenerator: device.DefaultDeviceCodeGenerator,
+		clock:         clock,
+	}
+}
+
+type deviceCodeRepo struct {
+	*db
+	codeGenerator device.DeviceCodeGenerator
+	clock         clockwork.Clock
+}
+
+func (r *deviceCodeRepo) Create(dc device.DeviceCode) (string, error) {
+	if dc.UserCode == "" {
+		return "", errors.New("device code has no user code")
+	}
+
+	code, err := r.codeGenerator.Generate()
+	if err != nil {
+		return "", err
+	}
+	if err := r.executor(nil).Insert(newDeviceCodeModel(dc, hashDeviceCode(code))); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (r *deviceCodeRepo) Get(deviceCode string) (*device.DeviceCode, error) {
+	if deviceCode == "" {
+		return nil, device.ErrorNotFound
+	}
+
+	q := fmt.Sprintf("SELECT * FROM %s WHERE code_hash = $1", r.quote(deviceCodeTableName))
+	var m deviceCodeModel
+	if err := r.executor(nil).SelectOne(&m, q, hashDeviceCode(deviceCode)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, device.ErrorNotFound
+		}
+		return nil, err
+	}
+	return m.deviceCode(), nil
+}
+
+func (r *deviceCodeRepo) GetByUserCode(userCode string) (*device.DeviceCode, error) {
+	m, err := r.executor(nil).Get(deviceCodeModel{}, userCode)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, device.ErrorNotFound
+	}
+
+	dm, ok := m.(*deviceCodeModel)
+	if !ok {
+		log.Errorf("expected deviceCodeModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+	return dm.deviceCode(), nil
+}
+
+func (r *deviceCodeRepo) Update(dc device.DeviceCode) error {
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := r.executor(tx)
+
+	m, err := exec.Get(deviceCodeModel{}, dc.UserCode)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return device.ErrorNotFound
+	}
+	dm, ok := m.(*deviceCodeModel)
+	if !ok {
+		log.Errorf("expected deviceCodeModel but found %v", reflect.TypeOf(m))
+		return errors.New("unrecognized model")
+	}
+
+	if _, err := exec.Update(newDeviceCodeModel(dc, dm.CodeHash)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *deviceCodeRepo) Delete(userCode string) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE user_code = $1", r.quote(deviceCodeTableName))
+	res, err := r.executor(nil).Exec(q, userCode)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return device.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *deviceCodeRepo) purge() error {
+	qt := r.quote(deviceCodeTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, deviceCodeTableName)
+	return nil
+}
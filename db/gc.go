@@ -8,6 +8,7 @@ import (
 
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
+	"github.com/coreos/dex/refresh"
 )
 
 type purger interface {
@@ -22,6 +23,12 @@ type namedPurger struct {
 func NewGarbageCollector(dbm *gorp.DbMap, ival time.Duration) *GarbageCollector {
 	sRepo := NewSessionRepo(dbm)
 	skRepo := NewSessionKeyRepo(dbm)
+	atRepo := newAccessTokenRepo(dbm, clockwork.NewRealClock())
+	bsRepo := NewBrowserSessionRepo(dbm)
+	parRepo := NewPushedAuthRequestRepo(dbm)
+	caRepo := NewClientAssertionRepo(dbm)
+	dcRepo := newDeviceCodeRepo(dbm, clockwork.NewRealClock())
+	rtRepo := newRefreshTokenRepo(dbm, refresh.DefaultRefreshTokenGenerator, refresh.ExpiryPolicy{}, clockwork.NewRealClock())
 
 	purgers := []namedPurger{
 		namedPurger{
@@ -32,6 +39,30 @@ func NewGarbageCollector(dbm *gorp.DbMap, ival time.Duration) *GarbageCollector
 			name:   "session_key",
 			purger: skRepo,
 		},
+		namedPurger{
+			name:   "access_token",
+			purger: atRepo,
+		},
+		namedPurger{
+			name:   "browser_session",
+			purger: bsRepo,
+		},
+		namedPurger{
+			name:   "pushed_auth_request",
+			purger: parRepo,
+		},
+		namedPurger{
+			name:   "client_assertion",
+			purger: caRepo,
+		},
+		namedPurger{
+			name:   "device_code",
+			purger: dcRepo,
+		},
+		namedPurger{
+			name:   "refresh_token",
+			purger: rtRepo,
+		},
 	}
 
 	gc := GarbageCollector{
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/coreos/dex/grant"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	// "grant" is a reserved word in SQL.
+	grantTableName = "user_grant"
+)
+
+func init() {
+	register(table{
+		name:    grantTableName,
+		model:   grantModel{},
+		autoinc: false,
+		pkey:    []string{"user_id", "client_id"},
+	})
+}
+
+type grantModel struct {
+	UserID    string `db:"user_id"`
+	ClientID  string `db:"client_id"`
+	Scopes    string `db:"scopes"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+func (m *grantModel) grant() grant.Grant {
+	g := grant.Grant{
+		UserID:    m.UserID,
+		ClientID:  m.ClientID,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		UpdatedAt: time.Unix(m.UpdatedAt, 0).UTC(),
+	}
+	if len(m.Scopes) > 0 {
+		g.Scope = strings.Split(m.Scopes, " ")
+	}
+	return g
+}
+
+func newGrantModel(g grant.Grant) *grantModel {
+	return &grantModel{
+		UserID:    g.UserID,
+		ClientID:  g.ClientID,
+		Scopes:    strings.Join(g.Scope, " "),
+		CreatedAt: g.CreatedAt.Unix(),
+		UpdatedAt: g.UpdatedAt.Unix(),
+	}
+}
+
+func NewGrantRepo(dbm *gorp.DbMap) grant.GrantRepo {
+	return &grantRepo{db: &db{dbm}}
+}
+
+type grantRepo struct {
+	*db
+}
+
+func (r *grantRepo) Get(userID, clientID string) (*grant.Grant, error) {
+	m, err := r.executor(nil).Get(grantModel{}, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, grant.ErrorNotFound
+	}
+
+	gm, ok := m.(*grantModel)
+	if !ok {
+		log.Errorf("expected grantModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	g := gm.grant()
+	return &g, nil
+}
+
+func (r *grantRepo) Set(g grant.Grant) error {
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := r.executor(tx)
+
+	n, err := exec.Update(newGrantModel(g))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := exec.Insert(newGrantModel(g)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *grantRepo) List(userID string) ([]grant.Grant, error) {
+	q := fmt.Sprintf("SELECT * FROM %s WHERE user_id = $1 ORDER BY client_id", r.quote(grantTableName))
+	var models []grantModel
+	if _, err := r.executor(nil).Select(&models, q, userID); err != nil {
+		return nil, err
+	}
+
+	grants := make([]grant.Grant, len(models))
+	for i, m := range models {
+		grants[i] = m.grant()
+	}
+	return grants, nil
+}
+
+func (r *grantRepo) Delete(userID, clientID string) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND client_id = $2", r.quote(grantTableName))
+	res, err := r.executor(nil).Exec(q, userID, clientID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return grant.ErrorNotFound
+	}
+	return nil
+}
@@ -2,6 +2,19 @@ package db
 
 // SQLite3 is a test only database. There is only one migration because we do not support migrations.
 const sqlite3Migration = `
+CREATE TABLE access_token (
+    id text NOT NULL UNIQUE,
+    user_id text,
+    client_id text,
+    connector_id text,
+    scopes text,
+    groups text,
+    created_at bigint,
+    expires_at bigint,
+    claims text,
+    resources text
+);
+
 CREATE TABLE authd_user (
     id text NOT NULL UNIQUE,
     email text,
@@ -9,7 +22,31 @@ CREATE TABLE authd_user (
     display_name text,
     admin integer,
     created_at bigint,
-    disabled integer
+    disabled integer,
+    given_name text,
+    family_name text,
+    preferred_username text,
+    picture text,
+    locale text
+);
+
+CREATE TABLE browser_session (
+    id text NOT NULL UNIQUE,
+    user_id text,
+    connector_id text,
+    identity text,
+    auth_time bigint,
+    created_at bigint,
+    expires_at bigint,
+    amr text,
+    acr text
+);
+
+CREATE TABLE client_assertion (
+    client_id text NOT NULL,
+    jti text NOT NULL,
+    expires_at bigint,
+    UNIQUE (client_id, jti)
 );
 
 CREATE TABLE client_identity (
@@ -17,7 +54,14 @@ CREATE TABLE client_identity (
     secret blob,
     metadata text,
     dex_admin integer,
-    public integer
+    public integer,
+    post_logout_redirect_uris text,
+    refresh_token_idle_timeout bigint,
+    refresh_token_lifetime bigint,
+    disable_refresh_token_rotation integer,
+    password_grant_connector_id text,
+    registration_access_token blob,
+    claim_mappings text
 );
 
 CREATE TABLE connector_config (
@@ -26,23 +70,57 @@ CREATE TABLE connector_config (
     config text
 );
 
+CREATE TABLE device_code (
+    user_code text NOT NULL UNIQUE,
+    code_hash text NOT NULL UNIQUE,
+    client_id text,
+    scopes text,
+    state text,
+    session_id text,
+    poll_interval bigint,
+    last_polled_at bigint,
+    created_at bigint,
+    expires_at bigint
+);
+
 CREATE TABLE key (
     value blob
 );
 
+CREATE TABLE pairwise_subject (
+    sector text NOT NULL,
+    subject text NOT NULL,
+    user_id text NOT NULL
+);
+
 CREATE TABLE password_info (
     user_id text NOT NULL UNIQUE,
     password text,
     password_expires bigint
 );
 
+CREATE TABLE pushed_auth_request (
+    id text NOT NULL UNIQUE,
+    client_id text,
+    params text,
+    created_at bigint,
+    expires_at bigint
+);
+
 CREATE TABLE refresh_token (
     id integer PRIMARY KEY,
     payload_hash blob,
     user_id text,
     client_id text,
     connector_id text,
-    scopes text
+    scopes text,
+    resources text,
+    created_at bigint,
+    last_used_at bigint,
+    expires_at bigint,
+    idle_timeout bigint,
+    family_id bigint,
+    retired_at bigint
 );
 
 CREATE TABLE remote_identity_mapping (
@@ -65,7 +143,19 @@ CREATE TABLE session (
     register integer,
     nonce text,
     scope text,
-    groups text
+    groups text,
+    code_challenge text,
+    code_challenge_method text,
+    response_type text,
+    browser_session_id text,
+    auth_time bigint,
+    prompt text,
+    amr text,
+    acr_values text,
+    claims_request text,
+    profile text,
+    resources text,
+    acr text
 );
 
 CREATE TABLE session_key (
@@ -75,9 +165,21 @@ CREATE TABLE session_key (
     stale integer
 );
 
+CREATE TABLE signing_key (
+    value blob
+);
+
 CREATE TABLE trusted_peers (
     client_id text NOT NULL,
     trusted_client_id text NOT NULL
 );
 
+CREATE TABLE user_grant (
+    user_id text NOT NULL,
+    client_id text NOT NULL,
+    scopes text,
+    created_at bigint,
+    updated_at bigint
+);
+
 `
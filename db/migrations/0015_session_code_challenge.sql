@@ -0,0 +1,3 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "code_challenge" text;
+ALTER TABLE session ADD COLUMN "code_challenge_method" text;
@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "response_type" text;
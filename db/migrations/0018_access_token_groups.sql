@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE access_token ADD COLUMN "groups" text;
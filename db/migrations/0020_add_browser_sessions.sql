@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE browser_session (
+    id text NOT NULL,
+    user_id text,
+    connector_id text,
+    identity text,
+    auth_time bigint,
+    created_at bigint,
+    expires_at bigint
+);
+
+ALTER TABLE ONLY browser_session
+    ADD CONSTRAINT browser_session_pkey PRIMARY KEY (id);
+
+ALTER TABLE session ADD COLUMN "browser_session_id" text;
+ALTER TABLE session ADD COLUMN "auth_time" bigint;
+
+UPDATE session SET browser_session_id = '', auth_time = 0;
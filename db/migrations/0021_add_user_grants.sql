@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE user_grant (
+    user_id text NOT NULL,
+    client_id text NOT NULL,
+    scopes text,
+    created_at bigint,
+    updated_at bigint
+);
+
+ALTER TABLE ONLY user_grant
+    ADD CONSTRAINT user_grant_pkey PRIMARY KEY (user_id, client_id);
+
+ALTER TABLE session ADD COLUMN "prompt" text;
+
+UPDATE session SET prompt = '';
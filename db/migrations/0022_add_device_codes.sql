@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE device_code (
+    user_code text NOT NULL,
+    code_hash text NOT NULL UNIQUE,
+    client_id text,
+    scopes text,
+    state text,
+    session_id text,
+    poll_interval bigint,
+    last_polled_at bigint,
+    created_at bigint,
+    expires_at bigint
+);
+
+ALTER TABLE ONLY device_code
+    ADD CONSTRAINT device_code_pkey PRIMARY KEY (user_code);
@@ -0,0 +1,14 @@
+-- +migrate Up
+ALTER TABLE refresh_token ADD COLUMN "created_at" bigint;
+ALTER TABLE refresh_token ADD COLUMN "last_used_at" bigint;
+ALTER TABLE refresh_token ADD COLUMN "expires_at" bigint;
+ALTER TABLE refresh_token ADD COLUMN "idle_timeout" bigint;
+
+-- Tokens issued before expiry was introduced are bounded by the expiry policy
+-- in effect when they are used, counted from now.
+UPDATE refresh_token SET created_at = extract(epoch from now())::bigint, last_used_at = extract(epoch from now())::bigint, expires_at = 0, idle_timeout = 0;
+
+ALTER TABLE client_identity ADD COLUMN "refresh_token_idle_timeout" bigint;
+ALTER TABLE client_identity ADD COLUMN "refresh_token_lifetime" bigint;
+
+UPDATE client_identity SET refresh_token_idle_timeout = 0, refresh_token_lifetime = 0;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE refresh_token ADD COLUMN "family_id" bigint;
+ALTER TABLE refresh_token ADD COLUMN "retired_at" bigint;
+
+UPDATE refresh_token SET family_id = id, retired_at = 0;
+
+ALTER TABLE client_identity ADD COLUMN "disable_refresh_token_rotation" boolean;
+
+UPDATE client_identity SET disable_refresh_token_rotation = false;
@@ -0,0 +1,4 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "password_grant_connector_id" text;
+
+UPDATE client_identity SET password_grant_connector_id = '';
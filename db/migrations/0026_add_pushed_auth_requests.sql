@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE pushed_auth_request (
+    id text NOT NULL,
+    client_id text,
+    params text,
+    created_at bigint,
+    expires_at bigint
+);
+
+ALTER TABLE ONLY pushed_auth_request
+    ADD CONSTRAINT pushed_auth_request_pkey PRIMARY KEY (id);
@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "registration_access_token" bytea;
@@ -0,0 +1,3 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "signing_key" (
+       "value" bytea not null primary key) ;
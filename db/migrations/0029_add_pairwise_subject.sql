@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE TABLE pairwise_subject (
+    sector text NOT NULL,
+    subject text NOT NULL,
+    user_id text NOT NULL
+);
+
+ALTER TABLE ONLY pairwise_subject
+    ADD CONSTRAINT pairwise_subject_pkey PRIMARY KEY (sector, subject);
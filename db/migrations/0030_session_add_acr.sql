@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "amr" text;
+ALTER TABLE session ADD COLUMN "acr_values" text;
+
+UPDATE session SET amr = '', acr_values = '';
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "claims_request" text;
+ALTER TABLE access_token ADD COLUMN "claims" text;
+
+UPDATE session SET claims_request = '';
+UPDATE access_token SET claims = '';
@@ -0,0 +1,10 @@
+-- +migrate Up
+ALTER TABLE authd_user ADD COLUMN "given_name" text;
+ALTER TABLE authd_user ADD COLUMN "family_name" text;
+ALTER TABLE authd_user ADD COLUMN "preferred_username" text;
+ALTER TABLE authd_user ADD COLUMN "picture" text;
+ALTER TABLE authd_user ADD COLUMN "locale" text;
+ALTER TABLE session ADD COLUMN "profile" text;
+
+UPDATE authd_user SET given_name = '', family_name = '', preferred_username = '', picture = '', locale = '';
+UPDATE session SET profile = '';
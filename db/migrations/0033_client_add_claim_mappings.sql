@@ -0,0 +1,4 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "claim_mappings" text;
+
+UPDATE client_identity SET claim_mappings = '';
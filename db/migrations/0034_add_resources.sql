@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "resources" text;
+ALTER TABLE refresh_token ADD COLUMN "resources" text;
+ALTER TABLE access_token ADD COLUMN "resources" text;
+
+UPDATE session SET resources = '';
+UPDATE refresh_token SET resources = '';
+UPDATE access_token SET resources = '';
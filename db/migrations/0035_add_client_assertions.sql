@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE TABLE client_assertion (
+    client_id text NOT NULL,
+    jti text NOT NULL,
+    expires_at bigint
+);
+
+ALTER TABLE ONLY client_assertion
+    ADD CONSTRAINT client_assertion_pkey PRIMARY KEY (client_id, jti);
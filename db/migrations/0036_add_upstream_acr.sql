@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "acr" text;
+ALTER TABLE browser_session ADD COLUMN "amr" text;
+ALTER TABLE browser_session ADD COLUMN "acr" text;
+
+UPDATE session SET acr = '';
+UPDATE browser_session SET amr = '', acr = '';
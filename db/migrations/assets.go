@@ -96,5 +96,137 @@ var PostgresMigrations migrate.MigrationSource = &migrate.MemoryMigrationSource{
 				"-- +migrate Up\nALTER TABLE refresh_token ADD COLUMN \"connector_id\" text;\nALTER TABLE session ADD COLUMN \"groups\" text;\n",
 			},
 		},
+		{
+			Id: "0015_session_code_challenge.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"code_challenge\" text;\nALTER TABLE session ADD COLUMN \"code_challenge_method\" text;\n",
+			},
+		},
+		{
+			Id: "0016_session_response_type.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"response_type\" text;\n",
+			},
+		},
+		{
+			Id: "0017_add_access_tokens.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE access_token (\n    id text NOT NULL,\n    user_id text,\n    client_id text,\n    connector_id text,\n    scopes text,\n    created_at bigint,\n    expires_at bigint\n);\n\nALTER TABLE ONLY access_token\n    ADD CONSTRAINT access_token_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0018_access_token_groups.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE access_token ADD COLUMN \"groups\" text;\n",
+			},
+		},
+		{
+			Id: "0019_client_post_logout_redirect_uris.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"post_logout_redirect_uris\" text;\n\nUPDATE client_identity SET post_logout_redirect_uris = '';\n",
+			},
+		},
+		{
+			Id: "0020_add_browser_sessions.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE browser_session (\n    id text NOT NULL,\n    user_id text,\n    connector_id text,\n    identity text,\n    auth_time bigint,\n    created_at bigint,\n    expires_at bigint\n);\n\nALTER TABLE ONLY browser_session\n    ADD CONSTRAINT browser_session_pkey PRIMARY KEY (id);\n\nALTER TABLE session ADD COLUMN \"browser_session_id\" text;\nALTER TABLE session ADD COLUMN \"auth_time\" bigint;\n\nUPDATE session SET browser_session_id = '', auth_time = 0;\n",
+			},
+		},
+		{
+			Id: "0021_add_user_grants.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE user_grant (\n    user_id text NOT NULL,\n    client_id text NOT NULL,\n    scopes text,\n    created_at bigint,\n    updated_at bigint\n);\n\nALTER TABLE ONLY user_grant\n    ADD CONSTRAINT user_grant_pkey PRIMARY KEY (user_id, client_id);\n\nALTER TABLE session ADD COLUMN \"prompt\" text;\n\nUPDATE session SET prompt = '';\n",
+			},
+		},
+		{
+			Id: "0022_add_device_codes.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE device_code (\n    user_code text NOT NULL,\n    code_hash text NOT NULL UNIQUE,\n    client_id text,\n    scopes text,\n    state text,\n    session_id text,\n    poll_interval bigint,\n    last_polled_at bigint,\n    created_at bigint,\n    expires_at bigint\n);\n\nALTER TABLE ONLY device_code\n    ADD CONSTRAINT device_code_pkey PRIMARY KEY (user_code);\n",
+			},
+		},
+		{
+			Id: "0023_refresh_token_expiry.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE refresh_token ADD COLUMN \"created_at\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"last_used_at\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"expires_at\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"idle_timeout\" bigint;\n\n-- Tokens issued before expiry was introduced are bounded by the expiry policy\n-- in effect when they are used, counted from now.\nUPDATE refresh_token SET created_at = extract(epoch from now())::bigint, last_used_at = extract(epoch from now())::bigint, expires_at = 0, idle_timeout = 0;\n\nALTER TABLE client_identity ADD COLUMN \"refresh_token_idle_timeout\" bigint;\nALTER TABLE client_identity ADD COLUMN \"refresh_token_lifetime\" bigint;\n\nUPDATE client_identity SET refresh_token_idle_timeout = 0, refresh_token_lifetime = 0;\n",
+			},
+		},
+		{
+			Id: "0024_refresh_token_rotation.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE refresh_token ADD COLUMN \"family_id\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"retired_at\" bigint;\n\nUPDATE refresh_token SET family_id = id, retired_at = 0;\n\nALTER TABLE client_identity ADD COLUMN \"disable_refresh_token_rotation\" boolean;\n\nUPDATE client_identity SET disable_refresh_token_rotation = false;\n",
+			},
+		},
+		{
+			Id: "0025_client_password_grant.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"password_grant_connector_id\" text;\n\nUPDATE client_identity SET password_grant_connector_id = '';\n",
+			},
+		},
+		{
+			Id: "0026_add_pushed_auth_requests.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE pushed_auth_request (\n    id text NOT NULL,\n    client_id text,\n    params text,\n    created_at bigint,\n    expires_at bigint\n);\n\nALTER TABLE ONLY pushed_auth_request\n    ADD CONSTRAINT pushed_auth_request_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0027_client_registration_access_token.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"registration_access_token\" bytea;\n",
+			},
+		},
+		{
+			Id: "0028_add_signing_key.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE IF NOT EXISTS \"signing_key\" (\n       \"value\" bytea not null primary key) ;\n",
+			},
+		},
+		{
+			Id: "0029_add_pairwise_subject.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE pairwise_subject (\n    sector text NOT NULL,\n    subject text NOT NULL,\n    user_id text NOT NULL\n);\n\nALTER TABLE ONLY pairwise_subject\n    ADD CONSTRAINT pairwise_subject_pkey PRIMARY KEY (sector, subject);\n",
+			},
+		},
+		{
+			Id: "0030_session_add_acr.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"amr\" text;\nALTER TABLE session ADD COLUMN \"acr_values\" text;\n\nUPDATE session SET amr = '', acr_values = '';\n",
+			},
+		},
+		{
+			Id: "0031_add_claims_request.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"claims_request\" text;\nALTER TABLE access_token ADD COLUMN \"claims\" text;\n\nUPDATE session SET claims_request = '';\nUPDATE access_token SET claims = '';\n",
+			},
+		},
+		{
+			Id: "0032_add_user_profile.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE authd_user ADD COLUMN \"given_name\" text;\nALTER TABLE authd_user ADD COLUMN \"family_name\" text;\nALTER TABLE authd_user ADD COLUMN \"preferred_username\" text;\nALTER TABLE authd_user ADD COLUMN \"picture\" text;\nALTER TABLE authd_user ADD COLUMN \"locale\" text;\nALTER TABLE session ADD COLUMN \"profile\" text;\n\nUPDATE authd_user SET given_name = '', family_name = '', preferred_username = '', picture = '', locale = '';\nUPDATE session SET profile = '';\n",
+			},
+		},
+		{
+			Id: "0033_client_add_claim_mappings.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"claim_mappings\" text;\n\nUPDATE client_identity SET claim_mappings = '';\n",
+			},
+		},
+		{
+			Id: "0034_add_resources.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"resources\" text;\nALTER TABLE refresh_token ADD COLUMN \"resources\" text;\nALTER TABLE access_token ADD COLUMN \"resources\" text;\n\nUPDATE session SET resources = '';\nUPDATE refresh_token SET resources = '';\nUPDATE access_token SET resources = '';\n",
+			},
+		},
+		{
+			Id: "0035_add_client_assertions.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE client_assertion (\n    client_id text NOT NULL,\n    jti text NOT NULL,\n    expires_at bigint\n);\n\nALTER TABLE ONLY client_assertion\n    ADD CONSTRAINT client_assertion_pkey PRIMARY KEY (client_id, jti);\n",
+			},
+		},
+		{
+			Id: "0036_add_upstream_acr.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"acr\" text;\nALTER TABLE browser_session ADD COLUMN \"amr\" text;\nALTER TABLE browser_session ADD COLUMN \"acr\" text;\n\nUPDATE session SET acr = '';\nUPDATE browser_session SET amr = '', acr = '';\n",
+			},
+		},
 	},
 }
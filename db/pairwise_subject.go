@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
+)
+
+const (
+	pairwiseSubjectTableName = "pairwise_subject"
+)
+
+func init() {
+	register(table{
+		name:    pairwiseSubjectTableName,
+		model:   pairwiseSubjectModel{},
+		autoinc: false,
+		pkey:    []string{"sector", "subject"},
+	})
+}
+
+type pairwiseSubjectModel struct {
+	Sector  string `db:"sector"`
+	Subject string `db:"subject"`
+	UserID  string `db:"user_id"`
+}
+
+func NewPairwiseSubjectRepo(dbm *gorp.DbMap) user.PairwiseSubjectRepo {
+	return &pairwiseSubjectRepo{db: &db{dbm}}
+}
+
+type pairwiseSubjectRepo struct {
+	*db
+}
+
+func (r *pairwiseSubjectRepo) Get(sector, sub string) (string, error) {
+	m, err := r.executor(nil).Get(pairwiseSubjectModel{}, sector, sub)
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		return "", user.ErrorNotFound
+	}
+
+	pm, ok := m.(*pairwiseSubjectModel)
+	if !ok {
+		log.Errorf("expected pairwiseSubjectModel but found %v", reflect.TypeOf(m))
+		return "", errors.New("unrecognized model")
+	}
+	return pm.UserID, nil
+}
+
+func (r *pairwiseSubjectRepo) Set(sector, sub, userID string) error {
+	switch id, err := r.Get(sector, sub); err {
+	case nil:
+		if id != userID {
+			return errors.New("subject already identifies another user")
+		}
+		return nil
+	case user.ErrorNotFound:
+		break
+	default:
+		return err
+	}
+
+	err := r.executor(nil).Insert(&pairwiseSubjectModel{
+		Sector:  sector,
+		Subject: sub,
+		UserID:  userID,
+	})
+	if err != nil {
+		// Another worker may have just recorded the same subject.
+		if id, gerr := r.Get(sector, sub); gerr == nil && id == userID {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
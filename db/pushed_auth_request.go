@@ -0,0 +1,139 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+)
+
+const (
+	pushedAuthRequestTableName = "pushed_auth_request"
+)
+
+func init() {
+	register(table{
+		name:    pushedAuthRequestTableName,
+		model:   pushedAuthRequestModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type pushedAuthRequestModel struct {
+	ID       string `db:"id"`
+	ClientID string `db:"client_id"`
+	// Params is the URL encoded parameters of the request.
+	Params    string `db:"params"`
+	CreatedAt int64  `db:"created_at"`
+	ExpiresAt int64  `db:"expires_at"`
+}
+
+func (m *pushedAuthRequestModel) pushedAuthRequest() (*session.PushedAuthRequest, error) {
+	params, err := url.ParseQuery(m.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &session.PushedAuthRequest{
+		ID:        m.ID,
+		ClientID:  m.ClientID,
+		Params:    params,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt: time.Unix(m.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+func newPushedAuthRequestModel(p *session.PushedAuthRequest) *pushedAuthRequestModel {
+	return &pushedAuthRequestModel{
+		ID:        p.ID,
+		ClientID:  p.ClientID,
+		Params:    p.Params.Encode(),
+		CreatedAt: p.CreatedAt.Unix(),
+		ExpiresAt: p.ExpiresAt.Unix(),
+	}
+}
+
+func NewPushedAuthRequestRepo(dbm *gorp.DbMap) *PushedAuthRequestRepo {
+	return NewPushedAuthRequestRepoWithClock(dbm, clockwork.NewRealClock())
+}
+
+func NewPushedAuthRequestRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) *PushedAuthRequestRepo {
+	return &PushedAuthRequestRepo{db: &db{dbm}, clock: clock}
+}
+
+type PushedAuthRequestRepo struct {
+	*db
+	clock clockwork.Clock
+}
+
+func (r *PushedAuthRequestRepo) Get(id string) (*session.PushedAuthRequest, error) {
+	m, err := r.executor(nil).Get(pushedAuthRequestModel{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, session.ErrorPushedAuthRequestNotFound
+	}
+
+	pm, ok := m.(*pushedAuthRequestModel)
+	if !ok {
+		log.Errorf("expected pushedAuthRequestModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	p, err := pm.pushedAuthRequest()
+	if err != nil {
+		return nil, err
+	}
+	if !p.ExpiresAt.After(r.clock.Now()) {
+		return nil, session.ErrorPushedAuthRequestNotFound
+	}
+	return p, nil
+}
+
+func (r *PushedAuthRequestRepo) Create(p session.PushedAuthRequest) error {
+	return r.executor(nil).Insert(newPushedAuthRequestModel(&p))
+}
+
+func (r *PushedAuthRequestRepo) Delete(id string) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1", r.quote(pushedAuthRequestTableName))
+	res, err := r.executor(nil).Exec(q, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return session.ErrorPushedAuthRequestNotFound
+	}
+	return nil
+}
+
+func (r *PushedAuthRequestRepo) purge() error {
+	qt := r.quote(pushedAuthRequestTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, pushedAuthRequestTableName)
+	return nil
+}
@@ -7,8 +7,10 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/coreos/dex/client"
@@ -34,8 +36,19 @@ func init() {
 type refreshTokenRepo struct {
 	*db
 	tokenGenerator refresh.RefreshTokenGenerator
+	expiry         refresh.ExpiryPolicy
+	clock          clockwork.Clock
 }
 
+// refreshTokenModel records when the token expires so that purging does not
+// depend on the expiry policy in effect: ExpiresAt is the end of the token's
+// lifetime, and IdleTimeout in seconds is counted from LastUsedAt. Zero means
+// the token was issued without that bound, like tokens issued before refresh
+// tokens expired, and the expiry policy in effect applies to it once used.
+//
+// Renewing a token retires it rather than deleting it, so that presenting it
+// again can be detected. All tokens renewed from the same grant share the ID
+// of the first one as FamilyID.
 type refreshTokenModel struct {
 	ID          int64  `db:"id"`
 	PayloadHash []byte `db:"payload_hash"`
@@ -43,6 +56,33 @@ type refreshTokenModel struct {
 	ClientID    string `db:"client_id"`
 	ConnectorID string `db:"connector_id"`
 	Scopes      string `db:"scopes"`
+	Resources   string `db:"resources"`
+	CreatedAt   int64  `db:"created_at"`
+	LastUsedAt  int64  `db:"last_used_at"`
+	ExpiresAt   int64  `db:"expires_at"`
+	IdleTimeout int64  `db:"idle_timeout"`
+	FamilyID    int64  `db:"family_id"`
+	RetiredAt   int64  `db:"retired_at"`
+}
+
+// expiresAt returns when the token expires unless it is used again, or the
+// zero time if it never expires.
+func (m *refreshTokenModel) expiresAt() time.Time {
+	exp := m.ExpiresAt
+	if m.IdleTimeout > 0 {
+		if idleExp := m.LastUsedAt + m.IdleTimeout; exp == 0 || idleExp < exp {
+			exp = idleExp
+		}
+	}
+	if exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(exp, 0).UTC()
+}
+
+func (m *refreshTokenModel) expired(now time.Time) bool {
+	exp := m.expiresAt()
+	return !exp.IsZero() && !exp.After(now)
 }
 
 // buildToken combines the token ID and token payload to create a new token.
@@ -84,18 +124,93 @@ func NewRefreshTokenRepo(dbm *gorp.DbMap) refresh.RefreshTokenRepo {
 }
 
 func NewRefreshTokenRepoWithGenerator(dbm *gorp.DbMap, gen refresh.RefreshTokenGenerator) refresh.RefreshTokenRepo {
+	return newRefreshTokenRepo(dbm, gen, refresh.ExpiryPolicy{}, clockwork.NewRealClock())
+}
+
+// NewRefreshTokenRepoWithExpiry returns a repo issuing tokens that expire
+// according to expiry, unless the client they are issued to has its own policy.
+func NewRefreshTokenRepoWithExpiry(dbm *gorp.DbMap, expiry refresh.ExpiryPolicy, clock clockwork.Clock) refresh.RefreshTokenRepo {
+	return newRefreshTokenRepo(dbm, refresh.DefaultRefreshTokenGenerator, expiry, clock)
+}
+
+func newRefreshTokenRepo(dbm *gorp.DbMap, gen refresh.RefreshTokenGenerator, expiry refresh.ExpiryPolicy, clock clockwork.Clock) *refreshTokenRepo {
 	return &refreshTokenRepo{
 		db:             &db{dbm},
 		tokenGenerator: gen,
+		expiry:         expiry,
+		clock:          clock,
 	}
 }
 
-func (r *refreshTokenRepo) Create(userID, clientID, connectorID string, scopes []string) (string, error) {
-	return r.create(nil, userID, clientID, connectorID, scopes)
+func (r *refreshTokenRepo) Create(userID, clientID, connectorID string, scopes, resources []string) (string, error) {
+	tx, err := r.begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	token, err := r.create(tx, userID, clientID, connectorID, scopes, resources, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
 }
 
 func (r *refreshTokenRepo) Verify(clientID, token string) (userID, connectorID string, scope scope.Scopes, err error) {
-	return r.verify(nil, clientID, token)
+	record, err := r.verify(nil, clientID, token)
+	if err == refresh.ErrorTokenReused {
+		if err := r.revokeFamily(nil, record); err != nil {
+			return "", "", nil, err
+		}
+		return record.UserID, "", nil, refresh.ErrorTokenReused
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	record.LastUsedAt = r.clock.Now().Unix()
+	if _, err := r.executor(nil).Update(record); err != nil {
+		return "", "", nil, err
+	}
+
+	return record.UserID, record.ConnectorID, record.scopes(), nil
+}
+
+func (r *refreshTokenRepo) Get(token string) (*refresh.RefreshToken, error) {
+	tokenID, tokenPayload, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := r.get(nil, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTokenPayload(record.PayloadHash, tokenPayload); err != nil {
+		return nil, err
+	}
+
+	if err := r.applyExpiryPolicy(nil, record); err != nil {
+		return nil, err
+	}
+
+	if record.RetiredAt != 0 || record.expired(r.clock.Now()) {
+		return nil, refresh.ErrorInvalidToken
+	}
+
+	tok := refresh.RefreshToken{
+		UserID:      record.UserID,
+		ClientID:    record.ClientID,
+		ConnectorID: record.ConnectorID,
+		Scope:       record.scopes(),
+		Resources:   strings.Fields(record.Resources),
+		CreatedAt:   time.Unix(record.CreatedAt, 0).UTC(),
+		LastUsedAt:  time.Unix(record.LastUsedAt, 0).UTC(),
+		ExpiresAt:   record.expiresAt(),
+	}
+	return &tok, nil
 }
 
 func (r *refreshTokenRepo) Revoke(userID, token string) error {
@@ -112,24 +227,37 @@ func (r *refreshTokenRepo) Revoke(userID, token string) error {
 }
 
 func (r *refreshTokenRepo) RenewRefreshToken(clientID, userID, oldToken string) (newRefreshToken string, err error) {
+	tx, err := r.begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
 	// Verify
-	userID, connectorID, scopes, err := r.verify(nil, clientID, oldToken)
+	record, err := r.verify(tx, clientID, oldToken)
+	if err == refresh.ErrorTokenReused {
+		return "", r.revokeReused(tx, record)
+	}
 	if err != nil {
 		return "", err
 	}
+	userID = record.UserID
 
-	// Revoke old refresh token
-	tx, err := r.begin()
+	// Retire old refresh token. If a concurrent request retired it first,
+	// the token was presented twice.
+	q := fmt.Sprintf("UPDATE %s SET retired_at = $1 WHERE id = $2 AND retired_at = 0", r.quote(refreshTokenTableName))
+	res, err := r.executor(tx).Exec(q, r.clock.Now().Unix(), record.ID)
 	if err != nil {
 		return "", err
 	}
-	defer tx.Rollback()
-	if err := r.revoke(tx, userID, oldToken); err != nil {
+	if n, err := res.RowsAffected(); err != nil {
 		return "", err
+	} else if n == 0 {
+		return "", r.revokeReused(tx, record)
 	}
 
-	// Renew refresh token
-	newRefreshToken, err = r.create(tx, userID, clientID, connectorID, scopes)
+	// Renew refresh token, keeping the lifetime of the old one.
+	newRefreshToken, err = r.create(tx, userID, clientID, record.ConnectorID, record.scopes(), strings.Fields(record.Resources), record)
 	if err != nil {
 		return "", err
 	}
@@ -137,6 +265,26 @@ func (r *refreshTokenRepo) RenewRefreshToken(clientID, userID, oldToken string)
 	return newRefreshToken, tx.Commit()
 }
 
+// revokeReused revokes the grant of a token that was presented after it was
+// retired, commits tx and returns ErrorTokenReused.
+func (r *refreshTokenRepo) revokeReused(tx repo.Transaction, record *refreshTokenModel) error {
+	if err := r.revokeFamily(tx, record); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return refresh.ErrorTokenReused
+}
+
+// revokeFamily deletes the tokens renewed from the same grant as record.
+func (r *refreshTokenRepo) revokeFamily(tx repo.Transaction, record *refreshTokenModel) error {
+	log.Infof("Revoking refresh token grant %d of client %s for user %s", record.FamilyID, record.ClientID, record.UserID)
+	q := fmt.Sprintf("DELETE FROM %s WHERE family_id = $1", r.quote(refreshTokenTableName))
+	_, err := r.executor(tx).Exec(q, record.FamilyID)
+	return err
+}
+
 func (r *refreshTokenRepo) RevokeTokensForClient(userID, clientID string) error {
 	q := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND client_id = $2", r.quote(refreshTokenTableName))
 	_, err := r.executor(nil).Exec(q, userID, clientID)
@@ -145,7 +293,7 @@ func (r *refreshTokenRepo) RevokeTokensForClient(userID, clientID string) error
 
 func (r *refreshTokenRepo) ClientsWithRefreshTokens(userID string) ([]client.Client, error) {
 	q := `SELECT c.* FROM %s as c
-	INNER JOIN %s as r ON c.id = r.client_id WHERE r.user_id = $1;`
+	INNER JOIN %s as r ON c.id = r.client_id WHERE r.user_id = $1 AND r.retired_at = 0;`
 	q = fmt.Sprintf(q, r.quote(clientTableName), r.quote(refreshTokenTableName))
 	var clients []clientModel
 	if _, err := r.executor(nil).Select(&clients, q, userID); err != nil {
@@ -185,36 +333,97 @@ func (r *refreshTokenRepo) get(tx repo.Transaction, tokenID int64) (*refreshToke
 	return record, nil
 }
 
-func (r *refreshTokenRepo) verify(tx repo.Transaction, clientID, token string) (userID, connectorID string, scope scope.Scopes, err error) {
-	tokenID, tokenPayload, err := parseToken(token)
+func (m *refreshTokenModel) scopes() scope.Scopes {
+	if len(m.Scopes) == 0 {
+		return nil
+	}
+	return strings.Split(m.Scopes, " ")
+}
 
+func (r *refreshTokenRepo) verify(tx repo.Transaction, clientID, token string) (*refreshTokenModel, error) {
+	tokenID, tokenPayload, err := parseToken(token)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	record, err := r.get(tx, tokenID)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	if record.ClientID != clientID {
-		return "", "", nil, refresh.ErrorInvalidClientID
+		return nil, refresh.ErrorInvalidClientID
 	}
 
 	// Check if the hash of token received is the same stored in database
 	if err = checkTokenPayload(record.PayloadHash, tokenPayload); err != nil {
-		return
+		return nil, err
 	}
 
-	var scopes []string
-	if len(record.Scopes) > 0 {
-		scopes = strings.Split(record.Scopes, " ")
+	if err := r.applyExpiryPolicy(tx, record); err != nil {
+		return nil, err
 	}
 
-	return record.UserID, record.ConnectorID, scopes, nil
+	if record.expired(r.clock.Now()) {
+		return nil, refresh.ErrorInvalidToken
+	}
+
+	if record.RetiredAt != 0 {
+		return record, refresh.ErrorTokenReused
+	}
+
+	return record, nil
 }
 
-func (r *refreshTokenRepo) create(tx repo.Transaction, userID, clientID, connectorID string, scopes []string) (string, error) {
+// expiryPolicy returns the refresh token expiry policy of the client, falling
+// back to the repo's for what the client does not set.
+func (r *refreshTokenRepo) expiryPolicy(tx repo.Transaction, clientID string) (refresh.ExpiryPolicy, error) {
+	expiry := r.expiry
+	m, err := r.executor(tx).Get(clientModel{}, clientID)
+	if err != nil {
+		return expiry, err
+	}
+	if m == nil {
+		return expiry, nil
+	}
+	cm, ok := m.(*clientModel)
+	if !ok {
+		log.Errorf("expected clientModel but found %v", reflect.TypeOf(m))
+		return expiry, errors.New("unrecognized model")
+	}
+	if cm.RefreshTokenIdleTimeout > 0 {
+		expiry.IdleTimeout = time.Duration(cm.RefreshTokenIdleTimeout) * time.Second
+	}
+	if cm.RefreshTokenLifetime > 0 {
+		expiry.Lifetime = time.Duration(cm.RefreshTokenLifetime) * time.Second
+	}
+	return expiry, nil
+}
+
+// applyExpiryPolicy bounds the record by the expiry policy of its client
+// where it was issued without a bound: its lifetime from its creation, and its
+// idle timeout from its last use. Verify stores the bounds with the record.
+func (r *refreshTokenRepo) applyExpiryPolicy(tx repo.Transaction, record *refreshTokenModel) error {
+	if record.ExpiresAt != 0 && record.IdleTimeout != 0 {
+		return nil
+	}
+	expiry, err := r.expiryPolicy(tx, record.ClientID)
+	if err != nil {
+		return err
+	}
+	if record.ExpiresAt == 0 && expiry.Lifetime > 0 {
+		record.ExpiresAt = time.Unix(record.CreatedAt, 0).Add(expiry.Lifetime).Unix()
+	}
+	if record.IdleTimeout == 0 && expiry.IdleTimeout > 0 {
+		record.IdleTimeout = int64(expiry.IdleTimeout / time.Second)
+	}
+	return nil
+}
+
+// create issues a refresh token. If parent is not nil the token renews it:
+// it belongs to the same grant and its lifetime is counted from the parent's
+// creation. Otherwise it starts a new grant, and tx must not be nil.
+func (r *refreshTokenRepo) create(tx repo.Transaction, userID, clientID, connectorID string, scopes, resources []string, parent *refreshTokenModel) (string, error) {
 	if userID == "" {
 		return "", refresh.ErrorInvalidUserID
 	}
@@ -233,17 +442,45 @@ func (r *refreshTokenRepo) create(tx repo.Transaction, userID, clientID, connect
 		return "", err
 	}
 
+	expiry, err := r.expiryPolicy(tx, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	now := r.clock.Now()
+	createdAt := now
+	var familyID int64
+	if parent != nil {
+		createdAt = time.Unix(parent.CreatedAt, 0)
+		familyID = parent.FamilyID
+	}
+
 	record := &refreshTokenModel{
 		PayloadHash: payloadHash,
 		UserID:      userID,
 		ClientID:    clientID,
 		ConnectorID: connectorID,
 		Scopes:      strings.Join(scopes, " "),
+		Resources:   strings.Join(resources, " "),
+		CreatedAt:   createdAt.Unix(),
+		LastUsedAt:  now.Unix(),
+		IdleTimeout: int64(expiry.IdleTimeout / time.Second),
+		FamilyID:    familyID,
+	}
+	if expiry.Lifetime > 0 {
+		record.ExpiresAt = createdAt.Add(expiry.Lifetime).Unix()
 	}
 
 	if err := r.executor(tx).Insert(record); err != nil {
 		return "", err
 	}
+	if parent == nil {
+		// The ID is only known once inserted.
+		record.FamilyID = record.ID
+		if _, err := r.executor(tx).Update(record); err != nil {
+			return "", err
+		}
+	}
 
 	return buildToken(record.ID, tokenPayload), nil
 }
@@ -268,13 +505,42 @@ func (r *refreshTokenRepo) revoke(tx repo.Transaction, userID, token string) err
 		return err
 	}
 
-	deleted, err := exec.Delete(record)
+	if record.RetiredAt != 0 {
+		return refresh.ErrorInvalidToken
+	}
+
+	// Revoke the whole grant, including the retired tokens.
+	q := fmt.Sprintf("DELETE FROM %s WHERE family_id = $1", r.quote(refreshTokenTableName))
+	res, err := exec.Exec(q, record.FamilyID)
 	if err != nil {
 		return err
 	}
-	if deleted == 0 {
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
 		return refresh.ErrorInvalidToken
 	}
 
 	return nil
 }
+
+func (r *refreshTokenRepo) purge() error {
+	qt := r.quote(refreshTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE (expires_at <> 0 AND expires_at <= $1) OR (idle_timeout > 0 AND last_used_at + idle_timeout <= $2) OR (retired_at <> 0 AND retired_at <= $3)", qt)
+	now := r.clock.Now()
+	res, err := r.executor(nil).Exec(q, now.Unix(), now.Unix(), now.Add(-refresh.RetiredTokenRetention).Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, refreshTokenTableName)
+	return nil
+}
@@ -3,6 +3,11 @@ package db
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/refresh"
 )
 
 func TestBuildAndParseToken(t *testing.T) {
@@ -29,3 +34,135 @@ func TestBuildAndParseToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRefreshTokenRepoPurge(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	r := newRefreshTokenRepo(NewMemDB(), refresh.DefaultRefreshTokenGenerator, refresh.ExpiryPolicy{}, clock)
+
+	create := func(expiry refresh.ExpiryPolicy) string {
+		r.expiry = expiry
+		tok, err := r.Create("user", "client", "connector", []string{"openid"}, nil)
+		if err != nil {
+			t.Fatalf("failed to create refresh token: %v", err)
+		}
+		return tok
+	}
+	forever := create(refresh.ExpiryPolicy{})
+	idle := create(refresh.ExpiryPolicy{IdleTimeout: time.Hour})
+	used := create(refresh.ExpiryPolicy{IdleTimeout: time.Hour})
+	lifetime := create(refresh.ExpiryPolicy{Lifetime: 2 * time.Hour})
+
+	clock.Advance(30 * time.Minute)
+	if _, _, _, err := r.Verify("client", used); err != nil {
+		t.Fatalf("failed to verify refresh token: %v", err)
+	}
+
+	tests := []struct {
+		advance time.Duration
+		want    map[string]bool
+	}{
+		{
+			advance: 0,
+			want:    map[string]bool{forever: true, idle: true, used: true, lifetime: true},
+		},
+		{
+			advance: 50 * time.Minute,
+			want:    map[string]bool{forever: true, idle: false, used: true, lifetime: true},
+		},
+		{
+			advance: time.Hour,
+			want:    map[string]bool{forever: true, idle: false, used: false, lifetime: false},
+		},
+	}
+
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		if err := r.purge(); err != nil {
+			t.Fatalf("case %d: purge failed: %v", i, err)
+		}
+		for tok, want := range tt.want {
+			id, _, err := parseToken(tok)
+			if err != nil {
+				t.Fatalf("case %d: failed to parse token: %v", i, err)
+			}
+			m, err := r.executor(nil).Get(refreshTokenModel{}, id)
+			if err != nil {
+				t.Fatalf("case %d: failed to get refresh token: %v", i, err)
+			}
+			if got := m != nil; got != want {
+				t.Errorf("case %d: token %d: want stored=%t, got %t", i, id, want, got)
+			}
+		}
+	}
+}
+
+func TestRefreshTokenRepoUnboundedTokens(t *testing.T) {
+	tests := []struct {
+		expiry  refresh.ExpiryPolicy
+		advance time.Duration
+
+		wantValid bool
+	}{
+		{
+			expiry:    refresh.ExpiryPolicy{},
+			advance:   24 * time.Hour,
+			wantValid: true,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{Lifetime: 2 * time.Hour},
+			advance:   time.Hour,
+			wantValid: true,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{Lifetime: 2 * time.Hour},
+			advance:   3 * time.Hour,
+			wantValid: false,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour},
+			advance:   2 * time.Hour,
+			wantValid: false,
+		},
+	}
+
+	for i, tt := range tests {
+		clock := clockwork.NewFakeClock()
+		// Tokens issued before refresh tokens expired have no bounds.
+		r := newRefreshTokenRepo(NewMemDB(), refresh.DefaultRefreshTokenGenerator, refresh.ExpiryPolicy{}, clock)
+		tok, err := r.Create("user", "client", "connector", []string{"openid"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed to create refresh token: %v", i, err)
+		}
+
+		r.expiry = tt.expiry
+		clock.Advance(tt.advance)
+
+		_, err = r.Get(tok)
+		if got := err == nil; got != tt.wantValid {
+			t.Errorf("case %d: Get: want valid=%t, got err=%v", i, tt.wantValid, err)
+		}
+		_, _, _, err = r.Verify("client", tok)
+		if got := err == nil; got != tt.wantValid {
+			t.Errorf("case %d: Verify: want valid=%t, got err=%v", i, tt.wantValid, err)
+		}
+		if tt.wantValid {
+			// Verify stores the bounds, so that purging deletes the token
+			// once expired.
+			clock.Advance(24 * time.Hour)
+			if err := r.purge(); err != nil {
+				t.Fatalf("case %d: purge failed: %v", i, err)
+			}
+			id, _, err := parseToken(tok)
+			if err != nil {
+				t.Fatalf("case %d: failed to parse token: %v", i, err)
+			}
+			m, err := r.executor(nil).Get(refreshTokenModel{}, id)
+			if err != nil {
+				t.Fatalf("case %d: failed to get refresh token: %v", i, err)
+			}
+			if wantStored := tt.expiry == (refresh.ExpiryPolicy{}); (m != nil) != wantStored {
+				t.Errorf("case %d: want stored=%t, got %t", i, wantStored, m != nil)
+			}
+		}
+	}
+}
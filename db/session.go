@@ -14,6 +14,7 @@ import (
 
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 )
 
@@ -45,6 +46,24 @@ type sessionModel struct {
 	Nonce       string `db:"nonce"`
 	Scope       string `db:"scope"`
 	Groups      string `db:"groups"`
+
+	CodeChallenge       string `db:"code_challenge"`
+	CodeChallengeMethod string `db:"code_challenge_method"`
+	ResponseType        string `db:"response_type"`
+
+	BrowserSessionID string `db:"browser_session_id"`
+	AuthTime         int64  `db:"auth_time"`
+	Prompt           string `db:"prompt"`
+
+	AMR       string `db:"amr"`
+	ACR       string `db:"acr"`
+	ACRValues string `db:"acr_values"`
+
+	ClaimsRequest string `db:"claims_request"`
+
+	Resources string `db:"resources"`
+
+	Profile string `db:"profile"`
 }
 
 func (s *sessionModel) session() (*session.Session, error) {
@@ -75,12 +94,35 @@ func (s *sessionModel) session() (*session.Session, error) {
 		Register:    s.Register,
 		Nonce:       s.Nonce,
 		Scope:       strings.Fields(s.Scope),
+
+		CodeChallenge:       s.CodeChallenge,
+		CodeChallengeMethod: s.CodeChallengeMethod,
+		ResponseType:        s.ResponseType,
+
+		BrowserSessionID: s.BrowserSessionID,
+		Prompt:           s.Prompt,
+
+		AMR:       strings.Fields(s.AMR),
+		ACR:       s.ACR,
+		ACRValues: strings.Fields(s.ACRValues),
+
+		Resources: strings.Fields(s.Resources),
 	}
 	if s.Groups != "" {
 		if err := json.Unmarshal([]byte(s.Groups), &ses.Groups); err != nil {
 			return nil, fmt.Errorf("failed to decode groups in session: %v", err)
 		}
 	}
+	if s.ClaimsRequest != "" {
+		if err := json.Unmarshal([]byte(s.ClaimsRequest), &ses.ClaimsRequest); err != nil {
+			return nil, fmt.Errorf("failed to decode claims request in session: %v", err)
+		}
+	}
+	if s.Profile != "" {
+		if err := json.Unmarshal([]byte(s.Profile), &ses.Profile); err != nil {
+			return nil, fmt.Errorf("failed to decode profile in session: %v", err)
+		}
+	}
 
 	if s.CreatedAt != 0 {
 		ses.CreatedAt = time.Unix(s.CreatedAt, 0).UTC()
@@ -90,6 +132,10 @@ func (s *sessionModel) session() (*session.Session, error) {
 		ses.ExpiresAt = time.Unix(s.ExpiresAt, 0).UTC()
 	}
 
+	if s.AuthTime != 0 {
+		ses.AuthTime = time.Unix(s.AuthTime, 0).UTC()
+	}
+
 	return &ses, nil
 }
 
@@ -111,6 +157,19 @@ func newSessionModel(s *session.Session) (*sessionModel, error) {
 		Register:    s.Register,
 		Nonce:       s.Nonce,
 		Scope:       strings.Join(s.Scope, " "),
+
+		CodeChallenge:       s.CodeChallenge,
+		CodeChallengeMethod: s.CodeChallengeMethod,
+		ResponseType:        s.ResponseType,
+
+		BrowserSessionID: s.BrowserSessionID,
+		Prompt:           s.Prompt,
+
+		AMR:       strings.Join(s.AMR, " "),
+		ACR:       s.ACR,
+		ACRValues: strings.Join(s.ACRValues, " "),
+
+		Resources: strings.Join(s.Resources, " "),
 	}
 
 	if s.Groups != nil {
@@ -121,6 +180,22 @@ func newSessionModel(s *session.Session) (*sessionModel, error) {
 		sm.Groups = string(data)
 	}
 
+	if s.ClaimsRequest.IDToken != nil || s.ClaimsRequest.UserInfo != nil {
+		data, err := json.Marshal(s.ClaimsRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal claims request: %v", err)
+		}
+		sm.ClaimsRequest = string(data)
+	}
+
+	if s.Profile != (user.Profile{}) {
+		data, err := json.Marshal(s.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal profile: %v", err)
+		}
+		sm.Profile = string(data)
+	}
+
 	if !s.CreatedAt.IsZero() {
 		sm.CreatedAt = s.CreatedAt.Unix()
 	}
@@ -129,6 +204,10 @@ func newSessionModel(s *session.Session) (*sessionModel, error) {
 		sm.ExpiresAt = s.ExpiresAt.Unix()
 	}
 
+	if !s.AuthTime.IsZero() {
+		sm.AuthTime = s.AuthTime.Unix()
+	}
+
 	return &sm, nil
 }
 
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/go-gorp/gorp"
+	"golang.org/x/crypto/ed25519"
+
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	"github.com/coreos/dex/signing"
+)
+
+const (
+	signingKeyTableName = "signing_key"
+)
+
+func init() {
+	register(table{
+		name:    signingKeyTableName,
+		model:   signingKeySetBlob{},
+		autoinc: false,
+	})
+}
+
+// signingKeyModel holds a private key as an SEC 1 DER EC key for ES256 and
+// ES384, or as a 32 byte seed for EdDSA.
+type signingKeyModel struct {
+	ID  string `json:"id"`
+	Alg string `json:"alg"`
+	Key []byte `json:"key"`
+}
+
+type signingKeySetModel struct {
+	Keys      []signingKeyModel `json:"keys"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+func newSigningKeySetModel(pks *signing.PrivateKeySet) (*signingKeySetModel, error) {
+	pkeys := pks.Keys()
+	keys := make([]signingKeyModel, len(pkeys))
+	for i, pkey := range pkeys {
+		var b []byte
+		switch pk := pkey.PrivateKey.(type) {
+		case *ecdsa.PrivateKey:
+			der, err := x509.MarshalECPrivateKey(pk)
+			if err != nil {
+				return nil, err
+			}
+			b = der
+		case ed25519.PrivateKey:
+			b = pk.Seed()
+		default:
+			return nil, fmt.Errorf("unsupported private key of type %T", pk)
+		}
+		keys[i] = signingKeyModel{
+			ID:  pkey.ID(),
+			Alg: pkey.Alg,
+			Key: b,
+		}
+	}
+
+	m := signingKeySetModel{
+		Keys:      keys,
+		ExpiresAt: pks.ExpiresAt(),
+	}
+
+	return &m, nil
+}
+
+func (m *signingKeySetModel) PrivateKeySet() (*signing.PrivateKeySet, error) {
+	keys := make([]*signing.PrivateKey, len(m.Keys))
+	for i, skm := range m.Keys {
+		var signer crypto.Signer
+		switch skm.Alg {
+		case jose.AlgES256, jose.AlgES384:
+			pk, err := x509.ParseECPrivateKey(skm.Key)
+			if err != nil {
+				return nil, err
+			}
+			signer = pk
+		case signing.AlgEdDSA:
+			if len(skm.Key) != ed25519.SeedSize {
+				return nil, fmt.Errorf("invalid EdDSA key %q", skm.ID)
+			}
+			signer = ed25519.NewKeyFromSeed(skm.Key)
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm %q", skm.Alg)
+		}
+		keys[i] = &signing.PrivateKey{
+			KeyID:      skm.ID,
+			Alg:        skm.Alg,
+			PrivateKey: signer,
+		}
+	}
+	return signing.NewPrivateKeySet(keys, m.ExpiresAt), nil
+}
+
+type signingKeySetBlob struct {
+	Value []byte `db:"value"`
+}
+
+// NewSigningKeySetRepo returns a repo of the keys of the signing package,
+// encrypted like the PrivateKeySetRepo's keys.
+func NewSigningKeySetRepo(dbm *gorp.DbMap, secrets ...[]byte) (*SigningKeySetRepo, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("must provide at least one key secret")
+	}
+	for i, secret := range secrets {
+		if len(secret) != 32 {
+			return nil, fmt.Errorf("key secret %d: expected 32-byte secret", i)
+		}
+	}
+
+	r := &SigningKeySetRepo{
+		db:      &db{dbm},
+		secrets: secrets,
+	}
+
+	return r, nil
+}
+
+type SigningKeySetRepo struct {
+	*db
+	secrets [][]byte
+}
+
+func (r *SigningKeySetRepo) Set(ks key.KeySet) error {
+	qt := r.quote(signingKeyTableName)
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := r.executor(tx)
+	if _, err := exec.Exec(fmt.Sprintf("DELETE FROM %s", qt)); err != nil {
+		return err
+	}
+
+	pks, ok := ks.(*signing.PrivateKeySet)
+	if !ok {
+		return errors.New("unable to cast to PrivateKeySet")
+	}
+
+	m, err := newSigningKeySetModel(pks)
+	if err != nil {
+		return err
+	}
+
+	j, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	v, err := pcrypto.Encrypt(j, r.secrets[0])
+	if err != nil {
+		return err
+	}
+
+	b := &signingKeySetBlob{Value: v}
+	if err := exec.Insert(b); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SigningKeySetRepo) Get() (key.KeySet, error) {
+	qt := r.quote(signingKeyTableName)
+	objs, err := r.executor(nil).Select(&signingKeySetBlob{}, fmt.Sprintf("SELECT * FROM %s", qt))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objs) == 0 {
+		return nil, key.ErrorNoKeys
+	}
+
+	b, ok := objs[0].(*signingKeySetBlob)
+	if !ok {
+		return nil, errors.New("unable to cast to KeySet")
+	}
+
+	var pks *signing.PrivateKeySet
+	for _, secret := range r.secrets {
+		var j []byte
+		if j, err = pcrypto.Decrypt(b.Value, secret); err != nil {
+			continue
+		}
+
+		var m signingKeySetModel
+		if err = json.Unmarshal(j, &m); err != nil {
+			continue
+		}
+
+		pks, err = m.PrivateKeySet()
+		if err != nil {
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return nil, ErrorCannotDecryptKeys
+	}
+	return key.KeySet(pks), nil
+}
@@ -431,6 +431,12 @@ type userModel struct {
 	Disabled      bool   `db:"disabled"`
 	Admin         bool   `db:"admin"`
 	CreatedAt     int64  `db:"created_at"`
+
+	GivenName         string `db:"given_name"`
+	FamilyName        string `db:"family_name"`
+	PreferredUsername string `db:"preferred_username"`
+	Picture           string `db:"picture"`
+	Locale            string `db:"locale"`
 }
 
 func (u *userModel) user() (user.User, error) {
@@ -441,6 +447,13 @@ func (u *userModel) user() (user.User, error) {
 		EmailVerified: u.EmailVerified,
 		Admin:         u.Admin,
 		Disabled:      u.Disabled,
+		Profile: user.Profile{
+			GivenName:         u.GivenName,
+			FamilyName:        u.FamilyName,
+			PreferredUsername: u.PreferredUsername,
+			Picture:           u.Picture,
+			Locale:            u.Locale,
+		},
 	}
 
 	if u.CreatedAt != 0 {
@@ -464,6 +477,12 @@ func newUserModel(u *user.User) (*userModel, error) {
 		EmailVerified: u.EmailVerified,
 		Admin:         u.Admin,
 		Disabled:      u.Disabled,
+
+		GivenName:         u.Profile.GivenName,
+		FamilyName:        u.Profile.FamilyName,
+		PreferredUsername: u.Profile.PreferredUsername,
+		Picture:           u.Profile.Picture,
+		Locale:            u.Profile.Locale,
 	}
 
 	if !u.CreatedAt.IsZero() {
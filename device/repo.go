@@ -0,0 +1,139 @@
+package device
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/coreos/dex/scope"
+)
+
+const (
+	DefaultDeviceCodePayloadLength = 32
+
+	// DefaultDeviceCodeValidityWindow is how long the user has to enter the
+	// user code and log in (RFC 8628 Section 3.2).
+	DefaultDeviceCodeValidityWindow = 10 * time.Minute
+
+	// DefaultPollInterval is the minimum time a device waits between polls
+	// of the token endpoint.
+	DefaultPollInterval = 5 * time.Second
+
+	// userCodeCharset holds the characters of user codes: upper case
+	// consonants, which are easy to type and can't spell words (RFC 8628
+	// Section 6.1).
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+var (
+	ErrorNotFound = errors.New("device code not found")
+)
+
+type DeviceCodeState string
+
+const (
+	// DeviceCodeStatePending is the state of a device code until the user
+	// has approved or denied the request.
+	DeviceCodeStatePending  = DeviceCodeState("PENDING")
+	DeviceCodeStateApproved = DeviceCodeState("APPROVED")
+	DeviceCodeStateDenied   = DeviceCodeState("DENIED")
+)
+
+// DeviceCode is a pending device authorization request (RFC 8628). The
+// device polls the token endpoint with the device code while the user enters
+// the user code on another device and logs in.
+type DeviceCode struct {
+	// UserCode is the code the user enters on the verification page.
+	UserCode string
+	ClientID string
+
+	// Scope is the scope the device asked for.
+	Scope scope.Scopes
+
+	State DeviceCodeState
+
+	// SessionID identifies the session the user logged in to. It is set
+	// once the user has approved the request.
+	SessionID string
+
+	// Interval is the minimum time between polls of the device.
+	Interval     time.Duration
+	LastPolledAt time.Time
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type DeviceCodeGenerator func() (string, error)
+
+func (g DeviceCodeGenerator) Generate() (string, error) {
+	return g()
+}
+
+func DefaultDeviceCodeGenerator() (string, error) {
+	b := make([]byte, DefaultDeviceCodePayloadLength)
+	n, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	if n != DefaultDeviceCodePayloadLength {
+		return "", errors.New("unable to read enough random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewUserCode returns a random user code of the form "BCDF-GHJK".
+func NewUserCode() (string, error) {
+	b := make([]byte, userCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, userCodeLength+1)
+	for i, c := range b {
+		if i == userCodeLength/2 {
+			code = append(code, '-')
+		}
+		// The modulo bias is negligible for a 20 character set.
+		code = append(code, userCodeCharset[int(c)%len(userCodeCharset)])
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode returns the user code as it was issued, ignoring case and
+// the separators users may add or leave out when typing it.
+func NormalizeUserCode(userCode string) string {
+	var code []byte
+	for _, c := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeCharset, c) {
+			code = append(code, byte(c))
+		}
+	}
+	if len(code) != userCodeLength {
+		return ""
+	}
+	return string(code[:userCodeLength/2]) + "-" + string(code[userCodeLength/2:])
+}
+
+type DeviceCodeRepo interface {
+	// Create stores a new device code with the given properties. On success
+	// the device code is returned.
+	Create(dc DeviceCode) (string, error)
+
+	// Get returns the device code, or ErrorNotFound if it is unknown.
+	// Expired device codes are returned until they are purged.
+	Get(deviceCode string) (*DeviceCode, error)
+
+	// GetByUserCode returns the device code with the user code, or
+	// ErrorNotFound if there is none.
+	GetByUserCode(userCode string) (*DeviceCode, error)
+
+	// Update replaces the stored device code with the same user code.
+	Update(dc DeviceCode) error
+
+	// Delete removes the device code with the user code. It returns
+	// ErrorNotFound if there is none.
+	Delete(userCode string) error
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/signing"
 )
 
 func connect(t *testing.T) *gorp.DbMap {
@@ -180,6 +181,84 @@ func TestDBPrivateKeySetRepoSetGet(t *testing.T) {
 	}
 }
 
+func TestDBSigningKeySetRepoSetGet(t *testing.T) {
+	s1 := []byte("xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")
+	s2 := []byte("oooooooooooooooooooooooooooooooo")
+	s3 := []byte("wwwwwwwwwwwwwwwwwwwwwwwwwwwwwwww")
+
+	keys := []*signing.PrivateKey{}
+	for _, alg := range signing.Algs {
+		k, err := signing.GeneratePrivateKey(alg)
+		if err != nil {
+			t.Fatalf("Unable to generate %s key: %v", alg, err)
+		}
+		keys = append(keys, k)
+	}
+
+	ks := signing.NewPrivateKeySet(keys, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		setSecrets [][]byte
+		getSecrets [][]byte
+		wantErr    bool
+	}{
+		{
+			setSecrets: [][]byte{s1, s2},
+			getSecrets: [][]byte{s1, s2},
+		},
+		{
+			setSecrets: [][]byte{s2, s3},
+			getSecrets: [][]byte{s1, s2},
+		},
+		{
+			setSecrets: [][]byte{s3},
+			getSecrets: [][]byte{s1, s2},
+			wantErr:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		dbMap := connect(t)
+		setRepo, err := db.NewSigningKeySetRepo(dbMap, tt.setSecrets...)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		getRepo, err := db.NewSigningKeySetRepo(dbMap, tt.getSecrets...)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		if err := setRepo.Set(ks); err != nil {
+			t.Fatalf("case %d: Unexpected error: %v", i, err)
+		}
+
+		got, err := getRepo.Get()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want err, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: Unexpected error: %v", i, err)
+		}
+
+		pks := got.(*signing.PrivateKeySet)
+		if !pks.ExpiresAt().Equal(ks.ExpiresAt()) {
+			t.Errorf("case %d: want expiresAt=%v, got %v", i, ks.ExpiresAt(), pks.ExpiresAt())
+		}
+		if len(pks.Keys()) != len(keys) {
+			t.Fatalf("case %d: want %d keys, got %d", i, len(keys), len(pks.Keys()))
+		}
+		for j, k := range pks.Keys() {
+			if diff := pretty.Compare(keys[j].JWK(), k.JWK()); diff != "" {
+				t.Errorf("case %d: Retrieved incorrect key %d: Compare(want,got): %v", i, j, diff)
+			}
+		}
+	}
+}
+
 func TestDBClientRepoMetadata(t *testing.T) {
 	r := db.NewClientRepo(connect(t))
 
@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+)
+
+func newAccessTokenRepo(t *testing.T) (accesstoken.AccessTokenRepo, clockwork.FakeClock) {
+	clock := clockwork.NewFakeClock()
+	if os.Getenv("DEX_TEST_DSN") == "" {
+		return db.NewAccessTokenRepoWithClock(db.NewMemDB(), clock), clock
+	}
+	dbMap := connect(t)
+	return db.NewAccessTokenRepoWithClock(dbMap, clock), clock
+}
+
+func TestAccessTokenRepoCreateGet(t *testing.T) {
+	r, clock := newAccessTokenRepo(t)
+
+	now := clock.Now().UTC()
+	want := accesstoken.AccessToken{
+		UserID:      "user1",
+		ClientID:    "client1",
+		ConnectorID: "IDPC-1",
+		Scope:       []string{"openid", "email"},
+		Claims: session.ClaimRequests{
+			"email":  nil,
+			"groups": &session.ClaimRequest{Essential: true},
+		},
+		Resources: []string{"https://orders.example.com", "https://billing.example.com"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	token, err := r.Create(want)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := r.Get(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("access token did not match: %s", diff)
+	}
+
+	if _, err := r.Get(token + "x"); err != accesstoken.ErrorInvalidToken {
+		t.Errorf("want %v for unknown token, got %v", accesstoken.ErrorInvalidToken, err)
+	}
+}
+
+func TestAccessTokenRepoCreateNoClient(t *testing.T) {
+	r, clock := newAccessTokenRepo(t)
+
+	_, err := r.Create(accesstoken.AccessToken{
+		UserID:    "user1",
+		ExpiresAt: clock.Now().Add(time.Hour),
+	})
+	if err != accesstoken.ErrorInvalidClientID {
+		t.Errorf("want %v, got %v", accesstoken.ErrorInvalidClientID, err)
+	}
+}
+
+func TestAccessTokenRepoExpired(t *testing.T) {
+	r, clock := newAccessTokenRepo(t)
+
+	token, err := r.Create(accesstoken.AccessToken{
+		ClientID:  "client1",
+		CreatedAt: clock.Now(),
+		ExpiresAt: clock.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+
+	if _, err := r.Get(token); err != accesstoken.ErrorInvalidToken {
+		t.Errorf("want %v for expired token, got %v", accesstoken.ErrorInvalidToken, err)
+	}
+}
+
+func TestAccessTokenRepoRevoke(t *testing.T) {
+	r, clock := newAccessTokenRepo(t)
+
+	create := func(userID, clientID string) string {
+		token, err := r.Create(accesstoken.AccessToken{
+			UserID:    userID,
+			ClientID:  clientID,
+			CreatedAt: clock.Now(),
+			ExpiresAt: clock.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return token
+	}
+
+	token := create("user1", "client1")
+	if err := r.Revoke(token); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.Get(token); err != accesstoken.ErrorInvalidToken {
+		t.Errorf("want %v for revoked token, got %v", accesstoken.ErrorInvalidToken, err)
+	}
+	if err := r.Revoke(token); err != accesstoken.ErrorInvalidToken {
+		t.Errorf("want %v revoking a revoked token, got %v", accesstoken.ErrorInvalidToken, err)
+	}
+
+	revoked := []string{create("user1", "client1"), create("user1", "client1")}
+	kept := []string{create("user1", "client2"), create("user2", "client1")}
+	if err := r.RevokeTokensForClient("user1", "client1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, token := range revoked {
+		if _, err := r.Get(token); err != accesstoken.ErrorInvalidToken {
+			t.Errorf("token %d: want %v, got %v", i, accesstoken.ErrorInvalidToken, err)
+		}
+	}
+	for i, token := range kept {
+		if _, err := r.Get(token); err != nil {
+			t.Errorf("token %d: unexpected error: %v", i, err)
+		}
+	}
+}
@@ -3,10 +3,18 @@ package repo
 import (
 	"encoding/base64"
 	"net/url"
+	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/grant"
+	"github.com/coreos/dex/refresh"
 )
 
 var (
@@ -43,3 +51,222 @@ var (
 		},
 	}
 )
+
+func TestClientRepoPostLogoutRedirectURIs(t *testing.T) {
+	tests := [][]url.URL{
+		nil,
+		{
+			url.URL{Scheme: "https", Host: "client1.example.com", Path: "/logged-out"},
+			url.URL{Scheme: "https", Host: "client1.example.com", Path: "/bye", RawQuery: "a=b"},
+		},
+	}
+
+	for i, uris := range tests {
+		repo := db.NewClientRepo(connect(t))
+
+		cli := testClients[0]
+		cli.PostLogoutRedirectURIs = uris
+		if _, err := repo.New(nil, cli); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		got, err := repo.Get(nil, cli.Credentials.ID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if diff := pretty.Compare(uris, got.PostLogoutRedirectURIs); diff != "" {
+			t.Errorf("case %d: post logout redirect URIs did not match: %s", i, diff)
+		}
+	}
+}
+
+func TestClientRepoRefreshTokenExpiry(t *testing.T) {
+	repo := db.NewClientRepo(connect(t))
+
+	cli := testClients[0]
+	cli.RefreshTokenIdleTimeout = 24 * time.Hour
+	cli.RefreshTokenLifetime = 720 * time.Hour
+	if _, err := repo.New(nil, cli); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := repo.Get(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.RefreshTokenIdleTimeout != cli.RefreshTokenIdleTimeout {
+		t.Errorf("want RefreshTokenIdleTimeout=%v, got %v", cli.RefreshTokenIdleTimeout, got.RefreshTokenIdleTimeout)
+	}
+	if got.RefreshTokenLifetime != cli.RefreshTokenLifetime {
+		t.Errorf("want RefreshTokenLifetime=%v, got %v", cli.RefreshTokenLifetime, got.RefreshTokenLifetime)
+	}
+}
+
+func TestClientRepoPasswordGrantConnector(t *testing.T) {
+	repo := db.NewClientRepo(connect(t))
+
+	cli := testClients[0]
+	cli.PasswordGrantConnectorID = "local"
+	if _, err := repo.New(nil, cli); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := repo.Get(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PasswordGrantConnectorID != cli.PasswordGrantConnectorID {
+		t.Errorf("want PasswordGrantConnectorID=%q, got %q", cli.PasswordGrantConnectorID, got.PasswordGrantConnectorID)
+	}
+}
+
+func TestClientRepoClaimMappings(t *testing.T) {
+	repo := db.NewClientRepo(connect(t))
+
+	cli := testClients[0]
+	cli.ClaimMappings = []client.ClaimMapping{
+		{Claim: "roles", From: "groups", Filter: "^app-"},
+		{Claim: "tenant", Value: "acme"},
+	}
+	if _, err := repo.New(nil, cli); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := repo.Get(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(cli.ClaimMappings, got.ClaimMappings); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
+func TestClientRepoUpdateKeepsSecret(t *testing.T) {
+	repo := db.NewClientRepo(connect(t))
+
+	cli := testClients[0]
+	if _, err := repo.New(nil, cli); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, err := repo.GetSecret(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.SetRegistrationAccessToken(nil, cli.Credentials.ID, []byte("hashed-token")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := repo.Get(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got.Metadata.ClientName = "Updated"
+	if err := repo.Update(nil, got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gotSecret, err := repo.GetSecret(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(gotSecret) != string(secret) {
+		t.Errorf("want secret to be kept, got %q", gotSecret)
+	}
+	token, err := repo.GetRegistrationAccessToken(nil, cli.Credentials.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(token) != "hashed-token" {
+		t.Errorf("want registration access token to be kept, got %q", token)
+	}
+}
+
+func TestClientRepoDelete(t *testing.T) {
+	dbMap := connect(t)
+	repo := db.NewClientRepo(dbMap)
+
+	for _, cli := range testClients {
+		if _, err := repo.New(nil, cli); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	id := testClients[0].Credentials.ID
+	if err := repo.SetTrustedPeers(nil, id, []string{testClients[1].Credentials.ID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// What was issued to the client is deleted along with it.
+	accessTokenRepo := db.NewAccessTokenRepo(dbMap)
+	accessToken, err := accessTokenRepo.Create(accesstoken.AccessToken{
+		UserID:    "user1",
+		ClientID:  id,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	refreshTokenRepo := db.NewRefreshTokenRepo(dbMap)
+	refreshToken, err := refreshTokenRepo.Create("user1", id, "local", []string{"openid", "offline_access"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grantRepo := db.NewGrantRepo(dbMap)
+	if err := grantRepo.Set(grant.Grant{UserID: "user1", ClientID: id, Scope: []string{"openid"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := repo.Delete(nil, id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := accessTokenRepo.Get(accessToken); err != accesstoken.ErrorInvalidToken {
+		t.Errorf("want access token deleted, got err=%v", err)
+	}
+	if _, err := refreshTokenRepo.Get(refreshToken); err != refresh.ErrorInvalidToken {
+		t.Errorf("want refresh token deleted, got err=%v", err)
+	}
+	if _, err := grantRepo.Get("user1", id); err != grant.ErrorNotFound {
+		t.Errorf("want grant deleted, got err=%v", err)
+	}
+	if _, err := repo.Get(nil, id); err != client.ErrorNotFound {
+		t.Errorf("want deleted client not found, got err=%v", err)
+	}
+	if peers, err := repo.GetTrustedPeers(nil, id); err != nil || len(peers) != 0 {
+		t.Errorf("want trusted peers deleted, got %v, err=%v", peers, err)
+	}
+	if _, err := repo.Get(nil, testClients[1].Credentials.ID); err != nil {
+		t.Errorf("unexpected error getting other client: %v", err)
+	}
+	if err := repo.Delete(nil, id); err != client.ErrorNotFound {
+		t.Errorf("want deleting unknown client to fail, got err=%v", err)
+	}
+}
+
+func TestClientAssertionRepoUse(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	r := db.NewClientAssertionRepoWithClock(connect(t), clock)
+	exp := clock.Now().Add(time.Minute)
+
+	tests := []struct {
+		clientID string
+		jti      string
+
+		wantErr error
+	}{
+		{clientID: "client1", jti: "jti-1"},
+		{clientID: "client1", jti: "jti-1", wantErr: client.ErrorClientAssertionReplayed},
+		{clientID: "client1", jti: "jti-2"},
+		// jti values are only unique per client
+		{clientID: "client2", jti: "jti-1"},
+	}
+	for i, tt := range tests {
+		if err := r.Use(tt.clientID, tt.jti, exp); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+		}
+	}
+
+	// Once the assertion expires, its jti is forgotten.
+	clock.Advance(2 * time.Minute)
+	if err := r.Use("client1", "jti-1", clock.Now().Add(time.Minute)); err != nil {
+		t.Errorf("unexpected error using the jti of an expired assertion: %v", err)
+	}
+}
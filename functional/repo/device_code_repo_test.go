@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/device"
+)
+
+func TestDeviceCodeRepo(t *testing.T) {
+	r := db.NewDeviceCodeRepo(connect(t))
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+
+	dc := device.DeviceCode{
+		UserCode:  "BCDF-GHJK",
+		ClientID:  "client1",
+		Scope:     []string{"openid", "offline_access"},
+		State:     device.DeviceCodeStatePending,
+		Interval:  device.DefaultPollInterval,
+		CreatedAt: now,
+		ExpiresAt: now.Add(device.DefaultDeviceCodeValidityWindow),
+	}
+	code, err := r.Create(dc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code == "" {
+		t.Fatalf("want device code, got none")
+	}
+
+	if _, err := r.Create(dc); err == nil {
+		t.Errorf("want error creating a device code with a user code in use")
+	}
+	if _, err := r.Get("bogus"); err != device.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", device.ErrorNotFound, err)
+	}
+	if _, err := r.GetByUserCode("BCDF-BCDF"); err != device.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", device.ErrorNotFound, err)
+	}
+
+	got, err := r.Get(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(dc, *got); diff != "" {
+		t.Errorf("Compare(want, got): %v", diff)
+	}
+
+	dc.State = device.DeviceCodeStateApproved
+	dc.SessionID = "session1"
+	dc.LastPolledAt = now
+	if err := r.Update(dc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err = r.GetByUserCode(dc.UserCode)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(dc, *got); diff != "" {
+		t.Errorf("Compare(want, got): %v", diff)
+	}
+	// Updating keeps the device code.
+	if _, err := r.Get(code); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := r.Delete(dc.UserCode); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Delete(dc.UserCode); err != device.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", device.ErrorNotFound, err)
+	}
+	if _, err := r.Get(code); err != device.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", device.ErrorNotFound, err)
+	}
+	if err := r.Update(dc); err != device.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", device.ErrorNotFound, err)
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/grant"
+)
+
+func TestGrantRepoGetNoExist(t *testing.T) {
+	r := db.NewGrantRepo(connect(t))
+
+	if _, err := r.Get("user1", "client1"); err != grant.ErrorNotFound {
+		t.Fatalf("want err=%v, got=%v", grant.ErrorNotFound, err)
+	}
+	if err := r.Delete("user1", "client1"); err != grant.ErrorNotFound {
+		t.Fatalf("want err=%v, got=%v", grant.ErrorNotFound, err)
+	}
+}
+
+func TestGrantRepoSetGet(t *testing.T) {
+	r := db.NewGrantRepo(connect(t))
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+
+	grants := []grant.Grant{
+		{
+			UserID:    "user1",
+			ClientID:  "client1",
+			Scope:     []string{"openid", "offline_access"},
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			// Replaces the previous grant.
+			UserID:    "user1",
+			ClientID:  "client1",
+			Scope:     []string{"openid", "offline_access", "groups"},
+			CreatedAt: now,
+			UpdatedAt: now.Add(time.Minute),
+		},
+		{
+			UserID:    "user1",
+			ClientID:  "client2",
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	for i, g := range grants {
+		if err := r.Set(g); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		got, err := r.Get(g.UserID, g.ClientID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if diff := pretty.Compare(g, *got); diff != "" {
+			t.Errorf("case %d: Compare(want, got): %v", i, diff)
+		}
+	}
+
+	got, err := r.List("user1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(grants[1:], got); diff != "" {
+		t.Errorf("Compare(want, got): %v", diff)
+	}
+
+	if err := r.Delete("user1", "client1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Get("user1", "client1"); err != grant.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", grant.ErrorNotFound, err)
+	}
+	got, err = r.List("user2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want no grants for user2, got %d", len(got))
+	}
+}
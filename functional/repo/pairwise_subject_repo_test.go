@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/user"
+)
+
+func TestPairwiseSubjectRepoSetGet(t *testing.T) {
+	r := db.NewPairwiseSubjectRepo(connect(t))
+
+	if _, err := r.Get("client.example.com", "sub1"); err != user.ErrorNotFound {
+		t.Fatalf("want err=%v, got=%v", user.ErrorNotFound, err)
+	}
+
+	tests := []struct {
+		sector, sub, userID string
+	}{
+		{"client.example.com", "sub1", "user1"},
+		// Setting a subject again is a no-op.
+		{"client.example.com", "sub1", "user1"},
+		{"client.example.com", "sub2", "user2"},
+		{"other.example.com", "sub1", "user2"},
+	}
+	for i, tt := range tests {
+		if err := r.Set(tt.sector, tt.sub, tt.userID); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		got, err := r.Get(tt.sector, tt.sub)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if got != tt.userID {
+			t.Errorf("case %d: want userID=%q, got %q", i, tt.userID, got)
+		}
+	}
+
+	// A subject never identifies another user.
+	if err := r.Set("client.example.com", "sub1", "user2"); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
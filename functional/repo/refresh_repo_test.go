@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
 	"github.com/kylelemons/godebug/pretty"
 
 	"github.com/coreos/dex/client"
@@ -71,6 +74,11 @@ var (
 )
 
 func newRefreshRepo(t *testing.T, users []user.UserWithRemoteIdentities, clients []client.LoadableClient) refresh.RefreshTokenRepo {
+	r, _ := newRefreshRepoWithExpiry(t, users, clients, refresh.ExpiryPolicy{})
+	return r
+}
+
+func newRefreshRepoWithExpiry(t *testing.T, users []user.UserWithRemoteIdentities, clients []client.LoadableClient, expiry refresh.ExpiryPolicy) (refresh.RefreshTokenRepo, clockwork.FakeClock) {
 	dbMap := connect(t)
 	if _, err := db.NewUserRepoFromUsers(dbMap, users); err != nil {
 		t.Fatalf("Unable to add users: %v", err)
@@ -80,7 +88,8 @@ func newRefreshRepo(t *testing.T, users []user.UserWithRemoteIdentities, clients
 		t.Fatalf("Unable to add clients: %v", err)
 	}
 
-	return db.NewRefreshTokenRepo(dbMap)
+	clock := clockwork.NewFakeClock()
+	return db.NewRefreshTokenRepoWithExpiry(dbMap, expiry, clock), clock
 }
 
 func TestRefreshTokenRepoCreateVerify(t *testing.T) {
@@ -106,7 +115,7 @@ func TestRefreshTokenRepoCreateVerify(t *testing.T) {
 
 	for i, tt := range tests {
 		repo := newRefreshRepo(t, testRefreshUsers, testRefreshClients)
-		tok, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, tt.createScopes)
+		tok, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, tt.createScopes, nil)
 		if err != nil {
 			t.Fatalf("case %d: failed to create refresh token: %v", i, err)
 		}
@@ -136,6 +145,233 @@ func TestRefreshTokenRepoCreateVerify(t *testing.T) {
 	}
 }
 
+func TestRefreshTokenRepoGet(t *testing.T) {
+	repo, clock := newRefreshRepoWithExpiry(t, testRefreshUsers, testRefreshClients, refresh.ExpiryPolicy{Lifetime: time.Hour})
+	now := clock.Now().UTC()
+	tok, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, []string{"openid", "profile"}, []string{"https://orders.example.com"})
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	got, err := repo.Get(tok)
+	if err != nil {
+		t.Fatalf("failed to get refresh token: %v", err)
+	}
+	want := &refresh.RefreshToken{
+		UserID:      testRefreshUserID,
+		ClientID:    testRefreshClientID,
+		ConnectorID: testRefreshConnectorID,
+		Scope:       []string{"openid", "profile"},
+		Resources:   []string{"https://orders.example.com"},
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("Compare(want, got): %v", diff)
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := repo.Get(tok); err != refresh.ErrorInvalidToken {
+		t.Errorf("want %v for expired token, got %v", refresh.ErrorInvalidToken, err)
+	}
+
+	id := strings.SplitN(tok, refresh.TokenDelimer, 2)[0]
+	if _, err := repo.Get(buildRefreshToken(mustParseInt(t, id), []byte("wrong-payload"))); err != refresh.ErrorInvalidToken {
+		t.Errorf("want %v for wrong payload, got %v", refresh.ErrorInvalidToken, err)
+	}
+}
+
+func TestRefreshTokenRepoExpiry(t *testing.T) {
+	clients := []client.LoadableClient{
+		testRefreshClients[0],
+		{
+			Client: client.Client{
+				Credentials:             testRefreshClients[1].Client.Credentials,
+				Metadata:                testRefreshClients[1].Client.Metadata,
+				RefreshTokenIdleTimeout: 2 * time.Hour,
+			},
+		},
+	}
+
+	tests := []struct {
+		expiry   refresh.ExpiryPolicy
+		clientID string
+
+		// The token is used after each step, and is still valid after
+		// the last one if wantValid.
+		steps     []time.Duration
+		wantValid bool
+	}{
+		{
+			expiry:    refresh.ExpiryPolicy{},
+			clientID:  testRefreshClientID,
+			steps:     []time.Duration{24 * time.Hour * 365},
+			wantValid: true,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour},
+			clientID:  testRefreshClientID,
+			steps:     []time.Duration{59 * time.Minute, 59 * time.Minute, 59 * time.Minute},
+			wantValid: true,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour},
+			clientID:  testRefreshClientID,
+			steps:     []time.Duration{59 * time.Minute, time.Hour},
+			wantValid: false,
+		},
+		{
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour, Lifetime: 2 * time.Hour},
+			clientID:  testRefreshClientID,
+			steps:     []time.Duration{59 * time.Minute, 59 * time.Minute, 2 * time.Minute},
+			wantValid: false,
+		},
+		{
+			// The client's idle timeout overrides the repo's.
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour},
+			clientID:  testRefreshClientID2,
+			steps:     []time.Duration{90 * time.Minute},
+			wantValid: true,
+		},
+		{
+			// The repo's lifetime still applies to the client.
+			expiry:    refresh.ExpiryPolicy{IdleTimeout: time.Hour, Lifetime: 2 * time.Hour},
+			clientID:  testRefreshClientID2,
+			steps:     []time.Duration{90 * time.Minute, 90 * time.Minute},
+			wantValid: false,
+		},
+	}
+
+	for i, tt := range tests {
+		repo, clock := newRefreshRepoWithExpiry(t, testRefreshUsers, clients, tt.expiry)
+		tok, err := repo.Create(testRefreshUserID, tt.clientID, testRefreshConnectorID, []string{"openid"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed to create refresh token: %v", i, err)
+		}
+
+		for j, step := range tt.steps {
+			clock.Advance(step)
+			_, _, _, err = repo.Verify(tt.clientID, tok)
+			if j < len(tt.steps)-1 && err != nil {
+				t.Fatalf("case %d: step %d: unexpected error: %v", i, j, err)
+			}
+		}
+		if tt.wantValid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !tt.wantValid && err != refresh.ErrorInvalidToken {
+			t.Errorf("case %d: want %v, got %v", i, refresh.ErrorInvalidToken, err)
+		}
+	}
+}
+
+func TestRefreshTokenRepoRenewKeepsLifetime(t *testing.T) {
+	repo, clock := newRefreshRepoWithExpiry(t, testRefreshUsers, testRefreshClients, refresh.ExpiryPolicy{Lifetime: time.Hour})
+	createdAt := clock.Now().UTC()
+	resources := []string{"https://orders.example.com"}
+
+	tok, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, []string{"openid"}, resources)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+	clock.Advance(30 * time.Minute)
+	tok, err = repo.RenewRefreshToken(testRefreshClientID, testRefreshUserID, tok)
+	if err != nil {
+		t.Fatalf("failed to renew refresh token: %v", err)
+	}
+
+	got, err := repo.Get(tok)
+	if err != nil {
+		t.Fatalf("failed to get refresh token: %v", err)
+	}
+	if !got.CreatedAt.Equal(createdAt) {
+		t.Errorf("want CreatedAt=%v, got %v", createdAt, got.CreatedAt)
+	}
+	if want := createdAt.Add(time.Hour); !got.ExpiresAt.Equal(want) {
+		t.Errorf("want ExpiresAt=%v, got %v", want, got.ExpiresAt)
+	}
+	if diff := pretty.Compare(resources, got.Resources); diff != "" {
+		t.Errorf("Compare(wantResources, gotResources): %v", diff)
+	}
+}
+
+func TestRefreshTokenRepoReuse(t *testing.T) {
+	tests := []struct {
+		// present is called with the tokens of a grant, oldest first, after
+		// the first one was renewed twice.
+		present func(r refresh.RefreshTokenRepo, toks []string) error
+		wantErr error
+	}{
+		{
+			present: func(r refresh.RefreshTokenRepo, toks []string) error {
+				_, _, _, err := r.Verify(testRefreshClientID, toks[0])
+				return err
+			},
+			wantErr: refresh.ErrorTokenReused,
+		},
+		{
+			present: func(r refresh.RefreshTokenRepo, toks []string) error {
+				_, err := r.RenewRefreshToken(testRefreshClientID, testRefreshUserID, toks[1])
+				return err
+			},
+			wantErr: refresh.ErrorTokenReused,
+		},
+		{
+			present: func(r refresh.RefreshTokenRepo, toks []string) error {
+				return r.Revoke(testRefreshUserID, toks[2])
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newRefreshRepo(t, testRefreshUsers, testRefreshClients)
+		tok, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, []string{"openid"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed to create refresh token: %v", i, err)
+		}
+		// Another grant, which must be left alone.
+		other, err := repo.Create(testRefreshUserID, testRefreshClientID, testRefreshConnectorID, []string{"openid"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed to create refresh token: %v", i, err)
+		}
+
+		toks := []string{tok}
+		for j := 0; j < 2; j++ {
+			tok, err = repo.RenewRefreshToken(testRefreshClientID, testRefreshUserID, tok)
+			if err != nil {
+				t.Fatalf("case %d: failed to renew refresh token: %v", i, err)
+			}
+			toks = append(toks, tok)
+		}
+
+		if err := tt.present(repo, toks); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+		}
+
+		// The grant is revoked.
+		for j, tok := range toks {
+			if _, err := repo.Get(tok); err != refresh.ErrorInvalidToken {
+				t.Errorf("case %d: token %d: want %v, got %v", i, j, refresh.ErrorInvalidToken, err)
+			}
+		}
+		if _, _, _, err := repo.Verify(testRefreshClientID, toks[len(toks)-1]); err != refresh.ErrorInvalidToken {
+			t.Errorf("case %d: want %v, got %v", i, refresh.ErrorInvalidToken, err)
+		}
+		if _, _, _, err := repo.Verify(testRefreshClientID, other); err != nil {
+			t.Errorf("case %d: unexpected error verifying other grant: %v", i, err)
+		}
+	}
+}
+
+func mustParseInt(t *testing.T, s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return n
+}
+
 // buildRefreshToken combines the token ID and token payload to create a new token.
 // used in the tests to created a refresh token.
 func buildRefreshToken(tokenID int64, tokenPayload []byte) string {
@@ -145,7 +381,7 @@ func buildRefreshToken(tokenID int64, tokenPayload []byte) string {
 func TestRefreshRepoVerifyInvalidTokens(t *testing.T) {
 	r := db.NewRefreshTokenRepo(connect(t))
 
-	token, err := r.Create("user-foo", "client-foo", testRefreshConnectorID, oidc.DefaultScope)
+	token, err := r.Create("user-foo", "client-foo", testRefreshConnectorID, oidc.DefaultScope, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -239,7 +475,7 @@ func TestRefreshTokenRepoClientsWithRefreshTokens(t *testing.T) {
 		repo := newRefreshRepo(t, testRefreshUsers, testRefreshClients)
 
 		for _, clientID := range tt.clientIDs {
-			_, err := repo.Create(testRefreshUserID, clientID, testRefreshConnectorID, []string{"openid"})
+			_, err := repo.Create(testRefreshUserID, clientID, testRefreshConnectorID, []string{"openid"}, nil)
 			if err != nil {
 				t.Fatalf("case %d: client_id: %s couldn't create refresh token: %v", i, clientID, err)
 			}
@@ -288,7 +524,7 @@ func TestRefreshTokenRepoRevokeForClient(t *testing.T) {
 		repo := newRefreshRepo(t, testRefreshUsers, testRefreshClients)
 
 		for _, clientID := range tt.createIDs {
-			_, err := repo.Create(testRefreshUserID, clientID, testRefreshConnectorID, []string{"openid"})
+			_, err := repo.Create(testRefreshUserID, clientID, testRefreshConnectorID, []string{"openid"}, nil)
 			if err != nil {
 				t.Fatalf("case %d: client_id: %s couldn't create refresh token: %v", i, clientID, err)
 			}
@@ -325,7 +561,7 @@ func TestRefreshTokenRepoRevokeForClient(t *testing.T) {
 func TestRefreshRepoRevoke(t *testing.T) {
 	r := db.NewRefreshTokenRepo(connect(t))
 
-	token, err := r.Create("user-foo", "client-foo", testRefreshConnectorID, oidc.DefaultScope)
+	token, err := r.Create("user-foo", "client-foo", testRefreshConnectorID, oidc.DefaultScope, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -1,15 +1,18 @@
 package repo
 
 import (
+	"net/url"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/coreos/go-oidc/oidc"
 	"github.com/jonboulle/clockwork"
 	"github.com/kylelemons/godebug/pretty"
 
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
 )
 
 func newSessionRepo(t *testing.T) (session.SessionRepo, clockwork.FakeClock) {
@@ -21,6 +24,24 @@ func newSessionRepo(t *testing.T) (session.SessionRepo, clockwork.FakeClock) {
 	return db.NewSessionRepoWithClock(dbMap, clock), clock
 }
 
+func newBrowserSessionRepo(t *testing.T) (session.BrowserSessionRepo, clockwork.FakeClock) {
+	clock := clockwork.NewFakeClock()
+	if os.Getenv("DEX_TEST_DSN") == "" {
+		return db.NewBrowserSessionRepoWithClock(db.NewMemDB(), clock), clock
+	}
+	dbMap := connect(t)
+	return db.NewBrowserSessionRepoWithClock(dbMap, clock), clock
+}
+
+func newPushedAuthRequestRepo(t *testing.T) (session.PushedAuthRequestRepo, clockwork.FakeClock) {
+	clock := clockwork.NewFakeClock()
+	if os.Getenv("DEX_TEST_DSN") == "" {
+		return db.NewPushedAuthRequestRepoWithClock(db.NewMemDB(), clock), clock
+	}
+	dbMap := connect(t)
+	return db.NewPushedAuthRequestRepoWithClock(dbMap, clock), clock
+}
+
 func newSessionKeyRepo(t *testing.T) (session.SessionKeyRepo, clockwork.FakeClock) {
 	clock := clockwork.NewFakeClock()
 	if os.Getenv("DEX_TEST_DSN") == "" {
@@ -111,6 +132,48 @@ func TestSessionRepoCreateGet(t *testing.T) {
 			Nonce:       "oncenay",
 			Groups:      []string{"group1", "group2"},
 		},
+		session.Session{
+			ID:               "withBrowserSession",
+			ClientState:      "blargh",
+			ExpiresAt:        time.Unix(789, 0).UTC(),
+			BrowserSessionID: "bs-1",
+			AuthTime:         time.Unix(456, 0).UTC(),
+		},
+		session.Session{
+			ID:          "withACR",
+			ClientState: "blargh",
+			ExpiresAt:   time.Unix(789, 0).UTC(),
+			AMR:         []string{"pwd", "otp"},
+			ACR:         "urn:example:gold",
+			ACRValues:   []string{"2", "1"},
+		},
+		session.Session{
+			ID:          "withClaimsRequest",
+			ClientState: "blargh",
+			ExpiresAt:   time.Unix(789, 0).UTC(),
+			ClaimsRequest: session.ClaimsRequest{
+				IDToken: session.ClaimRequests{
+					"acr": &session.ClaimRequest{Essential: true, Values: []interface{}{"2"}},
+				},
+				UserInfo: session.ClaimRequests{"groups": nil},
+			},
+		},
+		session.Session{
+			ID:          "withProfile",
+			ClientState: "blargh",
+			ExpiresAt:   time.Unix(789, 0).UTC(),
+			Profile: user.Profile{
+				GivenName:         "Elroy",
+				PreferredUsername: "elroy",
+				Locale:            "en-US",
+			},
+		},
+		session.Session{
+			ID:          "withResources",
+			ClientState: "blargh",
+			ExpiresAt:   time.Unix(789, 0).UTC(),
+			Resources:   []string{"https://orders.example.com", "https://billing.example.com"},
+		},
 	}
 
 	for i, tt := range tests {
@@ -178,3 +241,118 @@ func TestSessionRepoUpdateNoExist(t *testing.T) {
 		t.Fatalf("Expected non-nil error")
 	}
 }
+
+func TestBrowserSessionRepo(t *testing.T) {
+	r, clock := newBrowserSessionRepo(t)
+	now := clock.Now().UTC()
+
+	bs := session.BrowserSession{
+		ID:        "bs-1",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := r.Create(bs); err != nil {
+		t.Fatalf("unexpected error creating browser session: %v", err)
+	}
+	got, err := r.Get(bs.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting browser session: %v", err)
+	}
+	if diff := pretty.Compare(bs, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	bs.UserID = "ID-1"
+	bs.ConnectorID = "IDPC-1"
+	bs.Identity = oidc.Identity{ID: "RID-1", Email: "Email-1@example.com"}
+	bs.AuthTime = now
+	bs.AMR = []string{"pwd", "otp"}
+	bs.ACR = "urn:example:gold"
+	bs.ExpiresAt = now.Add(24 * time.Hour)
+	if err := r.Update(bs); err != nil {
+		t.Fatalf("unexpected error updating browser session: %v", err)
+	}
+	got, err = r.Get(bs.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting browser session: %v", err)
+	}
+	if diff := pretty.Compare(bs, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := r.Update(session.BrowserSession{ID: "bs-2"}); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want updating unknown browser session to fail, got err=%v", err)
+	}
+
+	clock.Advance(25 * time.Hour)
+	if _, err := r.Get(bs.ID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want expired browser session not found, got err=%v", err)
+	}
+}
+
+func TestBrowserSessionRepoDelete(t *testing.T) {
+	r, clock := newBrowserSessionRepo(t)
+	now := clock.Now().UTC()
+
+	bs := session.BrowserSession{
+		ID:        "bs-1",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := r.Create(bs); err != nil {
+		t.Fatalf("unexpected error creating browser session: %v", err)
+	}
+	if err := r.Delete(bs.ID); err != nil {
+		t.Fatalf("unexpected error deleting browser session: %v", err)
+	}
+	if _, err := r.Get(bs.ID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want deleted browser session not found, got err=%v", err)
+	}
+}
+
+func TestPushedAuthRequestRepo(t *testing.T) {
+	r, clock := newPushedAuthRequestRepo(t)
+	now := clock.Now().UTC()
+
+	par := session.PushedAuthRequest{
+		ID:       "par-1",
+		ClientID: "client-1",
+		Params: url.Values{
+			"client_id":     {"client-1"},
+			"response_type": {"code"},
+			"scope":         {"openid email"},
+			"redirect_uri":  {"https://client.example.com/callback?a=b&c=d"},
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(5 * time.Minute),
+	}
+	if err := r.Create(par); err != nil {
+		t.Fatalf("unexpected error creating pushed authorization request: %v", err)
+	}
+	got, err := r.Get(par.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting pushed authorization request: %v", err)
+	}
+	if diff := pretty.Compare(par, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if _, err := r.Get("par-2"); err != session.ErrorPushedAuthRequestNotFound {
+		t.Errorf("want unknown pushed authorization request not found, got err=%v", err)
+	}
+	if err := r.Delete("par-2"); err != session.ErrorPushedAuthRequestNotFound {
+		t.Errorf("want deleting unknown pushed authorization request not found, got err=%v", err)
+	}
+
+	clock.Advance(6 * time.Minute)
+	if _, err := r.Get(par.ID); err != session.ErrorPushedAuthRequestNotFound {
+		t.Errorf("want expired pushed authorization request not found, got err=%v", err)
+	}
+
+	if err := r.Delete(par.ID); err != nil {
+		t.Fatalf("unexpected error deleting pushed authorization request: %v", err)
+	}
+	if err := r.Delete(par.ID); err != session.ErrorPushedAuthRequestNotFound {
+		t.Errorf("want deleted pushed authorization request not found, got err=%v", err)
+	}
+}
@@ -178,6 +178,21 @@ func TestUpdateUser(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			// Update the profile.
+			user: user.User{
+				ID:    "ID-1",
+				Email: "Email-1@example.com",
+				Profile: user.Profile{
+					GivenName:         "Elroy",
+					FamilyName:        "Jetson",
+					PreferredUsername: "elroy",
+					Picture:           "https://example.com/elroy.png",
+					Locale:            "en-US",
+				},
+			},
+			err: nil,
+		},
 		{
 			// No email.
 			user: user.User{
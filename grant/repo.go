@@ -0,0 +1,52 @@
+package grant
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/dex/scope"
+)
+
+var (
+	ErrorNotFound = errors.New("grant not found")
+)
+
+// Grant records the scopes a user has approved for a client on the consent
+// page.
+type Grant struct {
+	UserID   string
+	ClientID string
+
+	// Scope holds every scope the user has approved for the client.
+	Scope scope.Scopes
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Includes reports whether all of the scopes have been approved.
+func (g Grant) Includes(scopes []string) bool {
+	for _, s := range scopes {
+		if !g.Scope.HasScope(s) {
+			return false
+		}
+	}
+	return true
+}
+
+type GrantRepo interface {
+	// Get returns the grant of the user to the client, or ErrorNotFound if
+	// the user has not approved any scope for it.
+	Get(userID, clientID string) (*Grant, error)
+
+	// Set stores the grant, replacing any previous grant of the user to the
+	// client.
+	Set(g Grant) error
+
+	// List returns the grants of the user.
+	List(userID string) ([]Grant, error)
+
+	// Delete removes the grant of the user to the client. It returns
+	// ErrorNotFound if there is none.
+	Delete(userID, clientID string) error
+}
@@ -123,7 +123,7 @@ func makeAdminAPITestFixtures() *adminAPITestFixtures {
 	f.ur = ur
 	f.pwr = pwr
 	f.adAPI = admin.NewAdminAPI(ur, pwr, cr, ccr, um, cm, "local")
-	f.adSrv = server.NewAdminServer(f.adAPI, nil, adminAPITestSecret)
+	f.adSrv = server.NewAdminServer(f.adAPI, nil, nil, adminAPITestSecret)
 	f.hSrv = httptest.NewServer(f.adSrv.HTTPHandler())
 	f.hc = &http.Client{
 		Transport: &adminAPITransport{
@@ -483,6 +483,20 @@ func TestCreateClient(t *testing.T) {
 	adminClientBadSecret := adminClientGood
 	adminClientBadSecret.Secret = "not_base64_encoded"
 
+	adminClientClaimMappings := adminClientGood
+	adminClientClaimMappings.ClaimMappings = []*adminschema.ClaimMapping{
+		{Claim: "username", Template: "{{localpart .email}}"},
+	}
+	clientGoodClaimMappings := clientGood
+	clientGoodClaimMappings.ClaimMappings = []client.ClaimMapping{
+		{Claim: "username", Template: "{{localpart .email}}"},
+	}
+
+	adminClientBadClaimMappings := adminClientGood
+	adminClientBadClaimMappings.ClaimMappings = []*adminschema.ClaimMapping{
+		{Claim: "sub", From: "email"},
+	}
+
 	tests := []struct {
 		req              adminschema.ClientCreateRequest
 		want             adminschema.ClientCreateResponse
@@ -587,6 +601,19 @@ func TestCreateClient(t *testing.T) {
 				Client: &adminClientBadSecret,
 			},
 			wantError: http.StatusBadRequest,
+		}, {
+			req: adminschema.ClientCreateRequest{
+				Client: &adminClientClaimMappings,
+			},
+			want: adminschema.ClientCreateResponse{
+				Client: addIDAndSecret(adminClientClaimMappings),
+			},
+			wantClient: clientGoodClaimMappings,
+		}, {
+			req: adminschema.ClientCreateRequest{
+				Client: &adminClientBadClaimMappings,
+			},
+			wantError: http.StatusBadRequest,
 		}, {
 			// Client ID already exists
 			req: adminschema.ClientCreateRequest{
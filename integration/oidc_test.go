@@ -14,12 +14,14 @@ import (
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/refresh/refreshtest"
 	"github.com/coreos/dex/server"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
 )
@@ -49,6 +51,17 @@ func mockServer(cis []client.LoadableClient) (*server.Server, error) {
 		ClientRepo:     clientRepo,
 		ClientManager:  clientManager,
 		SessionManager: sm,
+
+		AccessTokenRepo:           db.NewAccessTokenRepo(dbMap),
+		AccessTokenValidityWindow: accesstoken.DefaultAccessTokenValidityWindow,
+
+		BrowserSessionRepo:           db.NewBrowserSessionRepo(dbMap),
+		PushedAuthRequestRepo:        db.NewPushedAuthRequestRepo(dbMap),
+		ClientAssertionRepo:          db.NewClientAssertionRepo(dbMap),
+		GrantRepo:                    db.NewGrantRepo(dbMap),
+		PairwiseSubjectRepo:          db.NewPairwiseSubjectRepo(dbMap),
+		DeviceCodeRepo:               db.NewDeviceCodeRepo(dbMap),
+		BrowserSessionValidityWindow: session.DefaultBrowserSessionValidityWindow,
 	}
 
 	return srv, nil
@@ -194,6 +207,17 @@ func TestHTTPExchangeTokenRefreshToken(t *testing.T) {
 		UserRepo:         userRepo,
 		PasswordInfoRepo: passwordInfoRepo,
 		RefreshTokenRepo: refreshTokenRepo,
+		AccessTokenRepo:  db.NewAccessTokenRepo(dbMap),
+
+		AccessTokenValidityWindow: accesstoken.DefaultAccessTokenValidityWindow,
+
+		BrowserSessionRepo:           db.NewBrowserSessionRepo(dbMap),
+		PushedAuthRequestRepo:        db.NewPushedAuthRequestRepo(dbMap),
+		ClientAssertionRepo:          db.NewClientAssertionRepo(dbMap),
+		GrantRepo:                    db.NewGrantRepo(dbMap),
+		PairwiseSubjectRepo:          db.NewPairwiseSubjectRepo(dbMap),
+		DeviceCodeRepo:               db.NewDeviceCodeRepo(dbMap),
+		BrowserSessionValidityWindow: session.DefaultBrowserSessionValidityWindow,
 	}
 
 	if err = srv.AddConnector(cfg); err != nil {
@@ -148,14 +148,15 @@ func makeUserAPITestFixtures(clientCredsFlag bool) *userAPITestFixtures {
 		return []key.PublicKey{*key.NewPublicKey(testPrivKey.JWK())}
 	}
 
-	jwtvFactory := func(clientID string) oidc.JWTVerifier {
-		return oidc.NewJWTVerifier(testIssuerURL.String(), clientID, noop, keysFunc)
+	jwtvFactory := func(clientID string) server.JWTVerifier {
+		v := oidc.NewJWTVerifier(testIssuerURL.String(), clientID, noop, keysFunc)
+		return &v
 	}
 
 	refreshRepo := db.NewRefreshTokenRepo(dbMap)
 	for _, user := range userUsers {
 		if _, err := refreshRepo.Create(user.User.ID, testClientID,
-			"", append([]string{"offline_access"}, oidc.DefaultScope...)); err != nil {
+			"", append([]string{"offline_access"}, oidc.DefaultScope...), nil); err != nil {
 			panic("Failed to create refresh token: " + err.Error())
 		}
 	}
@@ -163,8 +164,8 @@ func makeUserAPITestFixtures(clientCredsFlag bool) *userAPITestFixtures {
 	f.emailer = &testEmailer{}
 	um.Clock = clock
 
-	api := api.NewUsersAPI(um, clientManager, refreshRepo, f.emailer, "local", clientCredsFlag)
-	usrSrv := server.NewUserMgmtServer(api, jwtvFactory, um, clientManager, clientCredsFlag)
+	api := api.NewUsersAPI(um, clientManager, refreshRepo, db.NewAccessTokenRepo(dbMap), db.NewGrantRepo(dbMap), f.emailer, "local", clientCredsFlag)
+	usrSrv := server.NewUserMgmtServer(api, jwtvFactory, server.NewSubjectResolver(clientManager, db.NewPairwiseSubjectRepo(dbMap)), um, clientManager, clientCredsFlag)
 	f.hSrv = httptest.NewServer(usrSrv.HTTPHandler())
 
 	f.trans = &tokenHandlerTransport{
@@ -0,0 +1,263 @@
+// Package jwe encrypts JWTs for their recipients with RSA keys, using the
+// JWE Compact Serialization (RFC 7516).
+package jwe
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1" // for RSA-OAEP
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/coreos/go-oidc/jose"
+)
+
+// Algs are the supported key management algorithms.
+var Algs = []string{jose.AlgRSAOAEP, jose.AlgRSAOAEP256}
+
+// Encs are the supported content encryption algorithms.
+var Encs = []string{jose.EncA128CBCHS256, jose.EncA256CBCHS512, jose.EncA128GCM, jose.EncA256GCM}
+
+// Header is the protected header of a JWE.
+type Header struct {
+	Alg         string `json:"alg"`
+	Enc         string `json:"enc"`
+	KeyID       string `json:"kid,omitempty"`
+	ContentType string `json:"cty,omitempty"`
+}
+
+// Encrypt encrypts the plaintext for the holder of the private key of pub,
+// and returns the JWE in its compact serialization. Callers encrypting a signed
+// JWT set the header's ContentType to "JWT" (RFC 7519 Section 5.2).
+func Encrypt(plaintext []byte, pub *rsa.PublicKey, h Header) (string, error) {
+	keySize, err := contentKeySize(h.Enc)
+	if err != nil {
+		return "", err
+	}
+	keyHash, err := oaepHash(h.Alg)
+	if err != nil {
+		return "", err
+	}
+
+	cek := make([]byte, keySize)
+	if _, err := rand.Read(cek); err != nil {
+		return "", err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(keyHash.New(), rand.Reader, pub, cek, nil)
+	if err != nil {
+		return "", err
+	}
+
+	hb, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	header := encode(hb)
+
+	// The additional authenticated data is the encoded protected header
+	// (RFC 7516 Section 5.1).
+	iv, ciphertext, tag, err := encryptContent(h.Enc, cek, plaintext, []byte(header))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		header,
+		encode(encryptedKey),
+		encode(iv),
+		encode(ciphertext),
+		encode(tag),
+	}, "."), nil
+}
+
+// Decrypt decrypts a JWE in its compact serialization with the private key,
+// and returns its header and plaintext.
+func Decrypt(token string, priv *rsa.PrivateKey) (*Header, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errors.New("malformed JWE")
+	}
+	var raw [5][]byte
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed JWE: %v", err)
+		}
+		raw[i] = b
+	}
+
+	var h Header
+	if err := json.Unmarshal(raw[0], &h); err != nil {
+		return nil, nil, fmt.Errorf("malformed JWE header: %v", err)
+	}
+	keySize, err := contentKeySize(h.Enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyHash, err := oaepHash(h.Alg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cek, err := rsa.DecryptOAEP(keyHash.New(), nil, priv, raw[1], nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cek) != keySize {
+		return nil, nil, errors.New("invalid content encryption key")
+	}
+
+	plaintext, err := decryptContent(h.Enc, cek, raw[2], raw[3], raw[4], []byte(parts[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &h, plaintext, nil
+}
+
+func oaepHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case jose.AlgRSAOAEP:
+		return crypto.SHA1, nil
+	case jose.AlgRSAOAEP256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("unsupported key management algorithm %q", alg)
+}
+
+func contentKeySize(enc string) (int, error) {
+	switch enc {
+	case jose.EncA128GCM:
+		return 16, nil
+	case jose.EncA256GCM, jose.EncA128CBCHS256:
+		return 32, nil
+	case jose.EncA256CBCHS512:
+		return 64, nil
+	}
+	return 0, fmt.Errorf("unsupported content encryption algorithm %q", enc)
+}
+
+func encryptContent(enc string, cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	if enc == jose.EncA128GCM || enc == jose.EncA256GCM {
+		aead, err := newGCM(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		sealed := aead.Seal(nil, iv, plaintext, aad)
+		n := len(sealed) - aead.Overhead()
+		return iv, sealed[:n], sealed[n:], nil
+	}
+
+	// AES-CBC with HMAC-SHA2 (RFC 7518 Section 5.2.2): the first half of the
+	// key authenticates, the second half encrypts.
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	ciphertext = pad(plaintext, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return iv, ciphertext, cbcTag(enc, macKey, aad, iv, ciphertext), nil
+}
+
+func decryptContent(enc string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if enc == jose.EncA128GCM || enc == jose.EncA256GCM {
+		aead, err := newGCM(cek)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, errors.New("invalid initialization vector")
+		}
+		return aead.Open(nil, iv, append(ciphertext, tag...), aad)
+	}
+
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	if subtle.ConstantTimeCompare(tag, cbcTag(enc, macKey, aad, iv, ciphertext)) != 1 {
+		return nil, errors.New("authentication tag does not match")
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed ciphertext")
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return unpad(plaintext, aes.BlockSize)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cbcTag computes the authentication tag of AES-CBC with HMAC-SHA2: the first
+// half of the HMAC of the AAD, IV, ciphertext and the bit length of the AAD.
+func cbcTag(enc string, macKey, aad, iv, ciphertext []byte) []byte {
+	var h func() hash.Hash = sha256.New
+	if enc == jose.EncA256CBCHS512 {
+		h = sha512.New
+	}
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+
+	mac := hmac.New(h, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	mac.Write(al)
+	sum := mac.Sum(nil)
+	return sum[:len(sum)/2]
+}
+
+// pad applies PKCS#7 padding.
+func pad(b []byte, size int) []byte {
+	n := size - len(b)%size
+	padded := make([]byte, len(b)+n)
+	copy(padded, b)
+	for i := len(b); i < len(padded); i++ {
+		padded[i] = byte(n)
+	}
+	return padded
+}
+
+func unpad(b []byte, size int) ([]byte, error) {
+	n := int(b[len(b)-1])
+	if n == 0 || n > size || n > len(b) {
+		return nil, errors.New("malformed padding")
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, errors.New("malformed padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,78 @@
+package jwe
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/jose"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	plaintext := []byte("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJlbHJveSJ9.c2ln")
+
+	for _, alg := range Algs {
+		for _, enc := range Encs {
+			h := Header{Alg: alg, Enc: enc, KeyID: "enc-key", ContentType: "JWT"}
+			token, err := Encrypt(plaintext, &priv.PublicKey, h)
+			if err != nil {
+				t.Errorf("%s/%s: unexpected error encrypting: %v", alg, enc, err)
+				continue
+			}
+			if n := len(strings.Split(token, ".")); n != 5 {
+				t.Errorf("%s/%s: want 5 parts, got %d", alg, enc, n)
+			}
+
+			gotHeader, got, err := Decrypt(token, priv)
+			if err != nil {
+				t.Errorf("%s/%s: unexpected error decrypting: %v", alg, enc, err)
+				continue
+			}
+			if *gotHeader != h {
+				t.Errorf("%s/%s: want header %#v, got %#v", alg, enc, h, *gotHeader)
+			}
+			if string(got) != string(plaintext) {
+				t.Errorf("%s/%s: want plaintext %q, got %q", alg, enc, plaintext, got)
+			}
+
+			// Tampering with the ciphertext or the header is detected.
+			parts := strings.Split(token, ".")
+			for _, i := range []int{0, 3} {
+				tampered := append([]string{}, parts...)
+				b := []byte(tampered[i])
+				if b[1] == 'A' {
+					b[1] = 'B'
+				} else {
+					b[1] = 'A'
+				}
+				tampered[i] = string(b)
+				if _, _, err := Decrypt(strings.Join(tampered, "."), priv); err == nil {
+					t.Errorf("%s/%s: tampered part %d decrypted", alg, enc, i)
+				}
+			}
+		}
+	}
+}
+
+func TestEncryptUnsupported(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	tests := []Header{
+		{Alg: jose.AlgRSA15, Enc: jose.EncA128GCM},
+		{Alg: jose.AlgRSAOAEP, Enc: jose.EncA192GCM},
+		{Alg: jose.AlgRSAOAEP},
+	}
+	for i, h := range tests {
+		if _, err := Encrypt([]byte("data"), &priv.PublicKey, h); err == nil {
+			t.Errorf("case %d: want error, got nil", i)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package refresh
 import (
 	"crypto/rand"
 	"errors"
+	"time"
 
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/scope"
@@ -11,6 +12,10 @@ import (
 const (
 	DefaultRefreshTokenPayloadLength = 64
 	TokenDelimer                     = "/"
+
+	// RetiredTokenRetention is how long renewed refresh tokens are kept to
+	// detect them being presented again.
+	RetiredTokenRetention = 30 * 24 * time.Hour
 )
 
 var (
@@ -18,6 +23,10 @@ var (
 	ErrorInvalidClientID = errors.New("invalid client ID")
 
 	ErrorInvalidToken = errors.New("invalid token")
+
+	// ErrorTokenReused is returned when a refresh token is presented after
+	// it was renewed, which suggests it was stolen.
+	ErrorTokenReused = errors.New("refresh token reused")
 )
 
 type RefreshTokenGenerator func() ([]byte, error)
@@ -39,22 +48,67 @@ func DefaultRefreshTokenGenerator() ([]byte, error) {
 	return b, nil
 }
 
+// ExpiryPolicy bounds how long refresh tokens stay valid. A zero duration
+// means no bound.
+type ExpiryPolicy struct {
+	// IdleTimeout is how long a refresh token may go unused before it
+	// expires.
+	IdleTimeout time.Duration
+
+	// Lifetime is how long a refresh token is valid after the user
+	// authorized the client, however often it is used or renewed.
+	Lifetime time.Duration
+}
+
+// RefreshToken holds what is stored with a refresh token.
+type RefreshToken struct {
+	UserID      string
+	ClientID    string
+	ConnectorID string
+	Scope       scope.Scopes
+
+	// Resources are the resource servers the client may get access tokens
+	// for with the refresh token.
+	Resources []string
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+
+	// ExpiresAt is when the token expires unless it is used again, or the
+	// zero time if it never expires.
+	ExpiresAt time.Time
+}
+
 type RefreshTokenRepo interface {
 	// Create generates and returns a new refresh token for the given client-user pair.
-	// The scopes will be stored with the refresh token, and used to verify
-	// against future OIDC refresh requests' scopes.
+	// The scopes and resources will be stored with the refresh token, and
+	// used to verify against future OIDC refresh requests' scopes and
+	// resources.
+	// The token expires according to the client's expiry policy, or the
+	// repo's if the client has none.
 	// On success the token will be returned.
-	Create(userID, clientID, connectorID string, scope []string) (string, error)
+	Create(userID, clientID, connectorID string, scope, resources []string) (string, error)
 
-	// Verify verifies that a token belongs to the client.
+	// Verify verifies that a token belongs to the client and has not expired,
+	// and records that it was used.
 	// It returns the user ID to which the token belongs, and the scopes stored
 	// with token.
+	// If the token was already renewed, every token of the grant is revoked
+	// and ErrorTokenReused is returned along with the user ID.
 	Verify(clientID, token string) (userID, connectorID string, scope scope.Scopes, err error)
 
-	// Revoke deletes the refresh token if the token belongs to the given userID.
+	// Get returns what is stored with the token, whichever client it belongs to.
+	// Expired tokens are reported as ErrorInvalidToken.
+	Get(token string) (*RefreshToken, error)
+
+	// Revoke deletes the refresh token, and those renewed from the same grant,
+	// if the token belongs to the given userID.
 	Revoke(userID, token string) error
 
-	// Revoke old refresh token and generates a new one
+	// Retire old refresh token and generates a new one of the same grant. The
+	// new token expires no later than the old one's lifetime. If the old
+	// token was already renewed, every token of the grant is revoked and
+	// ErrorTokenReused is returned.
 	RenewRefreshToken(clientID, userID, oldToken string) (newRefreshToken string, err error)
 
 	// RevokeTokensForClient revokes all tokens issued for the userID for the provided client.
@@ -3,6 +3,7 @@ package adminschema
 import (
 	"errors"
 	"net/url"
+	"time"
 
 	"github.com/coreos/dex/client"
 	"github.com/coreos/go-oidc/oidc"
@@ -13,6 +14,9 @@ var (
 	ErrorInvalidRedirectURI = errors.New("Invalid Redirect URI")
 	ErrorInvalidLogoURI     = errors.New("Invalid Logo URI")
 	ErrorInvalidClientURI   = errors.New("Invalid Client URI")
+
+	ErrorInvalidPostLogoutRedirectURI = errors.New("Invalid Post Logout Redirect URI")
+	ErrorInvalidRefreshTokenDuration  = errors.New("Invalid Refresh Token Lifetime or Idle Timeout")
 )
 
 func MapSchemaClientToClient(sc Client) (client.Client, error) {
@@ -57,6 +61,37 @@ func MapSchemaClientToClient(sc Client) (client.Client, error) {
 		c.Metadata.ClientURI = clientURI
 	}
 
+	for _, pu := range sc.PostLogoutRedirectURIs {
+		u, err := url.Parse(pu)
+		if err != nil || pu == "" {
+			return client.Client{}, ErrorInvalidPostLogoutRedirectURI
+		}
+		c.PostLogoutRedirectURIs = append(c.PostLogoutRedirectURIs, *u)
+	}
+
+	var err error
+	if c.RefreshTokenLifetime, err = parseDuration(sc.RefreshTokenLifetime); err != nil {
+		return client.Client{}, ErrorInvalidRefreshTokenDuration
+	}
+	if c.RefreshTokenIdleTimeout, err = parseDuration(sc.RefreshTokenIdleTimeout); err != nil {
+		return client.Client{}, ErrorInvalidRefreshTokenDuration
+	}
+	c.DisableRefreshTokenRotation = sc.DisableRefreshTokenRotation
+	c.PasswordGrantConnectorID = sc.PasswordGrantConnector
+	for _, m := range sc.ClaimMappings {
+		if m == nil {
+			continue
+		}
+		c.ClaimMappings = append(c.ClaimMappings, client.ClaimMapping{
+			Claim:    m.Claim,
+			From:     m.From,
+			Value:    m.Value,
+			Template: m.Template,
+			Filter:   m.Filter,
+			Prefix:   m.Prefix,
+		})
+	}
+
 	c.Admin = sc.IsAdmin
 	return c, nil
 }
@@ -81,5 +116,41 @@ func MapClientToSchemaClient(c client.Client) Client {
 	if c.Metadata.ClientURI != nil {
 		cl.ClientURI = c.Metadata.ClientURI.String()
 	}
+	for _, u := range c.PostLogoutRedirectURIs {
+		cl.PostLogoutRedirectURIs = append(cl.PostLogoutRedirectURIs, u.String())
+	}
+	if c.RefreshTokenLifetime != 0 {
+		cl.RefreshTokenLifetime = c.RefreshTokenLifetime.String()
+	}
+	if c.RefreshTokenIdleTimeout != 0 {
+		cl.RefreshTokenIdleTimeout = c.RefreshTokenIdleTimeout.String()
+	}
+	cl.DisableRefreshTokenRotation = c.DisableRefreshTokenRotation
+	cl.PasswordGrantConnector = c.PasswordGrantConnectorID
+	for _, m := range c.ClaimMappings {
+		cl.ClaimMappings = append(cl.ClaimMappings, &ClaimMapping{
+			Claim:    m.Claim,
+			From:     m.From,
+			Value:    m.Value,
+			Template: m.Template,
+			Filter:   m.Filter,
+			Prefix:   m.Prefix,
+		})
+	}
 	return cl
 }
+
+// parseDuration parses an optional, non-negative duration.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("duration must not be negative")
+	}
+	return d, nil
+}
@@ -3,6 +3,7 @@ package adminschema
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
@@ -27,6 +28,18 @@ func TestMapSchemaClientToClient(t *testing.T) {
 				ClientName: "Bill",
 				LogoURI:    "https://logo.example.com",
 				ClientURI:  "https://clientURI.example.com",
+				PostLogoutRedirectURIs: []string{
+					"https://client.example.com/logged-out",
+				},
+				RefreshTokenLifetime:    "720h0m0s",
+				RefreshTokenIdleTimeout: "168h0m0s",
+
+				DisableRefreshTokenRotation: true,
+				PasswordGrantConnector:      "local",
+				ClaimMappings: []*ClaimMapping{
+					{Claim: "username", Template: "{{localpart .email}}"},
+					{Claim: "groups", Filter: "^dev-", Prefix: "example:"},
+				},
 			},
 			want: client.Client{
 				Credentials: oidc.ClientCredentials{
@@ -42,6 +55,18 @@ func TestMapSchemaClientToClient(t *testing.T) {
 					LogoURI:    mustParseURL(t, "https://logo.example.com"),
 					ClientURI:  mustParseURL(t, "https://clientURI.example.com"),
 				},
+				PostLogoutRedirectURIs: []url.URL{
+					*mustParseURL(t, "https://client.example.com/logged-out"),
+				},
+				RefreshTokenLifetime:    720 * time.Hour,
+				RefreshTokenIdleTimeout: 168 * time.Hour,
+
+				DisableRefreshTokenRotation: true,
+				PasswordGrantConnectorID:    "local",
+				ClaimMappings: []client.ClaimMapping{
+					{Claim: "username", Template: "{{localpart .email}}"},
+					{Claim: "groups", Filter: "^dev-", Prefix: "example:"},
+				},
 			},
 		}, {
 			sc: Client{
@@ -69,6 +94,38 @@ func TestMapSchemaClientToClient(t *testing.T) {
 				},
 			},
 			wantErr: true,
+		}, {
+			sc: Client{
+				Id:     "123",
+				Secret: "sec_123",
+				RedirectURIs: []string{
+					"https://client.example.com",
+				},
+				PostLogoutRedirectURIs: []string{
+					"",
+				},
+			},
+			wantErr: true,
+		}, {
+			sc: Client{
+				Id:     "123",
+				Secret: "sec_123",
+				RedirectURIs: []string{
+					"https://client.example.com",
+				},
+				RefreshTokenLifetime: "a month",
+			},
+			wantErr: true,
+		}, {
+			sc: Client{
+				Id:     "123",
+				Secret: "sec_123",
+				RedirectURIs: []string{
+					"https://client.example.com",
+				},
+				RefreshTokenIdleTimeout: "-1h",
+			},
+			wantErr: true,
 		},
 	}
 
@@ -108,6 +165,18 @@ func TestMapClientToClientSchema(t *testing.T) {
 				ClientName: "Bill",
 				LogoURI:    "https://logo.example.com",
 				ClientURI:  "https://clientURI.example.com",
+				PostLogoutRedirectURIs: []string{
+					"https://client.example.com/logged-out",
+				},
+				RefreshTokenLifetime:    "720h0m0s",
+				RefreshTokenIdleTimeout: "168h0m0s",
+
+				DisableRefreshTokenRotation: true,
+				PasswordGrantConnector:      "local",
+				ClaimMappings: []*ClaimMapping{
+					{Claim: "username", Template: "{{localpart .email}}"},
+					{Claim: "groups", Filter: "^dev-", Prefix: "example:"},
+				},
 			},
 			c: client.Client{
 				Credentials: oidc.ClientCredentials{
@@ -123,6 +192,18 @@ func TestMapClientToClientSchema(t *testing.T) {
 					LogoURI:    mustParseURL(t, "https://logo.example.com"),
 					ClientURI:  mustParseURL(t, "https://clientURI.example.com"),
 				},
+				PostLogoutRedirectURIs: []url.URL{
+					*mustParseURL(t, "https://client.example.com/logged-out"),
+				},
+				RefreshTokenLifetime:    720 * time.Hour,
+				RefreshTokenIdleTimeout: 168 * time.Hour,
+
+				DisableRefreshTokenRotation: true,
+				PasswordGrantConnectorID:    "local",
+				ClaimMappings: []client.ClaimMapping{
+					{Claim: "username", Template: "{{localpart .email}}"},
+					{Claim: "groups", Filter: "^dev-", Prefix: "example:"},
+				},
 			},
 		},
 		{
@@ -109,7 +109,35 @@ type Admin struct {
 	Password string `json:"password,omitempty"`
 }
 
+type ClaimMapping struct {
+	// Claim: The claim the mapping sets.
+	Claim string `json:"claim,omitempty"`
+
+	// Filter: OPTIONAL. A regular expression; only the values of a list of
+	// strings which match it are kept.
+	Filter string `json:"filter,omitempty"`
+
+	// From: OPTIONAL. Renames the claim from to claim.
+	From string `json:"from,omitempty"`
+
+	// Prefix: OPTIONAL. Prepended to a string, or to each value of a list
+	// of strings.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Template: OPTIONAL. Sets the claim to the output of a text/template
+	// executed with the other claims.
+	Template string `json:"template,omitempty"`
+
+	// Value: OPTIONAL. Sets the claim to a constant.
+	Value interface{} `json:"value,omitempty"`
+}
+
 type Client struct {
+	// ClaimMappings: OPTIONAL. Mappings which reshape the claims of the
+	// client's ID tokens and UserInfo responses. For documentation see
+	// Documentation/clients.md.
+	ClaimMappings []*ClaimMapping `json:"claimMappings,omitempty"`
+
 	// ClientName: OPTIONAL for normal cliens. Name of the Client to be
 	// presented to the End-User. If desired, representation of this Claim
 	// in different languages and scripts is represented as described in
@@ -125,6 +153,10 @@ type Client struct {
 	// Languages and Scripts ) .
 	ClientURI string `json:"clientURI,omitempty"`
 
+	// DisableRefreshTokenRotation: OPTIONAL. If true, refreshing keeps the
+	// client's refresh token instead of replacing it with a new one.
+	DisableRefreshTokenRotation bool `json:"disableRefreshTokenRotation,omitempty"`
+
 	// Id: The client ID. If specified in a client create request, it will
 	// be used as the ID. Otherwise, the server will choose the ID.
 	Id string `json:"id,omitempty"`
@@ -139,6 +171,16 @@ type Client struct {
 	// Section 2.1 ( Metadata Languages and Scripts ) .
 	LogoURI string `json:"logoURI,omitempty"`
 
+	// PasswordGrantConnector: OPTIONAL. The ID of the connector the client
+	// may log users in with using the resource owner password credentials
+	// grant. The grant is disabled for the client if unset.
+	PasswordGrantConnector string `json:"passwordGrantConnector,omitempty"`
+
+	// PostLogoutRedirectURIs: OPTIONAL. Array of URLs supplied by the
+	// Client to which it MAY request that the End-User's User Agent be
+	// redirected after a logout has been performed.
+	PostLogoutRedirectURIs []string `json:"postLogoutRedirectURIs,omitempty"`
+
 	// Public: OPTIONAL. Determines if the client is public. Public clients
 	// have certain restrictions: They cannot use their credentials to
 	// obtain a client JWT. Their redirects URLs cannot be specified: they
@@ -155,6 +197,16 @@ type Client struct {
 	// clients.
 	RedirectURIs []string `json:"redirectURIs,omitempty"`
 
+	// RefreshTokenIdleTimeout: OPTIONAL. How long the client's refresh
+	// tokens are valid without being used, as a duration such as "168h".
+	// Overrides the server's default.
+	RefreshTokenIdleTimeout string `json:"refreshTokenIdleTimeout,omitempty"`
+
+	// RefreshTokenLifetime: OPTIONAL. How long the client's refresh tokens
+	// are valid after they are issued, as a duration such as "720h".
+	// Overrides the server's default.
+	RefreshTokenLifetime string `json:"refreshTokenLifetime,omitempty"`
+
 	// Secret: The client secret. If specified in a client create request,
 	// it will be used as the secret. Otherwise, the server will choose the
 	// secret. Must be a base64 URLEncoded string.
@@ -96,6 +96,67 @@ const DiscoveryJSON = `{
         "public": {
           "type": "boolean",
           "description": "OPTIONAL. Determines if the client is public. Public clients have certain restrictions: They cannot use their credentials to obtain a client JWT. Their redirects URLs cannot be specified: they are always http://localhost:$PORT or urn:ietf:wg:oauth:2.0:oob."
+        },
+        "postLogoutRedirectURIs": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          },
+          "description": "OPTIONAL. Array of URLs supplied by the Client to which it MAY request that the End-User's User Agent be redirected after a logout has been performed."
+        },
+        "refreshTokenLifetime": {
+          "type": "string",
+          "description": "OPTIONAL. How long the client's refresh tokens are valid after they are issued, as a duration such as \"720h\". Overrides the server's default."
+        },
+        "refreshTokenIdleTimeout": {
+          "type": "string",
+          "description": "OPTIONAL. How long the client's refresh tokens are valid without being used, as a duration such as \"168h\". Overrides the server's default."
+        },
+        "disableRefreshTokenRotation": {
+          "type": "boolean",
+          "description": "OPTIONAL. If true, refreshing keeps the client's refresh token instead of replacing it with a new one."
+        },
+        "passwordGrantConnector": {
+          "type": "string",
+          "description": "OPTIONAL. The ID of the connector the client may log users in with using the resource owner password credentials grant. The grant is disabled for the client if unset."
+        },
+        "claimMappings": {
+          "type": "array",
+          "items": {
+            "$ref": "ClaimMapping"
+          },
+          "description": "OPTIONAL. Mappings which reshape the claims of the client's ID tokens and UserInfo responses. For documentation see Documentation/clients.md."
+        }
+      }
+    },
+    "ClaimMapping": {
+      "id": "ClaimMapping",
+      "type": "object",
+      "description": "A mapping which sets a claim of the client's ID tokens and UserInfo responses.",
+      "properties": {
+        "claim": {
+          "type": "string",
+          "description": "The claim the mapping sets."
+        },
+        "from": {
+          "type": "string",
+          "description": "OPTIONAL. Renames the claim from to claim."
+        },
+        "value": {
+          "type": "any",
+          "description": "OPTIONAL. Sets the claim to a constant."
+        },
+        "template": {
+          "type": "string",
+          "description": "OPTIONAL. Sets the claim to the output of a text/template executed with the other claims."
+        },
+        "filter": {
+          "type": "string",
+          "description": "OPTIONAL. A regular expression; only the values of a list of strings which match it are kept."
+        },
+        "prefix": {
+          "type": "string",
+          "description": "OPTIONAL. Prepended to a string, or to each value of a list of strings."
         }
       }
     },
@@ -45,6 +45,7 @@ func New(client *http.Client) (*Service, error) {
 		return nil, errors.New("client is nil")
 	}
 	s := &Service{client: client, BasePath: basePath}
+	s.Grants = NewGrantsService(s)
 	s.RefreshClient = NewRefreshClientService(s)
 	s.Users = NewUsersService(s)
 	return s, nil
@@ -54,11 +55,22 @@ type Service struct {
 	client   *http.Client
 	BasePath string // API endpoint base URL
 
+	Grants *GrantsService
+
 	RefreshClient *RefreshClientService
 
 	Users *UsersService
 }
 
+func NewGrantsService(s *Service) *GrantsService {
+	rs := &GrantsService{s: s}
+	return rs
+}
+
+type GrantsService struct {
+	s *Service
+}
+
 func NewRefreshClientService(s *Service) *RefreshClientService {
 	rs := &RefreshClientService{s: s}
 	return rs
@@ -83,6 +95,26 @@ type Error struct {
 	Error_description string `json:"error_description,omitempty"`
 }
 
+type Grant struct {
+	ClientID string `json:"clientID,omitempty"`
+
+	ClientName string `json:"clientName,omitempty"`
+
+	ClientURI string `json:"clientURI,omitempty"`
+
+	CreatedAt string `json:"createdAt,omitempty"`
+
+	LogoURI string `json:"logoURI,omitempty"`
+
+	Scopes []string `json:"scopes,omitempty"`
+
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+type GrantList struct {
+	Grants []*Grant `json:"grants,omitempty"`
+}
+
 type RefreshClient struct {
 	ClientID string `json:"clientID,omitempty"`
 
@@ -160,6 +192,154 @@ type UsersResponse struct {
 	Users []*User `json:"users,omitempty"`
 }
 
+// method id "dex.Grants.List":
+
+type GrantsListCall struct {
+	s      *Service
+	userid string
+	opt_   map[string]interface{}
+}
+
+// List: List the grants the specified user has approved on the consent
+// page.
+func (r *GrantsService) List(userid string) *GrantsListCall {
+	c := &GrantsListCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userid = userid
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GrantsListCall) Fields(s ...googleapi.Field) *GrantsListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GrantsListCall) Do() (*GrantList, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "account/{userid}/grants")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userid": c.userid,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *GrantList
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List the grants the specified user has approved on the consent page.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.Grants.List",
+	//   "parameterOrder": [
+	//     "userid"
+	//   ],
+	//   "parameters": {
+	//     "userid": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "account/{userid}/grants",
+	//   "response": {
+	//     "$ref": "GrantList"
+	//   }
+	// }
+
+}
+
+// method id "dex.Grants.Revoke":
+
+type GrantsRevokeCall struct {
+	s        *Service
+	userid   string
+	clientid string
+	opt_     map[string]interface{}
+}
+
+// Revoke: Revoke the grant of the specified user to the client, and the
+// refresh tokens issued to the client for the user.
+func (r *GrantsService) Revoke(userid string, clientid string) *GrantsRevokeCall {
+	c := &GrantsRevokeCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userid = userid
+	c.clientid = clientid
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GrantsRevokeCall) Fields(s ...googleapi.Field) *GrantsRevokeCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GrantsRevokeCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "account/{userid}/grants/{clientid}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userid":   c.userid,
+		"clientid": c.clientid,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Revoke the grant of the specified user to the client, and the refresh tokens and access tokens issued to the client for the user.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.Grants.Revoke",
+	//   "parameterOrder": [
+	//     "userid",
+	//     "clientid"
+	//   ],
+	//   "parameters": {
+	//     "clientid": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "userid": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "account/{userid}/grants/{clientid}"
+	// }
+
+}
+
 // method id "dex.RefreshClient.List":
 
 type RefreshClientListCall struct {
@@ -284,7 +464,7 @@ func (c *RefreshClientRevokeCall) Do() error {
 	}
 	return nil
 	// {
-	//   "description": "Revoke all refresh tokens issues to the client for the specified user.",
+	//   "description": "Revoke all refresh tokens issued to the client for the specified user, and the access tokens issued with them.",
 	//   "httpMethod": "DELETE",
 	//   "id": "dex.RefreshClient.Revoke",
 	//   "parameterOrder": [
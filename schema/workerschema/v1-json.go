@@ -1,10 +1,8 @@
 package workerschema
 
-//
 // This file is automatically generated by schema/generator
 //
 // **** DO NOT EDIT ****
-//
 const DiscoveryJSON = `{
   "kind": "discovery#restDescription",
   "discoveryVersion": "v1",
@@ -40,6 +38,51 @@ const DiscoveryJSON = `{
         }
       }
     },
+    "Grant": {
+      "id": "Grant",
+      "type": "object",
+      "description": "The scopes a user has approved for a client.",
+      "properties": {
+        "clientID": {
+          "type": "string"
+        },
+        "clientName": {
+          "type": "string"
+        },
+        "logoURI": {
+          "type": "string"
+        },
+        "clientURI": {
+          "type": "string"
+        },
+        "scopes": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "createdAt": {
+          "type": "string",
+          "format": "date-time"
+        },
+        "updatedAt": {
+          "type": "string",
+          "format": "date-time"
+        }
+      }
+    },
+    "GrantList": {
+      "id": "GrantList",
+      "type": "object",
+      "properties": {
+        "grants": {
+          "type": "array",
+          "items": {
+            "$ref": "Grant"
+          }
+        }
+      }
+    },
     "RefreshClient": {
       "id": "Client",
       "type": "object",
@@ -293,6 +336,51 @@ const DiscoveryJSON = `{
         }
       }
     },
+    "Grants": {
+      "methods": {
+        "List": {
+          "id": "dex.Grants.List",
+          "description": "List the grants the specified user has approved on the consent page.",
+          "httpMethod": "GET",
+          "path": "account/{userid}/grants",
+          "parameters": {
+            "userid": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "userid"
+          ],
+          "response": {
+            "$ref": "GrantList"
+          }
+        },
+        "Revoke": {
+          "id": "dex.Grants.Revoke",
+          "description": "Revoke the grant of the specified user to the client, and the refresh tokens and access tokens issued to the client for the user.",
+          "httpMethod": "DELETE",
+          "path": "account/{userid}/grants/{clientid}",
+          "parameterOrder": [
+            "userid",
+            "clientid"
+          ],
+          "parameters": {
+            "clientid": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "userid": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          }
+        }
+      }
+    },
     "RefreshClient": {
       "methods": {
         "List": {
@@ -316,7 +404,7 @@ const DiscoveryJSON = `{
         },
         "Revoke": {
           "id": "dex.RefreshClient.Revoke",
-          "description": "Revoke all refresh tokens issues to the client for the specified user.",
+          "description": "Revoke all refresh tokens issued to the client for the specified user, and the access tokens issued with them.",
           "httpMethod": "DELETE",
           "path": "account/{userid}/refresh/{clientid}",
           "parameterOrder": [
@@ -9,6 +9,10 @@ const (
 
 	// ScopeGroups indicates that groups should be added to the ID Token.
 	ScopeGroups = "groups"
+
+	// ScopeProfile indicates that the user's profile claims, such as their
+	// given name or picture, should be added to the ID Token.
+	ScopeProfile = "profile"
 )
 
 type Scopes []string
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/session"
+)
+
+// authMethods returns the methods users logging in through the connector are
+// authenticated with, or nil if the connector doesn't report them.
+func authMethods(c connector.Connector) []string {
+	amc, ok := c.(connector.AuthMethodsConnector)
+	if !ok {
+		return nil
+	}
+	return amc.AuthMethods()
+}
+
+// connectorSatisfiesACR reports whether logging in through the connector
+// authenticates users at least with the authentication context class min.
+func connectorSatisfiesACR(c connector.Connector, min string) bool {
+	return session.SatisfiesACR(session.ACR(authMethods(c)), min)
+}
+
+// authContext returns how the user was authenticated: as the upstream
+// identity provider reported, or else with the methods of the connector.
+func authContext(c connector.Connector, auth connector.Authentication) connector.Authentication {
+	if len(auth.AMR) == 0 && auth.ACR == "" {
+		auth.AMR = authMethods(c)
+	}
+	return auth
+}
+
+// browserSessionSatisfiesACR reports whether the user of the browser session
+// authenticated through the connector at least with the authentication
+// context class min when they last logged in.
+func browserSessionSatisfiesACR(bs *session.BrowserSession, c connector.Connector, min string) bool {
+	auth := authContext(c, connector.Authentication{AMR: bs.AMR, ACR: bs.ACR})
+	return session.SatisfiesACR(session.AuthContextClass(auth.AMR, auth.ACR), min)
+}
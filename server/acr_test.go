@@ -0,0 +1,330 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+func TestHandleAuthFuncACRValues(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		// bsConnectorID is the connector the user logged in to their
+		// browser session through, and bsAMR the methods the upstream
+		// identity provider reported.
+		bsConnectorID string
+		bsAMR         []string
+		// noStrongConnector leaves out the connector authenticating users
+		// with several factors.
+		noStrongConnector bool
+
+		wantCode     int
+		wantError    string
+		wantSSO      bool
+		wantLinks    []string
+		wantNoLinks  []string
+		wantBodyText string
+	}{
+		// the browser session meets the requirement
+		{
+			query:         url.Values{"acr_values": {session.ACRMultiFactor}},
+			bsConnectorID: testConnectorID1,
+			wantCode:      http.StatusFound,
+			wantSSO:       true,
+		},
+		// the browser session is too weak; only stronger connectors are
+		// offered
+		{
+			query:         url.Values{"acr_values": {session.ACRMultiFactor}},
+			bsConnectorID: testConnectorLocalID,
+			wantCode:      http.StatusOK,
+			wantLinks:     []string{testConnectorID1},
+			wantNoLinks:   []string{testConnectorLocalID, testConnectorIDOpenID},
+		},
+		// the upstream identity provider authenticated the user of the
+		// browser session more weakly than the connector is configured to
+		{
+			query:         url.Values{"acr_values": {session.ACRMultiFactor}},
+			bsConnectorID: testConnectorID1,
+			bsAMR:         []string{"pwd"},
+			wantCode:      http.StatusOK,
+			wantLinks:     []string{testConnectorID1},
+		},
+		{
+			query:       url.Values{"acr_values": {session.ACRSingleFactor}},
+			wantCode:    http.StatusOK,
+			wantLinks:   []string{testConnectorID1, testConnectorLocalID},
+			wantNoLinks: []string{testConnectorIDOpenID},
+		},
+		// an essential acr claim is required like acr_values
+		{
+			query:       url.Values{"claims": {`{"id_token":{"acr":{"essential":true,"value":"` + session.ACRMultiFactor + `"}}}`}},
+			wantCode:    http.StatusOK,
+			wantLinks:   []string{testConnectorID1},
+			wantNoLinks: []string{testConnectorLocalID, testConnectorIDOpenID},
+		},
+		// unknown classes aren't required
+		{
+			query:     url.Values{"acr_values": {"urn:example:gold"}},
+			wantCode:  http.StatusOK,
+			wantLinks: []string{testConnectorID1, testConnectorLocalID, testConnectorIDOpenID},
+		},
+		{
+			query:             url.Values{"acr_values": {session.ACRMultiFactor}},
+			noStrongConnector: true,
+			wantCode:          http.StatusOK,
+			wantBodyText:      "No login method meets the authentication requirements of the client",
+		},
+		// the requested connector is too weak
+		{
+			query:     url.Values{"acr_values": {session.ACRSingleFactor}, "connector_id": {"fake"}},
+			wantCode:  http.StatusFound,
+			wantError: errorUnmetAuthRequirements,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		idpcs := []connector.Connector{&fakeConnector{loginURL: "http://fake.example.com"}}
+		for _, c := range f.srv.Connectors {
+			if tt.noStrongConnector && c.ID() == testConnectorID1 {
+				continue
+			}
+			idpcs = append(idpcs, c)
+		}
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, f.srv.LoginTemplate, false)
+
+		bs, cookie, err := newTestBrowserSession(f.srv)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating browser session: %v", i, err)
+		}
+		if tt.bsConnectorID != "" {
+			bs.UserID = testUserID1
+			bs.ConnectorID = tt.bsConnectorID
+			bs.AMR = tt.bsAMR
+			bs.Identity = oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+			bs.AuthTime = time.Now().UTC().Round(time.Second)
+			if err := f.srv.BrowserSessionRepo.Update(*bs); err != nil {
+				t.Fatalf("case %d: unexpected error updating browser session: %v", i, err)
+			}
+		}
+
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"redirect_uri":  {testRedirectURL.String()},
+			"scope":         {"openid"},
+			"state":         {"xyz"},
+		}
+		for k, v := range tt.query {
+			q[k] = v
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://server.example.com/auth?%s", q.Encode()), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		req.AddCookie(cookie)
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+
+		body := w.Body.String()
+		for _, id := range tt.wantLinks {
+			if !strings.Contains(body, "connector_id="+id) {
+				t.Errorf("case %d: want link to connector %q", i, id)
+			}
+		}
+		for _, id := range tt.wantNoLinks {
+			if strings.Contains(body, "connector_id="+id) {
+				t.Errorf("case %d: want no link to connector %q", i, id)
+			}
+		}
+		if tt.wantBodyText != "" && !strings.Contains(body, tt.wantBodyText) {
+			t.Errorf("case %d: want body containing %q", i, tt.wantBodyText)
+		}
+		if w.Code != http.StatusFound {
+			continue
+		}
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		lq := loc.Query()
+		if e := lq.Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+		}
+		if tt.wantSSO != (lq.Get("code") != "") {
+			t.Errorf("case %d: want code=%t, got Location=%s", i, tt.wantSSO, loc)
+		}
+	}
+}
+
+func TestServerLoginACRValues(t *testing.T) {
+	tests := []struct {
+		connectorID string
+		acrValues   []string
+		// auth is how the upstream identity provider reported it
+		// authenticated the user.
+		auth connector.Authentication
+		// noStrongConnector leaves out the connector authenticating users
+		// with several factors.
+		noStrongConnector bool
+
+		wantConnectors []string
+		wantError      string
+		wantAMR        []string
+		wantACR        string
+	}{
+		{
+			connectorID: testConnectorID1,
+			wantAMR:     []string{"pwd", "otp"},
+			wantACR:     session.ACRMultiFactor,
+		},
+		{
+			connectorID: testConnectorID1,
+			acrValues:   []string{session.ACRMultiFactor},
+			wantAMR:     []string{"pwd", "otp"},
+			wantACR:     session.ACRMultiFactor,
+		},
+		// step-up through a stronger connector
+		{
+			connectorID:    testConnectorIDOpenID,
+			acrValues:      []string{session.ACRSingleFactor},
+			wantConnectors: []string{testConnectorID1, testConnectorLocalID},
+		},
+		{
+			connectorID:    testConnectorLocalID,
+			acrValues:      []string{session.ACRMultiFactor},
+			wantConnectors: []string{testConnectorID1},
+		},
+		{
+			connectorID:       testConnectorLocalID,
+			acrValues:         []string{session.ACRMultiFactor},
+			noStrongConnector: true,
+			wantError:         errorUnmetAuthRequirements,
+		},
+		// amr and acr reported upstream take precedence over the
+		// connector's methods
+		{
+			connectorID: testConnectorID1,
+			acrValues:   []string{session.ACRMultiFactor},
+			auth:        connector.Authentication{AMR: []string{"hwk", "mfa"}},
+			wantAMR:     []string{"hwk", "mfa"},
+			wantACR:     session.ACRMultiFactor,
+		},
+		{
+			connectorID: testConnectorID1,
+			auth:        connector.Authentication{ACR: "urn:example:gold"},
+			wantACR:     "urn:example:gold",
+		},
+		// the connector is configured to authenticate users more strongly
+		// than upstream did, so it isn't offered for step-up
+		{
+			connectorID: testConnectorID1,
+			acrValues:   []string{session.ACRMultiFactor},
+			auth:        connector.Authentication{AMR: []string{"pwd"}},
+			wantError:   errorUnmetAuthRequirements,
+		},
+		{
+			connectorID:    testConnectorID1,
+			acrValues:      []string{session.ACRSingleFactor},
+			auth:           connector.Authentication{ACR: "urn:example:gold"},
+			wantConnectors: []string{testConnectorLocalID},
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		if tt.noStrongConnector {
+			var conns []connector.Connector
+			for _, c := range f.srv.Connectors {
+				if c.ID() != testConnectorID1 {
+					conns = append(conns, c)
+				}
+			}
+			f.srv.Connectors = conns
+		}
+
+		key, err := f.srv.NewSession(tt.connectorID, testClientID, "bogus", testRedirectURL, "", false, []string{"openid"}, session.AuthParams{ACRValues: tt.acrValues})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating session: %v", i, err)
+		}
+		ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+		redirect, err := f.srv.LoginWithProfile(nil, ident, user.Profile{}, tt.auth, key)
+		if err != nil {
+			t.Errorf("case %d: unexpected error logging in: %v", i, err)
+			continue
+		}
+		loc, err := url.Parse(redirect)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect: %v", i, err)
+			continue
+		}
+		lq := loc.Query()
+
+		if tt.wantConnectors != nil {
+			if loc.Path != httpPathAuth {
+				t.Errorf("case %d: want redirect to login page, got %s", i, redirect)
+				continue
+			}
+			if got := strings.Split(lq.Get("show_connectors"), ","); !reflect.DeepEqual(tt.wantConnectors, got) {
+				t.Errorf("case %d: want connectors %v, got %v", i, tt.wantConnectors, got)
+			}
+			if lq.Get("msg_code") != "stronger-auth" {
+				t.Errorf("case %d: want msg_code=stronger-auth, got %q", i, lq.Get("msg_code"))
+			}
+			if want := strings.Join(tt.acrValues, " "); lq.Get("acr_values") != want {
+				t.Errorf("case %d: want acr_values=%q, got %q", i, want, lq.Get("acr_values"))
+			}
+			continue
+		}
+		if e := lq.Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+			continue
+		}
+		if tt.wantError != "" {
+			continue
+		}
+
+		jwt, _, _, _, err := f.srv.CodeToken(testClientCredentials, lq.Get("code"), "", nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error reading claims: %v", i, err)
+			continue
+		}
+		if acr, _, _ := claims.StringClaim("acr"); acr != tt.wantACR {
+			t.Errorf("case %d: want acr=%q, got %q", i, tt.wantACR, acr)
+		}
+		if amr, _, _ := claims.StringsClaim("amr"); !reflect.DeepEqual(tt.wantAMR, amr) {
+			t.Errorf("case %d: want amr=%v, got %v", i, tt.wantAMR, amr)
+		}
+	}
+}
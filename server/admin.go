@@ -13,6 +13,7 @@ import (
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/schema/adminschema"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/go-oidc/key"
 )
 
@@ -36,12 +37,13 @@ type AdminServer struct {
 	secret   string
 }
 
-func NewAdminServer(adminAPI *admin.AdminAPI, rotator *key.PrivateKeyRotator, secret string) *AdminServer {
+func NewAdminServer(adminAPI *admin.AdminAPI, rotator *key.PrivateKeyRotator, signingRotator *signing.KeyRotator, secret string) *AdminServer {
 	return &AdminServer{
 		adminAPI: adminAPI,
 		checker: health.Checker{
 			Checks: []health.Checkable{
 				rotator,
+				signingRotator,
 			},
 		},
 		secret: secret,
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// claimsSupported are the claims dex may return in ID tokens or from the
+// UserInfo endpoint.
+var claimsSupported = []string{
+	"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "azp",
+	"at_hash", "c_hash", "name", "given_name", "family_name",
+	"preferred_username", "picture", "locale", "email", "email_verified",
+	"groups",
+}
+
+// protectedClaims are never left out of tokens because of the value they were
+// requested with; requests for particular values of these are enforced
+// while the user logs in instead.
+var protectedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true,
+	"nonce": true, "acr": true, "azp": true,
+}
+
+// parseClaimsRequest parses the 'claims' parameter of an authentication
+// request (OpenID Connect Core 1.0 Section 5.5).
+func parseClaimsRequest(claims string) (session.ClaimsRequest, error) {
+	var cr session.ClaimsRequest
+	if claims == "" {
+		return cr, nil
+	}
+	if err := json.Unmarshal([]byte(claims), &cr); err != nil {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "claims must be a JSON object of claim requests"
+		return cr, err
+	}
+	return cr, nil
+}
+
+// essentialACRValues returns the authentication context classes the acr
+// claim of the ID token is requested with if it's essential. Unlike
+// 'acr_values', they're a requirement the user must meet (OpenID Connect Core
+// 1.0 Section 5.5.1.1).
+func essentialACRValues(cr session.ClaimsRequest) []string {
+	r := cr.IDToken["acr"]
+	if r == nil || !r.Essential {
+		return nil
+	}
+	return r.StringValues()
+}
+
+// addProfileClaims adds the claims of the user's profile if the 'profile' scope
+// was granted, or otherwise those requested individually.
+func addProfileClaims(claims jose.Claims, profile user.Profile, scopes scope.Scopes, requests session.ClaimRequests) {
+	pc := jose.Claims{}
+	profile.AddToClaims(pc)
+	for name, v := range pc {
+		if scopes.HasScope(scope.ScopeProfile) || requests.Requested(name) {
+			claims[name] = v
+		}
+	}
+}
+
+// addRequestedClaims adds the claims requested individually which dex doesn't
+// otherwise return, such as the user's groups, and leaves out those whose
+// value differs from the requested one.
+func addRequestedClaims(claims jose.Claims, requests session.ClaimRequests, groups []string) {
+	for name, r := range requests {
+		if name == "groups" && groups != nil {
+			if _, ok := claims["groups"]; !ok {
+				claims["groups"] = groups
+			}
+		}
+		if protectedClaims[name] {
+			continue
+		}
+		if v, ok := claims[name]; ok && isScalarClaim(v) && !r.Allows(v) {
+			delete(claims, name)
+		}
+	}
+}
+
+func isScalarClaim(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, float64, int, int64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,611 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// groupsConnector adds groups to a connector which doesn't support them.
+type groupsConnector struct {
+	connector.Connector
+	groups []string
+}
+
+func (c groupsConnector) Groups(fullUserID string) ([]string, error) {
+	return c.groups, nil
+}
+
+func TestParseClaimsRequest(t *testing.T) {
+	tests := []struct {
+		claims  string
+		want    session.ClaimsRequest
+		wantErr bool
+	}{
+		{
+			claims: "",
+		},
+		{
+			claims: `{"id_token":{"acr":{"essential":true,"values":["2"]},"email":null},"userinfo":{"groups":null}}`,
+			want: session.ClaimsRequest{
+				IDToken: session.ClaimRequests{
+					"acr":   &session.ClaimRequest{Essential: true, Values: []interface{}{"2"}},
+					"email": nil,
+				},
+				UserInfo: session.ClaimRequests{"groups": nil},
+			},
+		},
+		{
+			claims:  `{"id_token":`,
+			wantErr: true,
+		},
+		{
+			claims:  `["email"]`,
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := parseClaimsRequest(tt.claims)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestAddRequestedClaims(t *testing.T) {
+	tests := []struct {
+		requests session.ClaimRequests
+		groups   []string
+		want     jose.Claims
+	}{
+		{
+			want: jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+		},
+		{
+			requests: session.ClaimRequests{"groups": nil},
+			groups:   []string{"admins"},
+			want:     jose.Claims{"sub": "elroy-id", "email": "elroy@example.com", "groups": []string{"admins"}},
+		},
+		// groups the connector doesn't know are left out
+		{
+			requests: session.ClaimRequests{"groups": &session.ClaimRequest{Essential: true}},
+			want:     jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+		},
+		{
+			requests: session.ClaimRequests{"email": &session.ClaimRequest{Value: "elroy@example.com"}},
+			want:     jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+		},
+		{
+			requests: session.ClaimRequests{"email": &session.ClaimRequest{Values: []interface{}{"other@example.com"}}},
+			want:     jose.Claims{"sub": "elroy-id"},
+		},
+		// the subject is never left out
+		{
+			requests: session.ClaimRequests{"sub": &session.ClaimRequest{Value: "other-id"}},
+			want:     jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+		},
+	}
+
+	for i, tt := range tests {
+		claims := jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"}
+		addRequestedClaims(claims, tt.requests, tt.groups)
+		if diff := pretty.Compare(tt.want, claims); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestAddProfileClaims(t *testing.T) {
+	profile := user.Profile{GivenName: "Elroy", PreferredUsername: "elroy"}
+	tests := []struct {
+		scopes   scope.Scopes
+		requests session.ClaimRequests
+		want     jose.Claims
+	}{
+		{
+			scopes: scope.Scopes{"openid"},
+			want:   jose.Claims{"sub": "elroy-id"},
+		},
+		{
+			scopes: scope.Scopes{"openid", "profile"},
+			want:   jose.Claims{"sub": "elroy-id", "given_name": "Elroy", "preferred_username": "elroy"},
+		},
+		{
+			scopes:   scope.Scopes{"openid"},
+			requests: session.ClaimRequests{"preferred_username": nil, "locale": nil},
+			want:     jose.Claims{"sub": "elroy-id", "preferred_username": "elroy"},
+		},
+	}
+
+	for i, tt := range tests {
+		claims := jose.Claims{"sub": "elroy-id"}
+		addProfileClaims(claims, profile, tt.scopes, tt.requests)
+		if diff := pretty.Compare(tt.want, claims); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestServerLoginProfile(t *testing.T) {
+	profile := user.Profile{
+		GivenName:         "Elroy",
+		FamilyName:        "Jetson",
+		PreferredUsername: "elroy",
+		Picture:           "https://example.com/elroy.png",
+		Locale:            "en-US",
+	}
+	tests := []struct {
+		scope  []string
+		claims string
+		// userProfile is the profile the user had before logging in.
+		userProfile user.Profile
+		// profile is the profile reported by the connector.
+		profile user.Profile
+
+		wantUserProfile user.Profile
+		wantIDToken     jose.Claims
+		wantUserInfo    jose.Claims
+		// wantMissing are claims left out of the ID token.
+		wantMissing []string
+	}{
+		{
+			scope:           []string{"openid", "profile"},
+			profile:         profile,
+			wantUserProfile: profile,
+			wantIDToken:     jose.Claims{"given_name": "Elroy", "family_name": "Jetson", "locale": "en-US"},
+			wantUserInfo:    jose.Claims{"preferred_username": "elroy", "picture": "https://example.com/elroy.png"},
+		},
+		// the profile is stored, but not handed out without the scope
+		{
+			scope:           []string{"openid"},
+			profile:         profile,
+			wantUserProfile: profile,
+			wantMissing:     []string{"given_name", "preferred_username"},
+		},
+		{
+			scope:           []string{"openid"},
+			claims:          `{"userinfo":{"picture":null}}`,
+			profile:         profile,
+			wantUserProfile: profile,
+			wantUserInfo:    jose.Claims{"picture": "https://example.com/elroy.png"},
+			wantMissing:     []string{"picture"},
+		},
+		// connectors which know nothing about the user's profile leave it
+		// alone
+		{
+			scope:           []string{"openid", "profile"},
+			userProfile:     profile,
+			wantUserProfile: profile,
+			wantIDToken:     jose.Claims{"given_name": "Elroy"},
+		},
+		{
+			scope:           []string{"openid", "profile"},
+			userProfile:     profile,
+			profile:         user.Profile{GivenName: "Roy"},
+			wantUserProfile: user.Profile{GivenName: "Roy"},
+			wantIDToken:     jose.Claims{"given_name": "Roy"},
+			wantMissing:     []string{"family_name"},
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		if tt.userProfile != (user.Profile{}) {
+			usr, err := f.srv.UserRepo.Get(nil, testUserID1)
+			if err != nil {
+				t.Fatalf("case %d: unexpected error getting user: %v", i, err)
+			}
+			if err := f.srv.UserManager.SetProfile(usr, tt.userProfile); err != nil {
+				t.Fatalf("case %d: unexpected error setting profile: %v", i, err)
+			}
+		}
+		cr, err := parseClaimsRequest(tt.claims)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error parsing claims: %v", i, err)
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, tt.scope, session.AuthParams{ClaimsRequest: cr})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating session: %v", i, err)
+		}
+		ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+		redirect, err := f.srv.LoginWithProfile(nil, ident, tt.profile, connector.Authentication{}, key)
+		if err != nil {
+			t.Errorf("case %d: unexpected error logging in: %v", i, err)
+			continue
+		}
+		loc, err := url.Parse(redirect)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect: %v", i, err)
+			continue
+		}
+
+		usr, err := f.srv.UserRepo.Get(nil, testUserID1)
+		if err != nil {
+			t.Errorf("case %d: unexpected error getting user: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.wantUserProfile, usr.Profile); diff != "" {
+			t.Errorf("case %d: Compare(wantUserProfile, gotUserProfile) = %v", i, diff)
+		}
+
+		jwt, accessToken, _, _, err := f.srv.CodeToken(testClientCredentials, loc.Query().Get("code"), "", nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error reading claims: %v", i, err)
+			continue
+		}
+		info, err := f.srv.UserInfo(accessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error getting user info: %v", i, err)
+			continue
+		}
+
+		for name, want := range tt.wantIDToken {
+			if got := claims[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: ID token: want %s=%v, got %v", i, name, want, got)
+			}
+		}
+		for name, want := range tt.wantUserInfo {
+			if got := info[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: UserInfo: want %s=%v, got %v", i, name, want, got)
+			}
+		}
+		for _, name := range tt.wantMissing {
+			if _, ok := claims[name]; ok {
+				t.Errorf("case %d: want no %s claim in ID token", i, name)
+			}
+		}
+	}
+}
+
+func TestServerClaimsRequest(t *testing.T) {
+	tests := []struct {
+		claims string
+
+		wantError    string
+		wantIDToken  jose.Claims
+		wantUserInfo jose.Claims
+		// wantMissing are claims left out of the ID token.
+		wantMissing []string
+	}{
+		{
+			claims:      `{"id_token":{"groups":null}}`,
+			wantIDToken: jose.Claims{"groups": []string{"admins"}},
+		},
+		{
+			claims:       `{"userinfo":{"groups":{"essential":true}}}`,
+			wantUserInfo: jose.Claims{"groups": []string{"admins"}},
+			wantMissing:  []string{"groups"},
+		},
+		{
+			claims:      `{"id_token":{"acr":null}}`,
+			wantIDToken: jose.Claims{"acr": session.ACRUnknown},
+		},
+		{
+			claims:      `{"id_token":{"email":{"value":"other@example.com"}}}`,
+			wantMissing: []string{"email"},
+		},
+		{
+			claims:      fmt.Sprintf(`{"id_token":{"sub":{"value":%q}}}`, testUserID1),
+			wantIDToken: jose.Claims{"sub": testUserID1},
+		},
+		// the user logged in isn't the requested one
+		{
+			claims:    `{"id_token":{"sub":{"value":"other-id"}}}`,
+			wantError: errorLoginRequired,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		for j, c := range f.srv.Connectors {
+			if c.ID() == testConnectorID1 {
+				f.srv.Connectors[j] = groupsConnector{Connector: c, groups: []string{"admins"}}
+			}
+		}
+		cr, err := parseClaimsRequest(tt.claims)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error parsing claims: %v", i, err)
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, []string{"openid"}, session.AuthParams{ClaimsRequest: cr})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating session: %v", i, err)
+		}
+		ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+		redirect, err := f.srv.Login(ident, key)
+		if err != nil {
+			t.Errorf("case %d: unexpected error logging in: %v", i, err)
+			continue
+		}
+		loc, err := url.Parse(redirect)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect: %v", i, err)
+			continue
+		}
+		lq := loc.Query()
+		if e := lq.Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+			continue
+		}
+		if tt.wantError != "" {
+			continue
+		}
+
+		jwt, accessToken, _, _, err := f.srv.CodeToken(testClientCredentials, lq.Get("code"), "", nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error reading claims: %v", i, err)
+			continue
+		}
+		info, err := f.srv.UserInfo(accessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error getting user info: %v", i, err)
+			continue
+		}
+
+		for name, want := range tt.wantIDToken {
+			if got := claims[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: ID token: want %s=%v, got %v", i, name, want, got)
+			}
+		}
+		for name, want := range tt.wantUserInfo {
+			if got := info[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: UserInfo: want %s=%v, got %v", i, name, want, got)
+			}
+		}
+		for _, name := range tt.wantMissing {
+			if _, ok := claims[name]; ok {
+				t.Errorf("case %d: want no %s claim in ID token", i, name)
+			}
+		}
+	}
+}
+
+func TestServerClaimMappings(t *testing.T) {
+	tests := []struct {
+		scope    []string
+		mappings []client.ClaimMapping
+
+		wantClaims jose.Claims
+		// wantMissing are claims left out of the ID token and UserInfo
+		// response.
+		wantMissing []string
+	}{
+		{
+			scope:      []string{"openid", "groups"},
+			mappings:   []client.ClaimMapping{{Claim: "groups", Prefix: "oidc:"}},
+			wantClaims: jose.Claims{"groups": []string{"oidc:admins", "oidc:app-viewers"}},
+		},
+		{
+			scope:       []string{"openid", "groups"},
+			mappings:    []client.ClaimMapping{{Claim: "roles", From: "groups", Filter: "^app-"}},
+			wantClaims:  jose.Claims{"roles": []string{"app-viewers"}},
+			wantMissing: []string{"groups"},
+		},
+		{
+			scope: []string{"openid", "email"},
+			mappings: []client.ClaimMapping{
+				{Claim: "username", Template: "{{localpart .email}}"},
+				{Claim: "tenant", Value: "acme"},
+			},
+			wantClaims: jose.Claims{"username": "email-1", "tenant": "acme"},
+		},
+	}
+
+	for i, tt := range tests {
+		clients := make([]client.LoadableClient, len(testClients))
+		copy(clients, testClients)
+		for j, c := range clients {
+			if c.Client.Credentials.ID == testClientID {
+				clients[j].Client.ClaimMappings = tt.mappings
+			}
+		}
+		f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		for j, c := range f.srv.Connectors {
+			if c.ID() == testConnectorID1 {
+				f.srv.Connectors[j] = groupsConnector{Connector: c, groups: []string{"admins", "app-viewers"}}
+			}
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, tt.scope, session.AuthParams{})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating session: %v", i, err)
+		}
+		ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+		redirect, err := f.srv.Login(ident, key)
+		if err != nil {
+			t.Errorf("case %d: unexpected error logging in: %v", i, err)
+			continue
+		}
+		loc, err := url.Parse(redirect)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect: %v", i, err)
+			continue
+		}
+
+		jwt, accessToken, _, _, err := f.srv.CodeToken(testClientCredentials, loc.Query().Get("code"), "", nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error reading claims: %v", i, err)
+			continue
+		}
+		info, err := f.srv.UserInfo(accessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error getting user info: %v", i, err)
+			continue
+		}
+
+		for name, want := range tt.wantClaims {
+			if got := claims[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: ID token: want %s=%v, got %v", i, name, want, got)
+			}
+			if got := info[name]; !claimEqual(want, got) {
+				t.Errorf("case %d: UserInfo: want %s=%v, got %v", i, name, want, got)
+			}
+		}
+		for _, name := range tt.wantMissing {
+			if _, ok := claims[name]; ok {
+				t.Errorf("case %d: want no %s claim in ID token", i, name)
+			}
+			if _, ok := info[name]; ok {
+				t.Errorf("case %d: want no %s claim in UserInfo", i, name)
+			}
+		}
+	}
+}
+
+// claimEqual compares claims regardless of whether they were decoded from
+// JSON.
+func claimEqual(want, got interface{}) bool {
+	if ws, ok := want.([]string); ok {
+		var gs []string
+		switch got := got.(type) {
+		case []string:
+			gs = got
+		case []interface{}:
+			for _, v := range got {
+				s, _ := v.(string)
+				gs = append(gs, s)
+			}
+		}
+		return reflect.DeepEqual(ws, gs)
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+func TestHandleAuthFuncClaims(t *testing.T) {
+	tests := []struct {
+		claims string
+		// bsConnectorID is the connector the user logged in to their
+		// browser session through.
+		bsConnectorID string
+
+		wantCode  int
+		wantError string
+	}{
+		{
+			claims:        `{"id_token":{"email":null}}`,
+			bsConnectorID: testConnectorLocalID,
+			wantCode:      http.StatusFound,
+		},
+		{
+			claims:        `{"id_token":`,
+			bsConnectorID: testConnectorLocalID,
+			wantCode:      http.StatusFound,
+			wantError:     oauth2.ErrorInvalidRequest,
+		},
+		// an essential acr is required like acr_values
+		{
+			claims:        `{"id_token":{"acr":{"essential":true,"values":["2"]}}}`,
+			bsConnectorID: testConnectorLocalID,
+			wantCode:      http.StatusOK,
+		},
+		// a voluntary acr isn't
+		{
+			claims:        `{"id_token":{"acr":{"values":["2"]}}}`,
+			bsConnectorID: testConnectorLocalID,
+			wantCode:      http.StatusFound,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, f.srv.Connectors, f.srv.LoginTemplate, false)
+
+		bs, cookie, err := newTestBrowserSession(f.srv)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating browser session: %v", i, err)
+		}
+		if tt.bsConnectorID != "" {
+			bs.UserID = testUserID1
+			bs.ConnectorID = tt.bsConnectorID
+			bs.Identity = oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+			bs.AuthTime = time.Now().UTC().Round(time.Second)
+			if err := f.srv.BrowserSessionRepo.Update(*bs); err != nil {
+				t.Fatalf("case %d: unexpected error updating browser session: %v", i, err)
+			}
+		}
+
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"redirect_uri":  {testRedirectURL.String()},
+			"scope":         {"openid"},
+			"state":         {"xyz"},
+			"claims":        {tt.claims},
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://server.example.com/auth?%s", q.Encode()), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		req.AddCookie(cookie)
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if w.Code != http.StatusFound {
+			continue
+		}
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		if e := loc.Query().Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+		}
+	}
+}
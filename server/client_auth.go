@@ -0,0 +1,201 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	// clientAssertionTypeJWTBearer is the client_assertion_type of clients
+	// authenticating with a JWT (RFC 7523 Section 2.2).
+	clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// maxClientAssertionLifetime bounds how far in the future a client
+	// assertion may expire, and so how long its jti is remembered.
+	maxClientAssertionLifetime = 5 * time.Minute
+)
+
+var tokenEndpointAuthMethodsSupported = []string{
+	oauth2.AuthMethodClientSecretBasic,
+	oauth2.AuthMethodClientSecretPost,
+	oauth2.AuthMethodPrivateKeyJWT,
+}
+
+// clientCredentialsFromRequest returns the client credentials sent with the
+// request: with the HTTP Basic authentication scheme, as client_id and
+// client_secret form parameters (RFC 6749 Section 2.3.1), or as a JWT client
+// assertion (RFC 7523 Section 2.2). For assertions, the credentials' secret
+// is the assertion itself; authenticateClient tells the two apart by the
+// client's registered token_endpoint_auth_method. ok is false if the request
+// carries no client credentials.
+func clientCredentialsFromRequest(r *http.Request) (creds oidc.ClientCredentials, ok bool, err error) {
+	if err := r.ParseForm(); err != nil {
+		return creds, false, fmt.Errorf("error parsing request: %v", err)
+	}
+
+	var found []oidc.ClientCredentials
+
+	if user, password, ok := r.BasicAuth(); ok {
+		decodedUser, err := url.QueryUnescape(user)
+		if err != nil {
+			return creds, true, fmt.Errorf("error decoding user: %v", err)
+		}
+		decodedPassword, err := url.QueryUnescape(password)
+		if err != nil {
+			return creds, true, fmt.Errorf("error decoding password: %v", err)
+		}
+		found = append(found, oidc.ClientCredentials{ID: decodedUser, Secret: decodedPassword})
+	}
+
+	if secret := r.PostForm.Get("client_secret"); secret != "" {
+		post := oidc.ClientCredentials{ID: r.PostForm.Get("client_id"), Secret: secret}
+		// Some clients, including the go-oidc one, repeat their Basic
+		// credentials in the form; only conflicting credentials count as a
+		// second method.
+		if len(found) == 0 || found[0] != post {
+			found = append(found, post)
+		}
+	}
+
+	if assertion := r.PostForm.Get("client_assertion"); assertion != "" {
+		if r.PostForm.Get("client_assertion_type") != clientAssertionTypeJWTBearer {
+			return creds, true, errors.New("unsupported client_assertion_type")
+		}
+		jwt, err := jose.ParseJWT(assertion)
+		if err != nil {
+			return creds, true, fmt.Errorf("error parsing client assertion: %v", err)
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			return creds, true, fmt.Errorf("error parsing client assertion claims: %v", err)
+		}
+		sub, _, _ := claims.StringClaim("sub")
+		if id := r.PostForm.Get("client_id"); id != "" && id != sub {
+			return creds, true, errors.New("client_id does not match the client assertion")
+		}
+		found = append(found, oidc.ClientCredentials{ID: sub, Secret: assertion})
+	}
+
+	switch len(found) {
+	case 0:
+		return creds, false, nil
+	case 1:
+		if found[0].ID == "" {
+			return creds, true, errors.New("missing client_id")
+		}
+		return found[0], true, nil
+	default:
+		// Clients MUST NOT use more than one authentication method in
+		// each request (RFC 6749 Section 2.3).
+		return creds, true, errors.New("more than one client authentication method used")
+	}
+}
+
+// authenticateClient authenticates a client with the method it registered
+// with: clients using private_key_jwt must present a client assertion signed
+// with one of their keys, all others their client secret.
+func (s *Server) authenticateClient(creds oidc.ClientCredentials) (bool, error) {
+	cli, err := s.Client(creds.ID)
+	if err != nil {
+		if err == client.ErrorNotFound {
+			log.Errorf("no client found for client ID: %v", creds.ID)
+			return false, nil
+		}
+		return false, err
+	}
+
+	if cli.Metadata.TokenEndpointAuthMethod != oauth2.AuthMethodPrivateKeyJWT {
+		return s.ClientManager.Authenticate(creds)
+	}
+
+	if err := s.verifyClientAssertion(cli, creds.Secret); err != nil {
+		log.Errorf("invalid client assertion for client ID %v: %v", creds.ID, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// verifyClientAssertion verifies a client assertion against the keys the
+// client registered (RFC 7523 Section 3).
+func (s *Server) verifyClientAssertion(cli client.Client, assertion string) error {
+	jwt, err := jose.ParseJWT(assertion)
+	if err != nil {
+		return err
+	}
+
+	keys, err := s.clientPublicKeys(cli)
+	if err != nil {
+		return fmt.Errorf("error fetching client keys: %v", err)
+	}
+	ok, err := oidc.VerifySignature(jwt, keys)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("signature does not match the client's keys")
+	}
+
+	claims, err := jwt.Claims()
+	if err != nil {
+		return err
+	}
+	iss, _, _ := claims.StringClaim("iss")
+	sub, _, _ := claims.StringClaim("sub")
+	if iss != cli.Credentials.ID || sub != cli.Credentials.ID {
+		return errors.New("iss and sub must be the client ID")
+	}
+
+	tokenEndpoint := s.absURL(httpPathToken)
+	if !audienceContains(claims, s.IssuerURL.String()) && !audienceContains(claims, tokenEndpoint.String()) {
+		return errors.New("aud must be the issuer or the token endpoint")
+	}
+
+	jti, _, _ := claims.StringClaim("jti")
+	if jti == "" {
+		return errors.New("missing jti")
+	}
+
+	exp, ok, err := claims.TimeClaim("exp")
+	if err != nil || !ok {
+		return errors.New("missing exp")
+	}
+	now := time.Now()
+	if !exp.After(now) {
+		return errors.New("assertion is expired")
+	}
+	if exp.After(now.Add(maxClientAssertionLifetime)) {
+		return fmt.Errorf("assertion expires more than %v from now", maxClientAssertionLifetime)
+	}
+	if nbf, ok, _ := claims.TimeClaim("nbf"); ok && nbf.After(now) {
+		return errors.New("assertion is not yet valid")
+	}
+
+	return s.ClientAssertionRepo.Use(cli.Credentials.ID, jti, exp)
+}
+
+// clientPublicKeys returns the keys the client registered.
+func (s *Server) clientPublicKeys(cli client.Client) ([]key.PublicKey, error) {
+	jwks, err := s.clientJWKs(cli)
+	if err != nil {
+		return nil, err
+	}
+	if len(jwks) == 0 {
+		return nil, errors.New("client has no registered keys")
+	}
+	keys := make([]key.PublicKey, len(jwks))
+	for i, jwk := range jwks {
+		keys[i] = *key.NewPublicKey(jwk)
+	}
+	return keys, nil
+}
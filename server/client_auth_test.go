@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+)
+
+const testJWTClientID = "jwt.example.com"
+
+func makeJWTClientTestFixtures(clientKey *key.PrivateKey, jwksURI *url.URL) (*testFixtures, error) {
+	metadata := oidc.ClientMetadata{
+		RedirectURIs:            []url.URL{testRedirectURL},
+		TokenEndpointAuthMethod: oauth2.AuthMethodPrivateKeyJWT,
+	}
+	if jwksURI != nil {
+		metadata.JWKSURI = jwksURI
+	} else {
+		metadata.JWKS = &jose.JWKSet{Keys: []jose.JWK{clientKey.JWK()}}
+	}
+	clients := append([]client.LoadableClient{}, testClients...)
+	clients = append(clients, client.LoadableClient{
+		Client: client.Client{
+			Credentials: oidc.ClientCredentials{ID: testJWTClientID, Secret: clientTestSecret},
+			Metadata:    metadata,
+		},
+	})
+	return makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+}
+
+func signClientAssertion(t *testing.T, k *key.PrivateKey, claims jose.Claims) string {
+	jwt, err := jose.NewSignedJWT(claims, k.Signer())
+	if err != nil {
+		t.Fatalf("unexpected error signing client assertion: %v", err)
+	}
+	return jwt.Encode()
+}
+
+// clientAssertionCount numbers the assertions of tests, since each jti can
+// only be used once.
+var clientAssertionCount int
+
+func clientAssertionClaims(iss, sub, aud string, exp time.Time) jose.Claims {
+	clientAssertionCount++
+	return jose.Claims{
+		"iss": iss,
+		"sub": sub,
+		"aud": aud,
+		"jti": fmt.Sprintf("assertion-%d", clientAssertionCount),
+		"exp": exp.Unix(),
+	}
+}
+
+func TestClientCredentialsFromRequest(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	assertion := signClientAssertion(t, clientKey, clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), time.Now().Add(time.Minute)))
+
+	tests := []struct {
+		form      url.Values
+		basicAuth *oidc.ClientCredentials
+
+		wantCreds oidc.ClientCredentials
+		wantOK    bool
+		wantErr   bool
+	}{
+		// client_secret_basic
+		{
+			basicAuth: &testClientCredentials,
+			wantCreds: testClientCredentials,
+			wantOK:    true,
+		},
+		// client_secret_post
+		{
+			form:      url.Values{"client_id": {testClientID}, "client_secret": {clientTestSecret}},
+			wantCreds: testClientCredentials,
+			wantOK:    true,
+		},
+		// private_key_jwt, with or without client_id
+		{
+			form: url.Values{
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			wantCreds: oidc.ClientCredentials{ID: testJWTClientID, Secret: assertion},
+			wantOK:    true,
+		},
+		{
+			form: url.Values{
+				"client_id":             {testJWTClientID},
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			wantCreds: oidc.ClientCredentials{ID: testJWTClientID, Secret: assertion},
+			wantOK:    true,
+		},
+		// a client_id alone is not a credential
+		{
+			form: url.Values{"client_id": {testClientID}},
+		},
+		// client_id does not match the assertion
+		{
+			form: url.Values{
+				"client_id":             {testClientID},
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			wantOK:  true,
+			wantErr: true,
+		},
+		// unsupported assertion type
+		{
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:saml2-bearer"},
+				"client_assertion":      {assertion},
+			},
+			wantOK:  true,
+			wantErr: true,
+		},
+		// client_secret without client_id
+		{
+			form:    url.Values{"client_secret": {clientTestSecret}},
+			wantOK:  true,
+			wantErr: true,
+		},
+		// the same secret in both the header and the form
+		{
+			form:      url.Values{"client_id": {testClientID}, "client_secret": {clientTestSecret}},
+			basicAuth: &testClientCredentials,
+			wantCreds: testClientCredentials,
+			wantOK:    true,
+		},
+		// more than one method
+		{
+			form:      url.Values{"client_id": {testClientID}, "client_secret": {"other"}},
+			basicAuth: &testClientCredentials,
+			wantOK:    true,
+			wantErr:   true,
+		},
+		{
+			form: url.Values{
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			basicAuth: &testClientCredentials,
+			wantOK:    true,
+			wantErr:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		req, err := http.NewRequest("POST", "http://example.com/token", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Fatalf("case %d: unable to create HTTP request: %v", i, err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth != nil {
+			req.SetBasicAuth(tt.basicAuth.ID, tt.basicAuth.Secret)
+		}
+
+		creds, ok, err := clientCredentialsFromRequest(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("case %d: want err=%t, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if ok != tt.wantOK {
+			t.Errorf("case %d: want ok=%t, got %t", i, tt.wantOK, ok)
+		}
+		if err == nil && creds != tt.wantCreds {
+			t.Errorf("case %d: want creds=%#v, got %#v", i, tt.wantCreds, creds)
+		}
+	}
+}
+
+func TestServerAuthenticateClientAssertion(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	otherKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	now := time.Now()
+	tokenEndpoint := testIssuerURL.String() + httpPathToken
+	replayed := clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Minute))
+
+	tests := []struct {
+		signer *key.PrivateKey
+		claims jose.Claims
+		secret string
+
+		wantOK bool
+	}{
+		// aud is the issuer
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Minute)),
+			wantOK: true,
+		},
+		// aud is the token endpoint
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, tokenEndpoint, now.Add(time.Minute)),
+			wantOK: true,
+		},
+		// signed with a key the client did not register
+		{
+			signer: otherKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Minute)),
+		},
+		// issued by another client
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Minute)),
+		},
+		// intended for another server
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, "https://other.example.com", now.Add(time.Minute)),
+		},
+		// expired
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(-time.Minute)),
+		},
+		// expires too far in the future
+		{
+			signer: clientKey,
+			claims: clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Hour)),
+		},
+		// missing jti
+		{
+			signer: clientKey,
+			claims: func() jose.Claims {
+				claims := clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String(), now.Add(time.Minute))
+				delete(claims, "jti")
+				return claims
+			}(),
+		},
+		// the client may not fall back to its secret
+		{
+			secret: clientTestSecret,
+		},
+		{
+			signer: clientKey,
+			claims: replayed,
+			wantOK: true,
+		},
+		// an assertion can only be used once
+		{
+			signer: clientKey,
+			claims: replayed,
+		},
+	}
+
+	for _, jwksByReference := range []bool{false, true} {
+		var jwksURI *url.URL
+		if jwksByReference {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(jose.JWKSet{Keys: []jose.JWK{clientKey.JWK()}})
+			}))
+			defer ts.Close()
+			jwksURI, _ = url.Parse(ts.URL)
+
+			// Trust the test server's certificate.
+			transport := http.DefaultTransport
+			http.DefaultTransport = ts.Client().Transport
+			defer func() { http.DefaultTransport = transport }()
+		}
+
+		f, err := makeJWTClientTestFixtures(clientKey, jwksURI)
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		for i, tt := range tests {
+			secret := tt.secret
+			if secret == "" {
+				secret = signClientAssertion(t, tt.signer, tt.claims)
+			}
+			ok, err := f.srv.authenticateClient(oidc.ClientCredentials{ID: testJWTClientID, Secret: secret})
+			if err != nil {
+				t.Errorf("case %d: unexpected error: %v", i, err)
+				continue
+			}
+			if ok != tt.wantOK {
+				t.Errorf("case %d (jwks_uri=%t): want ok=%t, got %t", i, jwksByReference, tt.wantOK, ok)
+			}
+		}
+	}
+}
+
+func TestHandleTokenFuncClientAuthentication(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	f, err := makeJWTClientTestFixtures(clientKey, nil)
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	assertion := signClientAssertion(t, clientKey, clientAssertionClaims(testJWTClientID, testJWTClientID, testIssuerURL.String()+httpPathToken, time.Now().Add(time.Minute)))
+
+	tests := []struct {
+		form      url.Values
+		basicAuth *oidc.ClientCredentials
+
+		wantCode int
+	}{
+		{
+			basicAuth: &testClientCredentials,
+			wantCode:  http.StatusOK,
+		},
+		{
+			form:     url.Values{"client_id": {testClientID}, "client_secret": {clientTestSecret}},
+			wantCode: http.StatusOK,
+		},
+		{
+			form: url.Values{
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			wantCode: http.StatusOK,
+		},
+		// a private_key_jwt client has no usable secret
+		{
+			basicAuth: &oidc.ClientCredentials{ID: testJWTClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusUnauthorized,
+		},
+		// a client_secret_basic client may not send an assertion
+		{
+			form: url.Values{
+				"client_id":             {testClientID},
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {signClientAssertion(t, clientKey, clientAssertionClaims(testClientID, testClientID, testIssuerURL.String(), time.Now().Add(time.Minute)))},
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			form:      url.Values{"client_id": {testClientID}, "client_secret": {"other"}},
+			basicAuth: &testClientCredentials,
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	hdlr := handleTokenFunc(f.srv)
+	for i, tt := range tests {
+		form := url.Values{"grant_type": {oauth2.GrantTypeClientCreds}}
+		for k, vs := range tt.form {
+			form[k] = vs
+		}
+		req, err := http.NewRequest("POST", "http://example.com/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth != nil {
+			req.SetBasicAuth(tt.basicAuth.ID, tt.basicAuth.Secret)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+		}
+	}
+}
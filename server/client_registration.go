@@ -2,9 +2,15 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/coreos/dex/client"
+	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
 
 	"github.com/coreos/go-oidc/oauth2"
@@ -14,6 +20,9 @@ import (
 const (
 	invalidRedirectURI    = "invalid_redirect_uri"
 	invalidClientMetadata = "invalid_client_metadata"
+
+	// maxClientUpdateRequestSize bounds the size of client update requests.
+	maxClientUpdateRequestSize = 64 << 10
 )
 
 func (s *Server) handleClientRegistration(w http.ResponseWriter, r *http.Request) {
@@ -37,6 +46,15 @@ func (s *Server) handleClientRegistrationRequest(r *http.Request) (*oidc.ClientR
 	if err := s.ProviderConfig().Supports(clientMetadata); err != nil {
 		return nil, newAPIError(invalidClientMetadata, err.Error())
 	}
+	if err := validTokenEndpointAuthMethod(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := validIDTokenEncryption(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := s.validSubjectType(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
 
 	// metadata is guarenteed to have at least one redirect_uri by earlier validation.
 	cli := client.Client{
@@ -48,9 +66,225 @@ func (s *Server) handleClientRegistrationRequest(r *http.Request) (*oidc.ClientR
 		return nil, newAPIError(oauth2.ErrorServerError, "unable to save client metadata")
 	}
 
+	token, err := s.ClientManager.NewRegistrationAccessToken(creds.ID)
+	if err != nil {
+		log.Errorf("Failed to issue registration access token: %v", err)
+		return nil, newAPIError(oauth2.ErrorServerError, "unable to save client metadata")
+	}
+
+	resp := &oidc.ClientRegistrationResponse{
+		ClientID:                creds.ID,
+		ClientSecret:            creds.Secret,
+		RegistrationAccessToken: token,
+		RegistrationClientURI:   s.clientConfigurationURL(creds.ID),
+		ClientMetadata:          clientMetadata,
+	}
+	if clientMetadata.TokenEndpointAuthMethod == oauth2.AuthMethodPrivateKeyJWT {
+		// The client authenticates with its keys and never uses a secret.
+		resp.ClientSecret = ""
+	}
+	return resp, nil
+}
+
+// validTokenEndpointAuthMethod checks that the client's token endpoint
+// authentication method is supported, and that clients using private_key_jwt
+// register their keys either by value or by reference (RFC 7591 Section 2).
+func validTokenEndpointAuthMethod(m oidc.ClientMetadata) error {
+	method := m.TokenEndpointAuthMethod
+	if method == "" {
+		return nil
+	}
+	supported := false
+	for _, s := range tokenEndpointAuthMethodsSupported {
+		if s == method {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("token_endpoint_auth_method %q is not supported", method)
+	}
+	if method != oauth2.AuthMethodPrivateKeyJWT {
+		return nil
+	}
+	switch {
+	case m.JWKS != nil && m.JWKSURI != nil:
+		return errors.New("jwks and jwks_uri must not both be present")
+	case m.JWKS == nil && m.JWKSURI == nil:
+		return errors.New("private_key_jwt requires jwks or jwks_uri")
+	case m.JWKS != nil && len(m.JWKS.Keys) == 0:
+		return errors.New("jwks contains no keys")
+	}
+	return nil
+}
+
+// validIDTokenEncryption checks that clients asking for encrypted ID tokens
+// register the keys to encrypt them with.
+func validIDTokenEncryption(m oidc.ClientMetadata) error {
+	if m.IDTokenResponseOptions.EncryptionAlg == "" {
+		return nil
+	}
+	if m.JWKS == nil && m.JWKSURI == nil {
+		return errors.New("id_token_encrypted_response_alg requires jwks or jwks_uri")
+	}
+	if m.JWKS != nil {
+		if _, err := clientEncryptionKey(m.JWKS.Keys, m.IDTokenResponseOptions.EncryptionAlg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientConfigurationURL returns the URL at which a dynamically registered
+// client manages its registration (RFC 7592 Section 2).
+func (s *Server) clientConfigurationURL(clientID string) string {
+	u := s.absURL(httpPathClientRegistration, clientID)
+	return u.String()
+}
+
+// handleClientConfiguration lets dynamically registered clients read, update
+// and delete their registration, authenticated by the registration access
+// token they were issued (RFC 7592).
+func (s *Server) handleClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "PUT", "DELETE":
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET, PUT or DELETE only acceptable methods")
+		return
+	}
+
+	prefix := s.absURL(httpPathClientRegistration).Path + "/"
+	clientID := strings.TrimPrefix(r.URL.Path, prefix)
+	if clientID == "" || strings.Contains(clientID, "/") {
+		writeAPIError(w, http.StatusNotFound, newAPIError(oauth2.ErrorInvalidRequest, "unknown client configuration endpoint"))
+		return
+	}
+
+	// Requests for clients which do not exist are rejected like those with
+	// a wrong token, so the endpoint does not reveal which clients exist
+	// (RFC 7592 Section 2).
+	token, err := oidc.ExtractBearerToken(r)
+	if err != nil {
+		log.Errorf("client configuration request without registration access token: %v", err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.ClientManager.AuthenticateRegistrationAccessToken(clientID, token)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(oauth2.ErrorServerError, ""))
+		return
+	}
+	if !ok {
+		log.Errorf("Invalid registration access token for client %s", clientID)
+		writeBearerError(w, oauth2.NewError(errorInvalidToken))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		resp, aerr := s.clientConfiguration(clientID)
+		if aerr != nil {
+			writeAPIError(w, http.StatusInternalServerError, aerr)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, resp)
+	case "PUT":
+		resp, aerr := s.handleClientUpdateRequest(clientID, r)
+		if aerr != nil {
+			code := http.StatusBadRequest
+			if aerr.Type == oauth2.ErrorServerError {
+				code = http.StatusInternalServerError
+			}
+			writeAPIError(w, code, aerr)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, resp)
+	case "DELETE":
+		if err := s.ClientManager.Delete(clientID); err != nil {
+			log.Errorf("Failed to delete client %s: %v", clientID, err)
+			writeAPIError(w, http.StatusInternalServerError, newAPIError(oauth2.ErrorServerError, ""))
+			return
+		}
+		log.Infof("Client deleted through its configuration endpoint: clientID=%s", clientID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleClientUpdateRequest(clientID string, r *http.Request) (*oidc.ClientRegistrationResponse, *apiError) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxClientUpdateRequestSize+1))
+	if err != nil {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, err.Error())
+	}
+	if len(body) > maxClientUpdateRequestSize {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, fmt.Sprintf("request is larger than %d bytes", maxClientUpdateRequestSize))
+	}
+	// The update request carries the client's credentials alongside its
+	// metadata (RFC 7592 Section 2.2).
+	var creds struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, err.Error())
+	}
+	if creds.ClientID != clientID {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, "client_id does not match the client")
+	}
+	if creds.ClientSecret != "" {
+		ok, err := s.ClientManager.Authenticate(oidc.ClientCredentials{ID: clientID, Secret: creds.ClientSecret})
+		if err != nil {
+			log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+			return nil, newAPIError(oauth2.ErrorServerError, "")
+		}
+		if !ok {
+			return nil, newAPIError(oauth2.ErrorInvalidRequest, "client_secret does not match the client")
+		}
+	}
+
+	var clientMetadata oidc.ClientMetadata
+	if err := json.Unmarshal(body, &clientMetadata); err != nil {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, err.Error())
+	}
+	if err := s.ProviderConfig().Supports(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := validTokenEndpointAuthMethod(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := validIDTokenEncryption(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := s.validSubjectType(clientMetadata); err != nil {
+		return nil, newAPIError(invalidClientMetadata, err.Error())
+	}
+
+	if err := s.ClientManager.UpdateMetadata(clientID, clientMetadata); err != nil {
+		if _, ok := err.(client.ValidationError); ok {
+			return nil, newAPIError(invalidClientMetadata, err.Error())
+		}
+		log.Errorf("Failed to update client %s: %v", clientID, err)
+		return nil, newAPIError(oauth2.ErrorServerError, "unable to save client metadata")
+	}
+	log.Infof("Client updated through its configuration endpoint: clientID=%s", clientID)
+
+	return s.clientConfiguration(clientID)
+}
+
+// clientConfiguration returns the registration of the client. Its secret and
+// registration access token are only stored hashed, so neither is returned.
+func (s *Server) clientConfiguration(clientID string) (*oidc.ClientRegistrationResponse, *apiError) {
+	metadata, err := s.ClientManager.Metadata(clientID)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+		return nil, newAPIError(oauth2.ErrorServerError, "")
+	}
 	return &oidc.ClientRegistrationResponse{
-		ClientID:       creds.ID,
-		ClientSecret:   creds.Secret,
-		ClientMetadata: clientMetadata,
+		ClientID:              clientID,
+		RegistrationClientURI: s.clientConfigurationURL(clientID),
+		ClientMetadata:        *metadata,
 	}, nil
 }
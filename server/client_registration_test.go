@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,9 @@ import (
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/client"
 )
 
 func TestClientRegistration(t *testing.T) {
@@ -61,7 +65,7 @@ func TestClientRegistration(t *testing.T) {
 				],
 				"client_name": "My Example",
 				"logo_uri": "https://client.example.org/logo.png",
-				"subject_type": "pairwise",
+				"subject_type": "public",
 				"sector_identifier_uri": "https://other.example.net/file_of_redirect_uris.json",
 				"token_endpoint_auth_method": "client_secret_basic",
 				"jwks_uri": "https://client.example.org/my_public_keys.jwks",
@@ -71,6 +75,79 @@ func TestClientRegistration(t *testing.T) {
 			}`,
 			http.StatusCreated,
 		},
+		{
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"token_endpoint_auth_method": "private_key_jwt",
+				"jwks_uri": "https://client.example.org/my_public_keys.jwks"
+			}`,
+			http.StatusCreated,
+		},
+		{
+			// private_key_jwt without keys.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"token_endpoint_auth_method": "private_key_jwt"
+			}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"id_token_signed_response_alg": "ES256"
+			}`,
+			http.StatusCreated,
+		},
+		{
+			// Unsupported id_token_signed_response_alg.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"id_token_signed_response_alg": "HS256"
+			}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"jwks_uri": "https://client.example.org/keys",
+				"id_token_encrypted_response_alg": "RSA-OAEP-256",
+				"id_token_encrypted_response_enc": "A256GCM"
+			}`,
+			http.StatusCreated,
+		},
+		{
+			// Encrypted ID tokens without keys to encrypt them with.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"id_token_encrypted_response_alg": "RSA-OAEP-256"
+			}`,
+			http.StatusBadRequest,
+		},
+		{
+			// Unsupported id_token_encrypted_response_alg.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"jwks_uri": "https://client.example.org/keys",
+				"id_token_encrypted_response_alg": "RSA1_5"
+			}`,
+			http.StatusBadRequest,
+		},
+		{
+			// Pairwise subjects are not configured.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"subject_type": "pairwise"
+			}`,
+			http.StatusBadRequest,
+		},
+		{
+			// Unsupported token_endpoint_auth_method.
+			`{
+				"redirect_uris": ["https://client.example.org/callback"],
+				"token_endpoint_auth_method": "client_secret_jwt"
+			}`,
+			http.StatusBadRequest,
+		},
 	}
 
 	var handler http.Handler
@@ -142,6 +219,15 @@ func TestClientRegistration(t *testing.T) {
 			if r.ClientID == "" {
 				return fmt.Errorf("no client id in registration response")
 			}
+			if r.ClientMetadata.TokenEndpointAuthMethod == oauth2.AuthMethodPrivateKeyJWT && r.ClientSecret != "" {
+				return fmt.Errorf("private_key_jwt client was issued a secret")
+			}
+			if r.RegistrationAccessToken == "" {
+				return fmt.Errorf("no registration access token in registration response")
+			}
+			if want := testServer.URL + "/registration/" + r.ClientID; r.RegistrationClientURI != want {
+				return fmt.Errorf("want registration_client_uri=%q, got %q", want, r.RegistrationClientURI)
+			}
 
 			metadata, err := fixtures.clientManager.Metadata(r.ClientID)
 			if err != nil {
@@ -159,3 +245,218 @@ func TestClientRegistration(t *testing.T) {
 		}
 	}
 }
+
+func TestClientConfiguration(t *testing.T) {
+	var handler http.Handler
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+	issuerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// register returns fixtures with a dynamically registered client.
+	register := func() (*testFixtures, oidc.ClientRegistrationResponse) {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.IssuerURL = *issuerURL
+		f.srv.EnableClientRegistration = true
+		handler = f.srv.HTTPHandler()
+
+		body := `{"redirect_uris": ["https://client.example.org/callback"]}`
+		resp, err := http.Post(testServer.URL+"/registration", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POSTing client metadata: %v", err)
+		}
+		defer resp.Body.Close()
+		var r oidc.ClientRegistrationResponse
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return f, r
+	}
+
+	do := func(method, uri, token, body string) *http.Response {
+		req, err := http.NewRequest(method, uri, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unable to create HTTP request: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, uri, err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		method string
+		// body is a format string given the client ID and secret.
+		body     string
+		badToken bool
+		otherURI bool
+
+		wantCode        int
+		wantRedirectURI string
+	}{
+		{
+			method:          "GET",
+			wantCode:        http.StatusOK,
+			wantRedirectURI: "https://client.example.org/callback",
+		},
+		{
+			method:   "GET",
+			badToken: true,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:   "GET",
+			otherURI: true,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:          "PUT",
+			body:            `{"client_id": %q, "redirect_uris": ["https://client.example.org/cb"]}`,
+			wantCode:        http.StatusOK,
+			wantRedirectURI: "https://client.example.org/cb",
+		},
+		{
+			method:          "PUT",
+			body:            `{"client_id": %q, "client_secret": %q, "redirect_uris": ["https://client.example.org/cb"]}`,
+			wantCode:        http.StatusOK,
+			wantRedirectURI: "https://client.example.org/cb",
+		},
+		{
+			method:   "PUT",
+			body:     `{"client_id": %q, "client_secret": "wrong", "redirect_uris": ["https://client.example.org/cb"]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			method:   "PUT",
+			body:     `{"client_id": "other", "redirect_uris": ["https://client.example.org/cb"]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			method:   "PUT",
+			body:     `{"client_id": %q, "redirect_uris": []}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			method:   "PUT",
+			body:     `{"client_id": %q, "client_name": "` + strings.Repeat("x", maxClientUpdateRequestSize) + `", "redirect_uris": ["https://client.example.org/cb"]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			method:   "PUT",
+			body:     `{"client_id": %q, "redirect_uris": ["https://client.example.org/cb"]}`,
+			badToken: true,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:   "DELETE",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			method:   "DELETE",
+			badToken: true,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:   "POST",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tt := range tests {
+		f, reg := register()
+
+		uri, token := reg.RegistrationClientURI, reg.RegistrationAccessToken
+		if tt.badToken {
+			token = base64.URLEncoding.EncodeToString([]byte("wrong"))
+		}
+		if tt.otherURI {
+			uri = testServer.URL + "/registration/" + testClientID
+		}
+		body := tt.body
+		if strings.Count(body, "%q") == 2 {
+			body = fmt.Sprintf(body, reg.ClientID, reg.ClientSecret)
+		} else if strings.Contains(body, "%q") {
+			body = fmt.Sprintf(body, reg.ClientID)
+		}
+
+		accessToken, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+			UserID:   testUserID1,
+			ClientID: reg.ClientID,
+			Scope:    []string{"openid"},
+		})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating access token: %v", i, err)
+		}
+
+		resp := do(tt.method, uri, token, body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, resp.StatusCode)
+			continue
+		}
+
+		_, err = f.clientManager.Get(reg.ClientID)
+		if tt.method == "DELETE" && resp.StatusCode == http.StatusNoContent {
+			if err != client.ErrorNotFound {
+				t.Errorf("case %d: want client deleted, got err=%v", i, err)
+			}
+			// So are the tokens issued to it.
+			ti, err := f.srv.IntrospectToken(testClientCredentials, accessToken, "")
+			if err != nil || ti.Active {
+				t.Errorf("case %d: want access token inactive after deleting the client, got=%v err=%v", i, ti, err)
+			}
+			if _, err := f.srv.UserInfo(accessToken); err == nil {
+				t.Errorf("case %d: want UserInfo to reject the access token after deleting the client", i)
+			}
+			// The registration access token is gone with the client.
+			resp := do("GET", uri, token, "")
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("case %d: want code=%d after deleting the client, got=%d", i, http.StatusUnauthorized, resp.StatusCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error getting client: %v", i, err)
+			continue
+		}
+		if tt.wantRedirectURI == "" {
+			continue
+		}
+
+		// Read the configuration back, and check that the client can still
+		// authenticate with its secret.
+		resp = do("GET", uri, token, "")
+		var r oidc.ClientRegistrationResponse
+		err = json.NewDecoder(resp.Body).Decode(&r)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("case %d: decode response: %v", i, err)
+			continue
+		}
+		if r.ClientID != reg.ClientID || r.RegistrationClientURI != reg.RegistrationClientURI {
+			t.Errorf("case %d: unexpected client configuration %#v", i, r)
+		}
+		if r.ClientSecret != "" || r.RegistrationAccessToken != "" {
+			t.Errorf("case %d: client configuration must not carry secrets", i)
+		}
+		if len(r.RedirectURIs) != 1 || r.RedirectURIs[0].String() != tt.wantRedirectURI {
+			t.Errorf("case %d: want redirect_uris=[%s], got %v", i, tt.wantRedirectURI, r.RedirectURIs)
+		}
+		ok, err := f.srv.authenticateClient(oidc.ClientCredentials{ID: reg.ClientID, Secret: reg.ClientSecret})
+		if err != nil || !ok {
+			t.Errorf("case %d: want client to authenticate with its secret, got ok=%t err=%v", i, ok, err)
+		}
+	}
+}
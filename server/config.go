@@ -1,6 +1,9 @@
 package server
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,13 +19,18 @@ import (
 	"github.com/coreos/go-oidc/key"
 	"github.com/coreos/pkg/health"
 	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/email"
+	"github.com/coreos/dex/refresh"
+	"github.com/coreos/dex/session"
 	sessionmanager "github.com/coreos/dex/session/manager"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/dex/user"
 	useremail "github.com/coreos/dex/user/email"
 	usermanager "github.com/coreos/dex/user/manager"
@@ -41,6 +49,13 @@ type ServerConfig struct {
 	EnableClientRegistration     bool
 	EnableClientCredentialAccess bool
 	RegisterOnFirstLogin         bool
+	AccessTokenValidityWindow    time.Duration
+	BrowserSessionValidityWindow time.Duration
+	RevokeRefreshTokensOnLogout  bool
+	RefreshTokenIdleTimeout      time.Duration
+	RefreshTokenLifetime         time.Duration
+	PairwiseSubjectSalt          string
+	ResourceServersFile          string
 }
 
 type StateConfigurer interface {
@@ -70,19 +85,41 @@ func (cfg *ServerConfig) Server() (*Server, error) {
 		return nil, err
 	}
 
+	resourceServers, err := loadResourceServers(cfg.ResourceServersFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read resource servers from file %s: %v", cfg.ResourceServersFile, err)
+	}
+
 	km := key.NewPrivateKeyManager()
+	skm := signing.NewKeyManager()
 	srv := Server{
-		IssuerURL:  *iu,
-		KeyManager: km,
-		Templates:  tpl,
+		IssuerURL:         *iu,
+		KeyManager:        km,
+		SigningKeyManager: skm,
+		Templates:         tpl,
 
-		HealthChecks: []health.Checkable{km},
+		HealthChecks: []health.Checkable{km, signingKeysHealth{skm}},
 		Connectors:   []connector.Connector{},
 
 		EnableRegistration:           cfg.EnableRegistration,
 		EnableClientRegistration:     cfg.EnableClientRegistration,
 		EnableClientCredentialAccess: cfg.EnableClientCredentialAccess,
 		RegisterOnFirstLogin:         cfg.RegisterOnFirstLogin,
+		AccessTokenValidityWindow:    cfg.AccessTokenValidityWindow,
+		BrowserSessionValidityWindow: cfg.BrowserSessionValidityWindow,
+		RevokeRefreshTokensOnLogout:  cfg.RevokeRefreshTokensOnLogout,
+		PairwiseSubjectSalt:          cfg.PairwiseSubjectSalt,
+		ResourceServers:              resourceServers,
+		RefreshTokenExpiry: refresh.ExpiryPolicy{
+			IdleTimeout: cfg.RefreshTokenIdleTimeout,
+			Lifetime:    cfg.RefreshTokenLifetime,
+		},
+	}
+	if srv.AccessTokenValidityWindow == 0 {
+		srv.AccessTokenValidityWindow = accesstoken.DefaultAccessTokenValidityWindow
+	}
+	if srv.BrowserSessionValidityWindow == 0 {
+		srv.BrowserSessionValidityWindow = session.DefaultBrowserSessionValidityWindow
 	}
 
 	err = cfg.StateConfig.Configure(&srv)
@@ -116,6 +153,19 @@ func (cfg *SingleServerConfig) Configure(srv *Server) error {
 		return err
 	}
 
+	var sks []*signing.PrivateKey
+	for _, alg := range signing.Algs {
+		sk, err := signing.GeneratePrivateKey(alg)
+		if err != nil {
+			return err
+		}
+		sks = append(sks, sk)
+	}
+	sigRepo := signing.NewPrivateKeySetRepo()
+	if err = sigRepo.Set(signing.NewPrivateKeySet(sks, time.Now().Add(24*time.Hour))); err != nil {
+		return err
+	}
+
 	clients, err := loadClients(cfg.ClientsFile)
 	if err != nil {
 		return fmt.Errorf("unable to read clients from file %s: %v", cfg.ClientsFile, err)
@@ -158,7 +208,8 @@ func (cfg *SingleServerConfig) Configure(srv *Server) error {
 		return err
 	}
 
-	refTokRepo := db.NewRefreshTokenRepo(dbMap)
+	refTokRepo := db.NewRefreshTokenRepoWithExpiry(dbMap, srv.RefreshTokenExpiry, clockwork.NewRealClock())
+	accTokRepo := db.NewAccessTokenRepo(dbMap)
 
 	txnFactory := db.TransactionFactory(dbMap)
 	userManager := usermanager.NewUserManager(userRepo, pwiRepo, cfgRepo, txnFactory, usermanager.ManagerOptions{})
@@ -169,17 +220,40 @@ func (cfg *SingleServerConfig) Configure(srv *Server) error {
 	srv.ClientRepo = clientRepo
 	srv.ClientManager = clientManager
 	srv.KeySetRepo = kRepo
+	srv.SigningKeySetRepo = sigRepo
 	srv.ConnectorConfigRepo = cfgRepo
 	srv.UserRepo = userRepo
 	srv.UserManager = userManager
 	srv.PasswordInfoRepo = pwiRepo
 	srv.SessionManager = sm
 	srv.RefreshTokenRepo = refTokRepo
+	srv.AccessTokenRepo = accTokRepo
+	srv.BrowserSessionRepo = db.NewBrowserSessionRepo(dbMap)
+	srv.PushedAuthRequestRepo = db.NewPushedAuthRequestRepo(dbMap)
+	srv.ClientAssertionRepo = db.NewClientAssertionRepo(dbMap)
+	srv.GrantRepo = db.NewGrantRepo(dbMap)
+	srv.PairwiseSubjectRepo = db.NewPairwiseSubjectRepo(dbMap)
+	srv.DeviceCodeRepo = db.NewDeviceCodeRepo(dbMap)
 	srv.HealthChecks = append(srv.HealthChecks, db.NewHealthChecker(dbMap))
 	srv.dbMap = dbMap
+
+	// Browser sessions are kept in memory, so their cookies only need to
+	// outlive the process.
+	srv.BrowserSessionCookieKey = make([]byte, 32)
+	if _, err := rand.Read(srv.BrowserSessionCookieKey); err != nil {
+		return err
+	}
 	return nil
 }
 
+// browserSessionCookieKey derives the key of SSO cookies from a key secret,
+// so that every dex-worker sharing the database accepts them.
+func browserSessionCookieKey(secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("dex browser session cookie"))
+	return h.Sum(nil)
+}
+
 // loadUsers parses the user.json file and returns the users to be created.
 func loadUsers(filepath string) ([]user.UserWithRemoteIdentities, []user.PasswordInfo, error) {
 	f, err := os.Open(filepath)
@@ -257,6 +331,10 @@ func (cfg *MultiServerConfig) Configure(srv *Server) error {
 	if err != nil {
 		return fmt.Errorf("unable to create PrivateKeySetRepo: %v", err)
 	}
+	sigRepo, err := db.NewSigningKeySetRepo(dbc, cfg.KeySecrets...)
+	if err != nil {
+		return fmt.Errorf("unable to create SigningKeySetRepo: %v", err)
+	}
 
 	ciRepo := db.NewClientRepo(dbc)
 	sRepo := db.NewSessionRepo(dbc)
@@ -266,21 +344,31 @@ func (cfg *MultiServerConfig) Configure(srv *Server) error {
 	pwiRepo := db.NewPasswordInfoRepo(dbc)
 	userManager := usermanager.NewUserManager(userRepo, pwiRepo, cfgRepo, db.TransactionFactory(dbc), usermanager.ManagerOptions{})
 	clientManager := clientmanager.NewClientManager(ciRepo, db.TransactionFactory(dbc), clientmanager.ManagerOptions{})
-	refreshTokenRepo := db.NewRefreshTokenRepo(dbc)
+	refreshTokenRepo := db.NewRefreshTokenRepoWithExpiry(dbc, srv.RefreshTokenExpiry, clockwork.NewRealClock())
+	accessTokenRepo := db.NewAccessTokenRepo(dbc)
 
 	sm := sessionmanager.NewSessionManager(sRepo, skRepo)
 
 	srv.ClientRepo = ciRepo
 	srv.ClientManager = clientManager
 	srv.KeySetRepo = kRepo
+	srv.SigningKeySetRepo = sigRepo
 	srv.ConnectorConfigRepo = cfgRepo
 	srv.UserRepo = userRepo
 	srv.UserManager = userManager
 	srv.PasswordInfoRepo = pwiRepo
 	srv.SessionManager = sm
 	srv.RefreshTokenRepo = refreshTokenRepo
+	srv.AccessTokenRepo = accessTokenRepo
+	srv.BrowserSessionRepo = db.NewBrowserSessionRepo(dbc)
+	srv.PushedAuthRequestRepo = db.NewPushedAuthRequestRepo(dbc)
+	srv.ClientAssertionRepo = db.NewClientAssertionRepo(dbc)
+	srv.GrantRepo = db.NewGrantRepo(dbc)
+	srv.PairwiseSubjectRepo = db.NewPairwiseSubjectRepo(dbc)
+	srv.DeviceCodeRepo = db.NewDeviceCodeRepo(dbc)
 	srv.HealthChecks = append(srv.HealthChecks, db.NewHealthChecker(dbc))
 	srv.dbMap = dbc
+	srv.BrowserSessionCookieKey = browserSessionCookieKey(cfg.KeySecrets[0])
 	return nil
 }
 
@@ -321,6 +409,9 @@ func setTemplates(srv *Server, tpls *template.Template) error {
 		{SendResetPasswordEmailTemplateName, &srv.SendResetPasswordEmailTemplate},
 		{ResetPasswordTemplateName, &srv.ResetPasswordTemplate},
 		{OOBTemplateName, &srv.OOBTemplate},
+		{LogoutTemplateName, &srv.LogoutTemplate},
+		{ConsentTemplateName, &srv.ConsentTemplate},
+		{DeviceTemplateName, &srv.DeviceTemplate},
 	} {
 		tpl, err := findTemplate(t.templateName, tpls)
 		if err != nil {
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/grant"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
+)
+
+// consentScopes are the scopes a user must approve on the consent page before
+// a client is granted them. So are the scopes of resource servers.
+var consentScopes = []string{"offline_access", scope.ScopeGroups}
+
+type consentTemplateData struct {
+	Error   bool
+	Message string
+
+	Code       string
+	ClientName string
+	Scopes     []string
+
+	// Resources are the resource servers the client is asking access to.
+	Resources []consentResource
+}
+
+// consentResource is a resource server as shown on the consent page, along
+// with the scopes of it the client is asking for.
+type consentResource struct {
+	ID     string
+	Scopes []string
+}
+
+// scopeDescription returns what a scope lets the client do, as shown on the
+// consent page.
+func scopeDescription(s string) string {
+	switch {
+	case s == "openid":
+		return "Verify your identity"
+	case s == "email":
+		return "View your email address"
+	case s == scope.ScopeProfile:
+		return "View your basic profile"
+	case s == scope.ScopeGroups:
+		return "View the groups you belong to"
+	case s == "offline_access":
+		return "Access your account while you are not using it"
+	case strings.HasPrefix(s, scope.ScopeGoogleCrossClient):
+		return fmt.Sprintf("Log you in to %s", s[len(scope.ScopeGoogleCrossClient):])
+	}
+	return s
+}
+
+// handleConsentFunc shows the user the scopes a client is asking for, and
+// records their decision. The code identifies a session whose user has been
+// identified.
+func handleConsentFunc(s *Server, tpl *template.Template) http.HandlerFunc {
+	errPage := func(w http.ResponseWriter, msg string, status int) {
+		execTemplateWithStatus(w, tpl, consentTemplateData{Error: true, Message: msg}, status)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			w.Header().Set("Allow", "GET, POST")
+			errPage(w, "GET or POST only acceptable methods", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			errPage(w, "There was a problem processing your request.", http.StatusBadRequest)
+			return
+		}
+
+		sessionID, err := s.SessionManager.ExchangeKey(r.Form.Get("code"))
+		if err != nil {
+			errPage(w, "Please authenticate before granting access.", http.StatusUnauthorized)
+			return
+		}
+		ses, err := s.SessionManager.Get(sessionID)
+		if err != nil || ses == nil || ses.State != session.SessionStateIdentified {
+			errPage(w, "Please authenticate before granting access.", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == "GET" {
+			cli, err := s.Client(ses.ClientID)
+			if err != nil {
+				log.Errorf("Failed fetching client %q from repo: %v", ses.ClientID, err)
+				errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+				return
+			}
+			code, err := s.SessionManager.NewSessionKey(sessionID)
+			if err != nil {
+				log.Errorf("Failed creating session key: %v", err)
+				errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+				return
+			}
+
+			data := consentTemplateData{
+				Code:       code,
+				ClientName: cli.Metadata.ClientName,
+			}
+			if data.ClientName == "" {
+				data.ClientName = cli.Credentials.ID
+			}
+			for _, sc := range ses.Scope {
+				if !s.isResourceScope(sc) {
+					data.Scopes = append(data.Scopes, scopeDescription(sc))
+				}
+			}
+			data.Resources, err = s.consentResources(ses)
+			if err != nil {
+				log.Errorf("Failed resolving resources of session %s: %v", ses.ID, err)
+				errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+				return
+			}
+			execTemplate(w, tpl, data)
+			return
+		}
+
+		var ru string
+		if r.PostForm.Get("approve") != "" {
+			ru, err = s.grantConsent(ses)
+		} else {
+			log.Infof("Session %s consent denied: clientID=%s userID=%s", ses.ID, ses.ClientID, ses.UserID)
+			ru, err = s.authErrorRedirect(ses, oauth2.ErrorAccessDenied)
+		}
+		if err != nil {
+			log.Errorf("Failed completing consent: %v", err)
+			errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, ru, http.StatusSeeOther)
+	}
+}
+
+// consentRequired reports whether the user must approve the scopes of the
+// session before the client is granted them: either because the client asked
+// for consent with the prompt parameter, or because some of the scopes that
+// need consent have not been approved before.
+func (s *Server) consentRequired(ses *session.Session) (bool, error) {
+	prompt, err := parsePrompt(ses.Prompt)
+	if err != nil {
+		return false, err
+	}
+	if prompt[promptConsent] {
+		return true, nil
+	}
+
+	var needed []string
+	for _, sc := range consentScopes {
+		if ses.Scope.HasScope(sc) {
+			needed = append(needed, sc)
+		}
+	}
+	for _, sc := range ses.Scope {
+		if s.isResourceScope(sc) {
+			needed = append(needed, sc)
+		}
+	}
+	if len(needed) == 0 {
+		return false, nil
+	}
+
+	g, err := s.GrantRepo.Get(ses.UserID, ses.ClientID)
+	if err == grant.ErrorNotFound {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !g.Includes(needed), nil
+}
+
+// consentResources returns the resource servers of the session, with the
+// scopes of each the client asked for.
+func (s *Server) consentResources(ses *session.Session) ([]consentResource, error) {
+	rss, err := s.ResolveResources(ses.ClientID, ses.Resources)
+	if err != nil {
+		return nil, err
+	}
+	var crs []consentResource
+	for _, rs := range rss {
+		cr := consentResource{ID: rs.ID}
+		for _, sc := range ses.Scope {
+			if rs.allowsScope(sc) {
+				cr.Scopes = append(cr.Scopes, sc)
+			}
+		}
+		crs = append(crs, cr)
+	}
+	return crs, nil
+}
+
+// consentRedirect returns the URL of the consent page for the session, or
+// the consent_required error if the client asked for no interaction with the
+// user.
+func (s *Server) consentRedirect(ses *session.Session) (string, error) {
+	prompt, err := parsePrompt(ses.Prompt)
+	if err != nil {
+		return "", err
+	}
+	if prompt[promptNone] {
+		return s.authErrorRedirect(ses, errorConsentRequired)
+	}
+
+	code, err := s.SessionManager.NewSessionKey(ses.ID)
+	if err != nil {
+		return "", fmt.Errorf("creating new session key: %v", err)
+	}
+	ru := s.absURL(httpPathConsent)
+	q := ru.Query()
+	q.Set("code", code)
+	ru.RawQuery = q.Encode()
+	return ru.String(), nil
+}
+
+// grantConsent records that the user approved the scopes of the session for
+// its client, and returns the URL that sends the authentication response to
+// the client.
+func (s *Server) grantConsent(ses *session.Session) (string, error) {
+	now := s.SessionManager.Clock.Now()
+	g, err := s.GrantRepo.Get(ses.UserID, ses.ClientID)
+	if err == grant.ErrorNotFound {
+		g = &grant.Grant{
+			UserID:    ses.UserID,
+			ClientID:  ses.ClientID,
+			CreatedAt: now,
+		}
+	} else if err != nil {
+		return "", err
+	}
+	for _, sc := range ses.Scope {
+		if !g.Scope.HasScope(sc) {
+			g.Scope = append(g.Scope, sc)
+		}
+	}
+	g.UpdatedAt = now
+	if err := s.GrantRepo.Set(*g); err != nil {
+		return "", err
+	}
+	log.Infof("Session %s consent granted: clientID=%s userID=%s scope=%q", ses.ID, ses.ClientID, ses.UserID, ses.Scope)
+
+	usr, err := s.UserRepo.Get(nil, ses.UserID)
+	if err != nil {
+		return "", fmt.Errorf("getting user: %v", err)
+	}
+	return s.authResponseRedirect(ses, usr)
+}
+
+// authErrorRedirect ends the session and returns the URL that sends the
+// error to the client.
+func (s *Server) authErrorRedirect(ses *session.Session, errType string) (string, error) {
+	if _, err := s.SessionManager.Kill(ses.ID); err != nil {
+		return "", fmt.Errorf("killing session: %v", err)
+	}
+
+	v := url.Values{}
+	v.Set("error", errType)
+	v.Set("state", ses.ClientState)
+	if isDeviceCallbackURL(s.IssuerURL, &ses.RedirectURL) {
+		// The device callback only records errors of sessions it can
+		// exchange a key for.
+		key, err := s.SessionManager.NewSessionKey(ses.ID)
+		if err != nil {
+			return "", fmt.Errorf("creating session key: %v", err)
+		}
+		v.Set("code", key)
+	}
+	if isFragmentResponseType(ses.ResponseType) {
+		return fragmentRedirectURL(ses.RedirectURL, v), nil
+	}
+
+	ru := ses.RedirectURL
+	if ru.String() == client.OOBRedirectURI {
+		ru = s.absURL(httpPathOOB)
+	}
+	q := ru.Query()
+	for k := range v {
+		q.Set(k, v.Get(k))
+	}
+	ru.RawQuery = q.Encode()
+	return ru.String(), nil
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/grant"
+	"github.com/coreos/dex/session"
+)
+
+func TestServerLoginConsent(t *testing.T) {
+	tests := []struct {
+		scope     []string
+		resources []string
+		prompt    string
+		// granted is the scope the user has approved for the client before.
+		granted []string
+
+		wantConsent bool
+		wantError   string
+	}{
+		// scopes that don't need consent
+		{
+			scope: []string{"openid", "email"},
+		},
+		{
+			scope:       []string{"openid", "offline_access"},
+			wantConsent: true,
+		},
+		// consent remembered
+		{
+			scope:   []string{"openid", "offline_access"},
+			granted: []string{"openid", "offline_access"},
+		},
+		// consent for more scopes than remembered
+		{
+			scope:       []string{"openid", "email", "offline_access"},
+			granted:     []string{"openid", "email"},
+			wantConsent: true,
+		},
+		// client forces consent
+		{
+			scope:       []string{"openid"},
+			prompt:      "consent",
+			wantConsent: true,
+		},
+		{
+			scope:       []string{"openid", "offline_access"},
+			granted:     []string{"openid", "offline_access"},
+			prompt:      "consent",
+			wantConsent: true,
+		},
+		// client asks for no interaction
+		{
+			scope:     []string{"openid", "offline_access"},
+			prompt:    "none",
+			wantError: "consent_required",
+		},
+		{
+			scope:   []string{"openid", "offline_access"},
+			granted: []string{"openid", "offline_access"},
+			prompt:  "none",
+		},
+		// scopes of resource servers
+		{
+			scope:       []string{"openid", "orders:read"},
+			resources:   []string{testResourceServer.ID},
+			wantConsent: true,
+		},
+		{
+			scope:     []string{"openid", "orders:read"},
+			resources: []string{testResourceServer.ID},
+			granted:   []string{"openid", "orders:read"},
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.ResourceServers = []ResourceServer{testResourceServer}
+		if tt.granted != nil {
+			if err := f.srv.GrantRepo.Set(grant.Grant{UserID: testUserID1, ClientID: testClientID, Scope: tt.granted}); err != nil {
+				t.Fatalf("case %d: set grant: %v", i, err)
+			}
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, tt.scope, session.AuthParams{Prompt: tt.prompt, Resources: tt.resources})
+		if err != nil {
+			t.Fatalf("case %d: new session: %v", i, err)
+		}
+
+		ident := oidc.Identity{ID: testUserRemoteID1, Name: "elroy", Email: testUserEmail1}
+		redirectURL, err := f.srv.Login(ident, key)
+		if err != nil {
+			t.Errorf("case %d: server.Login: %v", i, err)
+			continue
+		}
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect URL: %v", i, err)
+			continue
+		}
+
+		if tt.wantConsent {
+			if u.Path != httpPathConsent || u.Query().Get("code") == "" {
+				t.Errorf("case %d: want redirect to consent page, got %s", i, redirectURL)
+			}
+			continue
+		}
+		if !strings.HasPrefix(redirectURL, testRedirectURL.String()) {
+			t.Errorf("case %d: want redirect to client, got %s", i, redirectURL)
+			continue
+		}
+		if got := u.Query().Get("error"); got != tt.wantError {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, got)
+		}
+		if tt.wantError == "" && u.Query().Get("code") == "" {
+			t.Errorf("case %d: want code in redirect, got %s", i, redirectURL)
+		}
+	}
+}
+
+func TestHandleConsentResources(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.ResourceServers = []ResourceServer{testResourceServer, testResourceServer2}
+
+	key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, []string{"openid", "orders:read"}, session.AuthParams{Resources: []string{testResourceServer.ID}})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	redirectURL, err := f.srv.Login(oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}, key)
+	if err != nil {
+		t.Fatalf("server.Login: %v", err)
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		t.Fatalf("invalid redirect URL: %v", err)
+	}
+	if u.Path != httpPathConsent {
+		t.Fatalf("want redirect to consent page, got %s", redirectURL)
+	}
+
+	hdlr := handleConsentFunc(f.srv, f.srv.ConsentTemplate)
+	w := httptest.NewRecorder()
+	hdlr.ServeHTTP(w, &http.Request{Method: "GET", URL: u, Header: http.Header{}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: want=%d, got=%d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{testResourceServer.ID, "orders:read"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("consent page does not show %q", want)
+		}
+	}
+	if strings.Contains(body, testResourceServer2.ID) {
+		t.Errorf("consent page shows a resource server the client did not ask for")
+	}
+}
+
+func TestHandleConsent(t *testing.T) {
+	tests := []struct {
+		form url.Values
+
+		wantError   string
+		wantGranted []string
+	}{
+		{
+			form:        url.Values{"approve": {"Allow"}},
+			wantGranted: []string{"openid", "email", "offline_access"},
+		},
+		{
+			form:      url.Values{"deny": {"Deny"}},
+			wantError: "access_denied",
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		// The user has approved some of the scopes before.
+		if err := f.srv.GrantRepo.Set(grant.Grant{UserID: testUserID1, ClientID: testClientID, Scope: []string{"openid", "email"}}); err != nil {
+			t.Fatalf("case %d: set grant: %v", i, err)
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, []string{"openid", "offline_access"}, session.AuthParams{})
+		if err != nil {
+			t.Fatalf("case %d: new session: %v", i, err)
+		}
+		ident := oidc.Identity{ID: testUserRemoteID1, Name: "elroy", Email: testUserEmail1}
+		redirectURL, err := f.srv.Login(ident, key)
+		if err != nil {
+			t.Fatalf("case %d: server.Login: %v", i, err)
+		}
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			t.Fatalf("case %d: invalid redirect URL: %v", i, err)
+		}
+
+		hdlr := handleConsentFunc(f.srv, f.srv.ConsentTemplate)
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, &http.Request{Method: "GET", URL: u, Header: http.Header{}})
+		if w.Code != http.StatusOK {
+			t.Errorf("case %d: GET: want=%d, got=%d", i, http.StatusOK, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), scopeDescription("offline_access")) {
+			t.Errorf("case %d: consent page does not describe offline_access", i)
+		}
+
+		// The code of the link is exchanged for the one in the form.
+		if _, err := f.srv.SessionManager.ExchangeKey(u.Query().Get("code")); err == nil {
+			t.Errorf("case %d: code of the consent page link was not exchanged", i)
+		}
+		m := regexp.MustCompile(`name="code" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Errorf("case %d: consent page has no code", i)
+			continue
+		}
+		code := m[1]
+
+		form := url.Values{}
+		for k, v := range tt.form {
+			form[k] = v
+		}
+		form.Set("code", code)
+
+		req, err := http.NewRequest("POST", httpPathConsent, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("case %d: new request: %v", i, err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case %d: POST: want=%d, got=%d", i, http.StatusSeeOther, w.Code)
+			continue
+		}
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		if !strings.HasPrefix(loc.String(), testRedirectURL.String()) {
+			t.Errorf("case %d: want redirect to client, got %s", i, loc)
+			continue
+		}
+		if got := loc.Query().Get("error"); got != tt.wantError {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, got)
+		}
+
+		g, err := f.srv.GrantRepo.Get(testUserID1, testClientID)
+		if err != nil {
+			t.Errorf("case %d: get grant: %v", i, err)
+			continue
+		}
+		want := tt.wantGranted
+		if want == nil {
+			want = []string{"openid", "email"}
+		}
+		if diff := pretty.Compare(want, []string(g.Scope)); diff != "" {
+			t.Errorf("case %d: Compare(want, got): %v", i, diff)
+		}
+	}
+}
@@ -253,6 +253,13 @@ func TestServerCodeTokenCrossClient(t *testing.T) {
 			wantAUD: []string{"client_a", "client_b"},
 			wantAZP: "client_a",
 		},
+		// client_b is not a trusted peer of client_a
+		{
+			clientID:     "client_b",
+			crossClients: []string{"client_a"},
+
+			wantErr: true,
+		},
 	}
 
 	for i, tt := range tests {
@@ -283,7 +290,13 @@ func TestServerCodeTokenCrossClient(t *testing.T) {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
 
-		jwt, token, expiresAt, err := f.srv.CodeToken(f.clientCreds[tt.clientID], key)
+		jwt, _, token, expiresAt, err := f.srv.CodeToken(f.clientCreds[tt.clientID], key, "", nil)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want error, got none", i)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
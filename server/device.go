@@ -0,0 +1,406 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/device"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+)
+
+const (
+	// grantTypeDeviceCode is the grant type devices poll the token endpoint
+	// with (RFC 8628 Section 3.4).
+	grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// deviceAuthorizationResponse is the response of the device authorization
+// endpoint (RFC 8628 Section 3.2).
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type deviceTemplateData struct {
+	Error   bool
+	Message string
+
+	// Done is set once the user has approved or denied the request.
+	Done     bool
+	UserCode string
+}
+
+// handleDeviceCodeFunc implements the device authorization endpoint. Devices
+// that can't show a browser, like CLIs, get a device code to poll the token
+// endpoint with and a user code for the user to enter on the verification
+// page.
+func handleDeviceCodeFunc(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, ok, err := clientCredentialsFromRequest(r)
+		if err != nil {
+			log.Errorf("error parsing client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+		if !ok {
+			// Public clients identify themselves with the client_id
+			// parameter (RFC 8628 Section 3.1).
+			creds.ID = r.PostForm.Get("client_id")
+			if creds.ID == "" {
+				log.Errorf("missing client credentials")
+				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+				return
+			}
+		}
+
+		var scopes []string
+		if sc := r.PostForm.Get("scope"); sc != "" {
+			scopes = strings.Split(sc, " ")
+		}
+
+		deviceCode, dc, err := s.NewDeviceCode(creds, scopes)
+		if err != nil {
+			log.Errorf("couldn't create device code: %v", err)
+			writeTokenError(w, err, "")
+			return
+		}
+
+		verificationURI := s.absURL(httpPathDevice)
+		complete := verificationURI
+		q := complete.Query()
+		q.Set("user_code", dc.UserCode)
+		complete.RawQuery = q.Encode()
+
+		resp := deviceAuthorizationResponse{
+			DeviceCode:              deviceCode,
+			UserCode:                dc.UserCode,
+			VerificationURI:         verificationURI.String(),
+			VerificationURIComplete: complete.String(),
+			ExpiresIn:               int64(dc.ExpiresAt.Sub(dc.CreatedAt).Seconds()),
+			Interval:                int64(dc.Interval.Seconds()),
+		}
+		b, err := json.Marshal(resp)
+		if err != nil {
+			log.Errorf("Failed marshaling %#v to JSON: %v", resp, err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorServerError), "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	}
+}
+
+// handleDeviceFunc serves the verification page, where the user enters the
+// user code shown by the device. The user is then sent through the
+// authorization endpoint to log in, with the device callback as the redirect
+// URL.
+func handleDeviceFunc(s *Server, tpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			w.Header().Set("Allow", "GET, POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			execTemplateWithStatus(w, tpl, deviceTemplateData{Error: true, Message: "There was a problem processing your request."}, http.StatusBadRequest)
+			return
+		}
+
+		userCode := r.Form.Get("user_code")
+		if userCode == "" {
+			execTemplate(w, tpl, deviceTemplateData{})
+			return
+		}
+
+		dc, err := s.pendingDeviceCode(userCode)
+		if err != nil {
+			log.Errorf("Invalid user code %q: %v", userCode, err)
+			execTemplateWithStatus(w, tpl, deviceTemplateData{
+				Error:    true,
+				Message:  "The code you entered is invalid or has expired. Please check the code shown on your device.",
+				UserCode: userCode,
+			}, http.StatusBadRequest)
+			return
+		}
+
+		// The user always confirms the request on the consent page, so a
+		// link to the verification page can't log them in to a device
+		// without them knowing.
+		callbackURL := s.absURL(httpPathDeviceCallback)
+		v := url.Values{}
+		v.Set("client_id", dc.ClientID)
+		v.Set("redirect_uri", callbackURL.String())
+		v.Set("response_type", oauth2.ResponseTypeCode)
+		v.Set("scope", strings.Join(dc.Scope, " "))
+		v.Set("state", dc.UserCode)
+		v.Set("prompt", promptConsent)
+		ru := s.absURL(httpPathAuth)
+		ru.RawQuery = v.Encode()
+		http.Redirect(w, r, ru.String(), http.StatusSeeOther)
+	}
+}
+
+// handleDeviceCallbackFunc receives the authentication response for a device
+// authorization request, and records the user's decision for the device to
+// pick up at the token endpoint.
+func handleDeviceCallbackFunc(s *Server, tpl *template.Template) http.HandlerFunc {
+	errPage := func(w http.ResponseWriter, msg string, status int) {
+		execTemplateWithStatus(w, tpl, deviceTemplateData{Error: true, Message: msg}, status)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "GET only acceptable method")
+			return
+		}
+
+		q := r.URL.Query()
+		dc, err := s.pendingDeviceCode(q.Get("state"))
+		if err != nil {
+			log.Errorf("Invalid device callback: %v", err)
+			errPage(w, "The code you entered is invalid or has expired. Please start again on your device.", http.StatusBadRequest)
+			return
+		}
+
+		// Both the user's decision and errors of the authentication request
+		// come with the key of the session started for the device code, so
+		// that others can't decide for the user.
+		e := q.Get("error")
+		sessionID, err := s.SessionManager.ExchangeKey(q.Get("code"))
+		if err != nil {
+			errPage(w, "Please authenticate before granting access.", http.StatusUnauthorized)
+			return
+		}
+		ses, err := s.SessionManager.Get(sessionID)
+		if err != nil || ses == nil || (e == "" && ses.State != session.SessionStateIdentified) {
+			errPage(w, "Please authenticate before granting access.", http.StatusUnauthorized)
+			return
+		}
+		if ses.ClientID != dc.ClientID || ses.ClientState != dc.UserCode {
+			log.Errorf("Session %s was not started for device code %s", ses.ID, dc.UserCode)
+			errPage(w, "There was a problem processing your request.", http.StatusBadRequest)
+			return
+		}
+
+		if e != "" {
+			log.Infof("Device code %s denied: clientID=%s error=%s", dc.UserCode, dc.ClientID, e)
+			dc.State = device.DeviceCodeStateDenied
+			if err := s.DeviceCodeRepo.Update(*dc); err != nil {
+				log.Errorf("Failed updating device code: %v", err)
+				errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+				return
+			}
+			execTemplate(w, tpl, deviceTemplateData{Done: true, Message: "Access was denied. You may close this window."})
+			return
+		}
+
+		dc.State = device.DeviceCodeStateApproved
+		dc.SessionID = ses.ID
+		if err := s.DeviceCodeRepo.Update(*dc); err != nil {
+			log.Errorf("Failed updating device code: %v", err)
+			errPage(w, "There was a problem processing your request.", http.StatusInternalServerError)
+			return
+		}
+		log.Infof("Device code %s approved: clientID=%s userID=%s", dc.UserCode, dc.ClientID, ses.UserID)
+		execTemplate(w, tpl, deviceTemplateData{Done: true, Message: "You are now logged in. You may close this window and return to your device."})
+	}
+}
+
+// isDeviceCallbackURL reports whether u is the redirect URL of device
+// authorization requests, which is served by dex rather than the client.
+func isDeviceCallbackURL(baseURL url.URL, u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	cb := baseURL
+	cb.Path = path.Join(cb.Path, httpPathDeviceCallback)
+	return u.String() == cb.String()
+}
+
+// authenticateDeviceClient authenticates a client making a device
+// authorization request or polling for its tokens. Public clients, which
+// have no secret, are identified by their ID alone.
+func (s *Server) authenticateDeviceClient(creds oidc.ClientCredentials) error {
+	if creds.Secret == "" {
+		cli, err := s.Client(creds.ID)
+		if err != nil {
+			log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+			return oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
+		if !cli.Public {
+			log.Errorf("Client %s is not public and did not provide a secret", creds.ID)
+			return oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
+		return nil
+	}
+
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+	return nil
+}
+
+// NewDeviceCode starts a device authorization request of the client for the
+// scopes. It returns the device code and the stored request, which holds the
+// user code.
+func (s *Server) NewDeviceCode(creds oidc.ClientCredentials, scopes []string) (string, *device.DeviceCode, error) {
+	if err := s.authenticateDeviceClient(creds); err != nil {
+		return "", nil, err
+	}
+	if err := validateScopes(s, creds.ID, scopes, "", nil); err != nil {
+		return "", nil, err
+	}
+
+	userCode, err := device.NewUserCode()
+	if err != nil {
+		log.Errorf("Failed to generate user code: %v", err)
+		return "", nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	now := s.SessionManager.Clock.Now()
+	dc := device.DeviceCode{
+		UserCode:  userCode,
+		ClientID:  creds.ID,
+		Scope:     scopes,
+		State:     device.DeviceCodeStatePending,
+		Interval:  device.DefaultPollInterval,
+		CreatedAt: now,
+		ExpiresAt: now.Add(device.DefaultDeviceCodeValidityWindow),
+	}
+	deviceCode, err := s.DeviceCodeRepo.Create(dc)
+	if err != nil {
+		log.Errorf("Failed to create device code: %v", err)
+		return "", nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	log.Infof("Device code %s created: clientID=%s scope=%q", userCode, creds.ID, scopes)
+	return deviceCode, &dc, nil
+}
+
+// pendingDeviceCode returns the device authorization request with the user
+// code if it is waiting for the user's decision.
+func (s *Server) pendingDeviceCode(userCode string) (*device.DeviceCode, error) {
+	userCode = device.NormalizeUserCode(userCode)
+	if userCode == "" {
+		return nil, device.ErrorNotFound
+	}
+	dc, err := s.DeviceCodeRepo.GetByUserCode(userCode)
+	if err != nil {
+		return nil, err
+	}
+	if dc.State != device.DeviceCodeStatePending || !s.SessionManager.Clock.Now().Before(dc.ExpiresAt) {
+		return nil, device.ErrorNotFound
+	}
+	return dc, nil
+}
+
+// DeviceToken returns the tokens of a device authorization request once the
+// user has approved it. Until then it returns the authorization_pending
+// error, or slow_down if the device polls more often than it was told to.
+func (s *Server) DeviceToken(creds oidc.ClientCredentials, deviceCode string) (*jose.JWT, string, string, time.Time, error) {
+	if err := s.authenticateDeviceClient(creds); err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+
+	dc, err := s.DeviceCodeRepo.Get(deviceCode)
+	if err != nil {
+		if err != device.ErrorNotFound {
+			log.Errorf("Failed fetching device code: %v", err)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+	if dc.ClientID != creds.ID {
+		log.Errorf("Device code %s was not issued to client %s", dc.UserCode, creds.ID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	now := s.SessionManager.Clock.Now()
+	if !now.Before(dc.ExpiresAt) {
+		return nil, "", "", time.Time{}, oauth2.NewError(errorExpiredToken)
+	}
+
+	switch dc.State {
+	case device.DeviceCodeStatePending:
+		oerr := oauth2.NewError(errorAuthorizationPending)
+		if !dc.LastPolledAt.IsZero() && now.Sub(dc.LastPolledAt) < dc.Interval {
+			// The device must wait 5 seconds longer from now on (RFC 8628
+			// Section 3.5).
+			dc.Interval += device.DefaultPollInterval
+			oerr = oauth2.NewError(errorSlowDown)
+		}
+		dc.LastPolledAt = now
+		if err := s.DeviceCodeRepo.Update(*dc); err != nil {
+			log.Errorf("Failed updating device code: %v", err)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		return nil, "", "", time.Time{}, oerr
+	case device.DeviceCodeStateDenied:
+		if err := s.DeviceCodeRepo.Delete(dc.UserCode); err != nil && err != device.ErrorNotFound {
+			log.Errorf("Failed deleting device code: %v", err)
+		}
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorAccessDenied)
+	}
+
+	// Deleting the device code ensures the tokens are only issued once.
+	if err := s.DeviceCodeRepo.Delete(dc.UserCode); err != nil {
+		if err == device.ErrorNotFound {
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+		}
+		log.Errorf("Failed deleting device code: %v", err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	ses, err := s.SessionManager.Kill(dc.SessionID)
+	if err != nil {
+		log.Errorf("Failed killing session %s of device code %s: %v", dc.SessionID, dc.UserCode, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	jwt, accessToken, refreshToken, expiresAt, err := s.sessionTokens(ses, ses.Resources)
+	if err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+
+	log.Infof("Device code %s token sent: clientID=%s", dc.UserCode, creds.ID)
+	return jwt, accessToken, refreshToken, expiresAt, nil
+}
@@ -0,0 +1,445 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/device"
+	"github.com/coreos/dex/session"
+)
+
+func TestHandleDeviceCode(t *testing.T) {
+	tests := []struct {
+		form     url.Values
+		username string
+		password string
+
+		wantCode int
+	}{
+		// public clients identify themselves with client_id
+		{
+			form:     url.Values{"client_id": {testPublicClientID}, "scope": {"openid offline_access"}},
+			wantCode: http.StatusOK,
+		},
+		// confidential clients authenticate
+		{
+			form:     url.Values{"scope": {"openid"}},
+			username: testClientID,
+			password: clientTestSecret,
+			wantCode: http.StatusOK,
+		},
+		{
+			form:     url.Values{"client_id": {testClientID}, "scope": {"openid"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			form:     url.Values{"scope": {"openid"}},
+			username: testClientID,
+			password: "bad-secret",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			form:     url.Values{"scope": {"openid"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		// invalid scopes
+		{
+			form:     url.Values{"client_id": {testPublicClientID}, "scope": {"email"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"client_id": {testPublicClientID}, "scope": {"openid bogus"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", "http://server.example.com/device/code", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.username != "" {
+			req.SetBasicAuth(url.QueryEscape(tt.username), url.QueryEscape(tt.password))
+		}
+
+		w := httptest.NewRecorder()
+		handleDeviceCodeFunc(f.srv).ServeHTTP(w, req)
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var resp deviceAuthorizationResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("case %d: invalid response: %v", i, err)
+			continue
+		}
+		if resp.DeviceCode == "" || resp.UserCode == "" {
+			t.Errorf("case %d: response has no device code or user code: %#v", i, resp)
+		}
+		if want := "http://server.example.com/device"; resp.VerificationURI != want {
+			t.Errorf("case %d: want verification_uri=%q, got=%q", i, want, resp.VerificationURI)
+		}
+		if !strings.HasPrefix(resp.VerificationURIComplete, resp.VerificationURI+"?user_code=") {
+			t.Errorf("case %d: unexpected verification_uri_complete %q", i, resp.VerificationURIComplete)
+		}
+		if resp.ExpiresIn != int64(device.DefaultDeviceCodeValidityWindow.Seconds()) {
+			t.Errorf("case %d: unexpected expires_in %d", i, resp.ExpiresIn)
+		}
+		if resp.Interval != int64(device.DefaultPollInterval.Seconds()) {
+			t.Errorf("case %d: unexpected interval %d", i, resp.Interval)
+		}
+	}
+}
+
+func TestHandleDevice(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	_, dc, err := f.srv.NewDeviceCode(oidc.ClientCredentials{ID: testPublicClientID}, []string{"openid"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		query url.Values
+
+		wantCode     int
+		wantRedirect bool
+	}{
+		{
+			query:    url.Values{},
+			wantCode: http.StatusOK,
+		},
+		{
+			query:        url.Values{"user_code": {dc.UserCode}},
+			wantCode:     http.StatusSeeOther,
+			wantRedirect: true,
+		},
+		// users may leave out the separator and type lower case
+		{
+			query:        url.Values{"user_code": {strings.ToLower(strings.Replace(dc.UserCode, "-", "", -1))}},
+			wantCode:     http.StatusSeeOther,
+			wantRedirect: true,
+		},
+		{
+			query:    url.Values{"user_code": {"BCDF-BCDF"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		req, err := http.NewRequest("GET", "http://server.example.com/device?"+tt.query.Encode(), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		handleDeviceFunc(f.srv, f.srv.DeviceTemplate).ServeHTTP(w, req)
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if !tt.wantRedirect {
+			continue
+		}
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		q := loc.Query()
+		want := url.Values{
+			"client_id":     {testPublicClientID},
+			"redirect_uri":  {"http://server.example.com/device/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"state":         {dc.UserCode},
+			"prompt":        {"consent"},
+		}
+		if loc.Path != httpPathAuth || q.Encode() != want.Encode() {
+			t.Errorf("case %d: unexpected redirect to %s", i, loc)
+		}
+	}
+}
+
+func TestHandleAuthFuncDeviceCallback(t *testing.T) {
+	tests := []struct {
+		query    url.Values
+		wantCode int
+	}{
+		{
+			query: url.Values{
+				"response_type": {"code"},
+				"redirect_uri":  {"http://server.example.com/device/callback"},
+				"client_id":     {testPublicClientID},
+				"connector_id":  {"fake"},
+				"scope":         {"openid"},
+				"prompt":        {"consent"},
+			},
+			wantCode: http.StatusFound,
+		},
+		// the user must be asked for consent
+		{
+			query: url.Values{
+				"response_type": {"code"},
+				"redirect_uri":  {"http://server.example.com/device/callback"},
+				"client_id":     {testPublicClientID},
+				"connector_id":  {"fake"},
+				"scope":         {"openid"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			query: url.Values{
+				"response_type": {"id_token"},
+				"redirect_uri":  {"http://server.example.com/device/callback"},
+				"client_id":     {testPublicClientID},
+				"connector_id":  {"fake"},
+				"scope":         {"openid"},
+				"prompt":        {"consent"},
+				"nonce":         {"foo"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		idpcs := []connector.Connector{
+			&fakeConnector{loginURL: "http://fake.example.com"},
+		}
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, nil, true)
+		req, err := http.NewRequest("GET", "http://server.example.com/auth?"+tt.query.Encode(), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+		}
+	}
+}
+
+// loginDeviceCode logs the user in to the device authorization request, and
+// returns the session shown on the consent page.
+func loginDeviceCode(t *testing.T, f *testFixtures, dc *device.DeviceCode) *session.Session {
+	key, err := f.srv.NewSession(testConnectorID1, dc.ClientID, dc.UserCode, f.srv.absURL(httpPathDeviceCallback), "", false, dc.Scope, session.AuthParams{Prompt: promptConsent})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ident := oidc.Identity{ID: testUserRemoteID1, Name: "elroy", Email: testUserEmail1}
+	ru, err := f.srv.Login(ident, key)
+	if err != nil {
+		t.Fatalf("server.Login: %v", err)
+	}
+	u, err := url.Parse(ru)
+	if err != nil {
+		t.Fatalf("invalid redirect URL: %v", err)
+	}
+	if u.Path != httpPathConsent {
+		t.Fatalf("want redirect to consent page, got %s", u)
+	}
+
+	sessionID, err := f.srv.SessionManager.ExchangeKey(u.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("exchange key: %v", err)
+	}
+	ses, err := f.srv.SessionManager.Get(sessionID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	return ses
+}
+
+// approveDeviceCode logs the user in to the device authorization request
+// and approves it on the consent page, and returns the URL of the device
+// callback.
+func approveDeviceCode(t *testing.T, f *testFixtures, dc *device.DeviceCode) *url.URL {
+	ru, err := f.srv.grantConsent(loginDeviceCode(t, f, dc))
+	if err != nil {
+		t.Fatalf("grant consent: %v", err)
+	}
+	u, err := url.Parse(ru)
+	if err != nil {
+		t.Fatalf("invalid redirect URL: %v", err)
+	}
+	return u
+}
+
+// denyDeviceCode is like approveDeviceCode, but denies the request.
+func denyDeviceCode(t *testing.T, f *testFixtures, dc *device.DeviceCode) *url.URL {
+	ru, err := f.srv.authErrorRedirect(loginDeviceCode(t, f, dc), oauth2.ErrorAccessDenied)
+	if err != nil {
+		t.Fatalf("deny consent: %v", err)
+	}
+	u, err := url.Parse(ru)
+	if err != nil {
+		t.Fatalf("invalid redirect URL: %v", err)
+	}
+	return u
+}
+
+func TestServerDeviceToken(t *testing.T) {
+	publicCreds := oidc.ClientCredentials{ID: testPublicClientID}
+
+	tests := []struct {
+		// setup runs after the device code is created and before the
+		// device polls for its tokens.
+		setup func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode)
+		creds oidc.ClientCredentials
+
+		wantErr     string
+		wantRefresh bool
+	}{
+		{
+			creds:   publicCreds,
+			wantErr: errorAuthorizationPending,
+		},
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				if _, _, _, _, err := f.srv.DeviceToken(publicCreds, deviceCode); err == nil {
+					t.Fatalf("unexpected tokens")
+				}
+			},
+			creds:   publicCreds,
+			wantErr: errorSlowDown,
+		},
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				cb := approveDeviceCode(t, f, dc)
+				w := httptest.NewRecorder()
+				handleDeviceCallbackFunc(f.srv, f.srv.DeviceTemplate).ServeHTTP(w, &http.Request{Method: "GET", URL: cb})
+				if w.Code != http.StatusOK {
+					t.Fatalf("device callback: want=%d, got=%d", http.StatusOK, w.Code)
+				}
+			},
+			creds:       publicCreds,
+			wantRefresh: true,
+		},
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				cb := denyDeviceCode(t, f, dc)
+				w := httptest.NewRecorder()
+				handleDeviceCallbackFunc(f.srv, f.srv.DeviceTemplate).ServeHTTP(w, &http.Request{Method: "GET", URL: cb})
+				if w.Code != http.StatusOK {
+					t.Fatalf("device callback: want=%d, got=%d", http.StatusOK, w.Code)
+				}
+			},
+			creds:   publicCreds,
+			wantErr: oauth2.ErrorAccessDenied,
+		},
+		// errors without the key of a session started for the device code
+		// are ignored
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				cb := &url.URL{Path: httpPathDeviceCallback, RawQuery: url.Values{"error": {"access_denied"}, "state": {dc.UserCode}}.Encode()}
+				w := httptest.NewRecorder()
+				handleDeviceCallbackFunc(f.srv, f.srv.DeviceTemplate).ServeHTTP(w, &http.Request{Method: "GET", URL: cb})
+				if w.Code != http.StatusUnauthorized {
+					t.Fatalf("device callback: want=%d, got=%d", http.StatusUnauthorized, w.Code)
+				}
+			},
+			creds:   publicCreds,
+			wantErr: errorAuthorizationPending,
+		},
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				key, err := f.srv.NewSession(testConnectorID1, testClientID, "other", testRedirectURL, "", false, []string{"openid"}, session.AuthParams{})
+				if err != nil {
+					t.Fatalf("new session: %v", err)
+				}
+				cb := &url.URL{Path: httpPathDeviceCallback, RawQuery: url.Values{"error": {"access_denied"}, "state": {dc.UserCode}, "code": {key}}.Encode()}
+				w := httptest.NewRecorder()
+				handleDeviceCallbackFunc(f.srv, f.srv.DeviceTemplate).ServeHTTP(w, &http.Request{Method: "GET", URL: cb})
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("device callback: want=%d, got=%d", http.StatusBadRequest, w.Code)
+				}
+			},
+			creds:   publicCreds,
+			wantErr: errorAuthorizationPending,
+		},
+		{
+			setup: func(t *testing.T, f *testFixtures, deviceCode string, dc *device.DeviceCode) {
+				dc.ExpiresAt = time.Now().Add(-time.Minute)
+				if err := f.srv.DeviceCodeRepo.Update(*dc); err != nil {
+					t.Fatalf("update device code: %v", err)
+				}
+			},
+			creds:   publicCreds,
+			wantErr: errorExpiredToken,
+		},
+		// the device code was issued to another client
+		{
+			creds:   testClientCredentials,
+			wantErr: oauth2.ErrorInvalidGrant,
+		},
+		{
+			creds:   oidc.ClientCredentials{ID: testClientID},
+			wantErr: oauth2.ErrorInvalidClient,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		deviceCode, dc, err := f.srv.NewDeviceCode(publicCreds, []string{"openid", "offline_access"})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if tt.setup != nil {
+			tt.setup(t, f, deviceCode, dc)
+		}
+
+		jwt, accessToken, refreshToken, _, err := f.srv.DeviceToken(tt.creds, deviceCode)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want error=%q, got=%v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if jwt == nil || accessToken == "" {
+			t.Errorf("case %d: want ID token and access token", i)
+		}
+		if tt.wantRefresh != (refreshToken != "") {
+			t.Errorf("case %d: want refresh token=%t, got=%q", i, tt.wantRefresh, refreshToken)
+		}
+
+		// Tokens are only issued once.
+		if _, _, _, _, err := f.srv.DeviceToken(tt.creds, deviceCode); err == nil {
+			t.Errorf("case %d: device code was exchanged twice", i)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/client"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
+)
+
+// handleEndSessionFunc implements the end session endpoint of OpenID Connect
+// RP-Initiated Logout 1.0. It clears dex's state in the browser and then
+// either redirects the end-user back to the client or shows the logout page.
+func handleEndSessionFunc(s *Server, tpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			w.Header().Set("Allow", "GET, POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			phttp.WriteError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		var postLogoutRedirectURL *url.URL
+		if ru := r.Form.Get("post_logout_redirect_uri"); ru != "" {
+			u, err := url.Parse(ru)
+			if err != nil {
+				log.Errorf("invalid post_logout_redirect_uri %q: %v", ru, err)
+				phttp.WriteError(w, http.StatusBadRequest, "invalid post_logout_redirect_uri")
+				return
+			}
+			postLogoutRedirectURL = u
+		}
+
+		redirectURL, err := s.EndSession(r.Form.Get("id_token_hint"), r.Form.Get("client_id"), postLogoutRedirectURL)
+		if err != nil {
+			log.Errorf("end session request failed: %v", err)
+			status := http.StatusBadRequest
+			msg := "invalid logout request"
+			if oerr, ok := err.(*oauth2.Error); ok && oerr.Type == oauth2.ErrorServerError {
+				status = http.StatusInternalServerError
+				msg = "unable to log out"
+			}
+			phttp.WriteError(w, status, msg)
+			return
+		}
+
+		if err := s.KillBrowserSession(w, r); err != nil {
+			log.Errorf("Failed ending browser session: %v", err)
+			phttp.WriteError(w, http.StatusInternalServerError, "unable to log out")
+			return
+		}
+		deleteCookie(w, cookieLastSeen)
+
+		if redirectURL == nil {
+			execTemplate(w, tpl, nil)
+			return
+		}
+		if state := r.Form.Get("state"); state != "" {
+			q := redirectURL.Query()
+			q.Set("state", state)
+			redirectURL.RawQuery = q.Encode()
+		}
+		http.Redirect(w, r, redirectURL.String(), http.StatusSeeOther)
+	}
+}
+
+// EndSession validates an RP-initiated logout request and returns where to
+// redirect the end-user afterwards, or nil if the client did not ask for a
+// redirect. idTokenHint identifies the end-user and client; it may have
+// expired. postLogoutRedirectURL must be registered by the client, which is
+// identified by the hint or by clientID.
+//
+// If RevokeRefreshTokensOnLogout is set and the hint identifies the end-user,
+// the tokens issued to the client for that user are revoked.
+func (s *Server) EndSession(idTokenHint, clientID string, postLogoutRedirectURL *url.URL) (*url.URL, error) {
+	var userID string
+	if idTokenHint != "" {
+		claims, ok, err := s.parseSignedJWT(idTokenHint)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		}
+		hintClientID := idTokenClientID(claims)
+		if clientID != "" && clientID != hintClientID {
+			log.Errorf("client_id %s does not match id_token_hint issued to %s", clientID, hintClientID)
+			return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		}
+		clientID = hintClientID
+		switch userID, err = s.tokenUserID(claims); err {
+		case nil:
+			break
+		case user.ErrorNotFound:
+			userID = ""
+		default:
+			log.Errorf("Failed to resolve the subject of id_token_hint: %v", err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+	}
+
+	var redirectURL *url.URL
+	if postLogoutRedirectURL != nil {
+		if clientID == "" {
+			log.Errorf("post_logout_redirect_uri given without identifying the client")
+			return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		}
+		cli, err := s.Client(clientID)
+		if err != nil {
+			if err == client.ErrorNotFound {
+				return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+			}
+			log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		ru, err := cli.ValidPostLogoutRedirectURL(postLogoutRedirectURL)
+		if err != nil {
+			log.Errorf("Client %s has not registered post_logout_redirect_uri %s", clientID, postLogoutRedirectURL)
+			return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		}
+		redirectURL = &ru
+	}
+
+	// A user ID that is also the client ID comes from an ID token issued with
+	// the client credentials grant, for which there are no user tokens.
+	if s.RevokeRefreshTokensOnLogout && userID != "" && userID != clientID {
+		if err := s.RefreshTokenRepo.RevokeTokensForClient(userID, clientID); err != nil {
+			log.Errorf("Failed to revoke refresh tokens: %v", err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if err := s.AccessTokenRepo.RevokeTokensForClient(userID, clientID); err != nil {
+			log.Errorf("Failed to revoke access tokens: %v", err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		log.Infof("Tokens revoked on logout: clientID=%s userID=%s", clientID, userID)
+	}
+
+	return redirectURL, nil
+}
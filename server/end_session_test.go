@@ -0,0 +1,220 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/refresh"
+)
+
+func TestServerEndSession(t *testing.T) {
+	now := time.Now()
+	validHint := oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now, now.Add(time.Hour))
+	expiredHint := oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	otherIssuerHint := oidc.NewClaims("https://other.example.com", testUserID1, testClientID, now, now.Add(time.Hour))
+
+	otherURL := url.URL{Scheme: "http", Host: "client.example.com", Path: "/elsewhere"}
+
+	tests := []struct {
+		hint                  jose.Claims
+		clientID              string
+		postLogoutRedirectURL *url.URL
+		revokeTokens          bool
+
+		wantRedirectURL *url.URL
+		wantErr         error
+		wantRevoked     bool
+	}{
+		// no parameters at all
+		{},
+		{
+			hint: validHint,
+		},
+		// expired hints are fine
+		{
+			hint:                  expiredHint,
+			postLogoutRedirectURL: &testPostLogoutRedirectURL,
+			wantRedirectURL:       &testPostLogoutRedirectURL,
+		},
+		{
+			clientID:              testClientID,
+			postLogoutRedirectURL: &testPostLogoutRedirectURL,
+			wantRedirectURL:       &testPostLogoutRedirectURL,
+		},
+		{
+			hint:         validHint,
+			revokeTokens: true,
+			wantRevoked:  true,
+		},
+		// without a hint the user is unknown
+		{
+			clientID:     testClientID,
+			revokeTokens: true,
+			wantRevoked:  false,
+		},
+		// hints from other issuers are rejected
+		{
+			hint:    otherIssuerHint,
+			wantErr: oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// the client_id must match the hint
+		{
+			hint:     validHint,
+			clientID: testPublicClientID,
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// the client must be identified to redirect
+		{
+			postLogoutRedirectURL: &testPostLogoutRedirectURL,
+			wantErr:               oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// the redirect URL must be registered
+		{
+			hint:                  validHint,
+			postLogoutRedirectURL: &otherURL,
+			wantErr:               oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		{
+			clientID:              testPublicClientID,
+			postLogoutRedirectURL: &testPostLogoutRedirectURL,
+			wantErr:               oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		{
+			clientID:              "unknown.example.com",
+			postLogoutRedirectURL: &testPostLogoutRedirectURL,
+			wantErr:               oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.RevokeRefreshTokensOnLogout = tt.revokeTokens
+
+		refreshToken, err := f.srv.RefreshTokenRepo.Create(testUserID1, testClientID, testConnectorID1, []string{"openid", "offline_access"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating refresh token: %v", i, err)
+		}
+		accessToken, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+			UserID:   testUserID1,
+			ClientID: testClientID,
+			Scope:    []string{"openid", "offline_access"},
+		})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating access token: %v", i, err)
+		}
+
+		var hint string
+		if tt.hint != nil {
+			if hint, err = signTestClaims(f, tt.hint); err != nil {
+				t.Fatalf("case %d: unexpected error signing hint: %v", i, err)
+			}
+		}
+
+		redirectURL, err := f.srv.EndSession(hint, tt.clientID, tt.postLogoutRedirectURL)
+		if !reflect.DeepEqual(tt.wantErr, err) {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.wantRedirectURL, redirectURL) {
+			t.Errorf("case %d: want redirect URL=%v, got=%v", i, tt.wantRedirectURL, redirectURL)
+		}
+
+		_, err = f.srv.RefreshTokenRepo.Get(refreshToken)
+		if revoked := err == refresh.ErrorInvalidToken; revoked != tt.wantRevoked {
+			t.Errorf("case %d: want refresh token revoked=%t, got err=%v", i, tt.wantRevoked, err)
+		}
+		_, err = f.srv.AccessTokenRepo.Get(accessToken)
+		if revoked := err == accesstoken.ErrorInvalidToken; revoked != tt.wantRevoked {
+			t.Errorf("case %d: want access token revoked=%t, got err=%v", i, tt.wantRevoked, err)
+		}
+	}
+}
+
+func TestHandleEndSessionFunc(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		query  url.Values
+
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			method:   "GET",
+			wantCode: http.StatusOK,
+		},
+		{
+			method: "GET",
+			query: url.Values{
+				"client_id":                {testClientID},
+				"post_logout_redirect_uri": {testPostLogoutRedirectURL.String()},
+				"state":                    {"xyz"},
+			},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "http://client.example.com/logged-out?state=xyz",
+		},
+		{
+			method: "GET",
+			query: url.Values{
+				"client_id":                {testClientID},
+				"post_logout_redirect_uri": {"http://client.example.com/elsewhere"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			method:   "PUT",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	hdlr := handleEndSessionFunc(f.srv, f.srv.LogoutTemplate)
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://example.com/logout?"+tt.query.Encode(), nil)
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.AddCookie(createLastSeenCookie())
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if loc := w.Header().Get("Location"); tt.wantLocation != loc {
+			t.Errorf("case %d: want Location=%q, got=%q", i, tt.wantLocation, loc)
+		}
+		if w.Code == http.StatusOK || w.Code == http.StatusSeeOther {
+			resp := http.Response{Header: w.Header()}
+			cleared := make(map[string]bool)
+			for _, c := range resp.Cookies() {
+				if c.MaxAge < 0 {
+					cleared[c.Name] = true
+				}
+			}
+			for _, name := range []string{cookieLastSeen, cookieBrowserSession} {
+				if !cleared[name] {
+					t.Errorf("case %d: want the %s cookie cleared", i, name)
+				}
+			}
+		}
+	}
+}
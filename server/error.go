@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 
@@ -12,6 +13,35 @@ const (
 	errorInvalidRequest        = "invalid_request"
 	errorServerError           = "server_error"
 	errorAccessDenied          = "access_denied"
+
+	// Errors of bearer token requests (RFC 6750 Section 3.1).
+	errorInvalidToken      = "invalid_token"
+	errorInsufficientScope = "insufficient_scope"
+
+	// Errors of authentication requests (OpenID Connect Core 1.0 Section
+	// 3.1.2.6).
+	errorLoginRequired   = "login_required"
+	errorConsentRequired = "consent_required"
+
+	// Error of authentication requests which can't authenticate the user
+	// as strongly as the requested acr_values require (OpenID Connect Core
+	// Error Code unmet_authentication_requirements 1.0).
+	errorUnmetAuthRequirements = "unmet_authentication_requirements"
+
+	// Errors of device access token requests (RFC 8628 Section 3.5).
+	errorAuthorizationPending = "authorization_pending"
+	errorSlowDown             = "slow_down"
+	errorExpiredToken         = "expired_token"
+
+	// Error of token exchange requests for an audience, and of requests for
+	// a resource, the client may not obtain tokens for (RFC 8693 Section
+	// 2.2.2, RFC 8707 Section 2).
+	errorInvalidTarget = "invalid_target"
+
+	// Errors of authorization requests passed in request objects (RFC 9101
+	// Section 6.2).
+	errorInvalidRequestURI    = "invalid_request_uri"
+	errorInvalidRequestObject = "invalid_request_object"
 )
 
 type apiError struct {
@@ -60,6 +90,32 @@ func writeTokenError(w http.ResponseWriter, err error, state string) {
 	writeResponseWithBody(w, status, oerr)
 }
 
+// writeBearerError writes the error response of a request to a resource
+// protected by a bearer access token (RFC 6750 Section 3).
+func writeBearerError(w http.ResponseWriter, err error) {
+	oerr, ok := err.(*oauth2.Error)
+	if !ok {
+		oerr = oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	var status int
+	switch oerr.Type {
+	case errorInvalidToken:
+		status = http.StatusUnauthorized
+	case errorInsufficientScope:
+		status = http.StatusForbidden
+	case oauth2.ErrorInvalidRequest:
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
+	}
+	if status != http.StatusInternalServerError {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", oerr.Type))
+	}
+
+	writeResponseWithBody(w, status, oerr)
+}
+
 func writeAuthError(w http.ResponseWriter, err error, state string) {
 	oerr, ok := err.(*oauth2.Error)
 	if !ok {
@@ -83,3 +139,19 @@ func redirectAuthError(w http.ResponseWriter, err error, state string, redirectU
 	w.Header().Set("Location", redirectURL.String())
 	w.WriteHeader(http.StatusFound)
 }
+
+// redirectAuthErrorFragment is like redirectAuthError, but for response types
+// whose parameters are returned in the fragment of the redirect URL.
+func redirectAuthErrorFragment(w http.ResponseWriter, err error, state string, redirectURL url.URL) {
+	oerr, ok := err.(*oauth2.Error)
+	if !ok {
+		oerr = oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	v := url.Values{}
+	v.Set("error", oerr.Type)
+	v.Set("state", state)
+
+	w.Header().Set("Location", fragmentRedirectURL(redirectURL, v))
+	w.WriteHeader(http.StatusFound)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,6 +24,8 @@ import (
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/signing"
 )
 
 const (
@@ -46,12 +49,21 @@ var (
 	httpPathDebugVars          = "/debug/vars"
 	httpPathClientRegistration = "/registration"
 	httpPathOOB                = "/oob"
+	httpPathUserInfo           = "/userinfo"
+	httpPathIntrospect         = "/token/introspect"
+	httpPathRevoke             = "/token/revoke"
+	httpPathEndSession         = "/logout"
+	httpPathConsent            = "/consent"
+	httpPathDevice             = "/device"
+	httpPathDeviceCode         = "/device/code"
+	httpPathDeviceCallback     = "/device/callback"
+	httpPathPushedAuthRequest  = "/par"
 
 	cookieLastSeen                 = "LastSeen"
 	cookieShowEmailVerifiedMessage = "ShowEmailVerifiedMessage"
 )
 
-func handleDiscoveryFunc(cfg oidc.ProviderConfig) http.HandlerFunc {
+func handleDiscoveryFunc(cfg ProviderConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			w.Header().Set("Allow", "GET")
@@ -70,7 +82,10 @@ func handleDiscoveryFunc(cfg oidc.ProviderConfig) http.HandlerFunc {
 	}
 }
 
-func handleKeysFunc(km key.PrivateKeyManager, clock clockwork.Clock) http.HandlerFunc {
+// handleKeysFunc publishes the RS256 keys of km along with the keys of skm, if
+// any. The RS256 keys are published alone while skm has no usable keys, e.g.
+// before the overlord first rotated them.
+func handleKeysFunc(km key.PrivateKeyManager, skm *signing.KeyManager, clock clockwork.Clock) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			w.Header().Set("Allow", "GET")
@@ -85,10 +100,31 @@ func handleKeysFunc(km key.PrivateKeyManager, clock clockwork.Clock) http.Handle
 			return
 		}
 
+		// The JWKs are of mixed types, which jose.JWK can't represent.
+		var all []interface{}
+		for i := range jwks {
+			all = append(all, &jwks[i])
+		}
+		exp := km.ExpiresAt()
+
+		if skm != nil {
+			sjwks, err := skm.JWKs()
+			if err != nil {
+				log.Warningf("Publishing RS256 keys only, failed to get signing JWKs: %v", err)
+			} else {
+				for _, jwk := range sjwks {
+					all = append(all, jwk)
+				}
+				if sexp := skm.ExpiresAt(); sexp.Before(exp) {
+					exp = sexp
+				}
+			}
+		}
+
 		keys := struct {
-			Keys []jose.JWK `json:"keys"`
+			Keys []interface{} `json:"keys"`
 		}{
-			Keys: jwks,
+			Keys: all,
 		}
 
 		b, err := json.Marshal(keys)
@@ -96,7 +132,6 @@ func handleKeysFunc(km key.PrivateKeyManager, clock clockwork.Clock) http.Handle
 			log.Errorf("Unable to marshal signing key to JSON: %v", err)
 		}
 
-		exp := km.ExpiresAt()
 		w.Header().Set("Expires", exp.Format(time.RFC1123))
 
 		ttl := int(exp.Sub(clock.Now()).Seconds())
@@ -152,7 +187,10 @@ func execTemplateWithStatus(w http.ResponseWriter, tpl Template, data interface{
 	}
 }
 
-func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idpcs []connector.Connector, register bool, tpl *template.Template) {
+// renderLoginPage renders the login page of an authorization request. The
+// links of the page carry params, and only lead to connectors which satisfy
+// acrValues, the authentication context classes the client requires.
+func renderLoginPage(w http.ResponseWriter, r *http.Request, params url.Values, acrValues []string, srv OIDCServer, idpcs []connector.Connector, register bool, tpl *template.Template) {
 	if tpl == nil {
 		phttp.WriteError(w, http.StatusInternalServerError, "error loading login page")
 		return
@@ -190,7 +228,7 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 	}
 
 	// Render error message if client id is invalid.
-	clientID := q.Get("client_id")
+	clientID := params.Get("client_id")
 	_, err := srv.Client(clientID)
 	if err != nil {
 		log.Errorf("Failed fetching client %q from repo: %v", clientID, err)
@@ -217,6 +255,8 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 	}
 
 	link := *r.URL
+	link.RawQuery = params.Encode()
+	base := link
 	linkParams := link.Query()
 	if !register {
 		linkParams.Set("register", "1")
@@ -228,6 +268,8 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 	link.RawQuery = linkParams.Encode()
 	td.RegisterOrLoginURL = link.String()
 
+	minACR := session.MinACR(acrValues)
+
 	var showConnectors map[string]struct{}
 
 	// Only show the following connectors, if param is present
@@ -248,6 +290,11 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 				continue
 			}
 		}
+		// Only offer connectors which authenticate users as strongly as
+		// the client requires.
+		if !connectorSatisfiesACR(idpc, minACR) {
+			continue
+		}
 		var link Link
 		link.ID = id
 
@@ -257,13 +304,18 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 		}
 		link.DisplayName = displayName
 
-		v := r.URL.Query()
+		v := base.Query()
 		v.Set("connector_id", idpc.ID())
-		v.Set("response_type", "code")
 		link.URL = httpPathAuth + "?" + v.Encode()
 		td.Links = append(td.Links, link)
 	}
 
+	if len(td.Links) == 0 && minACR != "" {
+		td.Error = true
+		td.Message = "Authentication Error"
+		td.Detail = "No login method meets the authentication requirements of the client"
+	}
+
 	execTemplate(w, tpl, td)
 }
 
@@ -284,14 +336,55 @@ func handleAuthFunc(srv OIDCServer, baseURL url.URL, idpcs []connector.Connector
 			if err := srv.KillSession(sessionKey); err != nil {
 				log.Errorf("Failed killing sessionKey %q: %v", sessionKey, err)
 			}
-			renderLoginPage(w, r, srv, idpcs, register, tpl)
+			renderLoginPage(w, r, q, nil, srv, idpcs, register, tpl)
+			return
+		}
+
+		// Requests passed in a request object or pushed to dex beforehand
+		// are handled like requests with the object's parameters.
+		q, err := srv.ResolveAuthRequest(q)
+		if err != nil {
+			log.Errorf("Invalid auth request: %v", err)
+			writeAuthError(w, err, r.URL.Query().Get("state"))
 			return
 		}
 
+		prompt, promptErr := parsePrompt(q.Get("prompt"))
+		maxAge, maxAgeErr := parseMaxAge(q.Get("max_age"))
+		claimsRequest, claimsErr := parseClaimsRequest(q.Get("claims"))
+		bs, err := srv.BrowserSession(r)
+		if err != nil {
+			log.Errorf("Failed getting browser session: %v", err)
+			bs = nil
+		}
+
+		// The user must log in again if they didn't authenticate as strongly
+		// as the client requires.
+		acrValues := strings.Fields(q.Get("acr_values"))
+		if v := essentialACRValues(claimsRequest); len(v) > 0 {
+			acrValues = v
+		}
+		minACR := session.MinACR(acrValues)
+
 		connectorID := q.Get("connector_id")
+		sso := !register && canUseBrowserSession(bs, prompt, maxAge, connectorID, time.Now()) &&
+			browserSessionSatisfiesACR(bs, idx[bs.ConnectorID], minACR)
+
 		idpc, ok := idx[connectorID]
-		if !ok {
-			renderLoginPage(w, r, srv, idpcs, register, tpl)
+		if !ok && !sso && !prompt[promptNone] {
+			// The links of the login page lead back here. A pushed
+			// request was used up resolving it, so they refer to it
+			// with a new request_uri.
+			params := r.URL.Query()
+			if strings.HasPrefix(params.Get("request_uri"), session.PushedAuthRequestURIPrefix) {
+				par, err := srv.RepushAuthRequest(q.Get("client_id"), q)
+				if err != nil {
+					writeAuthError(w, err, q.Get("state"))
+					return
+				}
+				params.Set("request_uri", par.RequestURI())
+			}
+			renderLoginPage(w, r, params, acrValues, srv, idpcs, register, tpl)
 			return
 		}
 
@@ -315,6 +408,11 @@ func handleAuthFunc(srv OIDCServer, baseURL url.URL, idpcs []connector.Connector
 		}
 
 		redirectURL, err := cli.ValidRedirectURL(acr.RedirectURL)
+		if err != nil && isDeviceCallbackURL(baseURL, acr.RedirectURL) {
+			// Device authorization requests are sent back to dex rather
+			// than to the client.
+			redirectURL, err = *acr.RedirectURL, nil
+		}
 		if err != nil {
 			switch err {
 			case (client.ErrorCantChooseRedirectURL):
@@ -332,25 +430,126 @@ func handleAuthFunc(srv OIDCServer, baseURL url.URL, idpcs []connector.Connector
 			}
 		}
 
-		if acr.ResponseType != oauth2.ResponseTypeCode {
+		responseType, ok := parseResponseType(acr.ResponseType)
+		if !ok {
 			log.Errorf("unexpected ResponseType: %v: ", acr.ResponseType)
 			redirectAuthError(w, oauth2.NewError(oauth2.ErrorUnsupportedResponseType), acr.State, redirectURL)
 			return
 		}
 
-		// Check scopes.
-		if scopeErr := validateScopes(srv, acr.ClientID, acr.Scope); scopeErr != nil {
+		redirectErr := redirectAuthError
+		if isFragmentResponseType(responseType) {
+			redirectErr = redirectAuthErrorFragment
+
+			if redirectURL.String() == client.OOBRedirectURI {
+				log.Errorf("ResponseType %q cannot be used with the out-of-band redirect URL", responseType)
+				writeAuthError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State)
+				return
+			}
+		}
+
+		// Check resources and scopes.
+		resources := q["resource"]
+		rss, err := srv.ResolveResources(acr.ClientID, resources)
+		if err != nil {
+			log.Errorf("Invalid auth request: %v", err)
+			redirectErr(w, err, acr.State, redirectURL)
+			return
+		}
+		if scopeErr := validateScopes(srv, acr.ClientID, acr.Scope, responseType, rss); scopeErr != nil {
 			log.Error(scopeErr)
 			writeAuthError(w, scopeErr, acr.State)
 			return
 		}
 
 		nonce := q.Get("nonce")
+		if nonce == "" && responseTypeIncludes(responseType, oauth2.ResponseTypeIDToken) {
+			// ID tokens returned from the authorization endpoint are only
+			// protected against replay by the nonce.
+			log.Errorf("Invalid auth request: nonce is required for ResponseType %q", responseType)
+			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+			err.Description = "nonce is required"
+			redirectErr(w, err, acr.State, redirectURL)
+			return
+		}
+
+		codeChallenge := q.Get("code_challenge")
+		codeChallengeMethod, err := parseCodeChallenge(codeChallenge, q.Get("code_challenge_method"))
+		if err != nil {
+			log.Errorf("Invalid auth request: %v", err)
+			redirectErr(w, err, acr.State, redirectURL)
+			return
+		}
+
+		for _, err := range []error{promptErr, maxAgeErr, claimsErr} {
+			if err != nil {
+				log.Errorf("Invalid auth request: %v", err)
+				redirectErr(w, err, acr.State, redirectURL)
+				return
+			}
+		}
+
+		if !sso && idpc != nil && !connectorSatisfiesACR(idpc, minACR) {
+			log.Errorf("Connector %q does not meet the requested acr_values %q", idpc.ID(), acrValues)
+			err := oauth2.NewError(errorUnmetAuthRequirements)
+			err.Description = "the connector does not authenticate users as strongly as requested"
+			redirectErr(w, err, acr.State, redirectURL)
+			return
+		}
+
+		if isDeviceCallbackURL(baseURL, &redirectURL) && (responseType != oauth2.ResponseTypeCode || !prompt[promptConsent]) {
+			// The user must confirm device authorization requests on the
+			// consent page.
+			log.Errorf("Invalid auth request: device authorization requests must use ResponseType %q and prompt %q", oauth2.ResponseTypeCode, promptConsent)
+			writeAuthError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State)
+			return
+		}
+
+		params := session.AuthParams{
+			ResponseType:        responseType,
+			CodeChallenge:       codeChallenge,
+			CodeChallengeMethod: codeChallengeMethod,
+			Prompt:              q.Get("prompt"),
+			ACRValues:           acrValues,
+			ClaimsRequest:       claimsRequest,
+			Resources:           resources,
+		}
+		if bs != nil {
+			// Without single sign-on, the browser gets a new browser
+			// session once the user has logged in; the current one is
+			// ended then.
+			params.BrowserSessionID = bs.ID
+		}
+
+		if sso {
+			// The user is still logged in to dex; skip the connector.
+			key, err := srv.NewSession(bs.ConnectorID, acr.ClientID, acr.State, redirectURL, nonce, false, acr.Scope, params)
+			if err != nil {
+				log.Errorf("Error creating new session: %v: ", err)
+				redirectErr(w, err, acr.State, redirectURL)
+				return
+			}
+			lu, err := srv.LoginWithBrowserSession(bs, key)
+			if err != nil {
+				log.Errorf("Login through browser session %s failed: %v", bs.ID, err)
+				redirectErr(w, oauth2.NewError(oauth2.ErrorServerError), acr.State, redirectURL)
+				return
+			}
+			w.Header().Set("Location", lu)
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		if prompt[promptNone] {
+			err := oauth2.NewError(errorLoginRequired)
+			err.Description = "the end-user is not logged in"
+			redirectErr(w, err, acr.State, redirectURL)
+			return
+		}
 
-		key, err := srv.NewSession(connectorID, acr.ClientID, acr.State, redirectURL, nonce, register, acr.Scope)
+		key, err := srv.NewSession(connectorID, acr.ClientID, acr.State, redirectURL, nonce, register, acr.Scope, params)
 		if err != nil {
 			log.Errorf("Error creating new session: %v: ", err)
-			redirectAuthError(w, err, acr.State, redirectURL)
+			redirectErr(w, err, acr.State, redirectURL)
 			return
 		}
 
@@ -373,10 +572,15 @@ func handleAuthFunc(srv OIDCServer, baseURL url.URL, idpcs []connector.Connector
 		if shouldReprompt(r) || register {
 			p = "select_account"
 		}
+		if !register && (prompt[promptLogin] || (bs.Authenticated() && maxAge >= 0 && time.Since(bs.AuthTime) > maxAge)) {
+			// The user is logged in to dex, but the client wants them to
+			// authenticate again.
+			p = promptLogin
+		}
 		lu, err := idpc.LoginURL(key, p)
 		if err != nil {
 			log.Errorf("Connector.LoginURL failed: %v", err)
-			redirectAuthError(w, err, acr.State, redirectURL)
+			redirectErr(w, err, acr.State, redirectURL)
 			return
 		}
 
@@ -387,7 +591,10 @@ func handleAuthFunc(srv OIDCServer, baseURL url.URL, idpcs []connector.Connector
 	}
 }
 
-func validateScopes(srv OIDCServer, clientID string, scopes []string) error {
+// validateScopes checks the scopes requested by the client. responseType is
+// that of the authorization request, or empty for grants at the token
+// endpoint, which don't go through one.
+func validateScopes(srv OIDCServer, clientID string, scopes []string, responseType string, resources []ResourceServer) error {
 	foundOpenIDScope := false
 	for i, curScope := range scopes {
 		if i > 0 && curScope == scopes[i-1] {
@@ -421,17 +628,22 @@ func validateScopes(srv OIDCServer, clientID string, scopes []string) error {
 			}
 		case curScope == "openid":
 			foundOpenIDScope = true
-		case curScope == "profile":
+		case curScope == scope.ScopeProfile:
 		case curScope == "email":
 		case curScope == scope.ScopeGroups:
 		case curScope == "offline_access":
-			// According to the spec, for offline_access scope, the client must
-			// use a response_type value that would result in an Authorization
-			// Code.  Currently oauth2.ResponseTypeCode is the only supported
-			// response type, and it's been checked above, so we don't need to
-			// check it again here.
-			//
-			// TODO(yifan): Verify that 'consent' should be in 'prompt'.
+			// The client must use a response_type that results in an
+			// authorization code (OpenID Connect Core 1.0 Section 11). The
+			// end-user is asked for consent after logging in, see
+			// consentRequired.
+			if responseType != "" && !responseTypeIncludes(responseType, oauth2.ResponseTypeCode) {
+				err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+				err.Description = fmt.Sprintf("%q requires a response_type including %q", curScope, oauth2.ResponseTypeCode)
+				return err
+			}
+		case resourcesAllowScope(resources, curScope):
+			// The scope is defined by one of the requested resource
+			// servers.
 		default:
 			// Reject all other scopes.
 			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
@@ -466,33 +678,29 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 
 		state := r.PostForm.Get("state")
 
-		user, password, ok := r.BasicAuth()
-		if !ok {
-			log.Errorf("error parsing basic auth")
-			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
-			return
-		}
+		grantType := r.PostForm.Get("grant_type")
 
-		decodedUser, err := url.QueryUnescape(user)
+		creds, ok, err := clientCredentialsFromRequest(r)
 		if err != nil {
-			log.Errorf("error decoding user: %v", err)
+			log.Errorf("error parsing client credentials: %v", err)
 			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
 			return
 		}
-
-		decodedPassword, err := url.QueryUnescape(password)
-		if err != nil {
-			log.Errorf("error decoding password: %v", err)
-			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
-			return
+		if !ok {
+			// Public clients exchanging a code with PKCE or polling for a
+			// device code identify themselves with the client_id parameter
+			// instead (RFC 7636 Section 4.5, RFC 8628 Section 3.4).
+			creds.ID = r.PostForm.Get("client_id")
+			if creds.ID == "" || (grantType != oauth2.GrantTypeAuthCode && grantType != grantTypeDeviceCode) {
+				log.Errorf("missing client credentials")
+				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
+				return
+			}
 		}
 
-		creds := oidc.ClientCredentials{ID: decodedUser, Secret: decodedPassword}
-
 		var jwt *jose.JWT
-		var refreshToken string
+		var accessToken, refreshToken string
 		var expiresAt time.Time
-		grantType := r.PostForm.Get("grant_type")
 
 		switch grantType {
 		case oauth2.GrantTypeAuthCode:
@@ -502,19 +710,75 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
 				return
 			}
-			jwt, refreshToken, expiresAt, err = srv.CodeToken(creds, code)
+			jwt, accessToken, refreshToken, expiresAt, err = srv.CodeToken(creds, code, r.PostForm.Get("code_verifier"), r.PostForm["resource"])
 			if err != nil {
 				log.Errorf("couldn't exchange code for token: %v", err)
 				writeTokenError(w, err, state)
 				return
 			}
+		case grantTypeDeviceCode:
+			deviceCode := r.PostForm.Get("device_code")
+			if deviceCode == "" {
+				log.Errorf("missing device_code param")
+				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
+				return
+			}
+			jwt, accessToken, refreshToken, expiresAt, err = srv.DeviceToken(creds, deviceCode)
+			if err != nil {
+				log.Errorf("couldn't exchange device code for token: %v", err)
+				writeTokenError(w, err, state)
+				return
+			}
+		case oauth2.GrantTypeUserCreds:
+			scopes := strings.Fields(r.PostForm.Get("scope"))
+			if len(scopes) == 0 {
+				scopes = []string{"openid"}
+			}
+			sort.Strings(scopes)
+			if err := validateScopes(srv, creds.ID, scopes, "", nil); err != nil {
+				log.Errorf("invalid password grant scopes: %v", err)
+				writeTokenError(w, err, state)
+				return
+			}
+			jwt, accessToken, refreshToken, expiresAt, err = srv.PasswordToken(creds, scopes, r.PostForm.Get("username"), r.PostForm.Get("password"))
+			if err != nil {
+				log.Errorf("couldn't exchange password for token: %v", err)
+				writeTokenError(w, err, state)
+				return
+			}
 		case oauth2.GrantTypeClientCreds:
-			jwt, expiresAt, err = srv.ClientCredsToken(creds)
+			jwt, accessToken, expiresAt, err = srv.ClientCredsToken(creds, r.PostForm["resource"])
 			if err != nil {
 				log.Errorf("couldn't creds for token: %v", err)
 				writeTokenError(w, err, state)
 				return
 			}
+		case grantTypeTokenExchange:
+			if actorToken := r.PostForm.Get("actor_token"); actorToken != "" {
+				// The authenticated client is the actor.
+				log.Errorf("unsupported actor_token param")
+				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
+				return
+			}
+			if tokenType := r.PostForm.Get("requested_token_type"); tokenType != "" && tokenType != tokenTypeIDToken {
+				log.Errorf("unsupported requested_token_type: %v", tokenType)
+				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
+				return
+			}
+			jwt, expiresAt, err = srv.ExchangeToken(creds, r.PostForm.Get("subject_token"), r.PostForm.Get("subject_token_type"), r.PostForm.Get("audience"))
+			if err != nil {
+				log.Errorf("couldn't exchange token: %v", err)
+				writeTokenError(w, err, state)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			writeResponseWithBody(w, http.StatusOK, tokenExchangeResponse{
+				AccessToken:     jwt.Encode(),
+				IssuedTokenType: tokenTypeIDToken,
+				TokenType:       "N_A",
+				ExpiresIn:       int64(expiresAt.Sub(time.Now()).Seconds()),
+			})
+			return
 		case oauth2.GrantTypeRefreshToken:
 			token := r.PostForm.Get("refresh_token")
 			scopes := r.PostForm.Get("scope")
@@ -522,7 +786,7 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
 				return
 			}
-			jwt, refreshToken, expiresAt, err = srv.RefreshToken(creds, strings.Split(scopes, " "), token)
+			jwt, accessToken, refreshToken, expiresAt, err = srv.RefreshToken(creds, strings.Split(scopes, " "), token, r.PostForm["resource"])
 			if err != nil {
 				writeTokenError(w, err, state)
 				return
@@ -533,9 +797,19 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 			return
 		}
 
+		// The ID tokens of the client credentials grant are the client's
+		// bearer tokens for dex's APIs, which can't decrypt them.
+		idToken := jwt.Encode()
+		if grantType != oauth2.GrantTypeClientCreds {
+			if idToken, err = srv.EncodeIDToken(creds.ID, jwt); err != nil {
+				writeTokenError(w, err, state)
+				return
+			}
+		}
+
 		t := oAuth2Token{
-			AccessToken:  jwt.Encode(),
-			IDToken:      jwt.Encode(),
+			AccessToken:  accessToken,
+			IDToken:      idToken,
 			TokenType:    "bearer",
 			RefreshToken: refreshToken,
 			ExpiresIn:    int64(expiresAt.Sub(time.Now()).Seconds()),
@@ -591,6 +865,39 @@ func makeHealthHandler(checks []health.Checkable) http.Handler {
 	}
 }
 
+func handleUserInfoFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			w.Header().Set("Allow", "GET, POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+			return
+		}
+
+		// The access token is sent in the Authorization header, or, for POST
+		// requests, in the form-encoded body (RFC 6750 Section 2).
+		token, err := oidc.ExtractBearerToken(r)
+		if err != nil && r.Method == "POST" {
+			token = r.PostFormValue("access_token")
+		}
+		if token == "" {
+			log.Errorf("userinfo request without access token: %v", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := srv.UserInfo(token)
+		if err != nil {
+			log.Errorf("userinfo request failed: %v", err)
+			writeBearerError(w, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, claims)
+	}
+}
+
 type oAuth2Token struct {
 	AccessToken  string `json:"access_token"`
 	IDToken      string `json:"id_token"`
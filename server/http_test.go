@@ -17,6 +17,7 @@ import (
 
 	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/scope"
@@ -147,6 +148,72 @@ func TestHandleAuthFuncResponsesSingleRedirectURL(t *testing.T) {
 			wantCode:     http.StatusFound,
 			wantLocation: "http://fake.example.com",
 		},
+		// PKCE code challenge
+		{
+			query: url.Values{
+				"response_type":         []string{"code"},
+				"redirect_uri":          []string{"http://localhost:8080"},
+				"client_id":             []string{testPublicClientID},
+				"connector_id":          []string{"fake"},
+				"scope":                 []string{"openid"},
+				"code_challenge":        []string{testCodeChallengeS256},
+				"code_challenge_method": []string{"S256"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://fake.example.com",
+		},
+		// unsupported PKCE code challenge method, redirects back to client
+		{
+			query: url.Values{
+				"response_type":         []string{"code"},
+				"redirect_uri":          []string{"http://localhost:8080"},
+				"client_id":             []string{testPublicClientID},
+				"connector_id":          []string{"fake"},
+				"scope":                 []string{"openid"},
+				"code_challenge":        []string{testCodeChallengeS256},
+				"code_challenge_method": []string{"S512"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://localhost:8080?error=invalid_request&state=",
+		},
+		// implicit flow with a nonce, redirects to the connector
+		{
+			query: url.Values{
+				"response_type": []string{"id_token token"},
+				"redirect_uri":  []string{"http://localhost:8080"},
+				"client_id":     []string{testPublicClientID},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"nonce":         []string{"abc"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://fake.example.com",
+		},
+		// hybrid flow without a nonce, redirects back to client with the
+		// error in the fragment
+		{
+			query: url.Values{
+				"response_type": []string{"id_token code"},
+				"redirect_uri":  []string{"http://localhost:8080"},
+				"client_id":     []string{testPublicClientID},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://localhost:8080#error=invalid_request&state=",
+		},
+		// implicit flow with the out-of-band redirect URL
+		{
+			query: url.Values{
+				"response_type": []string{"id_token"},
+				"redirect_uri":  []string{client.OOBRedirectURI},
+				"client_id":     []string{testPublicClientID},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"nonce":         []string{"abc"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
 		// provided redirect_uri does not match client
 		{
 			query: url.Values{
@@ -227,7 +294,7 @@ func TestHandleAuthFuncResponsesSingleRedirectURL(t *testing.T) {
 			wantCode: http.StatusBadRequest,
 		},
 
-		// registration
+		// registration; code-2 identifies the browser session
 		{
 			query: url.Values{
 				"response_type": []string{"code"},
@@ -390,6 +457,49 @@ func TestHandleAuthFuncResponsesMultipleRedirectURLs(t *testing.T) {
 	}
 }
 
+func TestHandleAuthFuncLoginPageLinks(t *testing.T) {
+	tests := []struct {
+		responseType string
+		want         string
+	}{
+		{"code", "response_type=code"},
+		{"id_token token", "response_type=id_token&#43;token"},
+		{"id_token code", "response_type=id_token&#43;code"},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		idpcs := []connector.Connector{&fakeConnector{loginURL: "http://fake.example.com"}}
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, f.srv.LoginTemplate, false)
+
+		q := url.Values{
+			"response_type": {tt.responseType},
+			"redirect_uri":  {"http://localhost:8080"},
+			"client_id":     {testPublicClientID},
+			"scope":         {"openid"},
+			"nonce":         {"abc"},
+		}
+		req, err := http.NewRequest("GET", "http://server.example.com/auth?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("case %d: want code=%d, got=%d", i, http.StatusOK, w.Code)
+			continue
+		}
+		// The connector links must keep the response type the client asked for.
+		if body := w.Body.String(); !strings.Contains(body, tt.want) {
+			t.Errorf("case %d: want login page links with %q", i, tt.want)
+		}
+	}
+}
+
 func TestValidateScopes(t *testing.T) {
 	f, err := makeCrossClientTestFixtures()
 	if err != nil {
@@ -397,9 +507,11 @@ func TestValidateScopes(t *testing.T) {
 	}
 
 	tests := []struct {
-		clientID string
-		scopes   []string
-		wantErr  bool
+		clientID     string
+		scopes       []string
+		responseType string
+		resources    []ResourceServer
+		wantErr      bool
 	}{
 		{
 			// ERR: no openid scope
@@ -419,6 +531,20 @@ func TestValidateScopes(t *testing.T) {
 			scopes:   []string{"openid", "offline_access"},
 			wantErr:  false,
 		},
+		{
+			// OK: offline_access with a response type returning a code
+			clientID:     "XXX",
+			scopes:       []string{"openid", "offline_access"},
+			responseType: "code id_token",
+			wantErr:      false,
+		},
+		{
+			// ERR: offline_access without a code
+			clientID:     "XXX",
+			scopes:       []string{"openid", "offline_access"},
+			responseType: "id_token token",
+			wantErr:      true,
+		},
 		{
 			// ERR: unknown scope
 			clientID: "XXX",
@@ -476,10 +602,30 @@ func TestValidateScopes(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			// OK: scope of a requested resource server
+			clientID:  "XXX",
+			scopes:    []string{"openid", "orders:read"},
+			resources: []ResourceServer{testResourceServer},
+			wantErr:   false,
+		},
+		{
+			// ERR: scope of a resource server that wasn't requested
+			clientID: "XXX",
+			scopes:   []string{"openid", "orders:read"},
+			wantErr:  true,
+		},
+		{
+			// ERR: scope the requested resource server doesn't define
+			clientID:  "XXX",
+			scopes:    []string{"openid", "orders:write"},
+			resources: []ResourceServer{testResourceServer},
+			wantErr:   true,
+		},
 	}
 
 	for i, tt := range tests {
-		err := validateScopes(f.srv, tt.clientID, tt.scopes)
+		err := validateScopes(f.srv, tt.clientID, tt.scopes, tt.responseType, tt.resources)
 		if tt.wantErr {
 			if err == nil {
 				t.Errorf("case %d: want non-nil err", i)
@@ -670,9 +816,101 @@ func TestHandleTokenFuncState(t *testing.T) {
 	}
 }
 
+func TestHandleUserInfoFunc(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	token, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+		UserID:   testUserID1,
+		ClientID: testClientID,
+		Scope:    []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating access token: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		header string
+		form   url.Values
+
+		wantCode            int
+		wantWWWAuthenticate string
+		wantBody            string
+	}{
+		{
+			method:   "GET",
+			header:   "Bearer " + token,
+			wantCode: http.StatusOK,
+			wantBody: `{"email":"email-1@example.com","name":"","sub":"ID-1"}`,
+		},
+		{
+			method:   "POST",
+			form:     url.Values{"access_token": {token}},
+			wantCode: http.StatusOK,
+			wantBody: `{"email":"email-1@example.com","name":"","sub":"ID-1"}`,
+		},
+		// no access token
+		{
+			method:              "GET",
+			wantCode:            http.StatusUnauthorized,
+			wantWWWAuthenticate: "Bearer",
+		},
+		// unknown access token
+		{
+			method:              "GET",
+			header:              "Bearer " + token + "x",
+			wantCode:            http.StatusUnauthorized,
+			wantWWWAuthenticate: `Bearer error="invalid_token"`,
+		},
+		// ID tokens are not access tokens
+		{
+			method:              "GET",
+			header:              "Bearer eyJhbGciOiJSUzI1NiJ9.e30.c2ln",
+			wantCode:            http.StatusUnauthorized,
+			wantWWWAuthenticate: `Bearer error="invalid_token"`,
+		},
+		{
+			method:   "PUT",
+			header:   "Bearer " + token,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	hdlr := handleUserInfoFunc(f.srv)
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://example.com/userinfo", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		if tt.form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); tt.wantWWWAuthenticate != got {
+			t.Errorf("case %d: want WWW-Authenticate=%q, got=%q", i, tt.wantWWWAuthenticate, got)
+		}
+		if tt.wantBody != "" && tt.wantBody != w.Body.String() {
+			t.Errorf("case %d: want body=%s, got=%s", i, tt.wantBody, w.Body.String())
+		}
+	}
+}
+
 func TestHandleDiscoveryFuncMethodNotAllowed(t *testing.T) {
 	for _, m := range []string{"POST", "PUT", "DELETE"} {
-		hdlr := handleDiscoveryFunc(oidc.ProviderConfig{})
+		hdlr := handleDiscoveryFunc(ProviderConfig{})
 		req, err := http.NewRequest(m, "http://example.com", nil)
 		if err != nil {
 			t.Errorf("case %s: unable to create HTTP request: %v", m, err)
@@ -697,17 +935,20 @@ func TestHandleDiscoveryFunc(t *testing.T) {
 		ucopy.Path = path
 		return &ucopy
 	}
-	cfg := oidc.ProviderConfig{
-		Issuer:        &u,
-		AuthEndpoint:  pathURL(httpPathAuth),
-		TokenEndpoint: pathURL(httpPathToken),
-		KeysEndpoint:  pathURL(httpPathKeys),
-
-		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode},
-		ResponseTypesSupported:            []string{"code"},
-		SubjectTypesSupported:             []string{"public"},
-		IDTokenSigningAlgValues:           []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+	cfg := ProviderConfig{
+		ProviderConfig: oidc.ProviderConfig{
+			Issuer:        &u,
+			AuthEndpoint:  pathURL(httpPathAuth),
+			TokenEndpoint: pathURL(httpPathToken),
+			KeysEndpoint:  pathURL(httpPathKeys),
+
+			GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode},
+			ResponseTypesSupported:            []string{"code"},
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValues:           []string{"RS256"},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		},
+		CodeChallengeMethodsSupported: []string{"S256", "plain"},
 	}
 
 	req, err := http.NewRequest("GET", "http://server.example.com", nil)
@@ -735,7 +976,7 @@ func TestHandleDiscoveryFunc(t *testing.T) {
 		t.Fatalf("Incorrect Cache-Control header: want=%q, got=%q", wantCC, gotCC)
 	}
 
-	wantBody := `{"issuer":"http://server.example.com","authorization_endpoint":"http://server.example.com/auth","token_endpoint":"http://server.example.com/token","jwks_uri":"http://server.example.com/keys","response_types_supported":["code"],"grant_types_supported":["authorization_code"],"subject_types_supported":["public"],"id_token_signing_alg_values_supported":["RS256"],"token_endpoint_auth_methods_supported":["client_secret_basic"]}`
+	wantBody := `{"issuer":"http://server.example.com","authorization_endpoint":"http://server.example.com/auth","token_endpoint":"http://server.example.com/token","jwks_uri":"http://server.example.com/keys","response_types_supported":["code"],"grant_types_supported":["authorization_code"],"subject_types_supported":["public"],"id_token_signing_alg_values_supported":["RS256"],"token_endpoint_auth_methods_supported":["client_secret_basic"],"code_challenge_methods_supported":["S256","plain"]}`
 	gotBody := w.Body.String()
 	if wantBody != gotBody {
 		t.Fatalf("Incorrect body: want=%s got=%s", wantBody, gotBody)
@@ -744,7 +985,7 @@ func TestHandleDiscoveryFunc(t *testing.T) {
 
 func TestHandleKeysFuncMethodNotAllowed(t *testing.T) {
 	for _, m := range []string{"POST", "PUT", "DELETE"} {
-		hdlr := handleKeysFunc(nil, clockwork.NewRealClock())
+		hdlr := handleKeysFunc(nil, nil, clockwork.NewRealClock())
 		req, err := http.NewRequest(m, "http://example.com", nil)
 		if err != nil {
 			t.Errorf("case %s: unable to create HTTP request: %v", m, err)
@@ -793,7 +1034,7 @@ func TestHandleKeysFunc(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	hdlr := handleKeysFunc(km, fc)
+	hdlr := handleKeysFunc(km, nil, fc)
 	hdlr.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/pkg/jwe"
+	"github.com/coreos/dex/pkg/log"
+)
+
+// EncodeIDToken returns the serialized ID token issued to the client. Clients
+// which registered an id_token_encrypted_response_alg receive the signed JWT
+// nested in a JWE encrypted with their public key (OpenID Connect Core 1.0
+// Section 10.2).
+func (s *Server) EncodeIDToken(clientID string, jwt *jose.JWT) (string, error) {
+	cli, err := s.Client(clientID)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+		return "", oauth2.NewError(oauth2.ErrorServerError)
+	}
+	opts := cli.Metadata.IDTokenResponseOptions
+	if opts.EncryptionAlg == "" {
+		return jwt.Encode(), nil
+	}
+	enc := opts.EncryptionEnc
+	if enc == "" {
+		enc = jose.EncA128CBCHS256
+	}
+
+	jwks, err := s.clientJWKs(cli)
+	if err != nil {
+		log.Errorf("Failed to get the keys of client %s: %v", clientID, err)
+		return "", oauth2.NewError(oauth2.ErrorServerError)
+	}
+	jwk, err := clientEncryptionKey(jwks, opts.EncryptionAlg)
+	if err != nil {
+		log.Errorf("Failed to get the encryption key of client %s: %v", clientID, err)
+		return "", oauth2.NewError(oauth2.ErrorServerError)
+	}
+	pub := &rsa.PublicKey{N: jwk.Modulus, E: jwk.Exponent}
+	token, err := jwe.Encrypt([]byte(jwt.Encode()), pub, jwe.Header{
+		Alg:         opts.EncryptionAlg,
+		Enc:         enc,
+		KeyID:       jwk.ID,
+		ContentType: "JWT",
+	})
+	if err != nil {
+		log.Errorf("Failed to encrypt ID token for client %s: %v", clientID, err)
+		return "", oauth2.NewError(oauth2.ErrorServerError)
+	}
+	return token, nil
+}
+
+// clientEncryptionKey returns the first RSA key among the client's which is
+// not only meant for signatures and suits alg.
+func clientEncryptionKey(jwks []jose.JWK, alg string) (*jose.JWK, error) {
+	for i, jwk := range jwks {
+		if jwk.Type != "RSA" || jwk.Use == "sig" || (jwk.Alg != "" && jwk.Alg != alg) {
+			continue
+		}
+		if jwk.Modulus == nil || jwk.Modulus.Sign() <= 0 || jwk.Exponent <= 1 {
+			continue
+		}
+		return &jwks[i], nil
+	}
+	return nil, fmt.Errorf("client has no RSA key for %s", alg)
+}
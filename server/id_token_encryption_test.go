@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/pkg/jwe"
+)
+
+func encryptionJWK(id string, priv *rsa.PrivateKey) jose.JWK {
+	return jose.JWK{
+		ID:       id,
+		Type:     "RSA",
+		Use:      "enc",
+		Exponent: priv.E,
+		Modulus:  priv.N,
+	}
+}
+
+func TestHandleTokenFuncIDTokenEncryption(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	sigKey := encryptionJWK("sig-key", priv)
+	sigKey.Use = "sig"
+
+	tests := []struct {
+		opts oidc.JWAOptions
+		keys []jose.JWK
+
+		wantCode int
+		wantEnc  string
+	}{
+		// not encrypted
+		{
+			keys:     []jose.JWK{encryptionJWK("enc-key", priv)},
+			wantCode: http.StatusOK,
+		},
+		{
+			opts:     oidc.JWAOptions{EncryptionAlg: jose.AlgRSAOAEP256},
+			keys:     []jose.JWK{sigKey, encryptionJWK("enc-key", priv)},
+			wantCode: http.StatusOK,
+			wantEnc:  jose.EncA128CBCHS256,
+		},
+		{
+			opts:     oidc.JWAOptions{EncryptionAlg: jose.AlgRSAOAEP, EncryptionEnc: jose.EncA256GCM},
+			keys:     []jose.JWK{encryptionJWK("enc-key", priv)},
+			wantCode: http.StatusOK,
+			wantEnc:  jose.EncA256GCM,
+		},
+		// the client has no key to encrypt with
+		{
+			opts:     oidc.JWAOptions{EncryptionAlg: jose.AlgRSAOAEP256},
+			keys:     []jose.JWK{sigKey},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		creds := oidc.ClientCredentials{ID: "mobile.example.com", Secret: clientTestSecret}
+		clients := append([]client.LoadableClient{}, testClients...)
+		clients = append(clients, client.LoadableClient{
+			Client: client.Client{
+				Credentials: creds,
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs:           []url.URL{testRedirectURL},
+					JWKS:                   &jose.JWKSet{Keys: tt.keys},
+					IDTokenResponseOptions: tt.opts,
+				},
+			},
+		})
+		f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		sm := f.sessionManager
+
+		sessionID, err := sm.NewSession("bogus_idpc", creds.ID, "bogus", url.URL{}, "", false, []string{"openid"})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err := sm.AttachRemoteIdentity(sessionID, oidc.Identity{}); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err := sm.AttachUser(sessionID, testUserID1); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		code, err := sm.NewSessionKey(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		form := url.Values{"grant_type": {oauth2.GrantTypeAuthCode}, "code": {code}}
+		req, err := http.NewRequest("POST", "http://example.com/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("case %d: unable to create HTTP request: %v", i, err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(creds.ID, creds.Secret)
+
+		w := httptest.NewRecorder()
+		handleTokenFunc(f.srv).ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var resp struct {
+			IDToken string `json:"id_token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("case %d: unexpected error decoding response: %v", i, err)
+		}
+
+		signed := resp.IDToken
+		if tt.wantEnc != "" {
+			h, plaintext, err := jwe.Decrypt(resp.IDToken, priv)
+			if err != nil {
+				t.Errorf("case %d: unexpected error decrypting ID token: %v", i, err)
+				continue
+			}
+			want := jwe.Header{Alg: tt.opts.EncryptionAlg, Enc: tt.wantEnc, KeyID: "enc-key", ContentType: "JWT"}
+			if *h != want {
+				t.Errorf("case %d: want header %#v, got %#v", i, want, *h)
+			}
+			signed = string(plaintext)
+		}
+
+		claims, ok, err := f.srv.parseSignedJWT(signed)
+		if err != nil || !ok {
+			t.Errorf("case %d: want signed ID token, got %t, %v", i, ok, err)
+			continue
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != testUserID1 {
+			t.Errorf("case %d: want sub=%q, got %q", i, testUserID1, sub)
+		}
+	}
+}
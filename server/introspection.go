@@ -0,0 +1,306 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/accesstoken"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/refresh"
+	"github.com/coreos/dex/user"
+)
+
+const (
+	// Token type hints of introspection requests (RFC 7662 Section 2.1). dex
+	// also accepts ID tokens, which are not registered by the RFC.
+	tokenTypeHintAccessToken  = "access_token"
+	tokenTypeHintRefreshToken = "refresh_token"
+	tokenTypeHintIDToken      = "id_token"
+)
+
+// TokenIntrospection is the response of the token introspection endpoint
+// (RFC 7662 Section 2.2). Only Active is set for tokens that are not active.
+type TokenIntrospection struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  interface{} `json:"aud,omitempty"`
+	Issuer    string      `json:"iss,omitempty"`
+}
+
+var inactiveToken = &TokenIntrospection{Active: false}
+
+func handleIntrospectFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, ok, err := clientCredentialsFromRequest(r)
+		if err != nil || !ok {
+			log.Errorf("introspection request without valid client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		ti, err := srv.IntrospectToken(creds, token, r.PostForm.Get("token_type_hint"))
+		if err != nil {
+			log.Errorf("introspection request failed: %v", err)
+			writeTokenError(w, err, "")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, ti)
+	}
+}
+
+// IntrospectToken reports whether the token, an access token, refresh token
+// or ID token issued by dex, is active. Tokens are inactive once expired or
+// revoked, or when the user they were issued for is disabled. Clients only
+// learn about tokens they may introspect; others are reported inactive.
+func (s *Server) IntrospectToken(creds oidc.ClientCredentials, token, tokenTypeHint string) (*TokenIntrospection, error) {
+	cli, err := s.Client(creds.ID)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+	if cli.Public {
+		log.Errorf("Public client %s may not introspect tokens", creds.ID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	introspectors := map[string]func(string) (*TokenIntrospection, error){
+		tokenTypeHintAccessToken:  s.introspectAccessToken,
+		tokenTypeHintRefreshToken: s.introspectRefreshToken,
+		tokenTypeHintIDToken:      s.introspectIDToken,
+	}
+	order := []string{tokenTypeHintAccessToken, tokenTypeHintRefreshToken, tokenTypeHintIDToken}
+
+	// The hint only changes the order in which token types are tried (RFC 7662
+	// Section 2.1).
+	if _, ok := introspectors[tokenTypeHint]; ok {
+		order = append([]string{tokenTypeHint}, order...)
+	}
+
+	for _, typ := range order {
+		ti, err := introspectors[typ](token)
+		if err != nil {
+			return nil, err
+		}
+		if ti.Active {
+			if !s.mayIntrospect(creds.ID, ti) {
+				log.Errorf("Client %s may not introspect a token of client %s", creds.ID, ti.ClientID)
+				return inactiveToken, nil
+			}
+			log.Infof("Token introspected: clientID=%s tokenType=%s", creds.ID, typ)
+			return ti, nil
+		}
+	}
+	return inactiveToken, nil
+}
+
+func (s *Server) introspectAccessToken(token string) (*TokenIntrospection, error) {
+	tok, err := s.AccessTokenRepo.Get(token)
+	switch err {
+	case nil:
+		break
+	case accesstoken.ErrorInvalidToken:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to fetch access token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if ok, err := s.introspectedClientExists(tok.ClientID); err != nil || !ok {
+		return inactiveToken, err
+	}
+
+	ti := &TokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(tok.Scope, " "),
+		ClientID:  tok.ClientID,
+		TokenType: "bearer",
+		ExpiresAt: tok.ExpiresAt.Unix(),
+		IssuedAt:  tok.CreatedAt.Unix(),
+		Issuer:    s.IssuerURL.String(),
+	}
+	if len(tok.Resources) > 0 {
+		// Resource servers check that they are in the audience.
+		ti.Audience = tok.Resources
+	}
+	if tok.UserID == "" {
+		// Issued to the client for itself.
+		ti.Subject = tok.ClientID
+		return ti, nil
+	}
+	return s.addIntrospectedUser(ti, tok.UserID)
+}
+
+func (s *Server) introspectRefreshToken(token string) (*TokenIntrospection, error) {
+	tok, err := s.RefreshTokenRepo.Get(token)
+	switch err {
+	case nil:
+		break
+	case refresh.ErrorInvalidToken:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to fetch refresh token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if ok, err := s.introspectedClientExists(tok.ClientID); err != nil || !ok {
+		return inactiveToken, err
+	}
+
+	ti := &TokenIntrospection{
+		Active:   true,
+		Scope:    strings.Join(tok.Scope, " "),
+		ClientID: tok.ClientID,
+		IssuedAt: tok.CreatedAt.Unix(),
+		Issuer:   s.IssuerURL.String(),
+	}
+	if !tok.ExpiresAt.IsZero() {
+		ti.ExpiresAt = tok.ExpiresAt.Unix()
+	}
+	return s.addIntrospectedUser(ti, tok.UserID)
+}
+
+func (s *Server) introspectIDToken(token string) (*TokenIntrospection, error) {
+	claims, ok, err := s.parseSignedJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return inactiveToken, nil
+	}
+	sub, ok, err := claims.StringClaim("sub")
+	if err != nil || !ok {
+		return inactiveToken, nil
+	}
+	exp, ok, err := claims.TimeClaim("exp")
+	if err != nil || !ok || !exp.After(time.Now()) {
+		return inactiveToken, nil
+	}
+	iat, _, _ := claims.TimeClaim("iat")
+
+	ti := &TokenIntrospection{
+		Active:    true,
+		ExpiresAt: exp.Unix(),
+		IssuedAt:  iat.Unix(),
+		Audience:  claims["aud"],
+		Issuer:    s.IssuerURL.String(),
+	}
+	ti.ClientID = idTokenClientID(claims)
+	if ok, err := s.introspectedClientExists(ti.ClientID); err != nil || !ok {
+		return inactiveToken, err
+	}
+
+	if sub == ti.ClientID {
+		// Issued with the client credentials grant.
+		ti.Subject = sub
+		return ti, nil
+	}
+
+	userID, err := s.tokenUserID(claims)
+	switch err {
+	case nil:
+		break
+	case user.ErrorNotFound:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to resolve subject %q: %v", sub, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	ti.Subject = sub
+	return s.addIntrospectedUser(ti, userID)
+}
+
+// mayIntrospect reports whether the client may introspect the active token:
+// if the token was issued to the client, if the client is in its audience, or
+// if the client is that of a resource server in its audience.
+func (s *Server) mayIntrospect(clientID string, ti *TokenIntrospection) bool {
+	if ti.ClientID == clientID {
+		return true
+	}
+	for _, aud := range tokenAudience(jose.Claims{"aud": ti.Audience}) {
+		if aud == clientID {
+			return true
+		}
+		if rs, ok := s.resourceServer(aud); ok && rs.introspectedBy(clientID) {
+			return true
+		}
+	}
+	return false
+}
+
+// introspectedClientExists reports whether the client an introspected token
+// was issued to still exists. Tokens of deleted clients are inactive.
+func (s *Server) introspectedClientExists(clientID string) (bool, error) {
+	ok, err := s.clientExists(clientID)
+	if err != nil {
+		log.Errorf("Failed to fetch client %q from repo: %v", clientID, err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	return ok, nil
+}
+
+// addIntrospectedUser sets the subject of an active token to the user it was
+// issued for, as the client knows them, or makes it inactive if the user no
+// longer exists or is disabled.
+func (s *Server) addIntrospectedUser(ti *TokenIntrospection, userID string) (*TokenIntrospection, error) {
+	usr, err := s.UserRepo.Get(nil, userID)
+	switch err {
+	case nil:
+		break
+	case user.ErrorNotFound:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to fetch user %q from repo: %v", userID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if usr.Disabled {
+		return inactiveToken, nil
+	}
+
+	if ti.Subject == "" {
+		sub, err := s.subject(usr.ID, ti.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		ti.Subject = sub
+	}
+	ti.Username = usr.Email
+	return ti, nil
+}
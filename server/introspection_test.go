@@ -0,0 +1,464 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/user"
+	usersapi "github.com/coreos/dex/user/api"
+)
+
+func TestServerIntrospectToken(t *testing.T) {
+	tests := []struct {
+		// token returns the token to introspect.
+		token         func(f *testFixtures) (string, error)
+		tokenTypeHint string
+		disableUser   bool
+
+		wantActive   bool
+		wantSubject  string
+		wantClientID string
+		wantScope    string
+	}{
+		// access token
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:   testUserID1,
+					ClientID: testClientID,
+					Scope:    []string{"openid", "email"},
+				})
+				return tok, err
+			},
+			wantActive:   true,
+			wantSubject:  testUserID1,
+			wantClientID: testClientID,
+			wantScope:    "openid email",
+		},
+		// access token of a disabled user
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:   testUserID1,
+					ClientID: testClientID,
+					Scope:    []string{"openid"},
+				})
+				return tok, err
+			},
+			disableUser: true,
+			wantActive:  false,
+		},
+		// access token of a client that has been deleted
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:   testUserID1,
+					ClientID: "deleted.example.com",
+					Scope:    []string{"openid"},
+				})
+				return tok, err
+			},
+			wantActive: false,
+		},
+		// access token issued to a client for itself
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{ClientID: testClientID})
+				return tok, err
+			},
+			wantActive:   true,
+			wantSubject:  testClientID,
+			wantClientID: testClientID,
+		},
+		// refresh token, with a misleading hint
+		{
+			token: func(f *testFixtures) (string, error) {
+				return f.srv.RefreshTokenRepo.Create(testUserID1, testClientID, testConnectorID1, []string{"openid", "offline_access"}, nil)
+			},
+			tokenTypeHint: "access_token",
+			wantActive:    true,
+			wantSubject:   testUserID1,
+			wantClientID:  testClientID,
+			wantScope:     "openid offline_access",
+		},
+		// ID token
+		{
+			token: func(f *testFixtures) (string, error) {
+				now := time.Now()
+				return signTestClaims(f, oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now, now.Add(time.Hour)))
+			},
+			tokenTypeHint: "id_token",
+			wantActive:    true,
+			wantSubject:   testUserID1,
+			wantClientID:  testClientID,
+		},
+		// expired ID token
+		{
+			token: func(f *testFixtures) (string, error) {
+				now := time.Now()
+				return signTestClaims(f, oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+			},
+			wantActive: false,
+		},
+		// ID token from another issuer
+		{
+			token: func(f *testFixtures) (string, error) {
+				now := time.Now()
+				return signTestClaims(f, oidc.NewClaims("https://other.example.com", testUserID1, testClientID, now, now.Add(time.Hour)))
+			},
+			wantActive: false,
+		},
+		// unknown token
+		{
+			token: func(f *testFixtures) (string, error) {
+				return "unknown-token", nil
+			},
+			wantActive: false,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		token, err := tt.token(f)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating token: %v", i, err)
+		}
+
+		if tt.disableUser {
+			if err := f.srv.UserManager.Disable(testUserID1, true); err != nil {
+				t.Fatalf("case %d: unexpected error disabling user: %v", i, err)
+			}
+		}
+
+		ti, err := f.srv.IntrospectToken(testClientCredentials, token, tt.tokenTypeHint)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if ti.Active != tt.wantActive {
+			t.Errorf("case %d: want active=%t, got=%t", i, tt.wantActive, ti.Active)
+			continue
+		}
+		if !ti.Active {
+			if !reflect.DeepEqual(ti, &TokenIntrospection{}) {
+				t.Errorf("case %d: inactive token should carry no other fields, got %#v", i, ti)
+			}
+			continue
+		}
+		if ti.Subject != tt.wantSubject {
+			t.Errorf("case %d: want sub=%q, got=%q", i, tt.wantSubject, ti.Subject)
+		}
+		if ti.ClientID != tt.wantClientID {
+			t.Errorf("case %d: want client_id=%q, got=%q", i, tt.wantClientID, ti.ClientID)
+		}
+		if ti.Scope != tt.wantScope {
+			t.Errorf("case %d: want scope=%q, got=%q", i, tt.wantScope, ti.Scope)
+		}
+	}
+}
+
+func TestServerIntrospectTokenClientAuth(t *testing.T) {
+	tests := []struct {
+		creds oidc.ClientCredentials
+	}{
+		// wrong secret
+		{
+			creds: oidc.ClientCredentials{ID: testClientID, Secret: base64.URLEncoding.EncodeToString([]byte("wrong"))},
+		},
+		// unknown client
+		{
+			creds: oidc.ClientCredentials{ID: "unknown.example.com", Secret: clientTestSecret},
+		},
+		// public clients cannot keep their credentials confidential
+		{
+			creds: testPublicClientCredentials,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		_, err = f.srv.IntrospectToken(tt.creds, "token", "")
+		if !reflect.DeepEqual(err, oauth2.NewError(oauth2.ErrorInvalidClient)) {
+			t.Errorf("case %d: want invalid_client error, got %v", i, err)
+		}
+	}
+}
+
+func TestServerIntrospectTokenOtherClient(t *testing.T) {
+	// rsCreds are those of the client a resource server introspects tokens
+	// as, and otherCreds those of an unrelated client.
+	rsCreds := oidc.ClientCredentials{
+		ID:     "rs.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("rs_secret")),
+	}
+	otherCreds := oidc.ClientCredentials{
+		ID:     "other.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("other_secret")),
+	}
+	rs := testResourceServer
+	rs.IntrospectionClients = []string{rsCreds.ID}
+
+	tests := []struct {
+		token func(f *testFixtures) (string, error)
+		creds oidc.ClientCredentials
+
+		wantActive bool
+	}{
+		// access token for the resource server
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:    testUserID1,
+					ClientID:  testClientID,
+					Scope:     []string{"openid", "orders:read"},
+					Resources: []string{rs.ID},
+				})
+				return tok, err
+			},
+			creds:      rsCreds,
+			wantActive: true,
+		},
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:    testUserID1,
+					ClientID:  testClientID,
+					Scope:     []string{"openid", "orders:read"},
+					Resources: []string{rs.ID},
+				})
+				return tok, err
+			},
+			creds:      otherCreds,
+			wantActive: false,
+		},
+		// access token for no resource server
+		{
+			token: func(f *testFixtures) (string, error) {
+				tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+					UserID:   testUserID1,
+					ClientID: testClientID,
+					Scope:    []string{"openid"},
+				})
+				return tok, err
+			},
+			creds:      rsCreds,
+			wantActive: false,
+		},
+		// refresh tokens are only introspected by their client
+		{
+			token: func(f *testFixtures) (string, error) {
+				return f.srv.RefreshTokenRepo.Create(testUserID1, testClientID, testConnectorID1, []string{"openid", "offline_access"}, nil)
+			},
+			creds:      rsCreds,
+			wantActive: false,
+		},
+		// ID token with the client in its audience
+		{
+			token: func(f *testFixtures) (string, error) {
+				now := time.Now()
+				claims := oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now, now.Add(time.Hour))
+				claims["aud"] = []string{testClientID, otherCreds.ID}
+				claims["azp"] = testClientID
+				return signTestClaims(f, claims)
+			},
+			creds:      otherCreds,
+			wantActive: true,
+		},
+		{
+			token: func(f *testFixtures) (string, error) {
+				now := time.Now()
+				return signTestClaims(f, oidc.NewClaims(testIssuerURL.String(), testUserID1, testClientID, now, now.Add(time.Hour)))
+			},
+			creds:      otherCreds,
+			wantActive: false,
+		},
+	}
+
+	for i, tt := range tests {
+		clients := append([]client.LoadableClient{}, testClients...)
+		for _, creds := range []oidc.ClientCredentials{rsCreds, otherCreds} {
+			clients = append(clients, client.LoadableClient{
+				Client: client.Client{
+					Credentials: creds,
+					Metadata: oidc.ClientMetadata{
+						RedirectURIs: []url.URL{testRedirectURL},
+					},
+				},
+			})
+		}
+		f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.ResourceServers = []ResourceServer{rs}
+
+		token, err := tt.token(f)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating token: %v", i, err)
+		}
+		ti, err := f.srv.IntrospectToken(tt.creds, token, "")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if ti.Active != tt.wantActive {
+			t.Errorf("case %d: want active=%t, got=%t", i, tt.wantActive, ti.Active)
+		}
+	}
+}
+
+func TestServerIntrospectTokenRevokedByUser(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	tok, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+		UserID:   testUserID1,
+		ClientID: testClientID,
+		Scope:    []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating access token: %v", err)
+	}
+	if ti, err := f.srv.IntrospectToken(testClientCredentials, tok, ""); err != nil || !ti.Active {
+		t.Fatalf("want active access token, got=%v err=%v", ti, err)
+	}
+
+	api := usersapi.NewUsersAPI(f.srv.UserManager, f.srv.ClientManager, f.srv.RefreshTokenRepo, f.srv.AccessTokenRepo, f.srv.GrantRepo, nil, f.srv.localConnectorID, false)
+	creds := usersapi.Creds{User: user.User{ID: testUserID1}}
+	if err := api.RevokeRefreshTokensForClient(creds, testUserID1, testClientID); err != nil {
+		t.Fatalf("unexpected error revoking tokens: %v", err)
+	}
+
+	ti, err := f.srv.IntrospectToken(testClientCredentials, tok, "")
+	if err != nil {
+		t.Fatalf("unexpected error introspecting token: %v", err)
+	}
+	if ti.Active {
+		t.Errorf("want access token inactive after the user revoked the client's tokens")
+	}
+}
+
+func TestHandleIntrospectFunc(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	token, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+		UserID:   testUserID1,
+		ClientID: testClientID,
+		Scope:    []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating access token: %v", err)
+	}
+
+	tests := []struct {
+		method    string
+		form      url.Values
+		basicAuth bool
+
+		wantCode   int
+		wantActive bool
+	}{
+		{
+			method:     "POST",
+			form:       url.Values{"token": {token}},
+			basicAuth:  true,
+			wantCode:   http.StatusOK,
+			wantActive: true,
+		},
+		{
+			method:    "POST",
+			form:      url.Values{"token": {"unknown-token"}},
+			basicAuth: true,
+			wantCode:  http.StatusOK,
+		},
+		// the client must authenticate
+		{
+			method:   "POST",
+			form:     url.Values{"token": {token}},
+			wantCode: http.StatusUnauthorized,
+		},
+		// missing token
+		{
+			method:    "POST",
+			form:      url.Values{},
+			basicAuth: true,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			method:    "GET",
+			basicAuth: true,
+			wantCode:  http.StatusMethodNotAllowed,
+		},
+	}
+
+	hdlr := handleIntrospectFunc(f.srv)
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://example.com/token/introspect", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth {
+			req.SetBasicAuth(testClientID, clientTestSecret)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var ti TokenIntrospection
+		if err := json.Unmarshal(w.Body.Bytes(), &ti); err != nil {
+			t.Errorf("case %d: invalid response body %q: %v", i, w.Body.String(), err)
+			continue
+		}
+		if ti.Active != tt.wantActive {
+			t.Errorf("case %d: want active=%t, got=%t", i, tt.wantActive, ti.Active)
+		}
+	}
+}
+
+func signTestClaims(f *testFixtures, claims jose.Claims) (string, error) {
+	signer, err := f.srv.KeyManager.Signer()
+	if err != nil {
+		return "", err
+	}
+	jwt, err := jose.NewSignedJWT(claims, signer)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Encode(), nil
+}
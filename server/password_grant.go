@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// PasswordToken implements the resource owner password credentials grant
+// (RFC 6749 Section 4.3) for clients allowed to use it. The user is
+// identified by the client's password grant connector, and then logged in
+// like a browser login would be: through a session and Login, whose
+// authorization code is exchanged for the tokens right away.
+//
+// The user can't be asked anything along the way, so logins which need the
+// user to register or to consent to the scopes fail with invalid_grant.
+func (s *Server) PasswordToken(creds oidc.ClientCredentials, scopes []string, username, password string) (*jose.JWT, string, string, time.Time, error) {
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	cli, err := s.Client(creds.ID)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if cli.PasswordGrantConnectorID == "" {
+		log.Errorf("Client %s may not use the password grant", creds.ID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorUnauthorizedClient)
+	}
+	conn, ok := s.connector(cli.PasswordGrantConnectorID)
+	if !ok {
+		log.Errorf("Client %s has unknown password grant connector %q", creds.ID, cli.PasswordGrantConnectorID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	pc, ok := conn.(connector.PasswordConnector)
+	if !ok {
+		log.Errorf("Password grant connector %q of client %s does not support passwords", conn.ID(), creds.ID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if username == "" || password == "" {
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
+	}
+	ident, profile, err := pc.Identity(username, password)
+	if err != nil {
+		log.Errorf("Password grant login of %q through connector %q failed: %v", username, conn.ID(), err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	// The session's authentication response is never sent anywhere; it is
+	// addressed to the token endpoint so it can be told apart from redirects
+	// to pages the user would have to act on.
+	tokenEndpoint := s.absURL(httpPathToken)
+	key, err := s.NewSession(conn.ID(), creds.ID, "", tokenEndpoint, "", false, scopes, session.AuthParams{Prompt: promptNone})
+	if err != nil {
+		log.Errorf("Failed creating session: %v", err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	redirectURL, err := s.LoginWithProfile(nil, *ident, profile, connector.Authentication{}, key)
+	if err == user.ErrorNotFound {
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	} else if err != nil {
+		log.Errorf("Password grant login of %q failed: %v", username, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		log.Errorf("Failed parsing login redirect %q: %v", redirectURL, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	q := u.Query()
+	if u.Scheme != tokenEndpoint.Scheme || u.Host != tokenEndpoint.Host || u.Path != tokenEndpoint.Path {
+		log.Errorf("Password grant login of %q needs user interaction: %s", username, redirectURL)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+	if e := q.Get("error"); e != "" {
+		log.Errorf("Password grant login of %q failed: %s", username, e)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	return s.CodeToken(creds, q.Get("code"), "", nil)
+}
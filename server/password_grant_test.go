@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/grant"
+)
+
+const (
+	testPasswordGrantEmail    = "legacy@example.com"
+	testPasswordGrantPassword = "hunter22"
+)
+
+var (
+	testPasswordGrantClientCreds = oidc.ClientCredentials{
+		ID:     "password.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("password_secret")),
+	}
+	testPasswordGrantBadConnClientCreds = oidc.ClientCredentials{
+		ID:     "badconn.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("badconn_secret")),
+	}
+)
+
+// makePasswordGrantTestFixtures returns fixtures with a client allowed to use
+// the password grant through the local connector, a client whose password
+// grant connector does not support passwords, and a local user. It returns the
+// ID of the user.
+func makePasswordGrantTestFixtures() (*testFixtures, string, error) {
+	clients := append([]client.LoadableClient{}, testClients...)
+	clients = append(clients,
+		client.LoadableClient{
+			Client: client.Client{
+				Credentials:              testPasswordGrantClientCreds,
+				Metadata:                 oidc.ClientMetadata{RedirectURIs: []url.URL{testRedirectURL}},
+				PasswordGrantConnectorID: testConnectorLocalID,
+			},
+		},
+		client.LoadableClient{
+			Client: client.Client{
+				Credentials:              testPasswordGrantBadConnClientCreds,
+				Metadata:                 oidc.ClientMetadata{RedirectURIs: []url.URL{testRedirectURL}},
+				PasswordGrantConnectorID: testConnectorIDOpenID,
+			},
+		},
+	)
+	f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+	if err != nil {
+		return nil, "", err
+	}
+	userID, err := f.srv.UserManager.RegisterWithPassword(testPasswordGrantEmail, testPasswordGrantPassword, testConnectorLocalID)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, userID, nil
+}
+
+func TestServerPasswordToken(t *testing.T) {
+	tests := []struct {
+		creds       oidc.ClientCredentials
+		scopes      []string
+		username    string
+		password    string
+		granted     []string
+		disableUser bool
+
+		wantErr        error
+		wantRefreshTok bool
+	}{
+		{
+			creds:    testPasswordGrantClientCreds,
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			password: testPasswordGrantPassword,
+		},
+		// offline_access was granted earlier
+		{
+			creds:          testPasswordGrantClientCreds,
+			scopes:         []string{"offline_access", "openid"},
+			username:       testPasswordGrantEmail,
+			password:       testPasswordGrantPassword,
+			granted:        []string{"offline_access", "openid"},
+			wantRefreshTok: true,
+		},
+		// the user can't be asked for consent
+		{
+			creds:    testPasswordGrantClientCreds,
+			scopes:   []string{"offline_access", "openid"},
+			username: testPasswordGrantEmail,
+			password: testPasswordGrantPassword,
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// wrong password
+		{
+			creds:    testPasswordGrantClientCreds,
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			password: "wrong",
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// unknown user
+		{
+			creds:    testPasswordGrantClientCreds,
+			scopes:   []string{"openid"},
+			username: "nobody@example.com",
+			password: testPasswordGrantPassword,
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// missing password
+		{
+			creds:    testPasswordGrantClientCreds,
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// disabled user
+		{
+			creds:       testPasswordGrantClientCreds,
+			scopes:      []string{"openid"},
+			username:    testPasswordGrantEmail,
+			password:    testPasswordGrantPassword,
+			disableUser: true,
+			wantErr:     oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// the client has not opted in
+		{
+			creds:    testClientCredentials,
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			password: testPasswordGrantPassword,
+			wantErr:  oauth2.NewError(oauth2.ErrorUnauthorizedClient),
+		},
+		// the client's connector does not support passwords
+		{
+			creds:    testPasswordGrantBadConnClientCreds,
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			password: testPasswordGrantPassword,
+			wantErr:  oauth2.NewError(oauth2.ErrorServerError),
+		},
+		// bad client secret
+		{
+			creds:    oidc.ClientCredentials{ID: testPasswordGrantClientCreds.ID, Secret: clientTestSecret},
+			scopes:   []string{"openid"},
+			username: testPasswordGrantEmail,
+			password: testPasswordGrantPassword,
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
+	}
+
+	for i, tt := range tests {
+		f, userID, err := makePasswordGrantTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		if tt.granted != nil {
+			if err := f.srv.GrantRepo.Set(grant.Grant{UserID: userID, ClientID: tt.creds.ID, Scope: tt.granted}); err != nil {
+				t.Fatalf("case %d: unexpected error setting grant: %v", i, err)
+			}
+		}
+		if tt.disableUser {
+			if err := f.srv.UserManager.Disable(userID, true); err != nil {
+				t.Fatalf("case %d: unexpected error disabling user: %v", i, err)
+			}
+		}
+
+		jwt, accessToken, refreshToken, _, err := f.srv.PasswordToken(tt.creds, tt.scopes, tt.username, tt.password)
+		if !reflect.DeepEqual(err, tt.wantErr) {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != userID {
+			t.Errorf("case %d: want sub=%q, got %q", i, userID, sub)
+		}
+		if aud, _, _ := claims.StringClaim("aud"); aud != tt.creds.ID {
+			t.Errorf("case %d: want aud=%q, got %q", i, tt.creds.ID, aud)
+		}
+		if accessToken == "" {
+			t.Errorf("case %d: no access token issued", i)
+		}
+		if (refreshToken != "") != tt.wantRefreshTok {
+			t.Errorf("case %d: want refresh token=%t, got %q", i, tt.wantRefreshTok, refreshToken)
+		}
+	}
+}
+
+func TestHandleTokenFuncPasswordGrant(t *testing.T) {
+	tests := []struct {
+		scope string
+
+		wantCode int
+	}{
+		{
+			scope:    "openid email",
+			wantCode: http.StatusOK,
+		},
+		// openid is requested when no scope is given
+		{
+			wantCode: http.StatusOK,
+		},
+		{
+			scope:    "email",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			scope:    "openid unknown",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		f, _, err := makePasswordGrantTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+
+		form := url.Values{
+			"grant_type": {oauth2.GrantTypeUserCreds},
+			"username":   {testPasswordGrantEmail},
+			"password":   {testPasswordGrantPassword},
+		}
+		if tt.scope != "" {
+			form.Set("scope", tt.scope)
+		}
+		req, err := http.NewRequest("POST", "http://example.com/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(testPasswordGrantClientCreds.ID, testPasswordGrantClientCreds.Secret)
+
+		w := httptest.NewRecorder()
+		handleTokenFunc(f.srv).ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/session"
+)
+
+const (
+	// Code challenge methods defined by PKCE (RFC 7636 Section 4.2).
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
+
+	// RFC 7636 Section 4.1 limits code verifiers, and therefore plain code
+	// challenges, to between 43 and 128 characters.
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+var codeChallengeMethodsSupported = []string{codeChallengeMethodS256, codeChallengeMethodPlain}
+
+// validCodeVerifier reports whether s is made up of 43 to 128 characters from
+// the unreserved set [A-Z] / [a-z] / [0-9] / "-" / "." / "_" / "~". The same
+// syntax applies to code challenges.
+func validCodeVerifier(s string) bool {
+	if len(s) < minCodeVerifierLength || len(s) > maxCodeVerifierLength {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case 'A' <= c && c <= 'Z':
+		case 'a' <= c && c <= 'z':
+		case '0' <= c && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseCodeChallenge validates the PKCE parameters of an authorization request
+// and returns the code challenge method to store with the session. If the
+// client did not send a code challenge, both return values are empty.
+func parseCodeChallenge(challenge, method string) (string, error) {
+	if challenge == "" {
+		if method != "" {
+			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+			err.Description = "code_challenge_method provided without code_challenge"
+			return "", err
+		}
+		return "", nil
+	}
+
+	if method == "" {
+		method = codeChallengeMethodPlain
+	}
+	if method != codeChallengeMethodPlain && method != codeChallengeMethodS256 {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = fmt.Sprintf("unsupported code_challenge_method %q", method)
+		return "", err
+	}
+
+	if !validCodeVerifier(challenge) {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "invalid code_challenge"
+		return "", err
+	}
+	return method, nil
+}
+
+// verifyCodeVerifier checks the code verifier sent to the token endpoint
+// against the code challenge stored with the session.
+func verifyCodeVerifier(ses *session.Session, verifier string) error {
+	if ses.CodeChallenge == "" {
+		if verifier != "" {
+			err := oauth2.NewError(oauth2.ErrorInvalidGrant)
+			err.Description = "code_verifier provided for an authorization request without a code_challenge"
+			return err
+		}
+		return nil
+	}
+
+	if !validCodeVerifier(verifier) {
+		err := oauth2.NewError(oauth2.ErrorInvalidGrant)
+		err.Description = "missing or invalid code_verifier"
+		return err
+	}
+
+	var computed string
+	switch ses.CodeChallengeMethod {
+	case codeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case codeChallengeMethodPlain, "":
+		computed = verifier
+	default:
+		return oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(ses.CodeChallenge)) != 1 {
+		err := oauth2.NewError(oauth2.ErrorInvalidGrant)
+		err.Description = "code_verifier does not match code_challenge"
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/session"
+)
+
+// Example values from RFC 7636 Appendix B.
+const (
+	testCodeVerifier      = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallengeS256 = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestParseCodeChallenge(t *testing.T) {
+	tests := []struct {
+		challenge  string
+		method     string
+		wantMethod string
+		wantErr    bool
+	}{
+		// no PKCE
+		{},
+		{
+			challenge:  testCodeChallengeS256,
+			method:     "S256",
+			wantMethod: "S256",
+		},
+		// method defaults to plain
+		{
+			challenge:  testCodeVerifier,
+			wantMethod: "plain",
+		},
+		{
+			challenge:  testCodeVerifier,
+			method:     "plain",
+			wantMethod: "plain",
+		},
+		{
+			challenge: testCodeChallengeS256,
+			method:    "S512",
+			wantErr:   true,
+		},
+		// method without challenge
+		{
+			method:  "S256",
+			wantErr: true,
+		},
+		// too short
+		{
+			challenge: "abc",
+			method:    "S256",
+			wantErr:   true,
+		},
+		// invalid characters
+		{
+			challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw+cM=",
+			method:    "S256",
+			wantErr:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		method, err := parseCodeChallenge(tt.challenge, tt.method)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if method != tt.wantMethod {
+			t.Errorf("case %d: want method=%q, got=%q", i, tt.wantMethod, method)
+		}
+	}
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	tests := []struct {
+		ses      session.Session
+		verifier string
+		err      error
+	}{
+		{
+			ses:      session.Session{CodeChallenge: testCodeChallengeS256, CodeChallengeMethod: "S256"},
+			verifier: testCodeVerifier,
+		},
+		{
+			ses:      session.Session{CodeChallenge: testCodeVerifier, CodeChallengeMethod: "plain"},
+			verifier: testCodeVerifier,
+		},
+		// no PKCE
+		{
+			ses: session.Session{},
+		},
+		// S256 challenge compared as plain
+		{
+			ses:      session.Session{CodeChallenge: testCodeChallengeS256, CodeChallengeMethod: "S256"},
+			verifier: testCodeChallengeS256,
+			err:      &oauth2.Error{Type: oauth2.ErrorInvalidGrant, Description: "code_verifier does not match code_challenge"},
+		},
+		// missing verifier
+		{
+			ses: session.Session{CodeChallenge: testCodeChallengeS256, CodeChallengeMethod: "S256"},
+			err: &oauth2.Error{Type: oauth2.ErrorInvalidGrant, Description: "missing or invalid code_verifier"},
+		},
+		// verifier without challenge
+		{
+			ses:      session.Session{},
+			verifier: testCodeVerifier,
+			err:      &oauth2.Error{Type: oauth2.ErrorInvalidGrant, Description: "code_verifier provided for an authorization request without a code_challenge"},
+		},
+	}
+
+	for i, tt := range tests {
+		err := verifyCodeVerifier(&tt.ses, tt.verifier)
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("case %d: want=%v, got=%v", i, tt.err, err)
+		}
+	}
+}
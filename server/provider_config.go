@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+
+	"github.com/coreos/go-oidc/oidc"
+)
+
+// ProviderConfig is the discovery document served by dex. It extends the
+// OpenID Connect provider metadata with metadata defined by OAuth 2.0
+// extensions that oidc.ProviderConfig does not model.
+type ProviderConfig struct {
+	oidc.ProviderConfig
+
+	// PKCE code challenge methods supported (RFC 7636 Section 4.3).
+	CodeChallengeMethodsSupported []string
+
+	// Token introspection endpoint and the client authentication methods it
+	// supports (RFC 7662, RFC 8414 Section 2).
+	IntrospectionEndpoint                     *url.URL
+	IntrospectionEndpointAuthMethodsSupported []string
+
+	// Token revocation endpoint and the client authentication methods it
+	// supports (RFC 7009, RFC 8414 Section 2).
+	RevocationEndpoint                     *url.URL
+	RevocationEndpointAuthMethodsSupported []string
+
+	// End session endpoint of OpenID Connect RP-Initiated Logout 1.0.
+	EndSessionEndpoint *url.URL
+
+	// Device authorization endpoint (RFC 8628 Section 4).
+	DeviceAuthorizationEndpoint *url.URL
+
+	// Pushed authorization request endpoint (RFC 9126 Section 5).
+	PushedAuthorizationRequestEndpoint *url.URL
+}
+
+type encodableProviderConfigExtensions struct {
+	CodeChallengeMethodsSupported             []string `json:"code_challenge_methods_supported,omitempty"`
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpoint                        string   `json:"revocation_endpoint,omitempty"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	EndSessionEndpoint                        string   `json:"end_session_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint               string   `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint        string   `json:"pushed_authorization_request_endpoint,omitempty"`
+}
+
+func (p *ProviderConfig) MarshalJSON() ([]byte, error) {
+	b, err := p.ProviderConfig.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	ext, err := json.Marshal(&encodableProviderConfigExtensions{
+		CodeChallengeMethodsSupported:             p.CodeChallengeMethodsSupported,
+		IntrospectionEndpoint:                     uriToString(p.IntrospectionEndpoint),
+		IntrospectionEndpointAuthMethodsSupported: p.IntrospectionEndpointAuthMethodsSupported,
+		RevocationEndpoint:                        uriToString(p.RevocationEndpoint),
+		RevocationEndpointAuthMethodsSupported:    p.RevocationEndpointAuthMethodsSupported,
+		EndSessionEndpoint:                        uriToString(p.EndSessionEndpoint),
+		DeviceAuthorizationEndpoint:               uriToString(p.DeviceAuthorizationEndpoint),
+		PushedAuthorizationRequestEndpoint:        uriToString(p.PushedAuthorizationRequestEndpoint),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(ext, []byte("{}")) {
+		return b, nil
+	}
+
+	// Splice the extension fields onto the end of the OpenID Connect
+	// metadata so the standard fields keep their order.
+	b = append(b[:len(b)-1], ',')
+	return append(b, ext[1:]...), nil
+}
+
+func uriToString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
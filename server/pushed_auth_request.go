@@ -0,0 +1,162 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+)
+
+// pushedAuthRequestResponse is the response of the pushed authorization
+// request endpoint (RFC 9126 Section 2.2).
+type pushedAuthRequestResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+func handlePushedAuthRequestFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, ok, err := clientCredentialsFromRequest(r)
+		if err != nil || !ok {
+			log.Errorf("pushed authorization request without valid client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+
+		// The client's credentials are not part of the authorization request.
+		params := url.Values{}
+		for k, v := range r.PostForm {
+			switch k {
+			case "client_secret", "client_assertion", "client_assertion_type":
+			default:
+				params[k] = v
+			}
+		}
+
+		par, err := srv.PushAuthRequest(creds, params)
+		if err != nil {
+			log.Errorf("pushed authorization request failed: %v", err)
+			writeTokenError(w, err, "")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusCreated, pushedAuthRequestResponse{
+			RequestURI: par.RequestURI(),
+			ExpiresIn:  int64(par.ExpiresAt.Sub(par.CreatedAt).Seconds()),
+		})
+	}
+}
+
+// PushAuthRequest authenticates the client and stores its authorization
+// request (RFC 9126), to be referred to by the returned request's request_uri.
+// Requests carrying a request object are stored with the object's verified
+// claims as their parameters.
+func (s *Server) PushAuthRequest(creds oidc.ClientCredentials, params url.Values) (*session.PushedAuthRequest, error) {
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	if params.Get("request_uri") != "" {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "request_uri must not be pushed"
+		return nil, err
+	}
+	if id := params.Get("client_id"); id != "" && id != creds.ID {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "client_id does not match the client's credentials"
+		return nil, err
+	}
+	params.Set("client_id", creds.ID)
+
+	// Resolving the request verifies its request object, and enforces the
+	// use of one for clients which must sign their requests.
+	params, err = s.ResolveAuthRequest(params)
+	if err != nil {
+		return nil, err
+	}
+	acr, err := oauth2.ParseAuthCodeRequest(params)
+	if err != nil {
+		return nil, err
+	}
+	if acr.ClientID != creds.ID {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "client_id does not match the client's credentials"
+		return nil, err
+	}
+	cli, err := s.Client(creds.ID)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if _, err := cli.ValidRedirectURL(acr.RedirectURL); err != nil && !isDeviceCallbackURL(s.IssuerURL, acr.RedirectURL) {
+		log.Errorf("Pushed authorization request of client %s has an invalid redirect URL: %v", creds.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+	}
+
+	par, err := s.storeAuthRequest(creds.ID, params)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Authorization request pushed: clientID=%s", creds.ID)
+	return par, nil
+}
+
+// RepushAuthRequest stores the already resolved parameters of an
+// authorization request of the client under a new request_uri. The
+// parameters dex adds to requests while the user chooses a connector are
+// not stored.
+func (s *Server) RepushAuthRequest(clientID string, params url.Values) (*session.PushedAuthRequest, error) {
+	stored := url.Values{}
+	for k, v := range params {
+		stored[k] = v
+	}
+	for _, k := range authRequestInternalParams {
+		stored.Del(k)
+	}
+	return s.storeAuthRequest(clientID, stored)
+}
+
+func (s *Server) storeAuthRequest(clientID string, params url.Values) (*session.PushedAuthRequest, error) {
+	id, err := s.SessionManager.GenerateCode()
+	if err != nil {
+		log.Errorf("Failed generating request_uri: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	now := s.SessionManager.Clock.Now()
+	par := session.PushedAuthRequest{
+		ID:        id,
+		ClientID:  clientID,
+		Params:    params,
+		CreatedAt: now,
+		ExpiresAt: now.Add(session.DefaultPushedAuthRequestValidityWindow),
+	}
+	if err := s.PushedAuthRequestRepo.Create(par); err != nil {
+		log.Errorf("Failed storing pushed authorization request: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	return &par, nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -110,7 +111,7 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 		if exists {
 			// we have to create a new session to be able to run the server.Login function
 			newSessionKey, err := s.NewSession(ses.ConnectorID, ses.ClientID,
-				ses.ClientState, ses.RedirectURL, ses.Nonce, false, ses.Scope)
+				ses.ClientState, ses.RedirectURL, ses.Nonce, false, ses.Scope, ses.AuthParams())
 			if err != nil {
 				internalError(w, err)
 				return
@@ -121,7 +122,8 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 			}
 
 			// finally, we can create a valid redirect URL for them.
-			redirURL, err := s.Login(ses.Identity, newSessionKey)
+			auth := connector.Authentication{AMR: ses.AMR, ACR: ses.ACR}
+			redirURL, err := s.LoginWithProfile(w, ses.Identity, ses.Profile, auth, newSessionKey)
 			if err != nil {
 				internalError(w, err)
 				return
@@ -245,12 +247,29 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 			internalError(w, err)
 			return
 		}
+		ses, err = s.SessionManager.AttachAuthTime(sessionID, s.SessionManager.Clock.Now())
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		c, err := s.startBrowserSession(ses)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		http.SetCookie(w, c)
 
 		usr, err := s.UserRepo.Get(nil, userID)
 		if err != nil {
 			internalError(w, err)
 			return
 		}
+		if ses.Profile != (user.Profile{}) {
+			if err = s.UserManager.SetProfile(usr, ses.Profile); err != nil {
+				internalError(w, err)
+				return
+			}
+		}
 
 		if !trustedEmail {
 			_, err = s.UserEmailer.SendEmailVerification(usr.ID, ses.ClientID, ses.RedirectURL)
@@ -260,6 +279,28 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 			}
 		}
 
+		required, err := s.consentRequired(ses)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		if required {
+			// The code of the registration form is spent; the consent page
+			// gets a new one.
+			if _, err = s.SessionManager.ExchangeKey(code); err != nil {
+				internalError(w, err)
+				return
+			}
+			ru, err := s.consentRedirect(ses)
+			if err != nil {
+				internalError(w, err)
+				return
+			}
+			w.Header().Set("Location", ru)
+			w.WriteHeader(http.StatusSeeOther)
+			return
+		}
+
 		w.Header().Set("Location", makeClientRedirectURL(
 			ses.RedirectURL, code, ses.ClientState).String())
 		w.WriteHeader(http.StatusSeeOther)
@@ -353,6 +394,23 @@ func newLoginURLFromSession(issuer url.URL, ses *session.Session, register bool,
 	if len(ses.Scope) > 0 {
 		v.Set("scope", strings.Join(ses.Scope, " "))
 	}
+	if ses.ResponseType != "" {
+		v.Set("response_type", ses.ResponseType)
+	}
+	if ses.Nonce != "" {
+		v.Set("nonce", ses.Nonce)
+	}
+	if len(ses.ACRValues) > 0 {
+		v.Set("acr_values", strings.Join(ses.ACRValues, " "))
+	}
+	for _, r := range ses.Resources {
+		v.Add("resource", r)
+	}
+	if ses.ClaimsRequest.IDToken != nil || ses.ClaimsRequest.UserInfo != nil {
+		if b, err := json.Marshal(ses.ClaimsRequest); err == nil {
+			v.Set("claims", string(b))
+		}
+	}
 
 	loginURL.RawQuery = v.Encode()
 	return &loginURL
@@ -12,6 +12,7 @@ import (
 	"github.com/kylelemons/godebug/pretty"
 
 	"github.com/coreos/dex/pkg/html"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -101,7 +102,7 @@ func TestHandleRegister(t *testing.T) {
 			wantRegisterTemplateData: &registerTemplateData{
 				RemoteExists: &remoteExistsData{
 					Login: newURLWithParams(testRedirectURL, url.Values{
-						"code":  []string{"code-7"},
+						"code":  []string{"code-8"},
 						"state": []string{""},
 					}).String(),
 					Register: newURLWithParams(testIssuerAuth, url.Values{
@@ -295,7 +296,7 @@ func TestHandleRegister(t *testing.T) {
 				})
 		}
 
-		key, err := f.srv.NewSession(tt.connID, testClientID, "", f.redirectURL, "", true, []string{"openid"})
+		key, err := f.srv.NewSession(tt.connID, testClientID, "", f.redirectURL, "", true, []string{"openid"}, session.AuthParams{})
 		t.Logf("case %d: key for NewSession: %v", i, key)
 
 		if tt.attachRemote {
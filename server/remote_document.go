@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+
+	"github.com/coreos/dex/client"
+)
+
+const (
+	// remoteDocumentTimeout bounds how long dex waits for a document hosted
+	// by a client.
+	remoteDocumentTimeout = 5 * time.Second
+
+	// maxRemoteDocumentSize bounds the size of documents hosted by clients.
+	maxRemoteDocumentSize = 64 << 10
+
+	// remoteDocumentMaxAge is how long documents hosted by clients are
+	// cached.
+	remoteDocumentMaxAge = 5 * time.Minute
+)
+
+// remoteDocumentCache fetches the documents clients host at the URIs they
+// register: JWK Sets, request objects and sector identifiers. Documents are
+// only fetched over https, with a timeout and a bounded size, and are cached
+// so that requests naming a client do not each make dex fetch them again.
+//
+// The zero value is ready to use.
+type remoteDocumentCache struct {
+	mu   sync.Mutex
+	docs map[string]remoteDocument
+}
+
+type remoteDocument struct {
+	body    []byte
+	expires time.Time
+}
+
+var remoteDocumentClient = &http.Client{
+	Timeout: remoteDocumentTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return errors.New("redirect to a URL without https")
+		}
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+// fetch returns the document at u. The fragment of u is not sent, but it is
+// part of the cache key, so that clients can change a request object by
+// changing the fragment of its request_uri (OpenID Connect Core 1.0 Section
+// 6.2).
+func (c *remoteDocumentCache) fetch(u url.URL) ([]byte, error) {
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("%s does not use https", u.String())
+	}
+
+	now := time.Now()
+	k := u.String()
+	c.mu.Lock()
+	doc, ok := c.docs[k]
+	c.mu.Unlock()
+	if ok && now.Before(doc.expires) {
+		return doc.body, nil
+	}
+
+	u.Fragment = ""
+	resp, err := remoteDocumentClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRemoteDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteDocumentSize {
+		return nil, fmt.Errorf("document is larger than %d bytes", maxRemoteDocumentSize)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.docs == nil {
+		c.docs = make(map[string]remoteDocument)
+	}
+	for dk, d := range c.docs {
+		if !now.Before(d.expires) {
+			delete(c.docs, dk)
+		}
+	}
+	c.docs[k] = remoteDocument{body: body, expires: now.Add(remoteDocumentMaxAge)}
+	return body, nil
+}
+
+// clientJWKs returns the keys in the client's registered JWK Set, or fetches
+// the set from its jwks_uri.
+func (s *Server) clientJWKs(cli client.Client) ([]jose.JWK, error) {
+	switch {
+	case cli.Metadata.JWKS != nil:
+		return cli.Metadata.JWKS.Keys, nil
+	case cli.Metadata.JWKSURI != nil:
+		b, err := s.remoteDocuments.fetch(*cli.Metadata.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		var set jose.JWKSet
+		if err := json.Unmarshal(b, &set); err != nil {
+			return nil, err
+		}
+		return set.Keys, nil
+	}
+	return nil, nil
+}
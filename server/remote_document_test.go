@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRemoteDocumentCacheFetch(t *testing.T) {
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/doc":
+			w.Write([]byte("document"))
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", maxRemoteDocumentSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Trust the test server's certificate.
+	transport := http.DefaultTransport
+	http.DefaultTransport = ts.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	tests := []struct {
+		url string
+
+		wantErr      bool
+		wantBody     string
+		wantRequests int
+	}{
+		{
+			url:          ts.URL + "/doc",
+			wantBody:     "document",
+			wantRequests: 1,
+		},
+		// cached
+		{
+			url:          ts.URL + "/doc",
+			wantBody:     "document",
+			wantRequests: 1,
+		},
+		// the fragment is part of the cache key, but is not sent
+		{
+			url:          ts.URL + "/doc#v2",
+			wantBody:     "document",
+			wantRequests: 2,
+		},
+		{
+			url:          ts.URL + "/large",
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			url:          ts.URL + "/missing",
+			wantErr:      true,
+			wantRequests: 4,
+		},
+		// only https is allowed
+		{
+			url:          strings.Replace(ts.URL, "https:", "http:", 1) + "/doc",
+			wantErr:      true,
+			wantRequests: 4,
+		},
+	}
+
+	var c remoteDocumentCache
+	for i, tt := range tests {
+		body, err := c.fetch(mustParseURL(tt.url))
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got %v", i, tt.wantErr, err)
+		} else if string(body) != tt.wantBody {
+			t.Errorf("case %d: want body %q, got %q", i, tt.wantBody, body)
+		}
+		if requests != tt.wantRequests {
+			t.Errorf("case %d: want %d requests, got %d", i, tt.wantRequests, requests)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+)
+
+var requestObjectSigningAlgValuesSupported = []string{jose.AlgRS256}
+
+// authRequestInternalParams are the parameters dex adds to authorization
+// requests itself while the user chooses a connector. They are kept when the
+// request's parameters are replaced by those of its request object.
+var authRequestInternalParams = []string{"connector_id", "register", "show_connectors"}
+
+// requestObjectRegisteredClaims are JWT claims of request objects which are
+// not authorization request parameters.
+var requestObjectRegisteredClaims = map[string]bool{
+	"iss": true,
+	"aud": true,
+	"exp": true,
+	"nbf": true,
+	"iat": true,
+	"jti": true,
+}
+
+// ResolveAuthRequest returns the parameters of an authorization request. For
+// requests passed by value in a request parameter or by reference in a
+// request_uri parameter (RFC 9101), these are the claims of the verified
+// request object, or the parameters of the pushed authorization request
+// (RFC 9126) the request_uri refers to, which is deleted. Other requests are returned as is,
+// unless the client registered a request_object_signing_alg and so must sign
+// its requests.
+func (s *Server) ResolveAuthRequest(q url.Values) (url.Values, error) {
+	request, requestURI := q.Get("request"), q.Get("request_uri")
+	clientID := q.Get("client_id")
+
+	if request == "" && requestURI == "" {
+		if clientID == "" {
+			return q, nil
+		}
+		cli, err := s.Client(clientID)
+		if err != nil {
+			// Unknown clients are reported while parsing the request.
+			return q, nil
+		}
+		if cli.Metadata.RequestObjectOptions.SigningAlg != "" {
+			log.Errorf("Client %s must send a signed request object", clientID)
+			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+			err.Description = "the client must use a request object"
+			return nil, err
+		}
+		return q, nil
+	}
+
+	if request != "" && requestURI != "" {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "request and request_uri must not both be present"
+		return nil, err
+	}
+	if clientID == "" {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "client_id is required"
+		return nil, err
+	}
+	cli, err := s.Client(clientID)
+	if err == client.ErrorNotFound {
+		log.Errorf("Client %q not found", clientID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
+	} else if err != nil {
+		log.Errorf("Failed fetching client %q from repo: %v", clientID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	var params url.Values
+	if strings.HasPrefix(requestURI, session.PushedAuthRequestURIPrefix) {
+		par, err := s.PushedAuthRequestRepo.Get(strings.TrimPrefix(requestURI, session.PushedAuthRequestURIPrefix))
+		if err == session.ErrorPushedAuthRequestNotFound {
+			log.Errorf("Pushed authorization request %q not found", requestURI)
+			return nil, oauth2.NewError(errorInvalidRequestURI)
+		} else if err != nil {
+			log.Errorf("Failed fetching pushed authorization request %q: %v", requestURI, err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if par.ClientID != clientID {
+			log.Errorf("Pushed authorization request %q was not pushed by client %s", requestURI, clientID)
+			return nil, oauth2.NewError(errorInvalidRequestURI)
+		}
+		// A request_uri can only be used once (RFC 9126 Section 4); if
+		// it was deleted since, it was used by another request.
+		if err := s.PushedAuthRequestRepo.Delete(par.ID); err == session.ErrorPushedAuthRequestNotFound {
+			log.Errorf("Pushed authorization request %q was already used", requestURI)
+			return nil, oauth2.NewError(errorInvalidRequestURI)
+		} else if err != nil {
+			log.Errorf("Failed deleting pushed authorization request %q: %v", requestURI, err)
+			return nil, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		params = par.Params
+	} else {
+		if requestURI != "" {
+			if request, err = s.fetchRequestObject(cli, requestURI); err != nil {
+				log.Errorf("Failed fetching request object of client %s: %v", clientID, err)
+				return nil, oauth2.NewError(errorInvalidRequestURI)
+			}
+		}
+		if params, err = s.verifyRequestObject(cli, request); err != nil {
+			log.Errorf("Invalid request object of client %s: %v", clientID, err)
+			return nil, oauth2.NewError(errorInvalidRequestObject)
+		}
+	}
+
+	for _, k := range authRequestInternalParams {
+		if v, ok := q[k]; ok {
+			params[k] = v
+		}
+	}
+	return params, nil
+}
+
+// verifyRequestObject verifies a request object against the keys the client
+// registered, and returns its claims as authorization request parameters.
+func (s *Server) verifyRequestObject(cli client.Client, request string) (url.Values, error) {
+	jwt, err := jose.ParseJWT(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unsigned request objects are not accepted: they would let anyone
+	// tamper with the request.
+	alg := jwt.Header[jose.HeaderKeyAlgorithm]
+	supported := false
+	for _, a := range requestObjectSigningAlgValuesSupported {
+		if a == alg {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported alg %q", alg)
+	}
+	if want := cli.Metadata.RequestObjectOptions.SigningAlg; want != "" && alg != want {
+		return nil, fmt.Errorf("alg must be %q", want)
+	}
+
+	keys, err := s.clientPublicKeys(cli)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching client keys: %v", err)
+	}
+	ok, err := oidc.VerifySignature(jwt, keys)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("signature does not match the client's keys")
+	}
+
+	claims, err := jwt.Claims()
+	if err != nil {
+		return nil, err
+	}
+	if iss, _, _ := claims.StringClaim("iss"); iss != cli.Credentials.ID {
+		return nil, errors.New("iss must be the client ID")
+	}
+	if id, _, _ := claims.StringClaim("client_id"); id != cli.Credentials.ID {
+		return nil, errors.New("client_id must be the client ID")
+	}
+	if aud := tokenAudience(claims); len(aud) != 1 || aud[0] != s.IssuerURL.String() {
+		return nil, errors.New("aud must be the issuer")
+	}
+	now := time.Now()
+	exp, ok, err := claims.TimeClaim("exp")
+	if err != nil || !ok {
+		return nil, errors.New("missing exp")
+	}
+	if !exp.After(now) {
+		return nil, errors.New("request object is expired")
+	}
+	if nbf, ok, _ := claims.TimeClaim("nbf"); ok && nbf.After(now) {
+		return nil, errors.New("request object is not yet valid")
+	}
+
+	params := url.Values{}
+	for k, v := range claims {
+		if requestObjectRegisteredClaims[k] {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			params.Set(k, v)
+		case float64:
+			params.Set(k, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			params.Set(k, strconv.FormatBool(v))
+		default:
+			// Parameters whose values are JSON, like claims, are passed
+			// on as JSON.
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid claim %q: %v", k, err)
+			}
+			params.Set(k, string(b))
+		}
+	}
+	return params, nil
+}
+
+// fetchRequestObject fetches the request object at requestURI, which the
+// client must have registered among its request_uris.
+func (s *Server) fetchRequestObject(cli client.Client, requestURI string) (string, error) {
+	u, err := url.Parse(requestURI)
+	if err != nil {
+		return "", err
+	}
+	// The fragment only lets clients change the request object without
+	// registering another URI (OpenID Connect Core 1.0 Section 6.2).
+	unfragmented := *u
+	unfragmented.Fragment = ""
+	registered := false
+	for _, ru := range cli.Metadata.RequestURIs {
+		ru.Fragment = ""
+		if ru.String() == unfragmented.String() {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return "", fmt.Errorf("request_uri %q is not registered", requestURI)
+	}
+
+	b, err := s.remoteDocuments.fetch(*u)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
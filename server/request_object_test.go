@@ -0,0 +1,522 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/session"
+)
+
+const (
+	testJARClientID        = "jar.example.com"
+	testSignedOnlyClientID = "signed.example.com"
+)
+
+// makeRequestObjectTestFixtures returns fixtures with a client which may sign
+// its requests with clientKey and fetch them from the request URI, and a
+// client which must sign its requests.
+func makeRequestObjectTestFixtures(clientKey *key.PrivateKey, requestURI *url.URL) (*testFixtures, error) {
+	jwks := &jose.JWKSet{Keys: []jose.JWK{clientKey.JWK()}}
+	metadata := oidc.ClientMetadata{
+		RedirectURIs: []url.URL{testRedirectURL},
+		JWKS:         jwks,
+	}
+	if requestURI != nil {
+		metadata.RequestURIs = []url.URL{*requestURI}
+	}
+	clients := append([]client.LoadableClient{}, testClients...)
+	clients = append(clients,
+		client.LoadableClient{
+			Client: client.Client{
+				Credentials: oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret},
+				Metadata:    metadata,
+			},
+		},
+		client.LoadableClient{
+			Client: client.Client{
+				Credentials: oidc.ClientCredentials{ID: testSignedOnlyClientID, Secret: clientTestSecret},
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs:         []url.URL{testRedirectURL},
+					JWKS:                 jwks,
+					RequestObjectOptions: oidc.JWAOptions{SigningAlg: jose.AlgRS256},
+				},
+			},
+		},
+	)
+	return makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+}
+
+func requestObjectClaims(clientID string) jose.Claims {
+	return jose.Claims{
+		"iss":           clientID,
+		"aud":           testIssuerURL.String(),
+		"exp":           time.Now().Add(time.Minute).Unix(),
+		"client_id":     clientID,
+		"response_type": "code",
+		"redirect_uri":  testRedirectURL.String(),
+		"scope":         "openid email",
+		"state":         "signed-state",
+		"max_age":       300,
+	}
+}
+
+// requestObjectParams are the parameters of requestObjectClaims.
+func requestObjectParams(clientID string) url.Values {
+	return url.Values{
+		"client_id":     {clientID},
+		"response_type": {"code"},
+		"redirect_uri":  {testRedirectURL.String()},
+		"scope":         {"openid email"},
+		"state":         {"signed-state"},
+		"max_age":       {"300"},
+	}
+}
+
+func unsignedRequestObject(t *testing.T, claims jose.Claims) string {
+	jwt, err := jose.NewJWT(jose.JOSEHeader{jose.HeaderKeyAlgorithm: "none"}, claims)
+	if err != nil {
+		t.Fatalf("unexpected error encoding request object: %v", err)
+	}
+	return jwt.Data() + "."
+}
+
+func TestServerResolveAuthRequest(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	otherKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	requestObject := signClientAssertion(t, clientKey, requestObjectClaims(testJARClientID))
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, requestObject)
+	}))
+	defer ts.Close()
+	requestURI, _ := url.Parse(ts.URL + "/request.jwt")
+
+	// Trust the test server's certificate.
+	transport := http.DefaultTransport
+	http.DefaultTransport = ts.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	withClaims := func(f func(jose.Claims)) string {
+		claims := requestObjectClaims(testJARClientID)
+		f(claims)
+		return signClientAssertion(t, clientKey, claims)
+	}
+
+	tests := []struct {
+		query url.Values
+
+		wantParams url.Values
+		wantErr    string
+	}{
+		// plain requests are returned as is
+		{
+			query:      url.Values{"client_id": {testClientID}, "response_type": {"code"}},
+			wantParams: url.Values{"client_id": {testClientID}, "response_type": {"code"}},
+		},
+		// the client must sign its requests
+		{
+			query:   url.Values{"client_id": {testSignedOnlyClientID}, "response_type": {"code"}},
+			wantErr: oauth2.ErrorInvalidRequest,
+		},
+		{
+			query: url.Values{
+				"client_id": {testSignedOnlyClientID},
+				"request":   {signClientAssertion(t, clientKey, requestObjectClaims(testSignedOnlyClientID))},
+			},
+			wantParams: requestObjectParams(testSignedOnlyClientID),
+		},
+		// parameters outside the request object are ignored, but those dex
+		// adds itself are kept
+		{
+			query: url.Values{
+				"client_id":    {testJARClientID},
+				"scope":        {"openid offline_access"},
+				"connector_id": {"local"},
+				"request":      {requestObject},
+			},
+			wantParams: func() url.Values {
+				v := requestObjectParams(testJARClientID)
+				v.Set("connector_id", "local")
+				return v
+			}(),
+		},
+		// request object fetched from a registered request_uri
+		{
+			query: url.Values{
+				"client_id":   {testJARClientID},
+				"request_uri": {requestURI.String() + "#v2"},
+			},
+			wantParams: requestObjectParams(testJARClientID),
+		},
+		{
+			query: url.Values{
+				"client_id":   {testJARClientID},
+				"request_uri": {ts.URL + "/other.jwt"},
+			},
+			wantErr: errorInvalidRequestURI,
+		},
+		{
+			query: url.Values{
+				"client_id":   {testJARClientID},
+				"request_uri": {session.PushedAuthRequestURIPrefix + "unknown"},
+			},
+			wantErr: errorInvalidRequestURI,
+		},
+		{
+			query: url.Values{
+				"client_id":   {testJARClientID},
+				"request":     {requestObject},
+				"request_uri": {requestURI.String()},
+			},
+			wantErr: oauth2.ErrorInvalidRequest,
+		},
+		{
+			query:   url.Values{"request": {requestObject}},
+			wantErr: oauth2.ErrorInvalidRequest,
+		},
+		// signed with a key the client did not register
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {signClientAssertion(t, otherKey, requestObjectClaims(testJARClientID))},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		// unsigned
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {unsignedRequestObject(t, requestObjectClaims(testJARClientID))},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		// sent by another client
+		{
+			query: url.Values{
+				"client_id": {testSignedOnlyClientID},
+				"request":   {requestObject},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { c["iss"] = testClientID })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { c["aud"] = "https://other.example.com" })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		// missing exp
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { delete(c, "exp") })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		// missing aud
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { delete(c, "aud") })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+		// aud includes another audience
+		{
+			query: url.Values{
+				"client_id": {testJARClientID},
+				"request":   {withClaims(func(c jose.Claims) { c["aud"] = []string{testIssuerURL.String(), "https://other.example.com"} })},
+			},
+			wantErr: errorInvalidRequestObject,
+		},
+	}
+
+	f, err := makeRequestObjectTestFixtures(clientKey, requestURI)
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	for i, tt := range tests {
+		params, err := f.srv.ResolveAuthRequest(tt.query)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want err=%q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.wantParams, params) {
+			t.Errorf("case %d: want params=%v, got %v", i, tt.wantParams, params)
+		}
+	}
+}
+
+func TestHandlePushedAuthRequestFunc(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	tests := []struct {
+		form      url.Values
+		basicAuth *oidc.ClientCredentials
+
+		wantCode int
+	}{
+		{
+			form: url.Values{
+				"response_type": {"code"},
+				"redirect_uri":  {testRedirectURL.String()},
+				"scope":         {"openid"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusCreated,
+		},
+		{
+			form: url.Values{
+				"client_id":     {testJARClientID},
+				"client_secret": {clientTestSecret},
+				"request":       {signClientAssertion(t, clientKey, requestObjectClaims(testJARClientID))},
+			},
+			wantCode: http.StatusCreated,
+		},
+		// the client must sign its requests
+		{
+			form: url.Values{
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testSignedOnlyClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			form: url.Values{
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testJARClientID, Secret: "wrong"},
+			wantCode:  http.StatusUnauthorized,
+		},
+		{
+			form: url.Values{
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			form: url.Values{
+				"client_id":     {testClientID},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			form: url.Values{
+				"response_type": {"code"},
+				"redirect_uri":  {"https://evil.example.com/callback"},
+				"scope":         {"openid"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			form: url.Values{
+				"request_uri": {session.PushedAuthRequestURIPrefix + "other"},
+			},
+			basicAuth: &oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret},
+			wantCode:  http.StatusBadRequest,
+		},
+	}
+
+	idpcs := []connector.Connector{
+		&fakeConnector{loginURL: "http://fake.example.com"},
+	}
+	for i, tt := range tests {
+		f, err := makeRequestObjectTestFixtures(clientKey, nil)
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+
+		req, err := http.NewRequest("POST", "http://example.com/par", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth != nil {
+			req.SetBasicAuth(tt.basicAuth.ID, tt.basicAuth.Secret)
+		}
+
+		w := httptest.NewRecorder()
+		handlePushedAuthRequestFunc(f.srv).ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusCreated {
+			continue
+		}
+
+		var resp pushedAuthRequestResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Errorf("case %d: unexpected error decoding response: %v", i, err)
+			continue
+		}
+		if !strings.HasPrefix(resp.RequestURI, session.PushedAuthRequestURIPrefix) {
+			t.Errorf("case %d: unexpected request_uri %q", i, resp.RequestURI)
+		}
+		if want := int64(session.DefaultPushedAuthRequestValidityWindow.Seconds()); resp.ExpiresIn != want {
+			t.Errorf("case %d: want expires_in=%d, got %d", i, want, resp.ExpiresIn)
+		}
+
+		// The request_uri can only be used by the client that pushed the
+		// request, and only once.
+		for j, clientID := range []string{testClientID, testJARClientID, testJARClientID} {
+			q := url.Values{
+				"client_id":    {clientID},
+				"request_uri":  {resp.RequestURI},
+				"connector_id": {"fake"},
+			}
+			req, err := http.NewRequest("GET", "http://server.example.com/auth?"+q.Encode(), nil)
+			if err != nil {
+				t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+			}
+			w := httptest.NewRecorder()
+			handleAuthFunc(f.srv, testIssuerURL, idpcs, nil, false).ServeHTTP(w, req)
+
+			wantCode := http.StatusBadRequest
+			if j == 1 {
+				wantCode = http.StatusFound
+			}
+			if w.Code != wantCode {
+				t.Errorf("case %d, request %d: want code=%d, got=%d: %s", i, j, wantCode, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestHandlePushedAuthRequestFuncMethodNotAllowed(t *testing.T) {
+	for _, m := range []string{"GET", "PUT", "DELETE"} {
+		hdlr := handlePushedAuthRequestFunc(nil)
+		req, err := http.NewRequest(m, "http://example.com/par", nil)
+		if err != nil {
+			t.Errorf("case %s: unable to create HTTP request: %v", m, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		want := http.StatusMethodNotAllowed
+		got := w.Code
+		if want != got {
+			t.Errorf("case %s: expected HTTP %d, got %d", m, want, got)
+		}
+	}
+}
+
+func TestHandleAuthFuncPushedAuthRequestLoginPage(t *testing.T) {
+	clientKey, err := key.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	f, err := makeRequestObjectTestFixtures(clientKey, nil)
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	par, err := f.srv.PushAuthRequest(oidc.ClientCredentials{ID: testJARClientID, Secret: clientTestSecret}, url.Values{
+		"response_type": {"code"},
+		"redirect_uri":  {testRedirectURL.String()},
+		"scope":         {"openid"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error pushing request: %v", err)
+	}
+
+	idpcs := []connector.Connector{
+		&fakeConnector{loginURL: "http://fake.example.com"},
+	}
+	hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, f.srv.LoginTemplate, false)
+	get := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://server.example.com/auth?"+query, nil)
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w
+	}
+
+	q := url.Values{"client_id": {testJARClientID}, "request_uri": {par.RequestURI()}}
+	w := get(q.Encode())
+	if w.Code != http.StatusOK {
+		t.Fatalf("want login page, got code=%d: %s", w.Code, w.Body.String())
+	}
+
+	// The request_uri was used up showing the login page, whose links refer
+	// to the request with a new one.
+	m := regexp.MustCompile(`href="[^"?]*\?([^"]*connector_id=fake[^"]*)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("no link to the fake connector in login page: %s", w.Body.String())
+	}
+	link, err := url.ParseQuery(html.UnescapeString(m[1]))
+	if err != nil {
+		t.Fatalf("unexpected error parsing link: %v", err)
+	}
+	if got := link.Get("request_uri"); got == par.RequestURI() || !strings.HasPrefix(got, session.PushedAuthRequestURIPrefix) {
+		t.Errorf("want link with a new request_uri, got %q", got)
+	}
+	if w := get(q.Encode()); w.Code != http.StatusBadRequest {
+		t.Errorf("want used request_uri rejected, got code=%d", w.Code)
+	}
+
+	w = get(link.Encode())
+	if w.Code != http.StatusFound {
+		t.Fatalf("want redirect to the connector, got code=%d: %s", w.Code, w.Body.String())
+	}
+	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "http://fake.example.com") {
+		t.Errorf("want redirect to the connector, got %q", loc)
+	}
+}
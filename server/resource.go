@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/scope"
+)
+
+// ResourceServer is an API dex issues audience-restricted access tokens for.
+// Clients name it in the 'resource' parameter of authorization and token
+// requests (RFC 8707), and the access tokens they get have it as their
+// audience.
+type ResourceServer struct {
+	// ID is the resource indicator of the server: an absolute URI without a
+	// fragment, such as "https://orders.example.com".
+	ID string `json:"id"`
+
+	// Scopes are the scopes the resource server defines. Clients may request
+	// them, besides the scopes dex defines, along with the resource server.
+	Scopes []string `json:"scopes"`
+
+	// Clients are the IDs of the clients that may get access tokens for the
+	// resource server. No other client may.
+	Clients []string `json:"clients"`
+
+	// IntrospectionClients are the IDs of the clients the resource server
+	// authenticates as at the introspection endpoint. They may introspect
+	// the access tokens for the resource server.
+	IntrospectionClients []string `json:"introspectionClients"`
+}
+
+// dexScopes are the scopes dex defines, which resource servers may not
+// redefine.
+var dexScopes = map[string]bool{
+	"openid":           true,
+	"email":            true,
+	"offline_access":   true,
+	scope.ScopeProfile: true,
+	scope.ScopeGroups:  true,
+}
+
+// allowsScope reports whether the resource server defines the scope.
+func (rs ResourceServer) allowsScope(s string) bool {
+	for _, allowed := range rs.Scopes {
+		if s == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsClient reports whether the client may get access tokens for the
+// resource server.
+func (rs ResourceServer) allowsClient(clientID string) bool {
+	for _, allowed := range rs.Clients {
+		if clientID == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// introspectedBy reports whether the resource server introspects tokens as
+// the client.
+func (rs ResourceServer) introspectedBy(clientID string) bool {
+	for _, id := range rs.IntrospectionClients {
+		if clientID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validResourceIndicator checks that the resource indicator is an absolute URI
+// without a fragment (RFC 8707 Section 2).
+func validResourceIndicator(id string) error {
+	u, err := url.Parse(id)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		return errors.New("resource indicator must be an absolute URI")
+	}
+	if u.Fragment != "" {
+		return errors.New("resource indicator must not have a fragment")
+	}
+	return nil
+}
+
+// loadResourceServers parses the resource servers file. Without a file, there
+// are no resource servers.
+func loadResourceServers(filepath string) ([]ResourceServer, error) {
+	if filepath == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ResourceServersFromReader(f)
+}
+
+// ResourceServersFromReader parses a JSON list of resource servers.
+func ResourceServersFromReader(r io.Reader) ([]ResourceServer, error) {
+	var rss []ResourceServer
+	if err := json.NewDecoder(r).Decode(&rss); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, rs := range rss {
+		if err := validResourceIndicator(rs.ID); err != nil {
+			return nil, fmt.Errorf("invalid resource server %q: %v", rs.ID, err)
+		}
+		if seen[rs.ID] {
+			return nil, fmt.Errorf("duplicate resource server %q", rs.ID)
+		}
+		seen[rs.ID] = true
+		for _, sc := range rs.Scopes {
+			if dexScopes[sc] || strings.HasPrefix(sc, scope.ScopeGoogleCrossClient) {
+				return nil, fmt.Errorf("invalid resource server %q: scope %q is defined by dex", rs.ID, sc)
+			}
+		}
+	}
+	return rss, nil
+}
+
+// ResolveResources returns the resource servers named by the 'resource'
+// parameters of a request of the client. Resources dex doesn't know, and
+// those the client may not access, are rejected with an invalid_target error.
+func (s *Server) ResolveResources(clientID string, resources []string) ([]ResourceServer, error) {
+	var rss []ResourceServer
+	for _, id := range resources {
+		rs, ok := s.resourceServer(id)
+		if !ok {
+			err := oauth2.NewError(errorInvalidTarget)
+			err.Description = fmt.Sprintf("%q is not a registered resource server", id)
+			return nil, err
+		}
+		if !rs.allowsClient(clientID) {
+			err := oauth2.NewError(errorInvalidTarget)
+			err.Description = fmt.Sprintf("client may not access %q", id)
+			return nil, err
+		}
+		rss = append(rss, rs)
+	}
+	return rss, nil
+}
+
+func (s *Server) resourceServer(id string) (ResourceServer, bool) {
+	for _, rs := range s.ResourceServers {
+		if rs.ID == id {
+			return rs, true
+		}
+	}
+	return ResourceServer{}, false
+}
+
+// accessTokenScope returns the scope of an access token for the resources: the
+// granted scopes dex defines, and those the resources define. Scopes of other
+// resource servers are left out.
+func (s *Server) accessTokenScope(granted scope.Scopes, resources []string) scope.Scopes {
+	var rss []ResourceServer
+	for _, id := range resources {
+		if rs, ok := s.resourceServer(id); ok {
+			rss = append(rss, rs)
+		}
+	}
+	var scopes scope.Scopes
+	for _, sc := range granted {
+		if !s.isResourceScope(sc) || resourcesAllowScope(rss, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+	return scopes
+}
+
+// isResourceScope reports whether a resource server defines the scope.
+func (s *Server) isResourceScope(sc string) bool {
+	return resourcesAllowScope(s.ResourceServers, sc)
+}
+
+func resourcesAllowScope(rss []ResourceServer, sc string) bool {
+	for _, rs := range rss {
+		if rs.allowsScope(sc) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetResources returns the resources an access token is issued for: those
+// requested from the token endpoint, which must have been granted, or else all
+// granted ones (RFC 8707 Section 2.2). The client must still be allowed to
+// access them.
+func (s *Server) targetResources(clientID string, granted, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		if _, err := s.ResolveResources(clientID, granted); err != nil {
+			return nil, err
+		}
+		return granted, nil
+	}
+	for _, r := range requested {
+		ok := false
+		for _, g := range granted {
+			if r == g {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			err := oauth2.NewError(errorInvalidTarget)
+			err.Description = fmt.Sprintf("access to %q was not granted", r)
+			return nil, err
+		}
+	}
+	if _, err := s.ResolveResources(clientID, requested); err != nil {
+		return nil, err
+	}
+	return requested, nil
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/session"
+)
+
+var (
+	testResourceServer = ResourceServer{
+		ID:      "https://orders.example.com",
+		Scopes:  []string{"orders:read"},
+		Clients: []string{testClientID},
+	}
+	testResourceServer2 = ResourceServer{
+		ID:      "https://billing.example.com",
+		Scopes:  []string{"billing:read"},
+		Clients: []string{testClientID},
+	}
+	// testRestrictedResourceServer is a resource server the test client may
+	// not access.
+	testRestrictedResourceServer = ResourceServer{
+		ID:      "https://hr.example.com",
+		Scopes:  []string{"hr:read"},
+		Clients: []string{"other.example.com"},
+	}
+)
+
+func TestResourceServersFromReader(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    []ResourceServer
+		wantErr bool
+	}{
+		{
+			json: `[{"id": "https://orders.example.com", "scopes": ["orders:read"], "clients": ["shop"], "introspectionClients": ["orders"]}, {"id": "urn:example:billing"}]`,
+			want: []ResourceServer{
+				{ID: "https://orders.example.com", Scopes: []string{"orders:read"}, Clients: []string{"shop"}, IntrospectionClients: []string{"orders"}},
+				{ID: "urn:example:billing"},
+			},
+		},
+		{
+			// relative URI
+			json:    `[{"id": "/orders"}]`,
+			wantErr: true,
+		},
+		{
+			// fragment
+			json:    `[{"id": "https://orders.example.com#v1"}]`,
+			wantErr: true,
+		},
+		{
+			// duplicate
+			json:    `[{"id": "https://orders.example.com"}, {"id": "https://orders.example.com"}]`,
+			wantErr: true,
+		},
+		{
+			// scope defined by dex
+			json:    `[{"id": "https://orders.example.com", "scopes": ["email"]}]`,
+			wantErr: true,
+		},
+		{
+			json:    `{"id": "https://orders.example.com"}`,
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := ResourceServersFromReader(strings.NewReader(tt.json))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+// audienceEqual reports whether the aud of a token introspection is the
+// resources, or absent without resources.
+func audienceEqual(want []string, got interface{}) bool {
+	if want == nil {
+		return got == nil
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// loginWithResources logs the test user in to the test client with the
+// scopes and resources, and returns the authorization code.
+func loginWithResources(f *testFixtures, scopes, resources []string) (string, error) {
+	key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, scopes, session.AuthParams{Resources: resources})
+	if err != nil {
+		return "", err
+	}
+	redirect, err := f.srv.Login(oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}, key)
+	if err != nil {
+		return "", err
+	}
+	loc, err := url.Parse(redirect)
+	if err != nil {
+		return "", err
+	}
+	if loc.Path != httpPathConsent {
+		return loc.Query().Get("code"), nil
+	}
+
+	// The user approves the scopes of the resource servers.
+	sessionID, err := f.srv.SessionManager.ExchangeKey(loc.Query().Get("code"))
+	if err != nil {
+		return "", err
+	}
+	ses, err := f.srv.SessionManager.Get(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if redirect, err = f.srv.grantConsent(ses); err != nil {
+		return "", err
+	}
+	if loc, err = url.Parse(redirect); err != nil {
+		return "", err
+	}
+	return loc.Query().Get("code"), nil
+}
+
+func TestServerCodeTokenResources(t *testing.T) {
+	orders, billing := testResourceServer.ID, testResourceServer2.ID
+
+	tests := []struct {
+		scope          []string
+		resources      []string
+		tokenResources []string
+
+		wantErr   string
+		wantAud   []string
+		wantScope string
+	}{
+		// no resources
+		{
+			scope:     []string{"openid"},
+			wantScope: "openid",
+		},
+		// all granted resources
+		{
+			scope:     []string{"openid", "orders:read", "billing:read"},
+			resources: []string{orders, billing},
+			wantAud:   []string{orders, billing},
+			wantScope: "openid orders:read billing:read",
+		},
+		// one of the granted resources
+		{
+			scope:          []string{"openid", "orders:read", "billing:read"},
+			resources:      []string{orders, billing},
+			tokenResources: []string{billing},
+			wantAud:        []string{billing},
+			wantScope:      "openid billing:read",
+		},
+		// resource that wasn't granted
+		{
+			scope:          []string{"openid", "orders:read"},
+			resources:      []string{orders},
+			tokenResources: []string{billing},
+			wantErr:        errorInvalidTarget,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		f.srv.ResourceServers = []ResourceServer{testResourceServer, testResourceServer2}
+
+		code, err := loginWithResources(f, tt.scope, tt.resources)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error logging in: %v", i, err)
+		}
+
+		_, accessToken, _, _, err := f.srv.CodeToken(testClientCredentials, code, "", tt.tokenResources)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want error %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+
+		ti, err := f.srv.IntrospectToken(testClientCredentials, accessToken, tokenTypeHintAccessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error introspecting token: %v", i, err)
+			continue
+		}
+		if !audienceEqual(tt.wantAud, ti.Audience) {
+			t.Errorf("case %d: want audience %v, got %v", i, tt.wantAud, ti.Audience)
+		}
+		if ti.Scope != tt.wantScope {
+			t.Errorf("case %d: want scope %q, got %q", i, tt.wantScope, ti.Scope)
+		}
+
+		// Tokens for resource servers are not for dex's UserInfo endpoint.
+		_, err = f.srv.UserInfo(accessToken)
+		if restricted := tt.wantAud != nil; restricted != (err != nil) {
+			t.Errorf("case %d: restricted=%t, got UserInfo error %v", i, restricted, err)
+		}
+	}
+}
+
+func TestServerRefreshTokenResources(t *testing.T) {
+	orders, billing := testResourceServer.ID, testResourceServer2.ID
+
+	tests := []struct {
+		resources []string
+
+		wantErr   string
+		wantAud   []string
+		wantScope string
+	}{
+		{
+			wantAud:   []string{orders, billing},
+			wantScope: "openid offline_access orders:read billing:read",
+		},
+		{
+			resources: []string{orders},
+			wantAud:   []string{orders},
+			wantScope: "openid offline_access orders:read",
+		},
+		{
+			resources: []string{"https://payroll.example.com"},
+			wantErr:   errorInvalidTarget,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		f.srv.ResourceServers = []ResourceServer{testResourceServer, testResourceServer2}
+
+		code, err := loginWithResources(f, []string{"openid", "offline_access", "orders:read", "billing:read"}, []string{orders, billing})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error logging in: %v", i, err)
+		}
+		// The access token of the code is for the billing server only; the
+		// refresh token is for every granted resource.
+		_, _, refreshToken, _, err := f.srv.CodeToken(testClientCredentials, code, "", []string{billing})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error exchanging code: %v", i, err)
+		}
+
+		_, accessToken, _, _, err := f.srv.RefreshToken(testClientCredentials, nil, refreshToken, tt.resources)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want error %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error refreshing token: %v", i, err)
+			continue
+		}
+
+		ti, err := f.srv.IntrospectToken(testClientCredentials, accessToken, tokenTypeHintAccessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error introspecting token: %v", i, err)
+			continue
+		}
+		if !audienceEqual(tt.wantAud, ti.Audience) {
+			t.Errorf("case %d: want audience %v, got %v", i, tt.wantAud, ti.Audience)
+		}
+		if ti.Scope != tt.wantScope {
+			t.Errorf("case %d: want scope %q, got %q", i, tt.wantScope, ti.Scope)
+		}
+	}
+}
+
+func TestServerClientCredsTokenResources(t *testing.T) {
+	tests := []struct {
+		resources []string
+
+		wantErr string
+		wantAud []string
+	}{
+		{},
+		{
+			resources: []string{testResourceServer.ID},
+			wantAud:   []string{testResourceServer.ID},
+		},
+		{
+			resources: []string{"https://payroll.example.com"},
+			wantErr:   errorInvalidTarget,
+		},
+		// the client is not allowed to access the resource server
+		{
+			resources: []string{testRestrictedResourceServer.ID},
+			wantErr:   errorInvalidTarget,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		f.srv.ResourceServers = []ResourceServer{testResourceServer, testRestrictedResourceServer}
+
+		_, accessToken, _, err := f.srv.ClientCredsToken(testClientCredentials, tt.resources)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want error %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		ti, err := f.srv.IntrospectToken(testClientCredentials, accessToken, tokenTypeHintAccessToken)
+		if err != nil {
+			t.Errorf("case %d: unexpected error introspecting token: %v", i, err)
+			continue
+		}
+		if !audienceEqual(tt.wantAud, ti.Audience) {
+			t.Errorf("case %d: want audience %v, got %v", i, tt.wantAud, ti.Audience)
+		}
+	}
+}
+
+func TestHandleAuthFuncResources(t *testing.T) {
+	tests := []struct {
+		query url.Values
+
+		wantCode  int
+		wantError string
+	}{
+		{
+			query:    url.Values{"resource": {testResourceServer.ID}, "scope": {"openid orders:read"}},
+			wantCode: http.StatusFound,
+		},
+		{
+			query:    url.Values{"resource": {testResourceServer.ID, testResourceServer2.ID}, "scope": {"openid billing:read orders:read"}},
+			wantCode: http.StatusFound,
+		},
+		{
+			query:     url.Values{"resource": {"https://payroll.example.com"}},
+			wantCode:  http.StatusFound,
+			wantError: errorInvalidTarget,
+		},
+		// the client is not allowed to access the resource server
+		{
+			query:     url.Values{"resource": {testRestrictedResourceServer.ID}, "scope": {"openid hr:read"}},
+			wantCode:  http.StatusFound,
+			wantError: errorInvalidTarget,
+		},
+		// scope of a resource server that wasn't requested
+		{
+			query:    url.Values{"resource": {testResourceServer.ID}, "scope": {"billing:read openid"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.ResourceServers = []ResourceServer{testResourceServer, testResourceServer2, testRestrictedResourceServer}
+		idpcs := []connector.Connector{&fakeConnector{loginURL: "http://fake.example.com"}}
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, f.srv.LoginTemplate, false)
+
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"connector_id":  {"fake"},
+			"redirect_uri":  {testRedirectURL.String()},
+			"scope":         {"openid"},
+			"state":         {"xyz"},
+		}
+		for k, v := range tt.query {
+			q[k] = v
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://server.example.com/auth?%s", q.Encode()), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if w.Code != http.StatusFound {
+			continue
+		}
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		if e := loc.Query().Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+		}
+	}
+}
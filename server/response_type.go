@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/signing"
+)
+
+// responseTypesSupported lists the response types dex accepts, in their
+// canonical form.
+var responseTypesSupported = []string{
+	oauth2.ResponseTypeCode,
+	oauth2.ResponseTypeIDToken,
+	oauth2.ResponseTypeIDTokenToken,
+	oauth2.ResponseTypeCodeIDToken,
+}
+
+// parseResponseType returns the canonical form of a supported response_type
+// value. The values making up a response_type are unordered, so
+// "token id_token" is returned as "id_token token".
+func parseResponseType(responseType string) (string, bool) {
+	for _, rt := range responseTypesSupported {
+		if oauth2.ResponseTypesEqual(responseType, rt) {
+			return rt, true
+		}
+	}
+	return "", false
+}
+
+// responseTypeIncludes reports whether responseType contains typ, for example
+// "code id_token" includes "id_token".
+func responseTypeIncludes(responseType, typ string) bool {
+	for _, t := range strings.Fields(responseType) {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// isFragmentResponseType reports whether the authorization response for
+// responseType is returned in the fragment of the redirect URL rather than
+// its query (OAuth 2.0 Multiple Response Type Encoding Practices, Section 5).
+// Only the plain authorization code flow uses the query.
+func isFragmentResponseType(responseType string) bool {
+	return responseType != "" && responseType != oauth2.ResponseTypeCode
+}
+
+// tokenHash computes the at_hash or c_hash claim for an access token or
+// authorization code: the base64url encoding of the left-most half of the hash
+// of its ASCII representation, using the hash algorithm of the ID token's
+// signature alg (OpenID Connect Core 1.0, Section 3.3.2.11). EdDSA signatures
+// over Ed25519 hash with SHA-512.
+func tokenHash(token, alg string) string {
+	var sum []byte
+	switch alg {
+	case jose.AlgES384:
+		s := sha512.Sum384([]byte(token))
+		sum = s[:]
+	case signing.AlgEdDSA:
+		s := sha512.Sum512([]byte(token))
+		sum = s[:]
+	default:
+		s := sha256.Sum256([]byte(token))
+		sum = s[:]
+	}
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// fragmentRedirectURL returns redirectURL with v encoded in its fragment.
+func fragmentRedirectURL(redirectURL url.URL, v url.Values) string {
+	redirectURL.Fragment = ""
+	return redirectURL.String() + "#" + v.Encode()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/accesstoken"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/refresh"
+)
+
+func handleRevokeFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, ok, err := clientCredentialsFromRequest(r)
+		if err != nil || !ok {
+			log.Errorf("revocation request without valid client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		if err := srv.RevokeToken(creds, token, r.PostForm.Get("token_type_hint")); err != nil {
+			log.Errorf("revocation request failed: %v", err)
+			writeTokenError(w, err, "")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// RevokeToken revokes a refresh token or access token issued to the client.
+// Revoking a refresh token also revokes the access tokens the user granted
+// the client. Unknown tokens are ignored (RFC 7009 Section 2.2).
+func (s *Server) RevokeToken(creds oidc.ClientCredentials, token, tokenTypeHint string) error {
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	revokers := []func(clientID, token string) (bool, error){
+		s.revokeRefreshToken,
+		s.revokeAccessToken,
+	}
+	// The hint only changes the order in which token types are tried (RFC 7009
+	// Section 2.1).
+	if tokenTypeHint == tokenTypeHintAccessToken {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		found, err := revoke(creds.ID, token)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return nil
+}
+
+// revokeRefreshToken revokes token if it is a refresh token. found is false if
+// it is not.
+func (s *Server) revokeRefreshToken(clientID, token string) (found bool, err error) {
+	tok, err := s.RefreshTokenRepo.Get(token)
+	switch err {
+	case nil:
+		break
+	case refresh.ErrorInvalidToken:
+		return false, nil
+	default:
+		log.Errorf("Failed to fetch refresh token: %v", err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if tok.ClientID != clientID {
+		log.Errorf("Client %s may not revoke a refresh token issued to client %s", clientID, tok.ClientID)
+		return false, oauth2.NewError(oauth2.ErrorUnauthorizedClient)
+	}
+
+	// ErrorInvalidToken means another request revoked the token meanwhile.
+	switch err := s.RefreshTokenRepo.Revoke(tok.UserID, token); err {
+	case nil, refresh.ErrorInvalidToken:
+		break
+	default:
+		log.Errorf("Failed to revoke refresh token: %v", err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if err := s.AccessTokenRepo.RevokeTokensForClient(tok.UserID, tok.ClientID); err != nil {
+		log.Errorf("Failed to revoke access tokens: %v", err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	log.Infof("Refresh token revoked: clientID=%s userID=%s", clientID, tok.UserID)
+	return true, nil
+}
+
+// revokeAccessToken revokes token if it is an access token. found is false if
+// it is not.
+func (s *Server) revokeAccessToken(clientID, token string) (found bool, err error) {
+	tok, err := s.AccessTokenRepo.Get(token)
+	switch err {
+	case nil:
+		break
+	case accesstoken.ErrorInvalidToken:
+		return false, nil
+	default:
+		log.Errorf("Failed to fetch access token: %v", err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if tok.ClientID != clientID {
+		log.Errorf("Client %s may not revoke an access token issued to client %s", clientID, tok.ClientID)
+		return false, oauth2.NewError(oauth2.ErrorUnauthorizedClient)
+	}
+
+	switch err := s.AccessTokenRepo.Revoke(token); err {
+	case nil, accesstoken.ErrorInvalidToken:
+		break
+	default:
+		log.Errorf("Failed to revoke access token: %v", err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	log.Infof("Access token revoked: clientID=%s userID=%s", clientID, tok.UserID)
+	return true, nil
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/accesstoken"
+	"github.com/coreos/dex/refresh"
+)
+
+func TestServerRevokeToken(t *testing.T) {
+	tests := []struct {
+		creds         oidc.ClientCredentials
+		tokenTypeHint string
+		// revokeRefresh selects the refresh token rather than the access
+		// token for revocation.
+		revokeRefresh bool
+
+		wantErr            error
+		wantRefreshRevoked bool
+		wantAccessRevoked  bool
+	}{
+		// revoking the refresh token also revokes the access token
+		{
+			creds:              testClientCredentials,
+			revokeRefresh:      true,
+			wantRefreshRevoked: true,
+			wantAccessRevoked:  true,
+		},
+		// a misleading hint does not matter
+		{
+			creds:              testClientCredentials,
+			tokenTypeHint:      "access_token",
+			revokeRefresh:      true,
+			wantRefreshRevoked: true,
+			wantAccessRevoked:  true,
+		},
+		// revoking the access token keeps the refresh token
+		{
+			creds:             testClientCredentials,
+			tokenTypeHint:     "access_token",
+			wantAccessRevoked: true,
+		},
+		{
+			creds:             testClientCredentials,
+			wantAccessRevoked: true,
+		},
+		// tokens issued to other clients cannot be revoked
+		{
+			creds:         testPublicClientCredentials,
+			revokeRefresh: true,
+			wantErr:       oauth2.NewError(oauth2.ErrorUnauthorizedClient),
+		},
+		{
+			creds:   testPublicClientCredentials,
+			wantErr: oauth2.NewError(oauth2.ErrorUnauthorizedClient),
+		},
+		// wrong secret
+		{
+			creds: oidc.ClientCredentials{
+				ID:     testClientID,
+				Secret: base64.URLEncoding.EncodeToString([]byte("wrong")),
+			},
+			revokeRefresh: true,
+			wantErr:       oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		refreshToken, err := f.srv.RefreshTokenRepo.Create(testUserID1, testClientID, testConnectorID1, []string{"openid", "offline_access"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating refresh token: %v", i, err)
+		}
+		accessToken, _, err := f.srv.newAccessToken(accesstoken.AccessToken{
+			UserID:   testUserID1,
+			ClientID: testClientID,
+			Scope:    []string{"openid", "offline_access"},
+		})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating access token: %v", i, err)
+		}
+
+		token := accessToken
+		if tt.revokeRefresh {
+			token = refreshToken
+		}
+
+		err = f.srv.RevokeToken(tt.creds, token, tt.tokenTypeHint)
+		if !reflect.DeepEqual(tt.wantErr, err) {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+
+		_, err = f.srv.RefreshTokenRepo.Get(refreshToken)
+		if revoked := err == refresh.ErrorInvalidToken; revoked != tt.wantRefreshRevoked {
+			t.Errorf("case %d: want refresh token revoked=%t, got err=%v", i, tt.wantRefreshRevoked, err)
+		}
+		_, err = f.srv.AccessTokenRepo.Get(accessToken)
+		if revoked := err == accesstoken.ErrorInvalidToken; revoked != tt.wantAccessRevoked {
+			t.Errorf("case %d: want access token revoked=%t, got err=%v", i, tt.wantAccessRevoked, err)
+		}
+	}
+}
+
+func TestServerRevokeUnknownToken(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	for i, token := range []string{"unknown-token", "1/" + base64.URLEncoding.EncodeToString([]byte("payload"))} {
+		if err := f.srv.RevokeToken(testClientCredentials, token, ""); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestHandleRevokeFunc(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	refreshToken, err := f.srv.RefreshTokenRepo.Create(testUserID1, testClientID, testConnectorID1, []string{"openid", "offline_access"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating refresh token: %v", err)
+	}
+
+	tests := []struct {
+		method    string
+		form      url.Values
+		basicAuth bool
+
+		wantCode int
+	}{
+		{
+			method:    "POST",
+			form:      url.Values{"token": {refreshToken}, "token_type_hint": {"refresh_token"}},
+			basicAuth: true,
+			wantCode:  http.StatusOK,
+		},
+		// revoking the same token again succeeds
+		{
+			method:    "POST",
+			form:      url.Values{"token": {refreshToken}},
+			basicAuth: true,
+			wantCode:  http.StatusOK,
+		},
+		// the client must authenticate
+		{
+			method:   "POST",
+			form:     url.Values{"token": {refreshToken}},
+			wantCode: http.StatusUnauthorized,
+		},
+		// missing token
+		{
+			method:    "POST",
+			form:      url.Values{},
+			basicAuth: true,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			method:    "GET",
+			basicAuth: true,
+			wantCode:  http.StatusMethodNotAllowed,
+		},
+	}
+
+	hdlr := handleRevokeFunc(f.srv)
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://example.com/token/revoke", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth {
+			req.SetBasicAuth(testClientID, clientTestSecret)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+		}
+	}
+
+	if _, err := f.srv.RefreshTokenRepo.Get(refreshToken); err != refresh.ErrorInvalidToken {
+		t.Errorf("want refresh token revoked, got err=%v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,14 +20,19 @@ import (
 	"github.com/go-gorp/gorp"
 	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/device"
+	"github.com/coreos/dex/grant"
+	"github.com/coreos/dex/pkg/jwe"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/refresh"
 	"github.com/coreos/dex/scope"
 	"github.com/coreos/dex/session"
 	sessionmanager "github.com/coreos/dex/session/manager"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/dex/user"
 	usersapi "github.com/coreos/dex/user/api"
 	useremail "github.com/coreos/dex/user/email"
@@ -40,29 +46,107 @@ const (
 	SendResetPasswordEmailTemplateName = "send-reset-password.html"
 	ResetPasswordTemplateName          = "reset-password.html"
 	OOBTemplateName                    = "oob-template.html"
+	LogoutTemplateName                 = "logout.html"
+	ConsentTemplateName                = "consent.html"
+	DeviceTemplateName                 = "device.html"
 	APIVersion                         = "v1"
 )
 
 type OIDCServer interface {
 	Client(string) (client.Client, error)
-	NewSession(connectorID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string) (string, error)
-	Login(oidc.Identity, string) (string, error)
-
-	// CodeToken exchanges a code for an ID token and a refresh token string on success.
-	CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jose.JWT, string, time.Time, error)
+	NewSession(connectorID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string, params session.AuthParams) (string, error)
 
-	ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, time.Time, error)
+	// Login attaches the identity to the session and returns the URL to
+	// redirect the user to. Depending on the session's response type, the
+	// redirect carries an authorization code in its query, or an ID token,
+	// access token or code in its fragment.
+	Login(oidc.Identity, string) (string, error)
 
-	// RefreshToken takes a previously generated refresh token and returns a new ID token and new refresh token
-	// if the token is valid.
-	RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes, token string) (*jose.JWT, string, time.Time, error)
+	// BrowserSession returns the browser session identified by the request's
+	// cookie, or nil if there is none.
+	BrowserSession(*http.Request) (*session.BrowserSession, error)
+
+	// LoginWithBrowserSession logs the user of an authenticated browser
+	// session in without asking for their credentials again, and returns the
+	// URL to redirect the user to like Login does.
+	LoginWithBrowserSession(*session.BrowserSession, string) (string, error)
+
+	// CodeToken exchanges a code for an ID token, an access token and a refresh token string on success.
+	// The returned time is the expiry of the access token.
+	// If the authorization request carried a PKCE code challenge, codeVerifier
+	// must match it, and public clients may omit their client secret.
+	// The access token is restricted to the resources, which must have been
+	// granted, or else to all granted resources.
+	CodeToken(creds oidc.ClientCredentials, sessionKey, codeVerifier string, resources []string) (*jose.JWT, string, string, time.Time, error)
+
+	// DeviceToken exchanges a device code for an ID token, an access token
+	// and a refresh token string once the user has approved the device
+	// authorization request.
+	DeviceToken(creds oidc.ClientCredentials, deviceCode string) (*jose.JWT, string, string, time.Time, error)
+
+	// ExchangeToken exchanges an ID token issued to the client for an ID
+	// token of the same user for the audience client. The returned time is
+	// the expiry of the issued token.
+	ExchangeToken(creds oidc.ClientCredentials, subjectToken, subjectTokenType, audience string) (*jose.JWT, time.Time, error)
+
+	// PasswordToken logs the user in with their username and password through
+	// the client's password grant connector, and returns an ID token, an
+	// access token and a refresh token string like CodeToken.
+	PasswordToken(creds oidc.ClientCredentials, scopes []string, username, password string) (*jose.JWT, string, string, time.Time, error)
+
+	// ResolveAuthRequest returns the parameters of an authorization request,
+	// unpacking its request object or pushed authorization request if it
+	// refers to one. A pushed authorization request can only be used once.
+	ResolveAuthRequest(url.Values) (url.Values, error)
+
+	// RepushAuthRequest stores the resolved parameters of a pushed
+	// authorization request again, so that the login page can refer to them
+	// with a new request_uri once the first one is used.
+	RepushAuthRequest(clientID string, params url.Values) (*session.PushedAuthRequest, error)
+
+	// PushAuthRequest authenticates the client and stores its authorization
+	// request, to be referred to by the request_uri of the returned request.
+	PushAuthRequest(creds oidc.ClientCredentials, params url.Values) (*session.PushedAuthRequest, error)
+
+	// EncodeIDToken returns the serialized ID token issued to the client,
+	// encrypted if the client asked for it.
+	EncodeIDToken(clientID string, jwt *jose.JWT) (string, error)
+
+	// ClientCredsToken returns an ID token and an access token for the client itself.
+	// The access token is restricted to the resources, if any.
+	ClientCredsToken(creds oidc.ClientCredentials, resources []string) (*jose.JWT, string, time.Time, error)
+
+	// RefreshToken takes a previously generated refresh token and returns a new ID token, access token
+	// and refresh token if the token is valid.
+	// The access token is restricted to the resources like for CodeToken.
+	RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes, token string, resources []string) (*jose.JWT, string, string, time.Time, error)
+
+	// ResolveResources returns the resource servers named by the 'resource'
+	// parameters of a request of the client.
+	ResolveResources(clientID string, resources []string) ([]ResourceServer, error)
+
+	// UserInfo returns the claims about the end-user the access token was issued for.
+	UserInfo(accessToken string) (jose.Claims, error)
+
+	// IntrospectToken authenticates the client and reports whether the token
+	// is active.
+	IntrospectToken(creds oidc.ClientCredentials, token, tokenTypeHint string) (*TokenIntrospection, error)
+
+	// RevokeToken authenticates the client and revokes a refresh token or
+	// access token issued to it.
+	RevokeToken(creds oidc.ClientCredentials, token, tokenTypeHint string) error
 
 	KillSession(string) error
 
 	CrossClientAuthAllowed(requestingClientID, authorizingClientID string) (bool, error)
 }
 
-type JWTVerifierFactory func(clientID string) oidc.JWTVerifier
+// JWTVerifier verifies JWTs, such as ID tokens, issued to a client.
+type JWTVerifier interface {
+	Verify(jwt jose.JWT) error
+}
+
+type JWTVerifierFactory func(clientID string) JWTVerifier
 
 type Server struct {
 	IssuerURL url.URL
@@ -74,23 +158,39 @@ type Server struct {
 	SendResetPasswordEmailTemplate *template.Template
 	ResetPasswordTemplate          *template.Template
 	OOBTemplate                    *template.Template
+	LogoutTemplate                 *template.Template
+	ConsentTemplate                *template.Template
+	DeviceTemplate                 *template.Template
 
 	HealthChecks []health.Checkable
 	// TODO(ericchiang): Make this a map of ID to connector.
 	Connectors []connector.Connector
 
-	ClientRepo          client.ClientRepo
-	ConnectorConfigRepo connector.ConnectorConfigRepo
-	KeySetRepo          key.PrivateKeySetRepo
-	RefreshTokenRepo    refresh.RefreshTokenRepo
-	UserRepo            user.UserRepo
-	PasswordInfoRepo    user.PasswordInfoRepo
+	ClientRepo            client.ClientRepo
+	ConnectorConfigRepo   connector.ConnectorConfigRepo
+	KeySetRepo            key.PrivateKeySetRepo
+	SigningKeySetRepo     key.PrivateKeySetRepo
+	RefreshTokenRepo      refresh.RefreshTokenRepo
+	AccessTokenRepo       accesstoken.AccessTokenRepo
+	BrowserSessionRepo    session.BrowserSessionRepo
+	PushedAuthRequestRepo session.PushedAuthRequestRepo
+	ClientAssertionRepo   client.ClientAssertionRepo
+	GrantRepo             grant.GrantRepo
+	DeviceCodeRepo        device.DeviceCodeRepo
+	UserRepo              user.UserRepo
+	PasswordInfoRepo      user.PasswordInfoRepo
+	PairwiseSubjectRepo   user.PairwiseSubjectRepo
 
 	ClientManager  *clientmanager.ClientManager
 	KeyManager     key.PrivateKeyManager
 	SessionManager *sessionmanager.SessionManager
 	UserManager    *usermanager.UserManager
 
+	// SigningKeyManager holds the keys of ID tokens of clients which
+	// registered an id_token_signed_response_alg other than RS256. Without
+	// it, all ID tokens are signed by the KeyManager's RS256 keys.
+	SigningKeyManager *signing.KeyManager
+
 	UserEmailer *useremail.UserEmailer
 
 	EnableRegistration           bool
@@ -98,8 +198,40 @@ type Server struct {
 	EnableClientCredentialAccess bool
 	RegisterOnFirstLogin         bool
 
+	// AccessTokenValidityWindow is the lifetime of issued access tokens.
+	AccessTokenValidityWindow time.Duration
+
+	// BrowserSessionValidityWindow is how long a user stays logged in to dex
+	// after authenticating with a connector.
+	BrowserSessionValidityWindow time.Duration
+
+	// BrowserSessionCookieKey is the HMAC key of SSO cookies. It is kept
+	// apart from the token signing keys, so that cookies and tokens cannot
+	// stand in for each other.
+	BrowserSessionCookieKey []byte
+
+	// RevokeRefreshTokensOnLogout makes RP-initiated logout revoke the
+	// refresh tokens and access tokens the user granted the client.
+	RevokeRefreshTokensOnLogout bool
+
+	// PairwiseSubjectSalt is hashed into the subject identifiers of clients
+	// with the pairwise subject_type. Those clients are only supported when
+	// it is set, and changing it changes their users' subject identifiers.
+	PairwiseSubjectSalt string
+
+	// ResourceServers are the resource servers clients may request access
+	// tokens for with the 'resource' parameter.
+	ResourceServers []ResourceServer
+
+	// RefreshTokenExpiry is the expiry policy of refresh tokens issued to
+	// clients without their own. The StateConfigurer applies it when creating
+	// the RefreshTokenRepo.
+	RefreshTokenExpiry refresh.ExpiryPolicy
+
 	dbMap            *gorp.DbMap
 	localConnectorID string
+
+	remoteDocuments remoteDocumentCache
 }
 
 func (s *Server) Run() chan struct{} {
@@ -108,6 +240,9 @@ func (s *Server) Run() chan struct{} {
 	chans := []chan struct{}{
 		key.NewKeySetSyncer(s.KeySetRepo, s.KeyManager).Run(),
 	}
+	if s.SigningKeySetRepo != nil && s.SigningKeyManager != nil {
+		chans = append(chans, key.NewKeySetSyncer(s.SigningKeySetRepo, s.SigningKeyManager).Run())
+	}
 
 	for _, idpc := range s.Connectors {
 		chans = append(chans, idpc.Sync())
@@ -134,21 +269,55 @@ func (s *Server) KillSession(sessionKey string) error {
 	return err
 }
 
-func (s *Server) ProviderConfig() oidc.ProviderConfig {
+func (s *Server) ProviderConfig() ProviderConfig {
 	authEndpoint := s.absURL(httpPathAuth)
 	tokenEndpoint := s.absURL(httpPathToken)
 	keysEndpoint := s.absURL(httpPathKeys)
-	cfg := oidc.ProviderConfig{
-		Issuer:        &s.IssuerURL,
-		AuthEndpoint:  &authEndpoint,
-		TokenEndpoint: &tokenEndpoint,
-		KeysEndpoint:  &keysEndpoint,
-
-		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeClientCreds},
-		ResponseTypesSupported:            []string{"code"},
-		SubjectTypesSupported:             []string{"public"},
-		IDTokenSigningAlgValues:           []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+	userInfoEndpoint := s.absURL(httpPathUserInfo)
+	introspectionEndpoint := s.absURL(httpPathIntrospect)
+	revocationEndpoint := s.absURL(httpPathRevoke)
+	endSessionEndpoint := s.absURL(httpPathEndSession)
+	deviceAuthorizationEndpoint := s.absURL(httpPathDeviceCode)
+	pushedAuthRequestEndpoint := s.absURL(httpPathPushedAuthRequest)
+	cfg := ProviderConfig{
+		ProviderConfig: oidc.ProviderConfig{
+			Issuer:           &s.IssuerURL,
+			AuthEndpoint:     &authEndpoint,
+			TokenEndpoint:    &tokenEndpoint,
+			KeysEndpoint:     &keysEndpoint,
+			UserInfoEndpoint: &userInfoEndpoint,
+
+			GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeImplicit, oauth2.GrantTypeClientCreds, oauth2.GrantTypeUserCreds, grantTypeDeviceCode, grantTypeTokenExchange},
+			ResponseTypesSupported:            responseTypesSupported,
+			SubjectTypesSupported:             s.subjectTypesSupported(),
+			ACRValuesSupported:                session.ACRValuesSupported,
+			ClaimsSupported:                   claimsSupported,
+			ClaimsParameterSupported:          true,
+			IDTokenSigningAlgValues:           s.idTokenSigningAlgValues(),
+			IDTokenEncryptionAlgValues:        jwe.Algs,
+			IDTokenEncryptionEncValues:        jwe.Encs,
+			TokenEndpointAuthMethodsSupported: tokenEndpointAuthMethodsSupported,
+
+			TokenEndpointAuthSigningAlgValuesSupported: []string{"RS256"},
+
+			ReqObjSigningAlgValues:        requestObjectSigningAlgValuesSupported,
+			RequestParameterSupported:     true,
+			RequestURIParamaterSupported:  true,
+			RequireRequestURIRegistration: true,
+		},
+		CodeChallengeMethodsSupported: codeChallengeMethodsSupported,
+
+		IntrospectionEndpoint:                     &introspectionEndpoint,
+		IntrospectionEndpointAuthMethodsSupported: tokenEndpointAuthMethodsSupported,
+
+		RevocationEndpoint:                     &revocationEndpoint,
+		RevocationEndpointAuthMethodsSupported: tokenEndpointAuthMethodsSupported,
+
+		EndSessionEndpoint: &endSessionEndpoint,
+
+		DeviceAuthorizationEndpoint: &deviceAuthorizationEndpoint,
+
+		PushedAuthorizationRequestEndpoint: &pushedAuthRequestEndpoint,
 	}
 
 	if s.EnableClientRegistration {
@@ -171,7 +340,7 @@ func (s *Server) AddConnector(cfg connector.ConnectorConfig) error {
 	ns := s.IssuerURL
 	ns.Path = path.Join(ns.Path, httpPathAuth, connectorID)
 
-	idpc, err := cfg.Connector(ns, s.Login, s.Templates)
+	idpc, err := cfg.Connector(ns, s.LoginWithProfile, s.Templates)
 	if err != nil {
 		return err
 	}
@@ -242,7 +411,16 @@ func (s *Server) HTTPHandler() http.Handler {
 	handleFunc(httpPathAuth, handleAuthFunc(s, s.IssuerURL, s.Connectors, s.LoginTemplate, s.EnableRegistration))
 	handleFunc(httpPathOOB, handleOOBFunc(s, s.OOBTemplate))
 	handleFunc(httpPathToken, handleTokenFunc(s))
-	handleFunc(httpPathKeys, handleKeysFunc(s.KeyManager, clock))
+	handleFunc(httpPathKeys, handleKeysFunc(s.KeyManager, s.SigningKeyManager, clock))
+	handleFunc(httpPathUserInfo, handleUserInfoFunc(s))
+	handleFunc(httpPathIntrospect, handleIntrospectFunc(s))
+	handleFunc(httpPathRevoke, handleRevokeFunc(s))
+	handleFunc(httpPathEndSession, handleEndSessionFunc(s, s.LogoutTemplate))
+	handleFunc(httpPathConsent, handleConsentFunc(s, s.ConsentTemplate))
+	handleFunc(httpPathDevice, handleDeviceFunc(s, s.DeviceTemplate))
+	handleFunc(httpPathDeviceCode, handleDeviceCodeFunc(s))
+	handleFunc(httpPathDeviceCallback, handleDeviceCallbackFunc(s, s.DeviceTemplate))
+	handleFunc(httpPathPushedAuthRequest, handlePushedAuthRequestFunc(s))
 	handle(httpPathHealth, makeHealthHandler(checks))
 
 	if s.EnableRegistration {
@@ -283,6 +461,7 @@ func (s *Server) HTTPHandler() http.Handler {
 
 	if s.EnableClientRegistration {
 		handleFunc(httpPathClientRegistration, s.handleClientRegistration)
+		handleFunc(httpPathClientRegistration+"/", s.handleClientConfiguration)
 	}
 
 	handleFunc(httpPathDebugVars, health.ExpvarHandler)
@@ -301,8 +480,8 @@ func (s *Server) HTTPHandler() http.Handler {
 	apiBasePath := path.Join(httpPathAPI, APIVersion)
 	registerDiscoveryResource(apiBasePath, mux)
 
-	usersAPI := usersapi.NewUsersAPI(s.UserManager, s.ClientManager, s.RefreshTokenRepo, s.UserEmailer, s.localConnectorID, s.EnableClientCredentialAccess)
-	handler := NewUserMgmtServer(usersAPI, s.JWTVerifierFactory(), s.UserManager, s.ClientManager, s.EnableClientCredentialAccess).HTTPHandler()
+	usersAPI := usersapi.NewUsersAPI(s.UserManager, s.ClientManager, s.RefreshTokenRepo, s.AccessTokenRepo, s.GrantRepo, s.UserEmailer, s.localConnectorID, s.EnableClientCredentialAccess)
+	handler := NewUserMgmtServer(usersAPI, s.JWTVerifierFactory(), s.SubjectResolver(), s.UserManager, s.ClientManager, s.EnableClientCredentialAccess).HTTPHandler()
 
 	handleStripPrefix(apiBasePath+"/", handler)
 
@@ -323,12 +502,67 @@ func (s *Server) Client(clientID string) (client.Client, error) {
 	return s.ClientManager.Get(clientID)
 }
 
-func (s *Server) NewSession(ipdcID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string) (string, error) {
+// clientExists reports whether the client is registered. Tokens of clients
+// that have been deleted are no longer valid.
+func (s *Server) clientExists(clientID string) (bool, error) {
+	_, err := s.ClientManager.Get(clientID)
+	switch err {
+	case nil:
+		return true, nil
+	case client.ErrorNotFound:
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *Server) NewSession(ipdcID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string, params session.AuthParams) (string, error) {
 	sessionID, err := s.SessionManager.NewSession(ipdcID, clientID, clientState, redirectURL, nonce, register, scope)
 	if err != nil {
 		return "", err
 	}
 
+	if params.ResponseType != "" && params.ResponseType != oauth2.ResponseTypeCode {
+		if _, err := s.SessionManager.AttachResponseType(sessionID, params.ResponseType); err != nil {
+			return "", err
+		}
+	}
+
+	if params.CodeChallenge != "" {
+		if _, err := s.SessionManager.AttachCodeChallenge(sessionID, params.CodeChallenge, params.CodeChallengeMethod); err != nil {
+			return "", err
+		}
+	}
+
+	if params.Prompt != "" {
+		if _, err := s.SessionManager.AttachPrompt(sessionID, params.Prompt); err != nil {
+			return "", err
+		}
+	}
+
+	if params.BrowserSessionID != "" {
+		if _, err := s.SessionManager.AttachBrowserSession(sessionID, params.BrowserSessionID); err != nil {
+			return "", err
+		}
+	}
+
+	if len(params.ACRValues) > 0 {
+		if _, err := s.SessionManager.AttachACRValues(sessionID, params.ACRValues); err != nil {
+			return "", err
+		}
+	}
+
+	if params.ClaimsRequest.IDToken != nil || params.ClaimsRequest.UserInfo != nil {
+		if _, err := s.SessionManager.AttachClaimsRequest(sessionID, params.ClaimsRequest); err != nil {
+			return "", err
+		}
+	}
+
+	if len(params.Resources) > 0 {
+		if _, err := s.SessionManager.AttachResources(sessionID, params.Resources); err != nil {
+			return "", err
+		}
+	}
+
 	log.Infof("Session %s created: clientID=%s clientState=%s", sessionID, clientID, clientState)
 	return s.SessionManager.NewSessionKey(sessionID)
 }
@@ -343,6 +577,23 @@ func (s *Server) connector(id string) (connector.Connector, bool) {
 }
 
 func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
+	return s.login(nil, ident, user.Profile{}, connector.Authentication{}, key, nil)
+}
+
+// LoginWithProfile is like Login, but also records the profile the connector
+// reported about the user, and how it authenticated them. It is the login
+// function of connectors. If w is not nil, the user is logged in to dex, and
+// the cookie of their new browser session is set on w.
+func (s *Server) LoginWithProfile(w http.ResponseWriter, ident oidc.Identity, profile user.Profile, auth connector.Authentication, key string) (string, error) {
+	return s.login(w, ident, profile, auth, key, nil)
+}
+
+// login logs the user in to the session identified by key. bs is the
+// authenticated browser session the identity came from, or nil if the user
+// has just authenticated with the session's connector. The user's profile is
+// replaced with profile unless it's empty; auth is how the connector reported
+// it authenticated the user.
+func (s *Server) login(w http.ResponseWriter, ident oidc.Identity, profile user.Profile, auth connector.Authentication, key string, bs *session.BrowserSession) (string, error) {
 	sessionID, err := s.SessionManager.ExchangeKey(key)
 	if err != nil {
 		return "", err
@@ -354,18 +605,53 @@ func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
 	}
 	log.Infof("Session %s remote identity attached: clientID=%s identity=%#v", sessionID, ses.ClientID, ident)
 
+	if profile != (user.Profile{}) {
+		if ses, err = s.SessionManager.AttachProfile(sessionID, profile); err != nil {
+			return "", fmt.Errorf("attaching profile to session: %v", err)
+		}
+	}
+
 	// Get the connector used to log the user in.
 	conn, ok := s.connector(ses.ConnectorID)
 	if !ok {
 		return "", fmt.Errorf("session contained invalid connector ID (%s)", ses.ConnectorID)
 	}
 
-	// If the client has requested access to groups, add them here.
-	if ses.Scope.HasScope(scope.ScopeGroups) {
-		grouper, ok := conn.(connector.GroupsConnector)
-		if !ok {
-			return "", fmt.Errorf("scope %q provided but connector does not support groups", scope.ScopeGroups)
+	// Users who authenticated too weakly for the client are asked to log
+	// in again through a stronger connector. The upstream identity provider
+	// may have authenticated them more weakly than its connector is
+	// configured to, so that connector is not offered again.
+	if bs != nil {
+		auth = connector.Authentication{AMR: bs.AMR, ACR: bs.ACR}
+	}
+	auth = authContext(conn, auth)
+	minACR := session.MinACR(ses.ACRValues)
+	if !session.SatisfiesACR(session.AuthContextClass(auth.AMR, auth.ACR), minACR) {
+		var stronger []string
+		for _, c := range s.Connectors {
+			if c.ID() != conn.ID() && connectorSatisfiesACR(c, minACR) {
+				stronger = append(stronger, c.ID())
+			}
+		}
+		if len(stronger) == 0 {
+			return s.authErrorRedirect(ses, errorUnmetAuthRequirements)
 		}
+		u := newLoginURLFromSession(s.IssuerURL, ses, false, stronger, "stronger-auth")
+		return u.String(), nil
+	}
+	if ses, err = s.SessionManager.AttachAuthMethods(sessionID, auth.AMR, auth.ACR); err != nil {
+		return "", fmt.Errorf("attaching auth methods to session: %v", err)
+	}
+
+	// If the client has requested access to groups, add them here. Groups
+	// requested as an individual claim are left out if the connector
+	// doesn't support them.
+	groupsScope := ses.Scope.HasScope(scope.ScopeGroups)
+	grouper, ok := conn.(connector.GroupsConnector)
+	if groupsScope && !ok {
+		return "", fmt.Errorf("scope %q provided but connector does not support groups", scope.ScopeGroups)
+	}
+	if ok && (groupsScope || ses.ClaimsRequest.Requested("groups")) {
 		groups, err := grouper.Groups(ident.ID)
 		if err != nil {
 			return "", fmt.Errorf("failed to retrieve user groups for %q %v", ident.ID, err)
@@ -443,13 +729,69 @@ func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
 		return "", user.ErrorNotFound
 	}
 
+	// Keep the profile up to date with what the connector knows about the
+	// user.
+	if ses.Profile != (user.Profile{}) && ses.Profile != usr.Profile {
+		if err = s.UserManager.SetProfile(usr, ses.Profile); err != nil {
+			return "", fmt.Errorf("couldn't set profile for user: %v", err)
+		}
+		usr.Profile = ses.Profile
+	}
+
 	ses, err = s.SessionManager.AttachUser(sessionID, usr.ID)
 	if err != nil {
 		return "", fmt.Errorf("attaching user to session: %v", err)
 	}
+
+	// A client asking for the ID token of a particular subject wants that
+	// user logged in.
+	if r := ses.ClaimsRequest.IDToken["sub"]; r != nil {
+		sub, err := s.subject(usr.ID, ses.ClientID)
+		if err != nil {
+			return "", fmt.Errorf("getting subject: %v", err)
+		}
+		if !r.Allows(sub) {
+			log.Infof("Session %s user %s is not the requested subject", sessionID, usr.ID)
+			return s.authErrorRedirect(ses, errorLoginRequired)
+		}
+	}
 	log.Infof("Session %s user identified: clientID=%s user=%#v", sessionID, ses.ClientID, usr)
 
-	code, err := s.SessionManager.NewSessionKey(sessionID)
+	authTime := s.SessionManager.Clock.Now()
+	if bs != nil {
+		authTime = bs.AuthTime
+	}
+	if ses, err = s.SessionManager.AttachAuthTime(sessionID, authTime); err != nil {
+		return "", fmt.Errorf("attaching auth time to session: %v", err)
+	}
+	if bs == nil && w != nil {
+		c, err := s.startBrowserSession(ses)
+		if err != nil {
+			return "", fmt.Errorf("starting browser session: %v", err)
+		}
+		http.SetCookie(w, c)
+	}
+
+	required, err := s.consentRequired(ses)
+	if err != nil {
+		return "", fmt.Errorf("checking consent: %v", err)
+	}
+	if required {
+		return s.consentRedirect(ses)
+	}
+
+	return s.authResponseRedirect(ses, usr)
+}
+
+// authResponseRedirect returns the URL that sends the authentication response
+// for the session to the client. Depending on the session's response type, it
+// carries an authorization code in its query, or tokens in its fragment.
+func (s *Server) authResponseRedirect(ses *session.Session, usr user.User) (string, error) {
+	if isFragmentResponseType(ses.ResponseType) {
+		return s.fragmentRedirect(ses, usr)
+	}
+
+	code, err := s.SessionManager.NewSessionKey(ses.ID)
 	if err != nil {
 		return "", fmt.Errorf("creating new session key: %v", err)
 	}
@@ -466,29 +808,149 @@ func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
 	return ru.String(), nil
 }
 
-func (s *Server) ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, time.Time, error) {
+// fragmentRedirect issues the tokens of the implicit and hybrid flows from the
+// authorization endpoint, and returns the redirect URL carrying them in its
+// fragment.
+func (s *Server) fragmentRedirect(ses *session.Session, usr user.User) (string, error) {
+	v := url.Values{}
+	v.Set("state", ses.ClientState)
+
+	claims, err := s.sessionClaims(ses, usr)
+	if err != nil {
+		return "", fmt.Errorf("getting claims: %v", err)
+	}
+
+	signer, err := s.idTokenSigner(ses.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("getting signer: %v", err)
+	}
+
+	if responseTypeIncludes(ses.ResponseType, oauth2.ResponseTypeCode) {
+		code, err := s.SessionManager.NewSessionKey(ses.ID)
+		if err != nil {
+			return "", fmt.Errorf("creating new session key: %v", err)
+		}
+		v.Set("code", code)
+		claims.Add("c_hash", tokenHash(code, signer.Alg()))
+	} else {
+		// Nothing is left to exchange at the token endpoint.
+		if _, err := s.SessionManager.Kill(ses.ID); err != nil {
+			return "", fmt.Errorf("killing session: %v", err)
+		}
+	}
+
+	if responseTypeIncludes(ses.ResponseType, oauth2.ResponseTypeToken) {
+		accessToken, expiresAt, err := s.newAccessToken(accesstoken.AccessToken{
+			UserID:      ses.UserID,
+			ClientID:    ses.ClientID,
+			ConnectorID: ses.ConnectorID,
+			Scope:       s.accessTokenScope(ses.Scope, ses.Resources),
+			Groups:      ses.Groups,
+			Claims:      ses.ClaimsRequest.UserInfo,
+			Resources:   ses.Resources,
+		})
+		if err != nil {
+			return "", fmt.Errorf("creating access token: %v", err)
+		}
+		v.Set("access_token", accessToken)
+		v.Set("token_type", "bearer")
+		v.Set("expires_in", strconv.FormatInt(int64(expiresAt.Sub(time.Now()).Seconds()), 10))
+		claims.Add("at_hash", tokenHash(accessToken, signer.Alg()))
+	}
+
+	jwt, err := jose.NewSignedJWT(claims, signer)
+	if err != nil {
+		return "", fmt.Errorf("signing ID token: %v", err)
+	}
+	idToken, err := s.EncodeIDToken(ses.ClientID, jwt)
+	if err != nil {
+		return "", fmt.Errorf("encoding ID token: %v", err)
+	}
+	v.Set("id_token", idToken)
+
+	log.Infof("Session %s tokens sent from the authorization endpoint: clientID=%s responseType=%q", ses.ID, ses.ClientID, ses.ResponseType)
+	return fragmentRedirectURL(ses.RedirectURL, v), nil
+}
+
+// sessionClaims returns the claims of the ID token issued for the session.
+func (s *Server) sessionClaims(ses *session.Session, usr user.User) (jose.Claims, error) {
+	claims := ses.Claims(s.IssuerURL.String())
+	usr.AddToClaims(claims)
+	addProfileClaims(claims, usr.Profile, ses.Scope, ses.ClaimsRequest.IDToken)
+
+	addRequestedClaims(claims, ses.ClaimsRequest.IDToken, ses.Groups)
+	if err := s.addClaimsFromScope(claims, ses.Scope, ses.ClientID); err != nil {
+		return nil, err
+	}
+	if err := s.setSubject(claims, usr.ID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parseSignedJWT returns the claims of a JWT issued by dex, such as an ID
+// token. ok is false if the token is malformed, not signed by one of dex's
+// keys or from another issuer. Its expiry is left to the caller.
+func (s *Server) parseSignedJWT(token string) (claims jose.Claims, ok bool, err error) {
+	jwt, err := jose.ParseJWT(token)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	if ok, err := s.verifySignature(jwt); err != nil {
+		log.Errorf("Failed to verify JWT signature: %v", err)
+		return nil, false, oauth2.NewError(oauth2.ErrorServerError)
+	} else if !ok {
+		return nil, false, nil
+	}
+
+	claims, err = jwt.Claims()
+	if err != nil {
+		return nil, false, nil
+	}
+	if iss, _, _ := claims.StringClaim("iss"); iss != s.IssuerURL.String() {
+		return nil, false, nil
+	}
+	return claims, true, nil
+}
+
+// idTokenClientID returns the client an ID token was issued to: its authorized
+// party, or else its audience.
+func idTokenClientID(claims jose.Claims) string {
+	if azp, ok, _ := claims.StringClaim("azp"); ok {
+		return azp
+	}
+	aud, _, _ := claims.StringClaim("aud")
+	return aud
+}
+
+func (s *Server) ClientCredsToken(creds oidc.ClientCredentials, resources []string) (*jose.JWT, string, time.Time, error) {
 	cli, err := s.Client(creds.ID)
 	if err != nil {
-		return nil, time.Time{}, err
+		return nil, "", time.Time{}, err
 	}
 
 	if cli.Public {
-		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
 	}
 
-	ok, err := s.ClientManager.Authenticate(creds)
+	ok, err := s.authenticateClient(creds)
 	if err != nil {
 		log.Errorf("Failed fetching client %s from manager: %v", creds.ID, err)
-		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 	if !ok {
-		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	if _, err := s.ResolveResources(creds.ID, resources); err != nil {
+		return nil, "", time.Time{}, err
 	}
 
 	signer, err := s.KeyManager.Signer()
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	now := time.Now()
@@ -499,60 +961,111 @@ func (s *Server) ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, time
 	jwt, err := jose.NewSignedJWT(claims, signer)
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	accessToken, accessExp, err := s.newAccessToken(accesstoken.AccessToken{ClientID: creds.ID, Resources: resources})
+	if err != nil {
+		log.Errorf("Failed to generate access token: %v", err)
+		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	log.Infof("Client token sent: clientID=%s", creds.ID)
 
-	return jwt, exp, nil
+	return jwt, accessToken, accessExp, nil
 }
 
-func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jose.JWT, string, time.Time, error) {
-	ok, err := s.ClientManager.Authenticate(creds)
-	if err != nil {
-		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
-	}
-	if !ok {
-		log.Errorf("Failed to Authenticate client %s", creds.ID)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey, codeVerifier string, resources []string) (*jose.JWT, string, string, time.Time, error) {
+	// Public clients using PKCE are not required to authenticate, the code
+	// verifier proves they initiated the authorization request.
+	publicPKCE := false
+	if creds.Secret == "" {
+		cli, err := s.Client(creds.ID)
+		if err != nil {
+			log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
+		if !cli.Public {
+			log.Errorf("Client %s is not public and did not provide a secret", creds.ID)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
+		publicPKCE = true
+	} else {
+		ok, err := s.authenticateClient(creds)
+		if err != nil {
+			log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if !ok {
+			log.Errorf("Failed to Authenticate client %s", creds.ID)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
 	}
 
 	sessionID, err := s.SessionManager.ExchangeKey(sessionKey)
 	if err != nil {
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
 	}
 
 	ses, err := s.SessionManager.Kill(sessionID)
 	if err != nil {
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
 	}
 
 	if ses.ClientID != creds.ID {
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
 	}
 
-	signer, err := s.KeyManager.Signer()
+	if publicPKCE && ses.CodeChallenge == "" {
+		log.Errorf("Public client %s did not provide a secret or use PKCE", creds.ID)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	if err := verifyCodeVerifier(ses, codeVerifier); err != nil {
+		log.Errorf("Failed PKCE verification for session %s: %v", sessionID, err)
+		return nil, "", "", time.Time{}, err
+	}
+
+	resources, err = s.targetResources(creds.ID, ses.Resources, resources)
+	if err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+
+	jwt, accessToken, refreshToken, expiresAt, err := s.sessionTokens(ses, resources)
+	if err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+
+	log.Infof("Session %s token sent: clientID=%s", sessionID, creds.ID)
+	return jwt, accessToken, refreshToken, expiresAt, nil
+}
+
+// sessionTokens issues the ID token, access token and, if the session was
+// granted offline access, refresh token for a session whose user has been
+// identified. The access token is restricted to the resources, a subset of
+// those granted to the session.
+func (s *Server) sessionTokens(ses *session.Session, resources []string) (*jose.JWT, string, string, time.Time, error) {
+	signer, err := s.idTokenSigner(ses.ClientID)
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	user, err := s.UserRepo.Get(nil, ses.UserID)
 	if err != nil {
 		log.Errorf("Failed to fetch user %q from repo: %v: ", ses.UserID, err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
-	claims := ses.Claims(s.IssuerURL.String())
-	user.AddToClaims(claims)
-
-	s.addClaimsFromScope(claims, ses.Scope, ses.ClientID)
+	claims, err := s.sessionClaims(ses, user)
+	if err != nil {
+		return nil, "", "", time.Time{}, err
+	}
 
 	jwt, err := jose.NewSignedJWT(claims, signer)
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	// Generate refresh token when 'scope' contains 'offline_access'.
@@ -560,61 +1073,85 @@ func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jo
 
 	for _, scope := range ses.Scope {
 		if scope == "offline_access" {
-			log.Infof("Session %s requests offline access, will generate refresh token", sessionID)
+			log.Infof("Session %s requests offline access, will generate refresh token", ses.ID)
 
-			refreshToken, err = s.RefreshTokenRepo.Create(ses.UserID, creds.ID, ses.ConnectorID, ses.Scope)
+			refreshToken, err = s.RefreshTokenRepo.Create(ses.UserID, ses.ClientID, ses.ConnectorID, ses.Scope, ses.Resources)
 			switch err {
 			case nil:
 				break
 			default:
 				log.Errorf("Failed to generate refresh token: %v", err)
-				return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+				return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 			}
 			break
 		}
 	}
 
-	log.Infof("Session %s token sent: clientID=%s", sessionID, creds.ID)
-	return jwt, refreshToken, ses.ExpiresAt, nil
+	accessToken, expiresAt, err := s.newAccessToken(accesstoken.AccessToken{
+		UserID:      ses.UserID,
+		ClientID:    ses.ClientID,
+		ConnectorID: ses.ConnectorID,
+		Scope:       s.accessTokenScope(ses.Scope, resources),
+		Groups:      ses.Groups,
+		Claims:      ses.ClaimsRequest.UserInfo,
+		Resources:   resources,
+	})
+	if err != nil {
+		log.Errorf("Failed to generate access token: %v", err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	return jwt, accessToken, refreshToken, expiresAt, nil
 }
 
-func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes, token string) (*jose.JWT, string, time.Time, error) {
-	ok, err := s.ClientManager.Authenticate(creds)
+func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes, token string, resources []string) (*jose.JWT, string, string, time.Time, error) {
+	ok, err := s.authenticateClient(creds)
 	if err != nil {
 		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 	if !ok {
 		log.Errorf("Failed to Authenticate client %s", creds.ID)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
 	}
 
 	userID, connectorID, rtScopes, err := s.RefreshTokenRepo.Verify(creds.ID, token)
 	switch err {
 	case nil:
 		break
+	case refresh.ErrorTokenReused:
+		return nil, "", "", time.Time{}, s.revokeReusedRefreshToken(creds.ID, userID)
 	case refresh.ErrorInvalidToken:
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
 	case refresh.ErrorInvalidClientID:
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
 	default:
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	if len(scopes) == 0 {
 		scopes = rtScopes
 	} else {
 		if !rtScopes.Contains(scopes) {
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
 		}
 	}
 
+	rt, err := s.RefreshTokenRepo.Get(token)
+	if err != nil {
+		log.Errorf("Failed to fetch refresh token: %v", err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if resources, err = s.targetResources(creds.ID, rt.Resources, resources); err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+
 	usr, err := s.UserRepo.Get(nil, userID)
 	if err != nil {
 		// The error can be user.ErrorNotFound, but we are not deleting
 		// user at this moment, so this shouldn't happen.
 		log.Errorf("Failed to fetch user %q from repo: %v: ", userID, err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	var groups []string
@@ -622,19 +1159,19 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes,
 		conn, ok := s.connector(connectorID)
 		if !ok {
 			log.Errorf("refresh token contained invalid connector ID (%s)", connectorID)
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 		}
 
 		grouper, ok := conn.(connector.GroupsConnector)
 		if !ok {
 			log.Errorf("refresh token requested groups for connector (%s) that doesn't support groups", connectorID)
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 		}
 
 		remoteIdentities, err := s.UserRepo.GetRemoteIdentities(nil, userID)
 		if err != nil {
 			log.Errorf("failed to get remote identities: %v", err)
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 		}
 		remoteIdentity, ok := func() (user.RemoteIdentity, bool) {
 			for _, ri := range remoteIdentities {
@@ -646,18 +1183,18 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes,
 		}()
 		if !ok {
 			log.Errorf("failed to get remote identity for connector %s", connectorID)
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 		}
 		if groups, err = grouper.Groups(remoteIdentity.ID); err != nil {
 			log.Errorf("failed to get groups for refresh token: %v", connectorID)
-			return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 		}
 	}
 
-	signer, err := s.KeyManager.Signer()
+	signer, err := s.idTokenSigner(creds.ID)
 	if err != nil {
 		log.Errorf("Failed to refresh ID token: %v", err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	now := time.Now()
@@ -665,6 +1202,7 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes,
 
 	claims := oidc.NewClaims(s.IssuerURL.String(), usr.ID, creds.ID, now, expiresAt)
 	usr.AddToClaims(claims)
+	addProfileClaims(claims, usr.Profile, rtScopes, nil)
 	if rtScopes.HasScope(scope.ScopeGroups) {
 		if groups == nil {
 			groups = []string{}
@@ -672,23 +1210,159 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, scopes scope.Scopes,
 		claims["groups"] = groups
 	}
 
-	s.addClaimsFromScope(claims, scope.Scopes(scopes), creds.ID)
+	if err := s.addClaimsFromScope(claims, scope.Scopes(scopes), creds.ID); err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+	if err := s.setSubject(claims, usr.ID); err != nil {
+		return nil, "", "", time.Time{}, err
+	}
 
 	jwt, err := jose.NewSignedJWT(claims, signer)
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
-	refreshToken, err := s.RefreshTokenRepo.RenewRefreshToken(creds.ID, userID, token)
+	cli, err := s.Client(creds.ID)
 	if err != nil {
-		log.Errorf("Failed to generate new refresh token: %v", err)
-		return nil, "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	refreshToken := token
+	if !cli.DisableRefreshTokenRotation {
+		refreshToken, err = s.RefreshTokenRepo.RenewRefreshToken(creds.ID, userID, token)
+		switch err {
+		case nil:
+			break
+		case refresh.ErrorTokenReused:
+			return nil, "", "", time.Time{}, s.revokeReusedRefreshToken(creds.ID, userID)
+		default:
+			log.Errorf("Failed to generate new refresh token: %v", err)
+			return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		}
+	}
+
+	accessToken, accessExp, err := s.newAccessToken(accesstoken.AccessToken{
+		UserID:      userID,
+		ClientID:    creds.ID,
+		ConnectorID: connectorID,
+		Scope:       s.accessTokenScope(scopes, resources),
+		Groups:      groups,
+		Resources:   resources,
+	})
+	if err != nil {
+		log.Errorf("Failed to generate access token: %v", err)
+		return nil, "", "", time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	log.Infof("New token sent: clientID=%s", creds.ID)
 
-	return jwt, refreshToken, expiresAt, nil
+	return jwt, accessToken, refreshToken, accessExp, nil
+}
+
+// revokeReusedRefreshToken handles a refresh token presented after it was
+// rotated. The RefreshTokenRepo has revoked the grant already; the access
+// tokens the user granted the client are revoked too, as either the client or
+// an attacker holds a stolen token.
+func (s *Server) revokeReusedRefreshToken(clientID, userID string) error {
+	log.Errorf("Rotated refresh token reused, revoking grant: clientID=%s userID=%s", clientID, userID)
+	if err := s.AccessTokenRepo.RevokeTokensForClient(userID, clientID); err != nil {
+		log.Errorf("Failed to revoke access tokens: %v", err)
+		return oauth2.NewError(oauth2.ErrorServerError)
+	}
+	return oauth2.NewError(oauth2.ErrorInvalidGrant)
+}
+
+// newAccessToken issues an opaque access token with the properties of tok,
+// valid for the server's access token validity window, and returns it with
+// its expiry.
+func (s *Server) newAccessToken(tok accesstoken.AccessToken) (string, time.Time, error) {
+	tok.CreatedAt = time.Now()
+	tok.ExpiresAt = tok.CreatedAt.Add(s.AccessTokenValidityWindow)
+	token, err := s.AccessTokenRepo.Create(tok)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, tok.ExpiresAt, nil
+}
+
+// UserInfo returns the claims about the end-user the access token was issued
+// for.
+func (s *Server) UserInfo(accessToken string) (jose.Claims, error) {
+	tok, err := s.AccessTokenRepo.Get(accessToken)
+	switch err {
+	case nil:
+		break
+	case accesstoken.ErrorInvalidToken:
+		return nil, oauth2.NewError(errorInvalidToken)
+	default:
+		log.Errorf("Failed to fetch access token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if ok, err := s.clientExists(tok.ClientID); err != nil {
+		log.Errorf("Failed to fetch client %q from repo: %v", tok.ClientID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	} else if !ok {
+		return nil, oauth2.NewError(errorInvalidToken)
+	}
+	if tok.UserID == "" {
+		err := oauth2.NewError(errorInvalidToken)
+		err.Description = "access token was not issued for an end-user"
+		return nil, err
+	}
+	if len(tok.Resources) > 0 {
+		err := oauth2.NewError(errorInvalidToken)
+		err.Description = "access token is restricted to other resource servers"
+		return nil, err
+	}
+	if !tok.Scope.HasScope("openid") {
+		return nil, oauth2.NewError(errorInsufficientScope)
+	}
+
+	usr, err := s.UserRepo.Get(nil, tok.UserID)
+	switch err {
+	case nil:
+		break
+	case user.ErrorNotFound:
+		return nil, oauth2.NewError(errorInvalidToken)
+	default:
+		log.Errorf("Failed to fetch user %q from repo: %v", tok.UserID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if usr.Disabled {
+		return nil, oauth2.NewError(errorInvalidToken)
+	}
+
+	claims := jose.Claims{"sub": usr.ID}
+	usr.AddToClaims(claims)
+	addProfileClaims(claims, usr.Profile, tok.Scope, tok.Claims)
+	if tok.Scope.HasScope(scope.ScopeGroups) {
+		groups := tok.Groups
+		if groups == nil {
+			groups = []string{}
+		}
+		claims["groups"] = groups
+	}
+
+	addRequestedClaims(claims, tok.Claims, tok.Groups)
+	if err := s.addClaimsFromScope(claims, tok.Scope, tok.ClientID); err != nil {
+		return nil, err
+	}
+
+	// The subject is that of the ID token issued along with the access token.
+	aud := tokenAudience(claims)
+	if len(aud) == 0 {
+		aud = []string{tok.ClientID}
+	}
+	sub, err := s.subject(usr.ID, aud...)
+	if err != nil {
+		return nil, err
+	}
+	claims["sub"] = sub
+
+	return claims, nil
 }
 
 func (s *Server) CrossClientAuthAllowed(requestingClientID, authorizingClientID string) (bool, error) {
@@ -704,25 +1378,21 @@ func (s *Server) CrossClientAuthAllowed(requestingClientID, authorizingClientID
 	return false, nil
 }
 
+// JWTVerifierFactory returns verifiers of the JWTs dex issued to a client,
+// whichever of dex's keys signed them.
 func (s *Server) JWTVerifierFactory() JWTVerifierFactory {
-	noop := func() error { return nil }
-
-	keyFunc := func() []key.PublicKey {
-		keys, err := s.KeyManager.PublicKeys()
-		if err != nil {
-			log.Errorf("error getting public keys from manager: %v", err)
-			return []key.PublicKey{}
+	return func(clientID string) JWTVerifier {
+		return jwtVerifier{
+			issuer:          s.IssuerURL.String(),
+			clientID:        clientID,
+			verifySignature: s.verifySignature,
 		}
-		return keys
-	}
-	return func(clientID string) oidc.JWTVerifier {
-
-		return oidc.NewJWTVerifier(s.IssuerURL.String(), clientID, noop, keyFunc)
 	}
 }
 
 // addClaimsFromScope adds claims that are based on the scopes that the client requested.
-// Currently, these include cross-client claims (aud, azp).
+// Currently, these include cross-client claims (aud, azp). The client's claim
+// mappings are then applied.
 func (s *Server) addClaimsFromScope(claims jose.Claims, scopes scope.Scopes, clientID string) error {
 	crossClientIDs := scopes.CrossClientIDs()
 	if len(crossClientIDs) > 0 {
@@ -753,6 +1423,14 @@ func (s *Server) addClaimsFromScope(claims jose.Claims, scopes scope.Scopes, cli
 		}
 		claims.Add("azp", clientID)
 	}
+
+	// Reshape the claims the way the client wants them.
+	cli, err := s.ClientManager.Get(clientID)
+	if err != nil {
+		log.Errorf("Failed to get client %q: %v", clientID, err)
+		return oauth2.NewError(oauth2.ErrorServerError)
+	}
+	client.ApplyClaimMappings(claims, cli.ClaimMappings)
 	return nil
 }
 
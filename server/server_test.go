@@ -16,11 +16,14 @@ import (
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/refresh/refreshtest"
 	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/session/manager"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/dex/user"
 )
 
@@ -112,19 +115,56 @@ func getRefreshTokenEncoded(id, value string) string {
 }
 
 func TestServerProviderConfig(t *testing.T) {
-	srv := &Server{IssuerURL: url.URL{Scheme: "http", Host: "server.example.com"}}
+	srv := &Server{
+		IssuerURL:         url.URL{Scheme: "http", Host: "server.example.com"},
+		SigningKeyManager: signing.NewKeyManager(),
+	}
+
+	want := ProviderConfig{
+		ProviderConfig: oidc.ProviderConfig{
+			Issuer:           &url.URL{Scheme: "http", Host: "server.example.com"},
+			AuthEndpoint:     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/auth"},
+			TokenEndpoint:    &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token"},
+			KeysEndpoint:     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/keys"},
+			UserInfoEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/userinfo"},
+
+			GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeImplicit, oauth2.GrantTypeClientCreds, oauth2.GrantTypeUserCreds, grantTypeDeviceCode, grantTypeTokenExchange},
+			ResponseTypesSupported:            []string{"code", "id_token", "id_token token", "code id_token"},
+			SubjectTypesSupported:             []string{"public"},
+			ACRValuesSupported:                []string{"0", "1", "2"},
+			IDTokenSigningAlgValues:           []string{"RS256", "ES256", "ES384", "EdDSA"},
+			IDTokenEncryptionAlgValues:        []string{"RSA-OAEP", "RSA-OAEP-256"},
+			IDTokenEncryptionEncValues:        []string{"A128CBC-HS256", "A256CBC-HS512", "A128GCM", "A256GCM"},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
+
+			TokenEndpointAuthSigningAlgValuesSupported: []string{"RS256"},
+
+			ClaimsSupported: []string{
+				"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "azp",
+				"at_hash", "c_hash", "name", "given_name", "family_name",
+				"preferred_username", "picture", "locale", "email", "email_verified",
+				"groups",
+			},
+			ClaimsParameterSupported: true,
+
+			ReqObjSigningAlgValues:        []string{"RS256"},
+			RequestParameterSupported:     true,
+			RequestURIParamaterSupported:  true,
+			RequireRequestURIRegistration: true,
+		},
+		CodeChallengeMethodsSupported: []string{"S256", "plain"},
+
+		IntrospectionEndpoint:                     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token/introspect"},
+		IntrospectionEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
 
-	want := oidc.ProviderConfig{
-		Issuer:        &url.URL{Scheme: "http", Host: "server.example.com"},
-		AuthEndpoint:  &url.URL{Scheme: "http", Host: "server.example.com", Path: "/auth"},
-		TokenEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token"},
-		KeysEndpoint:  &url.URL{Scheme: "http", Host: "server.example.com", Path: "/keys"},
+		RevocationEndpoint:                     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token/revoke"},
+		RevocationEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
 
-		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeClientCreds},
-		ResponseTypesSupported:            []string{"code"},
-		SubjectTypesSupported:             []string{"public"},
-		IDTokenSigningAlgValues:           []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		EndSessionEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/logout"},
+
+		DeviceAuthorizationEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/device/code"},
+
+		PushedAuthorizationRequestEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/par"},
 	}
 	got := srv.ProviderConfig()
 
@@ -157,7 +197,7 @@ func TestServerNewSession(t *testing.T) {
 		},
 	}
 
-	key, err := srv.NewSession("bogus_idpc", ci.Credentials.ID, state, ci.Metadata.RedirectURIs[0], nonce, false, []string{"openid"})
+	key, err := srv.NewSession("bogus_idpc", ci.Credentials.ID, state, ci.Metadata.RedirectURIs[0], nonce, false, []string{"openid"}, session.AuthParams{})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -398,6 +438,102 @@ func TestServerLoginDisplayName(t *testing.T) {
 	}
 }
 
+func TestServerLoginFragmentResponse(t *testing.T) {
+	tests := []struct {
+		responseType string
+
+		wantCode        bool
+		wantAccessToken bool
+	}{
+		{
+			responseType: "id_token",
+		},
+		{
+			responseType:    "id_token token",
+			wantAccessToken: true,
+		},
+		{
+			responseType: "code id_token",
+			wantCode:     true,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "nonce-1", false, []string{"openid"}, session.AuthParams{ResponseType: tt.responseType})
+		if err != nil {
+			t.Fatalf("case %d: new session: %v", i, err)
+		}
+
+		ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+		redirectURL, err := f.srv.Login(ident, key)
+		if err != nil {
+			t.Errorf("case %d: server.Login: %v", i, err)
+			continue
+		}
+
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			t.Errorf("case %d: invalid redirect URL %q: %v", i, redirectURL, err)
+			continue
+		}
+		if u.RawQuery != "" {
+			t.Errorf("case %d: expected response in fragment, got query %q", i, u.RawQuery)
+		}
+		v, err := url.ParseQuery(u.Fragment)
+		if err != nil {
+			t.Errorf("case %d: invalid fragment %q: %v", i, u.Fragment, err)
+			continue
+		}
+
+		if got := v.Get("state"); got != "bogus" {
+			t.Errorf("case %d: want state=%q, got=%q", i, "bogus", got)
+		}
+
+		jwt, err := jose.ParseJWT(v.Get("id_token"))
+		if err != nil {
+			t.Errorf("case %d: invalid ID token: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: invalid ID token claims: %v", i, err)
+			continue
+		}
+		if claims["nonce"] != "nonce-1" {
+			t.Errorf("case %d: want nonce=%q, got=%v", i, "nonce-1", claims["nonce"])
+		}
+
+		code := v.Get("code")
+		if tt.wantCode != (code != "") {
+			t.Errorf("case %d: want code=%t, got=%q", i, tt.wantCode, code)
+		}
+		if tt.wantCode && claims["c_hash"] != tokenHash(code, jose.AlgRS256) {
+			t.Errorf("case %d: want c_hash=%q, got=%v", i, tokenHash(code, jose.AlgRS256), claims["c_hash"])
+		}
+
+		accessToken := v.Get("access_token")
+		if tt.wantAccessToken != (accessToken != "") {
+			t.Errorf("case %d: want access_token=%t, got=%q", i, tt.wantAccessToken, accessToken)
+		}
+		if tt.wantAccessToken && claims["at_hash"] != tokenHash(accessToken, jose.AlgRS256) {
+			t.Errorf("case %d: want at_hash=%q, got=%v", i, tokenHash(accessToken, jose.AlgRS256), claims["at_hash"])
+		}
+
+		if tt.wantCode {
+			// The code must still be exchangeable at the token endpoint.
+			creds := oidc.ClientCredentials{ID: testClientID, Secret: clientTestSecret}
+			if _, _, _, _, err := f.srv.CodeToken(creds, code, "", nil); err != nil {
+				t.Errorf("case %d: exchanging code: %v", i, err)
+			}
+		}
+	}
+}
+
 func TestServerCodeToken(t *testing.T) {
 	f, err := makeTestFixtures()
 	if err != nil {
@@ -443,15 +579,28 @@ func TestServerCodeToken(t *testing.T) {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
 
-		jwt, token, expiresAt, err := f.srv.CodeToken(oidc.ClientCredentials{
+		jwt, accessToken, token, expiresAt, err := f.srv.CodeToken(oidc.ClientCredentials{
 			ID:     testClientID,
-			Secret: clientTestSecret}, key)
+			Secret: clientTestSecret}, key, "", nil)
 		if err != nil {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
 		if jwt == nil {
 			t.Fatalf("case %d: expect non-nil jwt", i)
 		}
+		at, err := f.srv.AccessTokenRepo.Get(accessToken)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error getting access token: %v", i, err)
+		}
+		if at.UserID != testUserID1 || at.ClientID != testClientID {
+			t.Errorf("case %d: unexpected access token %#v", i, at)
+		}
+		if diff := pretty.Compare(tt.scope, []string(at.Scope)); diff != "" {
+			t.Errorf("case %d: access token scope did not match: %s", i, diff)
+		}
+		if expiresAt.Unix() != at.ExpiresAt.Unix() {
+			t.Errorf("case %d: want access token expiry %v, got %v", i, expiresAt, at.ExpiresAt)
+		}
 		if token != tt.refreshToken {
 			t.Fatalf("case %d: expect refresh token %q, got %q", i, tt.refreshToken, token)
 		}
@@ -478,13 +627,16 @@ func TestServerTokenUnrecognizedKey(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	jwt, token, expiresAt, err := f.srv.CodeToken(testClientCredentials, "foo")
+	jwt, accessToken, token, expiresAt, err := f.srv.CodeToken(testClientCredentials, "foo", "", nil)
 	if err == nil {
 		t.Fatalf("Expected non-nil error")
 	}
 	if jwt != nil {
 		t.Fatalf("Expected nil jwt")
 	}
+	if accessToken != "" {
+		t.Fatalf("Expected empty access token")
+	}
 	if token != "" {
 		t.Fatalf("Expected empty refresh token")
 	}
@@ -586,7 +738,7 @@ func TestServerTokenFail(t *testing.T) {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		jwt, token, expiresAt, err := f.srv.CodeToken(tt.argCC, tt.argKey)
+		jwt, _, token, expiresAt, err := f.srv.CodeToken(tt.argCC, tt.argKey, "", nil)
 		if token != tt.refreshToken {
 			fmt.Printf("case %d: expect refresh token %q, got %q\n", i, tt.refreshToken, token)
 			t.Fatalf("case %d: expect refresh token %q, got %q", i, tt.refreshToken, token)
@@ -607,6 +759,186 @@ func TestServerTokenFail(t *testing.T) {
 	}
 }
 
+func TestServerCodeTokenPKCE(t *testing.T) {
+	tests := []struct {
+		clientID      string
+		creds         oidc.ClientCredentials
+		codeChallenge string
+		codeVerifier  string
+		err           error
+	}{
+		// public client without a secret
+		{
+			clientID:      testPublicClientID,
+			creds:         oidc.ClientCredentials{ID: testPublicClientID},
+			codeChallenge: testCodeChallengeS256,
+			codeVerifier:  testCodeVerifier,
+		},
+		// confidential client authenticates and uses PKCE
+		{
+			clientID:      testClientID,
+			creds:         testClientCredentials,
+			codeChallenge: testCodeChallengeS256,
+			codeVerifier:  testCodeVerifier,
+		},
+		// wrong verifier
+		{
+			clientID:      testPublicClientID,
+			creds:         oidc.ClientCredentials{ID: testPublicClientID},
+			codeChallenge: testCodeChallengeS256,
+			codeVerifier:  testCodeChallengeS256,
+			err:           &oauth2.Error{Type: oauth2.ErrorInvalidGrant, Description: "code_verifier does not match code_challenge"},
+		},
+		// public client without a secret must use PKCE
+		{
+			clientID: testPublicClientID,
+			creds:    oidc.ClientCredentials{ID: testPublicClientID},
+			err:      oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
+		// confidential client must authenticate even with PKCE
+		{
+			clientID:      testClientID,
+			creds:         oidc.ClientCredentials{ID: testClientID},
+			codeChallenge: testCodeChallengeS256,
+			codeVerifier:  testCodeVerifier,
+			err:           oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		sm := f.sessionManager
+
+		sessionID, err := sm.NewSession(testConnectorID1, tt.clientID, "bogus", url.URL{}, "", false, []string{"openid"})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if tt.codeChallenge != "" {
+			if _, err := sm.AttachCodeChallenge(sessionID, tt.codeChallenge, codeChallengeMethodS256); err != nil {
+				t.Fatalf("case %d: unexpected error: %v", i, err)
+			}
+		}
+		if _, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{}); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err = sm.AttachUser(sessionID, testUserID1); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		key, err := sm.NewSessionKey(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		jwt, _, _, _, err := f.srv.CodeToken(tt.creds, key, tt.codeVerifier, nil)
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.err, err)
+		}
+		if err == nil && jwt == nil {
+			t.Errorf("case %d: got nil JWT", i)
+		}
+	}
+}
+
+func TestServerUserInfo(t *testing.T) {
+	tests := []struct {
+		token accesstoken.AccessToken
+
+		want    jose.Claims
+		wantErr string
+	}{
+		{
+			token: accesstoken.AccessToken{
+				UserID:   testUserID1,
+				ClientID: testClientID,
+				Scope:    []string{"openid"},
+			},
+			want: jose.Claims{
+				"sub":   testUserID1,
+				"name":  "",
+				"email": "email-1@example.com",
+			},
+		},
+		{
+			token: accesstoken.AccessToken{
+				UserID:   testUserID1,
+				ClientID: testClientID,
+				Scope:    []string{"openid", "groups"},
+				Groups:   []string{"admins"},
+			},
+			want: jose.Claims{
+				"sub":    testUserID1,
+				"name":   "",
+				"email":  "email-1@example.com",
+				"groups": []string{"admins"},
+			},
+		},
+		// token issued without the openid scope
+		{
+			token: accesstoken.AccessToken{
+				UserID:   testUserID1,
+				ClientID: testClientID,
+				Scope:    []string{"groups"},
+			},
+			wantErr: "insufficient_scope",
+		},
+		// token issued to a client for itself
+		{
+			token: accesstoken.AccessToken{
+				ClientID: testClientID,
+			},
+			wantErr: "invalid_token",
+		},
+		// token issued for an unknown user
+		{
+			token: accesstoken.AccessToken{
+				UserID:   "unknown-user",
+				ClientID: testClientID,
+				Scope:    []string{"openid"},
+			},
+			wantErr: "invalid_token",
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+
+		token, _, err := f.srv.newAccessToken(tt.token)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating access token: %v", i, err)
+		}
+
+		got, err := f.srv.UserInfo(token)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want error %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: claims did not match: %s", i, diff)
+		}
+	}
+
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	if _, err := f.srv.UserInfo("unknown-token"); err == nil {
+		t.Errorf("expected error for unknown access token")
+	}
+}
+
 func TestServerRefreshToken(t *testing.T) {
 
 	clientB := client.Client{
@@ -623,7 +955,7 @@ func TestServerRefreshToken(t *testing.T) {
 	signerFixture := &StaticSigner{sig: []byte("beer"), err: nil}
 
 	// NOTE(ericchiang): These tests assume that the database ID of the first
-	// refresh token will be "1".
+	// refresh token will be "1", and of the one it is rotated to "2".
 	tests := []struct {
 		token                string
 		expectedRefreshToken string
@@ -638,7 +970,7 @@ func TestServerRefreshToken(t *testing.T) {
 		// Everything is good.
 		{
 			token:                getRefreshTokenEncoded("1", "refresh-1"),
-			expectedRefreshToken: getRefreshTokenEncoded("1", "refresh-2"),
+			expectedRefreshToken: getRefreshTokenEncoded("2", "refresh-2"),
 			clientID:             testClientID,
 			creds:                testClientCredentials,
 			signer:               signerFixture,
@@ -748,7 +1080,7 @@ func TestServerRefreshToken(t *testing.T) {
 		// Valid Cross-Client
 		{
 			token:                getRefreshTokenEncoded("1", "refresh-1"),
-			expectedRefreshToken: getRefreshTokenEncoded("1", "refresh-2"),
+			expectedRefreshToken: getRefreshTokenEncoded("2", "refresh-2"),
 			clientID:             "client_a",
 			creds: oidc.ClientCredentials{
 				ID: "client_a",
@@ -765,7 +1097,7 @@ func TestServerRefreshToken(t *testing.T) {
 		// being used.
 		{
 			token:                getRefreshTokenEncoded("1", "refresh-1"),
-			expectedRefreshToken: getRefreshTokenEncoded("1", "refresh-2"),
+			expectedRefreshToken: getRefreshTokenEncoded("2", "refresh-2"),
 			clientID:             "client_a",
 			creds: oidc.ClientCredentials{
 				ID: "client_a",
@@ -781,7 +1113,7 @@ func TestServerRefreshToken(t *testing.T) {
 		// when creating the refresh token, which is ok.
 		{
 			token:                getRefreshTokenEncoded("1", "refresh-1"),
-			expectedRefreshToken: getRefreshTokenEncoded("1", "refresh-2"),
+			expectedRefreshToken: getRefreshTokenEncoded("2", "refresh-2"),
 			clientID:             "client_a",
 			creds: oidc.ClientCredentials{
 				ID: "client_a",
@@ -796,7 +1128,7 @@ func TestServerRefreshToken(t *testing.T) {
 		// Valid Cross-Client - asking for multiple clients in the audience.
 		{
 			token:                getRefreshTokenEncoded("1", "refresh-1"),
-			expectedRefreshToken: getRefreshTokenEncoded("1", "refresh-2"),
+			expectedRefreshToken: getRefreshTokenEncoded("2", "refresh-2"),
 			clientID:             "client_a",
 			creds: oidc.ClientCredentials{
 				ID: "client_a",
@@ -840,11 +1172,11 @@ func TestServerRefreshToken(t *testing.T) {
 			t.Errorf("case %d: error creating other client: %v", i, err)
 		}
 
-		if _, err := f.srv.RefreshTokenRepo.Create(testUserID1, tt.clientID, "", tt.createScopes); err != nil {
+		if _, err := f.srv.RefreshTokenRepo.Create(testUserID1, tt.clientID, "", tt.createScopes, nil); err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		jwt, refreshToken, expiresIn, err := f.srv.RefreshToken(tt.creds, tt.refreshScopes, tt.token)
+		jwt, _, refreshToken, expiresIn, err := f.srv.RefreshToken(tt.creds, tt.refreshScopes, tt.token, nil)
 		if !reflect.DeepEqual(err, tt.err) {
 			t.Errorf("Case %d: expect: %v, got: %v", i, tt.err, err)
 		}
@@ -890,3 +1222,108 @@ func TestServerRefreshToken(t *testing.T) {
 		}
 	}
 }
+
+func TestServerRefreshTokenRotation(t *testing.T) {
+	noRotationClient := client.Client{
+		Credentials: oidc.ClientCredentials{
+			ID:     "norotation.example.com",
+			Secret: clientTestSecret,
+		},
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				url.URL{Scheme: "https", Host: "norotation.example.com", Path: "/callback"},
+			},
+		},
+		DisableRefreshTokenRotation: true,
+	}
+
+	tests := []struct {
+		creds oidc.ClientCredentials
+
+		// Whether each refresh request presents the original token rather
+		// than the latest one.
+		reuse bool
+
+		wantRotated bool
+		wantErr     []error
+
+		// Whether the access tokens issued are revoked in the end.
+		wantRevoked bool
+	}{
+		{
+			creds:       testClientCredentials,
+			wantRotated: true,
+			wantErr:     []error{nil, nil, nil},
+		},
+		{
+			// Presenting a rotated token revokes the grant, so the
+			// token it was rotated to stops working too.
+			creds:       testClientCredentials,
+			reuse:       true,
+			wantRotated: true,
+			wantErr: []error{
+				nil,
+				oauth2.NewError(oauth2.ErrorInvalidGrant),
+				oauth2.NewError(oauth2.ErrorInvalidRequest),
+			},
+			wantRevoked: true,
+		},
+		{
+			creds:       noRotationClient.Credentials,
+			reuse:       true,
+			wantRotated: false,
+			wantErr:     []error{nil, nil, nil},
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		f.srv.KeyManager = &StaticKeyManager{
+			signer: &StaticSigner{sig: []byte("beer"), err: nil},
+		}
+		if _, err := f.clientRepo.New(nil, noRotationClient); err != nil {
+			t.Fatalf("case %d: error creating client: %v", i, err)
+		}
+
+		original, err := f.srv.RefreshTokenRepo.Create(testUserID1, tt.creds.ID, "", []string{"openid", "offline_access"}, nil)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		token := original
+		var accessTokens []string
+		for j, wantErr := range tt.wantErr {
+			presented := token
+			if tt.reuse {
+				presented = original
+			}
+			if j == len(tt.wantErr)-1 {
+				// The latest token.
+				presented = token
+			}
+
+			_, accessToken, refreshToken, _, err := f.srv.RefreshToken(tt.creds, nil, presented, nil)
+			if !reflect.DeepEqual(err, wantErr) {
+				t.Errorf("case %d: request %d: want err=%v, got %v", i, j, wantErr, err)
+			}
+			if err != nil {
+				continue
+			}
+			if rotated := refreshToken != presented; rotated != tt.wantRotated {
+				t.Errorf("case %d: request %d: want rotated=%t, got %t", i, j, tt.wantRotated, rotated)
+			}
+			token = refreshToken
+			accessTokens = append(accessTokens, accessToken)
+		}
+
+		for j, accessToken := range accessTokens {
+			_, err := f.srv.AccessTokenRepo.Get(accessToken)
+			if revoked := err != nil; revoked != tt.wantRevoked {
+				t.Errorf("case %d: access token %d: want revoked=%t, got %t", i, j, tt.wantRevoked, revoked)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/signing"
+)
+
+// idTokenSigningAlgValues returns the algorithms ID tokens can be signed with.
+func (s *Server) idTokenSigningAlgValues() []string {
+	algs := []string{jose.AlgRS256}
+	if s.SigningKeyManager != nil {
+		algs = append(algs, signing.Algs...)
+	}
+	return algs
+}
+
+// idTokenSigner returns the signer of the client's ID tokens: RS256 unless the
+// client registered another id_token_signed_response_alg. It falls back to
+// RS256 while there are no keys for that algorithm.
+func (s *Server) idTokenSigner(clientID string) (jose.Signer, error) {
+	cli, err := s.Client(clientID)
+	if err != nil {
+		return nil, err
+	}
+	alg := cli.Metadata.IDTokenResponseOptions.SigningAlg
+	if alg == "" || alg == jose.AlgRS256 || s.SigningKeyManager == nil {
+		return s.KeyManager.Signer()
+	}
+	signer, err := s.SigningKeyManager.Signer(alg)
+	if err != nil {
+		log.Warningf("Signing ID token of client %s with RS256, no %s key: %v", clientID, alg, err)
+		return s.KeyManager.Signer()
+	}
+	return signer, nil
+}
+
+// signingKeysHealth reports the health of the keys of a signing.KeyManager
+// once it has any, so that a worker is healthy before the overlord first
+// rotated them.
+type signingKeysHealth struct {
+	*signing.KeyManager
+}
+
+func (h signingKeysHealth) Healthy() error {
+	if err := h.KeyManager.Healthy(); err != key.ErrorNoKeys {
+		return err
+	}
+	return nil
+}
+
+// verifySignature reports whether the JWT is signed by one of dex's keys.
+func (s *Server) verifySignature(jwt jose.JWT) (bool, error) {
+	if alg := jwt.Header[jose.HeaderKeyAlgorithm]; alg != jose.AlgRS256 {
+		if s.SigningKeyManager == nil || !signing.Supported(alg) {
+			return false, nil
+		}
+		return s.SigningKeyManager.VerifySignature(jwt)
+	}
+
+	keys, err := s.KeyManager.PublicKeys()
+	if err != nil {
+		return false, err
+	}
+	return oidc.VerifySignature(jwt, keys)
+}
+
+// jwtVerifier verifies the claims of a JWT issued to a client, and that it is
+// signed by one of dex's keys. Unlike oidc.JWTVerifier it accepts the keys of
+// ID tokens signed with algorithms other than RS256.
+type jwtVerifier struct {
+	issuer          string
+	clientID        string
+	verifySignature func(jose.JWT) (bool, error)
+}
+
+func (v jwtVerifier) Verify(jwt jose.JWT) error {
+	if err := oidc.VerifyClaims(jwt, v.issuer, v.clientID); err != nil {
+		return fmt.Errorf("JWT claims invalid: %v", err)
+	}
+	ok, err := v.verifySignature(jwt)
+	if err != nil {
+		return fmt.Errorf("JWT signature verification failed: %v", err)
+	}
+	if !ok {
+		return errors.New("unable to verify JWT signature: no matching keys")
+	}
+	return nil
+}
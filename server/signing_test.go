@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/signing"
+)
+
+func TestServerIDTokenSigningAlg(t *testing.T) {
+	tests := []struct {
+		alg string
+
+		wantAlg string
+	}{
+		{alg: "", wantAlg: jose.AlgRS256},
+		{alg: jose.AlgRS256, wantAlg: jose.AlgRS256},
+		{alg: jose.AlgES256, wantAlg: jose.AlgES256},
+		{alg: jose.AlgES384, wantAlg: jose.AlgES384},
+		{alg: signing.AlgEdDSA, wantAlg: signing.AlgEdDSA},
+	}
+
+	for i, tt := range tests {
+		creds := oidc.ClientCredentials{
+			ID:     "mobile.example.com",
+			Secret: base64.URLEncoding.EncodeToString([]byte("mobile_secret")),
+		}
+		clients := append([]client.LoadableClient{}, testClients...)
+		clients = append(clients, client.LoadableClient{
+			Client: client.Client{
+				Credentials: creds,
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs:           []url.URL{testRedirectURL},
+					IDTokenResponseOptions: oidc.JWAOptions{SigningAlg: tt.alg},
+				},
+			},
+		})
+		f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		sm := f.sessionManager
+
+		sessionID, err := sm.NewSession("bogus_idpc", creds.ID, "bogus", url.URL{}, "", false, []string{"openid"})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err := sm.AttachRemoteIdentity(sessionID, oidc.Identity{}); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err := sm.AttachUser(sessionID, testUserID1); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		code, err := sm.NewSessionKey(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		jwt, _, _, _, err := f.srv.CodeToken(creds, code, "", nil)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if alg := jwt.Header[jose.HeaderKeyAlgorithm]; alg != tt.wantAlg {
+			t.Errorf("case %d: want alg=%q, got %q", i, tt.wantAlg, alg)
+		}
+
+		// dex accepts its own ID tokens, such as an id_token_hint, whatever
+		// their algorithm.
+		claims, ok, err := f.srv.parseSignedJWT(jwt.Encode())
+		if err != nil || !ok {
+			t.Errorf("case %d: want ID token accepted, got %t, %v", i, ok, err)
+			continue
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != testUserID1 {
+			t.Errorf("case %d: want sub=%q, got %q", i, testUserID1, sub)
+		}
+
+		// So does the user management API.
+		if err := f.srv.JWTVerifierFactory()(creds.ID).Verify(*jwt); err != nil {
+			t.Errorf("case %d: want ID token verified, got %v", i, err)
+		}
+		if err := f.srv.JWTVerifierFactory()("XXX").Verify(*jwt); err == nil {
+			t.Errorf("case %d: want ID token of another client rejected", i)
+		}
+	}
+}
+
+func TestServerParseSignedJWTOtherKey(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	for _, alg := range signing.Algs {
+		k, err := signing.GeneratePrivateKey(alg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error generating key: %v", alg, err)
+		}
+		jwt, err := jose.NewSignedJWT(jose.Claims{"iss": testIssuerURL.String(), "sub": testUserID1}, k.Signer())
+		if err != nil {
+			t.Fatalf("%s: unexpected error signing JWT: %v", alg, err)
+		}
+		if _, ok, err := f.srv.parseSignedJWT(jwt.Encode()); err != nil || ok {
+			t.Errorf("%s: want JWT signed with another key rejected, got %t, %v", alg, ok, err)
+		}
+	}
+}
+
+func TestHandleKeysFuncSigningKeys(t *testing.T) {
+	// The signing keys' manager checks their expiry against the real clock.
+	clock := clockwork.NewRealClock()
+	km := &StaticKeyManager{
+		expiresAt: clock.Now().Add(time.Hour),
+		keys: []jose.JWK{
+			{ID: "1234", Type: "RSA", Alg: "RS256", Use: "sig", Exponent: 65537, Modulus: testPrivKey.PrivateKey.N},
+		},
+	}
+	skm := signing.NewKeyManager()
+	sexp := clock.Now().Add(13 * time.Second)
+	if err := skm.Set(signing.NewPrivateKeySet(testSigningKeys, sexp)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://server.example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed creating HTTP request: err=%v", err)
+	}
+	w := httptest.NewRecorder()
+	handleKeysFunc(km, skm, clock).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Incorrect status code: want=200 got=%d", w.Code)
+	}
+
+	// The keys are cached until the first of them expires.
+	if got := w.Header().Get("Expires"); got != sexp.Format(time.RFC1123) {
+		t.Errorf("want Expires=%q, got %q", sexp.Format(time.RFC1123), got)
+	}
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unexpected error decoding keys: %v", err)
+	}
+	want := []struct{ kid, kty, alg, crv string }{
+		{"1234", "RSA", "RS256", ""},
+		{testSigningKeys[0].ID(), "EC", "ES256", "P-256"},
+		{testSigningKeys[1].ID(), "EC", "ES384", "P-384"},
+		{testSigningKeys[2].ID(), "OKP", "EdDSA", "Ed25519"},
+	}
+	if len(body.Keys) != len(want) {
+		t.Fatalf("want %d keys, got %d: %s", len(want), len(body.Keys), w.Body.String())
+	}
+	for i, k := range body.Keys {
+		if k["kid"] != want[i].kid || k["kty"] != want[i].kty || k["alg"] != want[i].alg || k["crv"] != want[i].crv {
+			t.Errorf("key %d: want %v, got %v", i, want[i], k)
+		}
+	}
+}
+
+func TestServerIDTokenSignerNoSigningKeys(t *testing.T) {
+	creds := oidc.ClientCredentials{
+		ID:     "mobile.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("mobile_secret")),
+	}
+	clients := append([]client.LoadableClient{}, testClients...)
+	clients = append(clients, client.LoadableClient{
+		Client: client.Client{
+			Credentials: creds,
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs:           []url.URL{testRedirectURL},
+				IDTokenResponseOptions: oidc.JWAOptions{SigningAlg: jose.AlgES256},
+			},
+		},
+	})
+	f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	// The overlord did not rotate the signing keys yet.
+	f.srv.SigningKeyManager = signing.NewKeyManager()
+
+	signer, err := f.srv.idTokenSigner(creds.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alg := signer.Alg(); alg != jose.AlgRS256 {
+		t.Errorf("want alg=%q, got %q", jose.AlgRS256, alg)
+	}
+}
+
+func TestHandleKeysFuncNoSigningKeys(t *testing.T) {
+	clock := clockwork.NewRealClock()
+	exp := clock.Now().Add(time.Hour)
+	km := &StaticKeyManager{
+		expiresAt: exp,
+		keys: []jose.JWK{
+			{ID: "1234", Type: "RSA", Alg: "RS256", Use: "sig", Exponent: 65537, Modulus: testPrivKey.PrivateKey.N},
+		},
+	}
+	expired := signing.NewKeyManager()
+	if err := expired.Set(signing.NewPrivateKeySet(testSigningKeys, clock.Now().Add(-time.Minute))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, skm := range []*signing.KeyManager{signing.NewKeyManager(), expired} {
+		req, err := http.NewRequest("GET", "http://server.example.com", nil)
+		if err != nil {
+			t.Fatalf("Failed creating HTTP request: err=%v", err)
+		}
+		w := httptest.NewRecorder()
+		handleKeysFunc(km, skm, clock).ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("case %d: Incorrect status code: want=200 got=%d", i, w.Code)
+		}
+		if got := w.Header().Get("Expires"); got != exp.Format(time.RFC1123) {
+			t.Errorf("case %d: want Expires=%q, got %q", i, exp.Format(time.RFC1123), got)
+		}
+
+		var body struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("case %d: unexpected error decoding keys: %v", i, err)
+		}
+		if len(body.Keys) != 1 || body.Keys[0]["kid"] != "1234" {
+			t.Errorf("case %d: want the RS256 key only, got %s", i, w.Body.String())
+		}
+	}
+}
+
+func TestSigningKeysHealth(t *testing.T) {
+	expired := signing.NewKeyManager()
+	if err := expired.Set(signing.NewPrivateKeySet(testSigningKeys, time.Now().Add(-time.Minute))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	valid := signing.NewKeyManager()
+	if err := valid.Set(signing.NewPrivateKeySet(testSigningKeys, time.Now().Add(time.Minute))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		skm *signing.KeyManager
+
+		wantErr error
+	}{
+		{skm: signing.NewKeyManager(), wantErr: nil},
+		{skm: valid, wantErr: nil},
+		{skm: expired, wantErr: key.ErrorPrivateKeysExpired},
+	}
+
+	for i, tt := range tests {
+		if err := (signingKeysHealth{tt.skm}).Healthy(); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestTokenHash(t *testing.T) {
+	tests := []struct {
+		alg     string
+		wantLen int
+	}{
+		{jose.AlgRS256, 16},
+		{jose.AlgES256, 16},
+		{jose.AlgES384, 24},
+		{signing.AlgEdDSA, 32},
+	}
+
+	for i, tt := range tests {
+		h, err := base64.RawURLEncoding.DecodeString(tokenHash("token", tt.alg))
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if len(h) != tt.wantLen {
+			t.Errorf("case %d: want %d bytes, got %d", i, tt.wantLen, len(h))
+		}
+	}
+}
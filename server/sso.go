@@ -0,0 +1,255 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+const (
+	cookieBrowserSession = "SSO"
+
+	// Values of the prompt parameter of authentication requests (OpenID
+	// Connect Core 1.0, Section 3.1.2.1).
+	promptNone          = "none"
+	promptLogin         = "login"
+	promptConsent       = "consent"
+	promptSelectAccount = "select_account"
+)
+
+// authPrompt is the parsed prompt parameter of an authentication request.
+type authPrompt map[string]bool
+
+// parsePrompt parses the space delimited prompt parameter. "none" may not be
+// combined with any other value.
+func parsePrompt(prompt string) (authPrompt, error) {
+	p := authPrompt{}
+	for _, v := range strings.Fields(prompt) {
+		switch v {
+		case promptNone, promptLogin, promptConsent, promptSelectAccount:
+			p[v] = true
+		default:
+			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+			err.Description = fmt.Sprintf("unsupported prompt value %q", v)
+			return nil, err
+		}
+	}
+	if p[promptNone] && len(p) > 1 {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = `prompt "none" cannot be combined with other values`
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseMaxAge parses the max_age parameter of an authentication request. It
+// returns a negative duration if the parameter is absent.
+func parseMaxAge(maxAge string) (time.Duration, error) {
+	if maxAge == "" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(maxAge, 10, 64)
+	if err != nil || n < 0 {
+		err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+		err.Description = "max_age must be a non-negative integer"
+		return 0, err
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// canUseBrowserSession reports whether the user can be logged in through the
+// browser session without being asked to log in again.
+func canUseBrowserSession(bs *session.BrowserSession, prompt authPrompt, maxAge time.Duration, connectorID string, now time.Time) bool {
+	if bs == nil || !bs.Authenticated() {
+		return false
+	}
+	if prompt[promptLogin] || prompt[promptSelectAccount] {
+		return false
+	}
+	if maxAge >= 0 && now.Sub(bs.AuthTime) > maxAge {
+		return false
+	}
+	// A client asking for a specific connector wants the user logged in
+	// through it.
+	return connectorID == "" || connectorID == bs.ConnectorID
+}
+
+// BrowserSession returns the browser session identified by the request's SSO
+// cookie, or nil if it has none or it is no longer valid. Authenticated
+// browser sessions of users that no longer exist or have been disabled are
+// ended.
+func (s *Server) BrowserSession(r *http.Request) (*session.BrowserSession, error) {
+	c, err := r.Cookie(cookieBrowserSession)
+	if err != nil {
+		return nil, nil
+	}
+
+	id, ok, err := s.parseBrowserSessionCookie(c.Value)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	bs, err := s.BrowserSessionRepo.Get(id)
+	if err == session.ErrorBrowserSessionNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !bs.Authenticated() {
+		return bs, nil
+	}
+
+	usr, err := s.UserRepo.Get(nil, bs.UserID)
+	if err != nil && err != user.ErrorNotFound {
+		return nil, err
+	}
+	if err == user.ErrorNotFound || usr.Disabled {
+		log.Infof("Browser session %s ended: user %s no longer valid", bs.ID, bs.UserID)
+		return nil, s.BrowserSessionRepo.Delete(bs.ID)
+	}
+	return bs, nil
+}
+
+// KillBrowserSession ends the browser session of the request, if any, and
+// clears its cookie.
+func (s *Server) KillBrowserSession(w http.ResponseWriter, r *http.Request) error {
+	bs, err := s.BrowserSession(r)
+	if err != nil {
+		return err
+	}
+	if bs != nil {
+		if err := s.BrowserSessionRepo.Delete(bs.ID); err != nil {
+			return err
+		}
+		log.Infof("Browser session %s ended: userID=%s", bs.ID, bs.UserID)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieBrowserSession,
+		Path:     s.browserSessionCookiePath(),
+		HttpOnly: true,
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+	})
+	return nil
+}
+
+// LoginWithBrowserSession logs the user of an authenticated browser session
+// in to the session identified by key, and returns the URL to redirect the
+// user-agent to.
+func (s *Server) LoginWithBrowserSession(bs *session.BrowserSession, key string) (string, error) {
+	if !bs.Authenticated() {
+		return "", fmt.Errorf("browser session %s is not authenticated", bs.ID)
+	}
+	return s.login(nil, bs.Identity, user.Profile{}, connector.Authentication{}, key, bs)
+}
+
+// startBrowserSession logs the user who has just authenticated in the session
+// in to dex, and returns the cookie of their new browser session. The browser
+// session the session was started from, if any, is ended: a browser gets a new
+// session ID whenever its user logs in, so one planted before cannot be used
+// to take over the session.
+func (s *Server) startBrowserSession(ses *session.Session) (*http.Cookie, error) {
+	if ses.BrowserSessionID != "" {
+		err := s.BrowserSessionRepo.Delete(ses.BrowserSessionID)
+		if err != nil && err != session.ErrorBrowserSessionNotFound {
+			return nil, err
+		}
+	}
+
+	id, err := s.SessionManager.GenerateCode()
+	if err != nil {
+		return nil, err
+	}
+	bs := session.BrowserSession{
+		ID:          id,
+		UserID:      ses.UserID,
+		ConnectorID: ses.ConnectorID,
+		Identity:    ses.Identity,
+		AuthTime:    ses.AuthTime,
+		AMR:         ses.AMR,
+		ACR:         ses.ACR,
+		CreatedAt:   ses.AuthTime,
+		ExpiresAt:   ses.AuthTime.Add(s.BrowserSessionValidityWindow),
+	}
+	if err := s.BrowserSessionRepo.Create(bs); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Browser session %s started: userID=%s", bs.ID, bs.UserID)
+	return s.browserSessionCookie(&bs)
+}
+
+// browserSessionCookie returns the cookie identifying the browser session.
+// Its value is signed with the BrowserSessionCookieKey, so the session ID
+// cannot be tampered with.
+func (s *Server) browserSessionCookie(bs *session.BrowserSession) (*http.Cookie, error) {
+	if len(s.BrowserSessionCookieKey) == 0 {
+		return nil, errors.New("no browser session cookie key")
+	}
+	jwt, err := jose.NewSignedJWT(jose.Claims{
+		"iss": s.IssuerURL.String(),
+		"sid": bs.ID,
+	}, jose.NewSignerHMAC("", s.BrowserSessionCookieKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Cookie{
+		Name:     cookieBrowserSession,
+		Value:    jwt.Encode(),
+		Path:     s.browserSessionCookiePath(),
+		HttpOnly: true,
+		Secure:   s.IssuerURL.Scheme == "https",
+		// The cookie lives as long as an authenticated browser session could.
+		MaxAge:  int(s.BrowserSessionValidityWindow.Seconds()),
+		Expires: bs.CreatedAt.Add(s.BrowserSessionValidityWindow),
+	}, nil
+}
+
+// parseBrowserSessionCookie returns the browser session ID from the value of
+// an SSO cookie. ok is false if the value was not signed with the
+// BrowserSessionCookieKey.
+func (s *Server) parseBrowserSessionCookie(value string) (id string, ok bool, err error) {
+	if len(s.BrowserSessionCookieKey) == 0 {
+		return "", false, nil
+	}
+	jwt, err := jose.ParseJWT(value)
+	if err != nil || jwt.Header[jose.HeaderKeyAlgorithm] != "HS256" {
+		return "", false, nil
+	}
+	v := jose.NewSignerHMAC("", s.BrowserSessionCookieKey)
+	if err := v.Verify(jwt.Signature, []byte(jwt.Data())); err != nil {
+		return "", false, nil
+	}
+	claims, err := jwt.Claims()
+	if err != nil {
+		return "", false, nil
+	}
+	if iss, _, _ := claims.StringClaim("iss"); iss != s.IssuerURL.String() {
+		return "", false, nil
+	}
+	id, ok, err = claims.StringClaim("sid")
+	if err != nil || !ok || id == "" {
+		return "", false, nil
+	}
+	return id, true, nil
+}
+
+func (s *Server) browserSessionCookiePath() string {
+	if s.IssuerURL.Path == "" {
+		return "/"
+	}
+	return s.IssuerURL.Path
+}
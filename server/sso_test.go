@@ -0,0 +1,463 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+func TestParsePrompt(t *testing.T) {
+	tests := []struct {
+		prompt  string
+		want    authPrompt
+		wantErr bool
+	}{
+		{
+			prompt: "",
+			want:   authPrompt{},
+		},
+		{
+			prompt: "none",
+			want:   authPrompt{promptNone: true},
+		},
+		{
+			prompt: "login consent",
+			want:   authPrompt{promptLogin: true, promptConsent: true},
+		},
+		{
+			prompt:  "none login",
+			wantErr: true,
+		},
+		{
+			prompt:  "bogus",
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := parsePrompt(tt.prompt)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("case %d: want=%v, got=%v", i, tt.want, got)
+		}
+	}
+}
+
+func TestParseMaxAge(t *testing.T) {
+	tests := []struct {
+		maxAge  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{maxAge: "", want: -1},
+		{maxAge: "0", want: 0},
+		{maxAge: "3600", want: time.Hour},
+		{maxAge: "-1", wantErr: true},
+		{maxAge: "an hour", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		got, err := parseMaxAge(tt.maxAge)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err == nil && tt.want != got {
+			t.Errorf("case %d: want=%v, got=%v", i, tt.want, got)
+		}
+	}
+}
+
+func TestCanUseBrowserSession(t *testing.T) {
+	now := time.Now()
+	bs := &session.BrowserSession{
+		ID:          "bs-1",
+		UserID:      testUserID1,
+		ConnectorID: testConnectorID1,
+		AuthTime:    now.Add(-time.Hour),
+	}
+
+	tests := []struct {
+		bs          *session.BrowserSession
+		prompt      authPrompt
+		maxAge      time.Duration
+		connectorID string
+		want        bool
+	}{
+		{bs: bs, maxAge: -1, want: true},
+		{bs: bs, prompt: authPrompt{promptNone: true}, maxAge: -1, want: true},
+		{bs: bs, maxAge: 2 * time.Hour, want: true},
+		{bs: bs, maxAge: -1, connectorID: testConnectorID1, want: true},
+		{bs: nil, maxAge: -1, want: false},
+		{bs: &session.BrowserSession{ID: "bs-2"}, maxAge: -1, want: false},
+		{bs: bs, prompt: authPrompt{promptLogin: true}, maxAge: -1, want: false},
+		{bs: bs, prompt: authPrompt{promptSelectAccount: true}, maxAge: -1, want: false},
+		{bs: bs, maxAge: time.Minute, want: false},
+		{bs: bs, maxAge: -1, connectorID: "other", want: false},
+	}
+
+	for i, tt := range tests {
+		if got := canUseBrowserSession(tt.bs, tt.prompt, tt.maxAge, tt.connectorID, now); tt.want != got {
+			t.Errorf("case %d: want=%t, got=%t", i, tt.want, got)
+		}
+	}
+}
+
+func TestHandleAuthFuncBrowserSession(t *testing.T) {
+	authTime := time.Now().Add(-time.Hour).UTC().Round(time.Second)
+
+	tests := []struct {
+		query url.Values
+		// authenticated sends the cookie of a browser session the user has
+		// logged in to.
+		authenticated bool
+
+		wantCode     int
+		wantLocation string
+		wantError    string
+		wantCode2    bool
+	}{
+		// logged in users skip the login page
+		{
+			query:         url.Values{},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantCode2:     true,
+		},
+		{
+			query:         url.Values{"prompt": {"none"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantCode2:     true,
+		},
+		{
+			query:         url.Values{"max_age": {"7200"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantCode2:     true,
+		},
+		// re-authentication is forced
+		{
+			query:         url.Values{"prompt": {"login"}, "connector_id": {"fake"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantLocation:  "http://fake.example.com",
+		},
+		{
+			query:         url.Values{"max_age": {"60"}, "connector_id": {"fake"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantLocation:  "http://fake.example.com",
+		},
+		{
+			query:         url.Values{"connector_id": {"fake"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantLocation:  "http://fake.example.com",
+		},
+		{
+			query:         url.Values{"prompt": {"none"}, "max_age": {"60"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantError:     errorLoginRequired,
+		},
+		// users that are not logged in
+		{
+			query:     url.Values{"prompt": {"none"}},
+			wantCode:  http.StatusFound,
+			wantError: errorLoginRequired,
+		},
+		{
+			query:    url.Values{},
+			wantCode: http.StatusOK,
+		},
+		// invalid parameters
+		{
+			query:         url.Values{"prompt": {"none login"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantError:     oauth2.ErrorInvalidRequest,
+		},
+		{
+			query:         url.Values{"max_age": {"-5"}, "connector_id": {"fake"}},
+			authenticated: true,
+			wantCode:      http.StatusFound,
+			wantError:     oauth2.ErrorInvalidRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		idpcs := append([]connector.Connector{&fakeConnector{loginURL: "http://fake.example.com"}}, f.srv.Connectors...)
+		hdlr := handleAuthFunc(f.srv, testIssuerURL, idpcs, f.srv.LoginTemplate, false)
+
+		bs, cookie, err := newTestBrowserSession(f.srv)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating browser session: %v", i, err)
+		}
+		if tt.authenticated {
+			bs.UserID = testUserID1
+			bs.ConnectorID = testConnectorID1
+			bs.Identity = oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+			bs.AuthTime = authTime
+			if err := f.srv.BrowserSessionRepo.Update(*bs); err != nil {
+				t.Fatalf("case %d: unexpected error updating browser session: %v", i, err)
+			}
+		}
+
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"redirect_uri":  {testRedirectURL.String()},
+			"scope":         {"openid"},
+			"state":         {"xyz"},
+		}
+		for k, v := range tt.query {
+			q[k] = v
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://server.example.com/auth?%s", q.Encode()), nil)
+		if err != nil {
+			t.Fatalf("case %d: unable to form HTTP request: %v", i, err)
+		}
+		if tt.authenticated {
+			req.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+			continue
+		}
+		// Browser sessions are only started once the user has logged in.
+		for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+			if c.Name == cookieBrowserSession {
+				t.Errorf("case %d: want no %s cookie set", i, cookieBrowserSession)
+			}
+		}
+		if tt.wantLocation != "" {
+			if loc := w.Header().Get("Location"); tt.wantLocation != loc {
+				t.Errorf("case %d: want Location=%q, got=%q", i, tt.wantLocation, loc)
+			}
+		}
+		if !tt.wantCode2 && tt.wantError == "" {
+			continue
+		}
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Errorf("case %d: invalid Location: %v", i, err)
+			continue
+		}
+		if loc.Host != testRedirectURL.Host || loc.Path != testRedirectURL.Path {
+			t.Errorf("case %d: want redirect to %s, got=%s", i, testRedirectURL.String(), loc)
+			continue
+		}
+		lq := loc.Query()
+		if e := lq.Get("error"); tt.wantError != e {
+			t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, e)
+		}
+		if lq.Get("state") != "xyz" {
+			t.Errorf("case %d: want state=xyz, got=%q", i, lq.Get("state"))
+		}
+		if !tt.wantCode2 {
+			continue
+		}
+
+		jwt, _, _, _, err := f.srv.CodeToken(testClientCredentials, lq.Get("code"), "", nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error exchanging code: %v", i, err)
+			continue
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error reading claims: %v", i, err)
+			continue
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != testUserID1 {
+			t.Errorf("case %d: want sub=%q, got=%q", i, testUserID1, sub)
+		}
+		if at, _, _ := claims.Int64Claim("auth_time"); at != authTime.Unix() {
+			t.Errorf("case %d: want auth_time=%d, got=%d", i, authTime.Unix(), at)
+		}
+	}
+}
+
+// newTestBrowserSession creates an unauthenticated browser session and returns
+// it along with its cookie.
+func newTestBrowserSession(srv *Server) (*session.BrowserSession, *http.Cookie, error) {
+	now := time.Now().UTC()
+	bs := session.BrowserSession{
+		ID:        fmt.Sprintf("bs-%d", now.UnixNano()),
+		CreatedAt: now,
+		ExpiresAt: now.Add(srv.BrowserSessionValidityWindow),
+	}
+	if err := srv.BrowserSessionRepo.Create(bs); err != nil {
+		return nil, nil, err
+	}
+	c, err := srv.browserSessionCookie(&bs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &bs, c, nil
+}
+
+func TestServerLoginStartsBrowserSession(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	// The browser arrives with a session planted by someone else.
+	old, oldCookie, err := newTestBrowserSession(f.srv)
+	if err != nil {
+		t.Fatalf("unexpected error creating browser session: %v", err)
+	}
+
+	key, err := f.srv.NewSession(testConnectorID1, testClientID, "bogus", testRedirectURL, "", false, []string{"openid"}, session.AuthParams{BrowserSessionID: old.ID})
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	ident := oidc.Identity{ID: testUserRemoteID1, Email: testUserEmail1}
+	w := httptest.NewRecorder()
+	if _, err := f.srv.LoginWithProfile(w, ident, user.Profile{}, connector.Authentication{}, key); err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+
+	if _, err := f.srv.BrowserSessionRepo.Get(old.ID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want the old browser session ended, got err=%v", err)
+	}
+	req, err := http.NewRequest("GET", "http://server.example.com/auth", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(oldCookie)
+	if got, err := f.srv.BrowserSession(req); got != nil || err != nil {
+		t.Errorf("want no browser session for the old cookie, got=%v err=%v", got, err)
+	}
+
+	resp := http.Response{Header: w.Header()}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == cookieBrowserSession {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("want the %s cookie set", cookieBrowserSession)
+	}
+	req, err = http.NewRequest("GET", "http://server.example.com/auth", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(cookie)
+	got, err := f.srv.BrowserSession(req)
+	if err != nil || got == nil {
+		t.Fatalf("want a browser session for the new cookie, got=%v err=%v", got, err)
+	}
+	if got.ID == old.ID {
+		t.Errorf("want a new browser session ID")
+	}
+	if got.UserID != testUserID1 || got.ConnectorID != testConnectorID1 || !reflect.DeepEqual(ident, got.Identity) {
+		t.Errorf("want browser session authenticated as %s through %s, got=%#v", testUserID1, testConnectorID1, got)
+	}
+	if got.AuthTime.IsZero() {
+		t.Errorf("want auth time set")
+	}
+	if want := got.AuthTime.Add(f.srv.BrowserSessionValidityWindow); !want.Equal(got.ExpiresAt) {
+		t.Errorf("want expiry=%v, got=%v", want, got.ExpiresAt)
+	}
+}
+
+func TestServerKillBrowserSession(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+
+	bs, cookie, err := newTestBrowserSession(f.srv)
+	if err != nil {
+		t.Fatalf("unexpected error creating browser session: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://server.example.com/logout", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(cookie)
+
+	got, err := f.srv.BrowserSession(req)
+	if err != nil || got == nil || got.ID != bs.ID {
+		t.Fatalf("want browser session %s, got=%v err=%v", bs.ID, got, err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := f.srv.KillBrowserSession(w, req); err != nil {
+		t.Fatalf("unexpected error killing browser session: %v", err)
+	}
+	if _, err := f.srv.BrowserSessionRepo.Get(bs.ID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want browser session deleted, got err=%v", err)
+	}
+
+	resp := http.Response{Header: w.Header()}
+	var cleared bool
+	for _, c := range resp.Cookies() {
+		if c.Name == cookieBrowserSession && c.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Errorf("want the %s cookie cleared", cookieBrowserSession)
+	}
+
+	// A tampered cookie does not identify a browser session.
+	req, err = http.NewRequest("GET", "http://server.example.com/auth", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: cookieBrowserSession, Value: bs.ID})
+	if got, err := f.srv.BrowserSession(req); got != nil {
+		t.Errorf("want no browser session for a tampered cookie, got=%v err=%v", got, err)
+	}
+
+	// Nor does a token signed with dex's token signing keys.
+	bs, _, err = newTestBrowserSession(f.srv)
+	if err != nil {
+		t.Fatalf("unexpected error creating browser session: %v", err)
+	}
+	signer, err := f.srv.KeyManager.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error getting signer: %v", err)
+	}
+	jwt, err := jose.NewSignedJWT(jose.Claims{"iss": testIssuerURL.String(), "sid": bs.ID}, signer)
+	if err != nil {
+		t.Fatalf("unexpected error signing JWT: %v", err)
+	}
+	req, err = http.NewRequest("GET", "http://server.example.com/auth", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: cookieBrowserSession, Value: jwt.Encode()})
+	if got, err := f.srv.BrowserSession(req); got != nil {
+		t.Errorf("want no browser session for a token signed with the token keys, got=%v err=%v", got, err)
+	}
+}
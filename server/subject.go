@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	clientmanager "github.com/coreos/dex/client/manager"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
+)
+
+// SubjectResolver returns the ID of the user that sub identifies to the
+// client.
+type SubjectResolver func(sub, clientID string) (string, error)
+
+// NewSubjectResolver returns a SubjectResolver mapping the pairwise subject
+// identifiers recorded in repo back to users. The subject identifiers of
+// other clients are the users' IDs.
+func NewSubjectResolver(cm *clientmanager.ClientManager, repo user.PairwiseSubjectRepo) SubjectResolver {
+	return func(sub, clientID string) (string, error) {
+		cli, err := cm.Get(clientID)
+		if err != nil {
+			return "", err
+		}
+		if !cli.Pairwise() {
+			return sub, nil
+		}
+		if repo == nil {
+			return "", errors.New("no repository of pairwise subjects")
+		}
+		return repo.Get(cli.SectorIdentifier(), sub)
+	}
+}
+
+func (s *Server) SubjectResolver() SubjectResolver {
+	return NewSubjectResolver(s.ClientManager, s.PairwiseSubjectRepo)
+}
+
+func (s *Server) subjectTypesSupported() []string {
+	if s.PairwiseSubjectSalt == "" || s.PairwiseSubjectRepo == nil {
+		return []string{oidc.SubjectTypePublic}
+	}
+	return []string{oidc.SubjectTypePublic, oidc.SubjectTypePairwise}
+}
+
+// subject returns the subject identifier of the user for the clients. Tokens
+// with several clients in their audience can only be issued if the clients
+// know the user by the same identifier.
+func (s *Server) subject(userID string, clientIDs ...string) (string, error) {
+	sub := userID
+	for i, clientID := range clientIDs {
+		cli, err := s.Client(clientID)
+		if err != nil {
+			log.Errorf("Failed fetching client %s from repo: %v", clientID, err)
+			return "", oauth2.NewError(oauth2.ErrorServerError)
+		}
+		csub := userID
+		if cli.Pairwise() {
+			if csub, err = s.pairwiseSubject(cli, userID); err != nil {
+				log.Errorf("Failed to issue pairwise subject for client %s: %v", clientID, err)
+				return "", oauth2.NewError(oauth2.ErrorServerError)
+			}
+		}
+		if i > 0 && csub != sub {
+			err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+			err.Description = fmt.Sprintf("%q and %q do not share subject identifiers", clientIDs[0], clientID)
+			return "", err
+		}
+		sub = csub
+	}
+	return sub, nil
+}
+
+func (s *Server) pairwiseSubject(cli client.Client, userID string) (string, error) {
+	if s.PairwiseSubjectSalt == "" || s.PairwiseSubjectRepo == nil {
+		return "", errors.New("pairwise subjects are not configured")
+	}
+	sector := cli.SectorIdentifier()
+	sub := user.PairwiseSubject(sector, userID, []byte(s.PairwiseSubjectSalt))
+	if err := s.PairwiseSubjectRepo.Set(sector, sub, userID); err != nil {
+		return "", err
+	}
+	return sub, nil
+}
+
+// setSubject sets the sub claim of a token issued for the user to the subject
+// identifier the clients in its audience know the user by.
+func (s *Server) setSubject(claims jose.Claims, userID string) error {
+	sub, err := s.subject(userID, tokenAudience(claims)...)
+	if err != nil {
+		return err
+	}
+	claims["sub"] = sub
+	return nil
+}
+
+// tokenUserID returns the ID of the user a token issued by dex identifies. The
+// subject of a token is that of the clients in its audience.
+func (s *Server) tokenUserID(claims jose.Claims) (string, error) {
+	sub, _, _ := claims.StringClaim("sub")
+	aud := tokenAudience(claims)
+	if len(aud) == 0 {
+		return sub, nil
+	}
+	return s.SubjectResolver()(sub, aud[0])
+}
+
+// validSubjectType checks that the subject_type of dynamically registered
+// client metadata is supported, and the sector of pairwise clients.
+func (s *Server) validSubjectType(m oidc.ClientMetadata) error {
+	if m.SubjectType == "" {
+		return nil
+	}
+	supported := false
+	for _, t := range s.subjectTypesSupported() {
+		if t == m.SubjectType {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported subject_type %q", m.SubjectType)
+	}
+	if m.SubjectType != oidc.SubjectTypePairwise {
+		return nil
+	}
+	if err := client.ValidSubjectType(m); err != nil {
+		return err
+	}
+	return s.validSectorIdentifier(m)
+}
+
+// validSectorIdentifier checks that the redirect URIs of a client are listed
+// by its sector_identifier_uri, which must be an https URL serving a JSON
+// array of them (OpenID Connect Core 1.0 Section 8.1).
+func (s *Server) validSectorIdentifier(m oidc.ClientMetadata) error {
+	u := m.SectorIdentifierURI
+	if u == nil {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return errors.New("sector_identifier_uri must use https")
+	}
+
+	b, err := s.remoteDocuments.fetch(*u)
+	if err != nil {
+		return fmt.Errorf("fetching sector_identifier_uri: %v", err)
+	}
+	var uris []string
+	if err := json.Unmarshal(b, &uris); err != nil {
+		return fmt.Errorf("sector_identifier_uri is not a JSON array of URIs: %v", err)
+	}
+
+	listed := make(map[string]bool)
+	for _, uri := range uris {
+		listed[uri] = true
+	}
+	for _, ru := range m.RedirectURIs {
+		if !listed[ru.String()] {
+			return fmt.Errorf("redirect_uri %s is not listed by the sector_identifier_uri", ru.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/user"
+)
+
+const testPairwiseSubjectSalt = "pairwise-salt"
+
+func makePairwiseTestFixtures() (*testFixtures, error) {
+	clients := append([]client.LoadableClient{}, testClients...)
+	for _, cliData := range []struct {
+		id           string
+		subjectType  string
+		redirectURL  string
+		sectorURL    string
+		trustedPeers []string
+	}{
+		{
+			id:          "pairwise_a",
+			subjectType: oidc.SubjectTypePairwise,
+			redirectURL: "https://a.example.com/callback",
+		},
+		{
+			id:           "pairwise_b",
+			subjectType:  oidc.SubjectTypePairwise,
+			redirectURL:  "https://a.example.com/other",
+			trustedPeers: []string{"pairwise_a"},
+		},
+		{
+			id:           "pairwise_c",
+			subjectType:  oidc.SubjectTypePairwise,
+			redirectURL:  "https://c.example.com/callback",
+			sectorURL:    "https://sector.example.com/uris.json",
+			trustedPeers: []string{"pairwise_a"},
+		},
+		{
+			id:           "public_d",
+			redirectURL:  "https://d.example.com/callback",
+			trustedPeers: []string{"pairwise_a"},
+		},
+	} {
+		md := oidc.ClientMetadata{
+			RedirectURIs: []url.URL{mustParseURL(cliData.redirectURL)},
+			SubjectType:  cliData.subjectType,
+		}
+		if cliData.sectorURL != "" {
+			u := mustParseURL(cliData.sectorURL)
+			md.SectorIdentifierURI = &u
+		}
+		clients = append(clients, client.LoadableClient{
+			Client: client.Client{
+				Credentials: crossClientCreds(cliData.id),
+				Metadata:    md,
+			},
+			TrustedPeers: cliData.trustedPeers,
+		})
+	}
+
+	f, err := makeTestFixturesWithOptions(testFixtureOptions{clients: clients})
+	if err != nil {
+		return nil, err
+	}
+	f.srv.PairwiseSubjectSalt = testPairwiseSubjectSalt
+	return f, nil
+}
+
+func mustParseURL(s string) url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return *u
+}
+
+func TestServerSubject(t *testing.T) {
+	subA := user.PairwiseSubject("a.example.com", testUserID1, []byte(testPairwiseSubjectSalt))
+	subC := user.PairwiseSubject("sector.example.com", testUserID1, []byte(testPairwiseSubjectSalt))
+
+	tests := []struct {
+		clientIDs []string
+		noSalt    bool
+
+		wantSub string
+		wantErr error
+	}{
+		{
+			clientIDs: []string{"pairwise_a"},
+			wantSub:   subA,
+		},
+		// clients redirecting to the same host are a sector
+		{
+			clientIDs: []string{"pairwise_a", "pairwise_b"},
+			wantSub:   subA,
+		},
+		{
+			clientIDs: []string{"pairwise_c"},
+			wantSub:   subC,
+		},
+		{
+			clientIDs: []string{"public_d"},
+			wantSub:   testUserID1,
+		},
+		{
+			clientIDs: []string{"pairwise_a", "public_d"},
+			wantErr: func() error {
+				err := oauth2.NewError(oauth2.ErrorInvalidRequest)
+				err.Description = `"pairwise_a" and "public_d" do not share subject identifiers`
+				return err
+			}(),
+		},
+		{
+			clientIDs: []string{"pairwise_a"},
+			noSalt:    true,
+			wantErr:   oauth2.NewError(oauth2.ErrorServerError),
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makePairwiseTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		if tt.noSalt {
+			f.srv.PairwiseSubjectSalt = ""
+		}
+
+		sub, err := f.srv.subject(testUserID1, tt.clientIDs...)
+		if !reflect.DeepEqual(err, tt.wantErr) {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if sub != tt.wantSub {
+			t.Errorf("case %d: want sub=%q, got %q", i, tt.wantSub, sub)
+		}
+
+		// Every client in the audience maps the subject back to the user.
+		for _, clientID := range tt.clientIDs {
+			userID, err := f.srv.SubjectResolver()(sub, clientID)
+			if err != nil || userID != testUserID1 {
+				t.Errorf("case %d: %s: want userID=%q, got %q, %v", i, clientID, testUserID1, userID, err)
+			}
+		}
+	}
+}
+
+func TestServerPairwiseTokens(t *testing.T) {
+	f, err := makePairwiseTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	sm := f.sessionManager
+	creds := crossClientCreds("pairwise_a")
+	subA := user.PairwiseSubject("a.example.com", testUserID1, []byte(testPairwiseSubjectSalt))
+
+	sessionID, err := sm.NewSession("bogus_idpc", creds.ID, "bogus", url.URL{}, "", false, []string{"openid"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sm.AttachRemoteIdentity(sessionID, oidc.Identity{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sm.AttachUser(sessionID, testUserID1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code, err := sm.NewSessionKey(sessionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jwt, accessToken, _, _, err := f.srv.CodeToken(creds, code, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err := jwt.Claims()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub, _, _ := claims.StringClaim("sub"); sub != subA {
+		t.Errorf("ID token: want sub=%q, got %q", subA, sub)
+	}
+
+	info, err := f.srv.UserInfo(accessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub, _, _ := info.StringClaim("sub"); sub != subA {
+		t.Errorf("UserInfo: want sub=%q, got %q", subA, sub)
+	}
+
+	for _, token := range []string{jwt.Encode(), accessToken} {
+		ti, err := f.srv.IntrospectToken(creds, token, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ti.Active || ti.Subject != subA {
+			t.Errorf("introspection: want active token with sub=%q, got %#v", subA, ti)
+		}
+	}
+
+	// Exchanged tokens carry the subject their audience knows the user by.
+	for audience, wantSub := range map[string]string{
+		"pairwise_b": subA,
+		"public_d":   testUserID1,
+	} {
+		exchanged, _, err := f.srv.ExchangeToken(creds, jwt.Encode(), tokenTypeIDToken, audience)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", audience, err)
+			continue
+		}
+		claims, err := exchanged.Claims()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", audience, err)
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != wantSub {
+			t.Errorf("%s: want sub=%q, got %q", audience, wantSub, sub)
+		}
+	}
+}
+
+func TestServerValidSubjectType(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{
+			"https://a.example.com/callback",
+			"https://b.example.com/callback",
+		})
+	}))
+	defer ts.Close()
+
+	// Trust the test server's certificate.
+	transport := http.DefaultTransport
+	http.DefaultTransport = ts.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	sectorURL := mustParseURL(ts.URL)
+	plainSectorURL := sectorURL
+	plainSectorURL.Scheme = "http"
+
+	tests := []struct {
+		md oidc.ClientMetadata
+
+		wantErr bool
+	}{
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{mustParseURL("https://a.example.com/callback")},
+			},
+		},
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{mustParseURL("https://a.example.com/callback")},
+				SubjectType:  oidc.SubjectTypePairwise,
+			},
+		},
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					mustParseURL("https://a.example.com/callback"),
+					mustParseURL("https://b.example.com/callback"),
+				},
+				SubjectType:         oidc.SubjectTypePairwise,
+				SectorIdentifierURI: &sectorURL,
+			},
+		},
+		// several hosts and no sector_identifier_uri
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					mustParseURL("https://a.example.com/callback"),
+					mustParseURL("https://b.example.com/callback"),
+				},
+				SubjectType: oidc.SubjectTypePairwise,
+			},
+			wantErr: true,
+		},
+		// redirect URI not listed by the sector_identifier_uri
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs:        []url.URL{mustParseURL("https://c.example.com/callback")},
+				SubjectType:         oidc.SubjectTypePairwise,
+				SectorIdentifierURI: &sectorURL,
+			},
+			wantErr: true,
+		},
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs:        []url.URL{mustParseURL("https://a.example.com/callback")},
+				SubjectType:         oidc.SubjectTypePairwise,
+				SectorIdentifierURI: &plainSectorURL,
+			},
+			wantErr: true,
+		},
+		{
+			md: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{mustParseURL("https://a.example.com/callback")},
+				SubjectType:  "other",
+			},
+			wantErr: true,
+		},
+	}
+
+	f, err := makePairwiseTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	for i, tt := range tests {
+		err := f.srv.validSubjectType(tt.md)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: want error=%t, got %v", i, tt.wantErr, err)
+		}
+	}
+
+	// Without a salt only public subjects are supported.
+	f.srv.PairwiseSubjectSalt = ""
+	if err := f.srv.validSubjectType(tests[1].md); err == nil {
+		t.Errorf("without salt: want error, got nil")
+	}
+}
+
+func TestSubjectTypesSupported(t *testing.T) {
+	f, err := makePairwiseTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	want := []string{oidc.SubjectTypePublic, oidc.SubjectTypePairwise}
+	if got := f.srv.ProviderConfig().SubjectTypesSupported; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// The salt is needed to issue pairwise subjects.
+	f.srv.PairwiseSubjectSalt = ""
+	want = []string{oidc.SubjectTypePublic}
+	if got := f.srv.ProviderConfig().SubjectTypesSupported; !reflect.DeepEqual(want, got) {
+		t.Errorf("without salt: want %v, got %v", want, got)
+	}
+}
@@ -9,13 +9,16 @@ import (
 	"github.com/coreos/go-oidc/key"
 	"github.com/coreos/go-oidc/oidc"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/email"
 	"github.com/coreos/dex/refresh/refreshtest"
+	"github.com/coreos/dex/session"
 	sessionmanager "github.com/coreos/dex/session/manager"
+	"github.com/coreos/dex/signing"
 	"github.com/coreos/dex/user"
 	useremail "github.com/coreos/dex/user/email"
 	usermanager "github.com/coreos/dex/user/manager"
@@ -55,6 +58,9 @@ var (
 						testRedirectURL,
 					},
 				},
+				PostLogoutRedirectURIs: []url.URL{
+					testPostLogoutRedirectURL,
+				},
 			},
 		},
 		{
@@ -71,7 +77,8 @@ var (
 	testConnectorIDOpenIDTrusted = "oidc-trusted"
 	testConnectorLocalID         = "local"
 
-	testRedirectURL = url.URL{Scheme: "http", Host: "client.example.com", Path: "/callback"}
+	testRedirectURL           = url.URL{Scheme: "http", Host: "client.example.com", Path: "/callback"}
+	testPostLogoutRedirectURL = url.URL{Scheme: "http", Host: "client.example.com", Path: "/logged-out"}
 
 	testUsers = []user.UserWithRemoteIdentities{
 		{
@@ -114,6 +121,18 @@ var (
 
 	testPrivKey, _ = key.GeneratePrivateKey()
 
+	testSigningKeys = func() []*signing.PrivateKey {
+		var keys []*signing.PrivateKey
+		for _, alg := range signing.Algs {
+			k, err := signing.GeneratePrivateKey(alg)
+			if err != nil {
+				panic(err)
+			}
+			keys = append(keys, k)
+		}
+		return keys
+	}()
+
 	testClientCreds = oidc.ClientCredentials{
 		ID:     testClientID,
 		Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
@@ -178,6 +197,7 @@ func makeTestFixturesWithOptions(options testFixtureOptions) (*testFixtures, err
 			ClientID:             testConnectorID1 + "_client_id",
 			ClientSecret:         testConnectorID1 + "_client_secret",
 			TrustedEmailProvider: true,
+			AuthMethods:          []string{"pwd", "otp"},
 		},
 		&connector.LocalConnectorConfig{
 			ID: testConnectorLocalID,
@@ -230,6 +250,12 @@ func makeTestFixturesWithOptions(options testFixtureOptions) (*testFixtures, err
 		return nil, err
 	}
 
+	skm := signing.NewKeyManager()
+	err = skm.Set(signing.NewPrivateKeySet(testSigningKeys, time.Now().Add(time.Minute)))
+	if err != nil {
+		return nil, err
+	}
+
 	tpl, err := getTemplates("dex", "https://coreos.com",
 		"https://coreos.com/assets/images/brand/coreos-mark-30px.png",
 		true, templatesLocation)
@@ -248,6 +274,20 @@ func makeTestFixturesWithOptions(options testFixtureOptions) (*testFixtures, err
 		ClientManager:    clientManager,
 		KeyManager:       km,
 		RefreshTokenRepo: refreshTokenRepo,
+		AccessTokenRepo:  db.NewAccessTokenRepo(dbMap),
+
+		SigningKeyManager: skm,
+
+		AccessTokenValidityWindow: accesstoken.DefaultAccessTokenValidityWindow,
+
+		BrowserSessionRepo:           db.NewBrowserSessionRepo(dbMap),
+		PushedAuthRequestRepo:        db.NewPushedAuthRequestRepo(dbMap),
+		ClientAssertionRepo:          db.NewClientAssertionRepo(dbMap),
+		GrantRepo:                    db.NewGrantRepo(dbMap),
+		PairwiseSubjectRepo:          db.NewPairwiseSubjectRepo(dbMap),
+		DeviceCodeRepo:               db.NewDeviceCodeRepo(dbMap),
+		BrowserSessionValidityWindow: session.DefaultBrowserSessionValidityWindow,
+		BrowserSessionCookieKey:      []byte("browser-session-cookie-key-12345"),
 	}
 
 	err = setTemplates(srv, tpl)
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/user"
+)
+
+const (
+	// grantTypeTokenExchange is the grant type of token exchange requests
+	// (RFC 8693 Section 2.1).
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// tokenTypeIDToken identifies ID tokens in token exchange requests and
+	// responses (RFC 8693 Section 3).
+	tokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// tokenExchangeResponse is the response to a token exchange request (RFC 8693
+// Section 2.2.1). The issued token is an ID token, so it is not an OAuth 2.0
+// access token and its token_type is "N_A".
+type tokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+// ExchangeToken implements delegation through token exchange: the client
+// presents an ID token issued to it and gets an ID token for the same user
+// whose audience is another client. The audience must list the client among
+// its trusted peers, as for cross-client scopes. The issued token names the
+// client in its act claim (RFC 8693 Section 4.1).
+func (s *Server) ExchangeToken(creds oidc.ClientCredentials, subjectToken, subjectTokenType, audience string) (*jose.JWT, time.Time, error) {
+	ok, err := s.authenticateClient(creds)
+	if err != nil {
+		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if !ok {
+		log.Errorf("Failed to Authenticate client %s", creds.ID)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+
+	if subjectToken == "" || subjectTokenType != tokenTypeIDToken || audience == "" {
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidRequest)
+	}
+
+	subject, ok, err := s.parseSignedJWT(subjectToken)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !ok {
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+	subjectExp, ok, err := subject.TimeClaim("exp")
+	if err != nil || !ok || !subjectExp.After(time.Now()) {
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+	if !audienceContains(subject, creds.ID) {
+		log.Errorf("Client %s may not exchange an ID token issued to %v", creds.ID, subject["aud"])
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	if audience != creds.ID {
+		allowed, err := s.CrossClientAuthAllowed(creds.ID, audience)
+		if err != nil {
+			log.Errorf("Failed to check cross client auth. reqClientID %v; authClient:ID %v; err: %v", creds.ID, audience, err)
+			return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if !allowed {
+			log.Errorf("Client %s is not a trusted peer of %s", creds.ID, audience)
+			return nil, time.Time{}, oauth2.NewError(errorInvalidTarget)
+		}
+	}
+
+	// The subject token identifies the user as the clients in its audience,
+	// including the requesting client, know them.
+	sub, _, _ := subject.StringClaim("sub")
+	userID, err := s.SubjectResolver()(sub, creds.ID)
+	switch err {
+	case nil:
+		break
+	case user.ErrorNotFound:
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	default:
+		log.Errorf("Failed to resolve subject %q of client %s: %v", sub, creds.ID, err)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	usr, err := s.UserRepo.Get(nil, userID)
+	switch err {
+	case nil:
+		break
+	case user.ErrorNotFound:
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	default:
+		log.Errorf("Failed to fetch user %q from repo: %v", userID, err)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+	if usr.Disabled {
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	signer, err := s.idTokenSigner(audience)
+	if err != nil {
+		log.Errorf("Failed to generate ID token: %v", err)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	// The issued token does not outlive the one it was exchanged for.
+	now := time.Now()
+	exp := now.Add(s.SessionManager.ValidityWindow)
+	if subjectExp.Before(exp) {
+		exp = subjectExp
+	}
+
+	claims := oidc.NewClaims(s.IssuerURL.String(), usr.ID, audience, now, exp)
+	usr.AddToClaims(claims)
+	if err := s.setSubject(claims, usr.ID); err != nil {
+		return nil, time.Time{}, err
+	}
+	if groups, ok := subject["groups"]; ok {
+		claims["groups"] = groups
+	}
+	claims.Add("azp", creds.ID)
+
+	// A token that was itself exchanged keeps the earlier actors nested
+	// (RFC 8693 Section 4.1).
+	act := map[string]interface{}{"sub": creds.ID}
+	if prior, ok := subject["act"]; ok {
+		act["act"] = prior
+	}
+	claims.Add("act", act)
+
+	jwt, err := jose.NewSignedJWT(claims, signer)
+	if err != nil {
+		log.Errorf("Failed to generate ID token: %v", err)
+		return nil, time.Time{}, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	log.Infof("Token exchanged: clientID=%s audience=%s userID=%s", creds.ID, audience, usr.ID)
+
+	return jwt, exp, nil
+}
+
+// audienceContains reports whether the aud claim, a list of clients or a
+// single client, contains clientID.
+func audienceContains(claims jose.Claims, clientID string) bool {
+	for _, id := range tokenAudience(claims) {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAudience returns the clients in the aud claim, a list of clients or a
+// single client.
+func tokenAudience(claims jose.Claims) []string {
+	clientIDs, ok, err := claims.StringsClaim("aud")
+	if err != nil || !ok {
+		aud, ok, _ := claims.StringClaim("aud")
+		if !ok {
+			return nil
+		}
+		clientIDs = []string{aud}
+	}
+	return clientIDs
+}
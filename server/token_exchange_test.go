@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func crossClientCreds(id string) oidc.ClientCredentials {
+	return oidc.ClientCredentials{
+		ID:     id,
+		Secret: base64.URLEncoding.EncodeToString([]byte(id + "_secret")),
+	}
+}
+
+func TestServerExchangeToken(t *testing.T) {
+	now := time.Now()
+	idToken := func(aud string, exp time.Time) jose.Claims {
+		return oidc.NewClaims(testIssuerURL.String(), testUserID1, aud, now, exp)
+	}
+
+	tests := []struct {
+		creds            oidc.ClientCredentials
+		subject          jose.Claims
+		subjectTokenType string
+		audience         string
+		disableUser      bool
+
+		wantErr error
+		wantAct interface{}
+	}{
+		// client_b trusts client_a
+		{
+			creds:    crossClientCreds("client_a"),
+			subject:  idToken("client_a", now.Add(time.Hour)),
+			audience: "client_b",
+			wantAct:  map[string]interface{}{"sub": "client_a"},
+		},
+		// a client may exchange a token for itself
+		{
+			creds:    crossClientCreds("client_a"),
+			subject:  idToken("client_a", now.Add(time.Hour)),
+			audience: "client_a",
+			wantAct:  map[string]interface{}{"sub": "client_a"},
+		},
+		// exchanging an exchanged token nests the actors
+		{
+			creds: crossClientCreds("client_b"),
+			subject: func() jose.Claims {
+				claims := idToken("client_b", now.Add(time.Hour))
+				claims.Add("act", map[string]interface{}{"sub": "client_a"})
+				return claims
+			}(),
+			audience: "client_c",
+			wantAct: map[string]interface{}{
+				"sub": "client_b",
+				"act": map[string]interface{}{"sub": "client_a"},
+			},
+		},
+		// client_a does not trust client_b
+		{
+			creds:    crossClientCreds("client_b"),
+			subject:  idToken("client_b", now.Add(time.Hour)),
+			audience: "client_a",
+			wantErr:  oauth2.NewError(errorInvalidTarget),
+		},
+		// unknown audience
+		{
+			creds:    crossClientCreds("client_a"),
+			subject:  idToken("client_a", now.Add(time.Hour)),
+			audience: "unknown_client",
+			wantErr:  oauth2.NewError(errorInvalidTarget),
+		},
+		// the ID token was not issued to the client
+		{
+			creds:    crossClientCreds("client_a"),
+			subject:  idToken("client_c", now.Add(time.Hour)),
+			audience: "client_b",
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// expired ID token
+		{
+			creds:    crossClientCreds("client_a"),
+			subject:  idToken("client_a", now.Add(-time.Minute)),
+			audience: "client_b",
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// disabled user
+		{
+			creds:       crossClientCreds("client_a"),
+			subject:     idToken("client_a", now.Add(time.Hour)),
+			audience:    "client_b",
+			disableUser: true,
+			wantErr:     oauth2.NewError(oauth2.ErrorInvalidGrant),
+		},
+		// unsupported subject token type
+		{
+			creds:            crossClientCreds("client_a"),
+			subject:          idToken("client_a", now.Add(time.Hour)),
+			subjectTokenType: "urn:ietf:params:oauth:token-type:access_token",
+			audience:         "client_b",
+			wantErr:          oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// missing audience
+		{
+			creds:   crossClientCreds("client_a"),
+			subject: idToken("client_a", now.Add(time.Hour)),
+			wantErr: oauth2.NewError(oauth2.ErrorInvalidRequest),
+		},
+		// bad client secret
+		{
+			creds:    oidc.ClientCredentials{ID: "client_a", Secret: clientTestSecret},
+			subject:  idToken("client_a", now.Add(time.Hour)),
+			audience: "client_b",
+			wantErr:  oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeCrossClientTestFixtures()
+		if err != nil {
+			t.Fatalf("case %d: error making test fixtures: %v", i, err)
+		}
+		if tt.disableUser {
+			if err := f.srv.UserManager.Disable(testUserID1, true); err != nil {
+				t.Fatalf("case %d: unexpected error disabling user: %v", i, err)
+			}
+		}
+		subjectToken, err := signTestClaims(f, tt.subject)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error signing ID token: %v", i, err)
+		}
+		subjectTokenType := tt.subjectTokenType
+		if subjectTokenType == "" {
+			subjectTokenType = tokenTypeIDToken
+		}
+
+		jwt, exp, err := f.srv.ExchangeToken(tt.creds, subjectToken, subjectTokenType, tt.audience)
+		if !reflect.DeepEqual(err, tt.wantErr) {
+			t.Errorf("case %d: want err=%v, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if aud, _, _ := claims.StringClaim("aud"); aud != tt.audience {
+			t.Errorf("case %d: want aud=%q, got %q", i, tt.audience, aud)
+		}
+		if sub, _, _ := claims.StringClaim("sub"); sub != testUserID1 {
+			t.Errorf("case %d: want sub=%q, got %q", i, testUserID1, sub)
+		}
+		if azp, _, _ := claims.StringClaim("azp"); azp != tt.creds.ID {
+			t.Errorf("case %d: want azp=%q, got %q", i, tt.creds.ID, azp)
+		}
+		if diff := pretty.Compare(tt.wantAct, claims["act"]); diff != "" {
+			t.Errorf("case %d: Compare(wantAct, gotAct): %v", i, diff)
+		}
+		if subjectExp, _, _ := tt.subject.TimeClaim("exp"); exp.After(subjectExp) {
+			t.Errorf("case %d: issued token expires at %v, after the subject token at %v", i, exp, subjectExp)
+		}
+	}
+}
+
+func TestHandleTokenFuncTokenExchange(t *testing.T) {
+	f, err := makeCrossClientTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	subjectToken, err := signTestClaims(f, oidc.NewClaims(testIssuerURL.String(), testUserID1, "client_a", time.Now(), time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("unexpected error signing ID token: %v", err)
+	}
+
+	form := func(extra url.Values) url.Values {
+		v := url.Values{
+			"grant_type":         {grantTypeTokenExchange},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {tokenTypeIDToken},
+			"audience":           {"client_b"},
+		}
+		for k, vs := range extra {
+			v[k] = vs
+		}
+		return v
+	}
+
+	tests := []struct {
+		form      url.Values
+		basicAuth bool
+
+		wantCode int
+	}{
+		{
+			form:      form(nil),
+			basicAuth: true,
+			wantCode:  http.StatusOK,
+		},
+		{
+			form:      form(url.Values{"requested_token_type": {tokenTypeIDToken}}),
+			basicAuth: true,
+			wantCode:  http.StatusOK,
+		},
+		// only ID tokens are issued
+		{
+			form:      form(url.Values{"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"}}),
+			basicAuth: true,
+			wantCode:  http.StatusBadRequest,
+		},
+		// the authenticated client is the only actor
+		{
+			form:      form(url.Values{"actor_token": {subjectToken}}),
+			basicAuth: true,
+			wantCode:  http.StatusBadRequest,
+		},
+		// the client must authenticate
+		{
+			form:     form(url.Values{"client_id": {"client_a"}}),
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	hdlr := handleTokenFunc(f.srv)
+	for i, tt := range tests {
+		req, err := http.NewRequest("POST", "http://example.com/token", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.basicAuth {
+			creds := crossClientCreds("client_a")
+			req.SetBasicAuth(creds.ID, creds.Secret)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var resp tokenExchangeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("case %d: invalid response body %q: %v", i, w.Body.String(), err)
+			continue
+		}
+		if resp.IssuedTokenType != tokenTypeIDToken || resp.TokenType != "N_A" {
+			t.Errorf("case %d: want issued_token_type=%q and token_type=N_A, got %q and %q", i, tokenTypeIDToken, resp.IssuedTokenType, resp.TokenType)
+		}
+		if _, err := jose.ParseJWT(resp.AccessToken); err != nil {
+			t.Errorf("case %d: issued token is not a JWT: %v", i, err)
+		}
+	}
+}
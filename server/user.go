@@ -32,20 +32,24 @@ var (
 	AccountSubTree                = "/account"
 	AccountListRefreshTokens      = addBasePath(AccountSubTree + "/:userid/refresh")
 	AccountRevokeRefreshToken     = addBasePath(AccountSubTree + "/:userid/refresh/:clientid")
+	AccountListGrants             = addBasePath(AccountSubTree + "/:userid/grants")
+	AccountRevokeGrant            = addBasePath(AccountSubTree + "/:userid/grants/:clientid")
 )
 
 type UserMgmtServer struct {
 	api                  *api.UsersAPI
 	jwtvFactory          JWTVerifierFactory
+	subjects             SubjectResolver
 	um                   *usermanager.UserManager
 	cm                   *clientmanager.ClientManager
 	allowClientCredsAuth bool
 }
 
-func NewUserMgmtServer(userMgmtAPI *api.UsersAPI, jwtvFactory JWTVerifierFactory, um *usermanager.UserManager, cm *clientmanager.ClientManager, allowClientCredsAuth bool) *UserMgmtServer {
+func NewUserMgmtServer(userMgmtAPI *api.UsersAPI, jwtvFactory JWTVerifierFactory, subjects SubjectResolver, um *usermanager.UserManager, cm *clientmanager.ClientManager, allowClientCredsAuth bool) *UserMgmtServer {
 	return &UserMgmtServer{
 		api:                  userMgmtAPI,
 		jwtvFactory:          jwtvFactory,
+		subjects:             subjects,
 		um:                   um,
 		cm:                   cm,
 		allowClientCredsAuth: allowClientCredsAuth,
@@ -65,6 +69,8 @@ func (s *UserMgmtServer) HTTPHandler() http.Handler {
 
 	r.GET(AccountListRefreshTokens, s.authAccount(s.listClientsWithRefreshTokens))
 	r.DELETE(AccountRevokeRefreshToken, s.authAccount(s.revokeRefreshTokensForClient))
+	r.GET(AccountListGrants, s.authAccount(s.listGrants))
+	r.DELETE(AccountRevokeGrant, s.authAccount(s.revokeGrant))
 	return r
 }
 
@@ -234,6 +240,23 @@ func (s *UserMgmtServer) revokeRefreshTokensForClient(w http.ResponseWriter, r *
 	w.WriteHeader(http.StatusOK) // NOTE (ericchiang): http.StatusNoContent or return an empty JSON object?
 }
 
+func (s *UserMgmtServer) listGrants(w http.ResponseWriter, r *http.Request, ps httprouter.Params, creds api.Creds) {
+	grants, err := s.api.ListGrants(creds, ps.ByName("userid"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, schema.GrantList{Grants: grants})
+}
+
+func (s *UserMgmtServer) revokeGrant(w http.ResponseWriter, r *http.Request, ps httprouter.Params, creds api.Creds) {
+	if err := s.api.RevokeGrant(creds, ps.ByName("userid"), ps.ByName("clientid")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *UserMgmtServer) writeError(w http.ResponseWriter, err error) {
 	log.Errorf("Error calling user management API: %v: ", err)
 	if apiErr, ok := err.(api.Error); ok {
@@ -315,7 +338,18 @@ func (s *UserMgmtServer) getCreds(r *http.Request, requiresAdmin bool) (api.Cred
 		}, nil
 	}
 
-	usr, err := s.um.Get(sub)
+	// The subject is that of the clients in the token's audience, which is
+	// not the user's ID for pairwise clients.
+	userID, err := s.subjects(sub, clientIDs[0])
+	if err != nil {
+		if err == user.ErrorNotFound {
+			return api.Creds{}, api.ErrorUnauthorized
+		}
+		log.Errorf("userMgmtServer: GetCreds err: %q", err)
+		return api.Creds{}, err
+	}
+
+	usr, err := s.um.Get(userID)
 	if err != nil {
 		if err == user.ErrorNotFound {
 			return api.Creds{}, api.ErrorUnauthorized
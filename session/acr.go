@@ -0,0 +1,85 @@
+package session
+
+// Authentication context classes dex issues in the "acr" claim, from the
+// weakest to the strongest. They're derived from the methods the user
+// authenticated with (OpenID Connect Core 1.0 Section 2).
+const (
+	// ACRUnknown is the class of authentication through connectors which
+	// don't report their methods, e.g. federated logins.
+	ACRUnknown = "0"
+
+	// ACRSingleFactor is the class of authentication with a single factor,
+	// such as a password.
+	ACRSingleFactor = "1"
+
+	// ACRMultiFactor is the class of authentication with several factors.
+	ACRMultiFactor = "2"
+)
+
+// ACRValuesSupported are the authentication context classes dex issues.
+var ACRValuesSupported = []string{ACRUnknown, ACRSingleFactor, ACRMultiFactor}
+
+// ACR returns the authentication context class of authentication with the
+// methods amr.
+func ACR(amr []string) string {
+	methods := make(map[string]bool)
+	for _, m := range amr {
+		if m == "mfa" {
+			return ACRMultiFactor
+		}
+		methods[m] = true
+	}
+	switch len(methods) {
+	case 0:
+		return ACRUnknown
+	case 1:
+		return ACRSingleFactor
+	}
+	return ACRMultiFactor
+}
+
+// AuthContextClass returns the authentication context class of an
+// authentication: acr, if the upstream identity provider reported it, or else
+// the class of authentication with the methods amr. Classes upstream providers
+// report which dex doesn't know only satisfy the empty minimum.
+func AuthContextClass(amr []string, acr string) string {
+	if acr != "" {
+		return acr
+	}
+	return ACR(amr)
+}
+
+// MinACR returns the weakest of the authentication context classes requested
+// in 'acr_values', which is the class the user must at least authenticate
+// with. Classes dex doesn't know are ignored; if there are no others, the
+// empty string is returned.
+func MinACR(acrValues []string) string {
+	min := ""
+	for _, v := range acrValues {
+		if acrLevel(v) < 0 {
+			continue
+		}
+		if min == "" || acrLevel(v) < acrLevel(min) {
+			min = v
+		}
+	}
+	return min
+}
+
+// SatisfiesACR reports whether authentication of the class acr meets the
+// minimum class min. Every class meets the empty minimum.
+func SatisfiesACR(acr, min string) bool {
+	if min == "" {
+		return true
+	}
+	return acrLevel(acr) >= acrLevel(min)
+}
+
+func acrLevel(acr string) int {
+	for i, v := range ACRValuesSupported {
+		if v == acr {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"testing"
+)
+
+func TestACR(t *testing.T) {
+	tests := []struct {
+		amr  []string
+		want string
+	}{
+		{
+			amr:  nil,
+			want: ACRUnknown,
+		},
+		{
+			amr:  []string{"pwd"},
+			want: ACRSingleFactor,
+		},
+		{
+			amr:  []string{"pwd", "pwd"},
+			want: ACRSingleFactor,
+		},
+		{
+			amr:  []string{"pwd", "otp"},
+			want: ACRMultiFactor,
+		},
+		{
+			amr:  []string{"hwk", "mfa"},
+			want: ACRMultiFactor,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := ACR(tt.amr); got != tt.want {
+			t.Errorf("case %d: want %q, got %q", i, tt.want, got)
+		}
+	}
+}
+
+func TestSatisfiesACR(t *testing.T) {
+	tests := []struct {
+		acr       string
+		acrValues []string
+		want      bool
+	}{
+		{
+			acr:  ACRUnknown,
+			want: true,
+		},
+		{
+			acr:       ACRSingleFactor,
+			acrValues: []string{ACRSingleFactor},
+			want:      true,
+		},
+		{
+			acr:       ACRMultiFactor,
+			acrValues: []string{ACRSingleFactor},
+			want:      true,
+		},
+		{
+			acr:       ACRUnknown,
+			acrValues: []string{ACRSingleFactor},
+			want:      false,
+		},
+		{
+			acr:       ACRSingleFactor,
+			acrValues: []string{ACRMultiFactor},
+			want:      false,
+		},
+		// The weakest of the requested classes is the minimum.
+		{
+			acr:       ACRSingleFactor,
+			acrValues: []string{ACRMultiFactor, ACRSingleFactor},
+			want:      true,
+		},
+		// Unknown classes are ignored.
+		{
+			acr:       ACRUnknown,
+			acrValues: []string{"urn:example:gold"},
+			want:      true,
+		},
+		{
+			acr:       ACRSingleFactor,
+			acrValues: []string{"urn:example:gold", ACRMultiFactor},
+			want:      false,
+		},
+		// Classes reported upstream which dex doesn't know meet no
+		// requested class.
+		{
+			acr:  "urn:example:gold",
+			want: true,
+		},
+		{
+			acr:       "urn:example:gold",
+			acrValues: []string{ACRUnknown},
+			want:      false,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := SatisfiesACR(tt.acr, MinACR(tt.acrValues)); got != tt.want {
+			t.Errorf("case %d: want %t, got %t", i, tt.want, got)
+		}
+	}
+}
+
+func TestAuthContextClass(t *testing.T) {
+	tests := []struct {
+		amr  []string
+		acr  string
+		want string
+	}{
+		{
+			amr:  []string{"pwd"},
+			want: ACRSingleFactor,
+		},
+		// The class reported upstream takes precedence.
+		{
+			amr:  []string{"pwd"},
+			acr:  ACRMultiFactor,
+			want: ACRMultiFactor,
+		},
+		{
+			acr:  "urn:example:gold",
+			want: "urn:example:gold",
+		},
+	}
+
+	for i, tt := range tests {
+		if got := AuthContextClass(tt.amr, tt.acr); got != tt.want {
+			t.Errorf("case %d: want %q, got %q", i, tt.want, got)
+		}
+	}
+}
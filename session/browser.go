@@ -0,0 +1,48 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/oidc"
+)
+
+const (
+	// DefaultBrowserSessionValidityWindow is how long users stay logged in to
+	// dex if no other lifetime is configured.
+	DefaultBrowserSessionValidityWindow = 24 * time.Hour
+)
+
+var (
+	ErrorBrowserSessionNotFound = errors.New("browser session not found")
+)
+
+// BrowserSession is the single sign-on session of a browser with dex. Once
+// the user has logged in, it allows dex to authenticate the user to other
+// clients without asking them to log in again.
+type BrowserSession struct {
+	ID string
+
+	// UserID is empty until the user has logged in.
+	UserID      string
+	ConnectorID string
+
+	// Identity is the remote identity the user logged in with.
+	Identity oidc.Identity
+
+	// AuthTime is when the user last logged in.
+	AuthTime time.Time
+
+	// AMR and ACR are how the user authenticated when they last logged in,
+	// as recorded in the session they logged in to.
+	AMR []string
+	ACR string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Authenticated reports whether the user has logged in.
+func (b *BrowserSession) Authenticated() bool {
+	return b != nil && b.UserID != ""
+}
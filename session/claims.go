@@ -0,0 +1,90 @@
+package session
+
+import (
+	"reflect"
+)
+
+// ClaimRequest is a request for an individual claim in the 'claims' parameter
+// of an authentication request (OpenID Connect Core 1.0 Section 5.5.1). A nil
+// ClaimRequest asks for the claim in the default manner.
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// Allows reports whether the claim may be returned with the value v: whether
+// v is the requested value, or one of them.
+func (r *ClaimRequest) Allows(v interface{}) bool {
+	if r == nil || (r.Value == nil && len(r.Values) == 0) {
+		return true
+	}
+	if r.Value != nil && claimValueEqual(r.Value, v) {
+		return true
+	}
+	for _, rv := range r.Values {
+		if claimValueEqual(rv, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// StringValues returns the string values the claim is requested with.
+func (r *ClaimRequest) StringValues() []string {
+	if r == nil {
+		return nil
+	}
+	var vs []string
+	for _, v := range append([]interface{}{r.Value}, r.Values...) {
+		if s, ok := v.(string); ok {
+			vs = append(vs, s)
+		}
+	}
+	return vs
+}
+
+// ClaimRequests maps claim names to the requests for them.
+type ClaimRequests map[string]*ClaimRequest
+
+// Requested reports whether the claim was requested.
+func (c ClaimRequests) Requested(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// ClaimsRequest is the 'claims' parameter of an authentication request,
+// which asks for individual claims to be returned in the ID token or from the
+// UserInfo endpoint.
+type ClaimsRequest struct {
+	IDToken  ClaimRequests `json:"id_token,omitempty"`
+	UserInfo ClaimRequests `json:"userinfo,omitempty"`
+}
+
+// Requested reports whether the claim was requested for either the ID token
+// or the UserInfo endpoint.
+func (c ClaimsRequest) Requested(name string) bool {
+	return c.IDToken.Requested(name) || c.UserInfo.Requested(name)
+}
+
+// claimValueEqual compares claim values decoded from JSON to those of claims,
+// which may have other numeric types.
+func claimValueEqual(a, b interface{}) bool {
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/jonboulle/clockwork"
 
 	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 )
 
@@ -156,6 +157,158 @@ func (m *SessionManager) AttachGroups(sessionID string, groups []string) (*sessi
 	return s, nil
 }
 
+func (m *SessionManager) AttachCodeChallenge(sessionID, challenge, method string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.CodeChallenge = challenge
+	s.CodeChallengeMethod = method
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachResponseType(sessionID, responseType string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ResponseType = responseType
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachBrowserSession(sessionID, browserSessionID string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.BrowserSessionID = browserSessionID
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachPrompt(sessionID, prompt string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Prompt = prompt
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachACRValues(sessionID string, acrValues []string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ACRValues = acrValues
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachResources(sessionID string, resources []string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Resources = resources
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachClaimsRequest(sessionID string, claims session.ClaimsRequest) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ClaimsRequest = claims
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachAuthMethods(sessionID string, amr []string, acr string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateRemoteAttached)
+	if err != nil {
+		return nil, err
+	}
+
+	s.AMR = amr
+	s.ACR = acr
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachProfile(sessionID string, profile user.Profile) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateRemoteAttached)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Profile = profile
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SessionManager) AttachAuthTime(sessionID string, authTime time.Time) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateIdentified)
+	if err != nil {
+		return nil, err
+	}
+
+	s.AuthTime = authTime
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 func (m *SessionManager) Kill(sessionID string) (*session.Session, error) {
 	s, err := m.sessions.Get(sessionID)
 	if err != nil {
@@ -0,0 +1,43 @@
+package session
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultPushedAuthRequestValidityWindow is how long the request_uri of
+	// a pushed authorization request can be used. It covers the user
+	// choosing a connector, which sends the request to the authorization
+	// endpoint a second time.
+	DefaultPushedAuthRequestValidityWindow = 5 * time.Minute
+
+	// PushedAuthRequestURIPrefix is the prefix of the request_uri of pushed
+	// authorization requests (RFC 9126 Section 2.2).
+	PushedAuthRequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+)
+
+var (
+	ErrorPushedAuthRequestNotFound = errors.New("pushed authorization request not found")
+)
+
+// PushedAuthRequest is an authorization request a client pushed to dex
+// (RFC 9126), to be referred to by its request_uri at the authorization
+// endpoint.
+type PushedAuthRequest struct {
+	ID       string
+	ClientID string
+
+	// Params are the parameters of the authorization request, after any
+	// request object has been verified and unpacked.
+	Params url.Values
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// RequestURI returns the request_uri referring to the request.
+func (p *PushedAuthRequest) RequestURI() string {
+	return PushedAuthRequestURIPrefix + p.ID
+}
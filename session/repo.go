@@ -12,3 +12,22 @@ type SessionKeyRepo interface {
 	Push(SessionKey, time.Duration) error
 	Pop(string) (string, error)
 }
+
+type BrowserSessionRepo interface {
+	// Get returns the browser session, or ErrorBrowserSessionNotFound if it
+	// does not exist or has expired.
+	Get(string) (*BrowserSession, error)
+	Create(BrowserSession) error
+	Update(BrowserSession) error
+	Delete(string) error
+}
+
+type PushedAuthRequestRepo interface {
+	// Get returns the pushed authorization request, or
+	// ErrorPushedAuthRequestNotFound if it does not exist or has expired.
+	Get(string) (*PushedAuthRequest, error)
+	Create(PushedAuthRequest) error
+	// Delete removes the pushed authorization request, or returns
+	// ErrorPushedAuthRequestNotFound if it does not exist.
+	Delete(string) error
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/coreos/go-oidc/oidc"
 
 	"github.com/coreos/dex/scope"
+	"github.com/coreos/dex/user"
 )
 
 const (
@@ -58,6 +59,80 @@ type Session struct {
 
 	// Groups the user belongs to.
 	Groups []string
+
+	// CodeChallenge and CodeChallengeMethod are optionally provided in the
+	// initial authorization request by clients using PKCE (RFC 7636). The
+	// code verifier presented when the code is exchanged must match them.
+	CodeChallenge       string
+	CodeChallengeMethod string
+
+	// ResponseType is the 'response_type' field in the authentication
+	// request. An empty value is equivalent to "code".
+	ResponseType string
+
+	// BrowserSessionID identifies the single sign-on session of the browser
+	// the authentication request came from.
+	BrowserSessionID string
+
+	// AuthTime is when the user authenticated, which may predate the session
+	// if the user was logged in through their browser session.
+	AuthTime time.Time
+
+	// Prompt is the 'prompt' field in the authentication request.
+	Prompt string
+
+	// AMR are the methods the user authenticated with, as reported by the
+	// upstream identity provider or else the connector.
+	AMR []string
+
+	// ACR is the authentication context class the upstream identity
+	// provider reported, if any.
+	ACR string
+
+	// ACRValues is the 'acr_values' field in the authentication request.
+	// The user must authenticate with at least the weakest of the
+	// requested classes.
+	ACRValues []string
+
+	// ClaimsRequest is the 'claims' field in the authentication request.
+	ClaimsRequest ClaimsRequest
+
+	// Resources are the 'resource' fields in the authentication request:
+	// the resource servers the client asked for access tokens for.
+	Resources []string
+
+	// Profile is what the connector reported about the user beyond their
+	// remote identity.
+	Profile user.Profile
+}
+
+// AuthParams are the optional parameters of the authentication request a
+// session is started for. They are stored in the Session fields of the same
+// names.
+type AuthParams struct {
+	ResponseType        string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+	BrowserSessionID    string
+	ACRValues           []string
+	ClaimsRequest       ClaimsRequest
+	Resources           []string
+}
+
+// AuthParams returns the parameters of the authentication request the
+// session was started for.
+func (s *Session) AuthParams() AuthParams {
+	return AuthParams{
+		ResponseType:        s.ResponseType,
+		CodeChallenge:       s.CodeChallenge,
+		CodeChallengeMethod: s.CodeChallengeMethod,
+		Prompt:              s.Prompt,
+		BrowserSessionID:    s.BrowserSessionID,
+		ACRValues:           s.ACRValues,
+		ClaimsRequest:       s.ClaimsRequest,
+		Resources:           s.Resources,
+	}
 }
 
 // Claims returns a new set of Claims for the current session.
@@ -68,6 +143,15 @@ func (s *Session) Claims(issuerURL string) jose.Claims {
 	if s.Nonce != "" {
 		claims["nonce"] = s.Nonce
 	}
+	if !s.AuthTime.IsZero() {
+		claims["auth_time"] = s.AuthTime.Unix()
+	}
+	if len(s.AMR) > 0 {
+		claims["amr"] = s.AMR
+	}
+	if len(s.AMR) > 0 || s.ACR != "" || len(s.ACRValues) > 0 || s.ClaimsRequest.IDToken.Requested("acr") {
+		claims["acr"] = AuthContextClass(s.AMR, s.ACR)
+	}
 	if s.Scope.HasScope(scope.ScopeGroups) {
 		claims["groups"] = s.Groups
 	}
@@ -84,6 +84,82 @@ func TestSessionClaims(t *testing.T) {
 				"nonce": "oncenay",
 			},
 		},
+		// auth_time is set once the user has logged in.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				UserID:    "elroy-id",
+				AuthTime:  now.Add(-time.Minute),
+			},
+			want: jose.Claims{
+				"iss":       issuerURL,
+				"sub":       "elroy-id",
+				"aud":       "XXX",
+				"iat":       now.Unix(),
+				"exp":       now.Add(time.Hour).Unix(),
+				"auth_time": now.Add(-time.Minute).Unix(),
+			},
+		},
+		// amr and acr describe how the user authenticated.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				UserID:    "elroy-id",
+				AMR:       []string{"pwd"},
+			},
+			want: jose.Claims{
+				"iss": issuerURL,
+				"sub": "elroy-id",
+				"aud": "XXX",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+				"amr": []string{"pwd"},
+				"acr": ACRSingleFactor,
+			},
+		},
+		// acr is set for clients that requested one, even if the methods
+		// are unknown.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				UserID:    "elroy-id",
+				ACRValues: []string{ACRUnknown},
+			},
+			want: jose.Claims{
+				"iss": issuerURL,
+				"sub": "elroy-id",
+				"aud": "XXX",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+				"acr": ACRUnknown,
+			},
+		},
+		// acr is the class the upstream identity provider reported.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				UserID:    "elroy-id",
+				AMR:       []string{"pwd"},
+				ACR:       "urn:example:acr:silver",
+			},
+			want: jose.Claims{
+				"iss": issuerURL,
+				"sub": "elroy-id",
+				"aud": "XXX",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+				"amr": []string{"pwd"},
+				"acr": "urn:example:acr:silver",
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -0,0 +1,104 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/coreos/go-oidc/jose"
+	"golang.org/x/crypto/ed25519"
+)
+
+// JWK is the JSON Web Key of an elliptic curve (RFC 7518 Section 6.2) or
+// Edwards curve (RFC 8037 Section 2) public key. go-oidc's jose.JWK only
+// represents RSA keys.
+type JWK struct {
+	ID    string `json:"kid,omitempty"`
+	Type  string `json:"kty"`
+	Alg   string `json:"alg"`
+	Use   string `json:"use"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y,omitempty"`
+}
+
+func newJWK(id, alg string, pub crypto.PublicKey) JWK {
+	jwk := JWK{
+		ID:  id,
+		Alg: alg,
+		Use: "sig",
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Type = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = encodeCoordinate(pub.X, size)
+		jwk.Y = encodeCoordinate(pub.Y, size)
+	case ed25519.PublicKey:
+		jwk.Type = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// Verifier returns a verifier of the signatures made with the key.
+func (j JWK) Verifier() (jose.Verifier, error) {
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %v", err)
+	}
+
+	var pub crypto.PublicKey
+	switch {
+	case j.Type == "EC" && (j.Alg == jose.AlgES256 || j.Alg == jose.AlgES384):
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %v", err)
+		}
+		c := curve(j.Alg)
+		if j.Curve != c.Params().Name {
+			return nil, fmt.Errorf("curve %q does not match alg %q", j.Curve, j.Alg)
+		}
+		pk := &ecdsa.PublicKey{
+			Curve: c,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !c.IsOnCurve(pk.X, pk.Y) {
+			return nil, fmt.Errorf("point is not on curve %q", j.Curve)
+		}
+		pub = pk
+	case j.Type == "OKP" && j.Alg == AlgEdDSA && j.Curve == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key size %d", len(x))
+		}
+		pub = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q with alg %q", j.Type, j.Alg)
+	}
+
+	return &verifier{
+		keyID:     j.ID,
+		alg:       j.Alg,
+		publicKey: pub,
+	}, nil
+}
+
+func encodeCoordinate(i *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(padBytes(i, size))
+}
+
+// padBytes returns the big-endian bytes of i, left-padded with zeros to size.
+func padBytes(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
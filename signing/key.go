@@ -0,0 +1,136 @@
+// Package signing provides the elliptic curve and Edwards curve keys dex signs
+// ID tokens with for clients which registered an id_token_signed_response_alg
+// other than RS256. RS256 keys are provided by go-oidc's key package.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"golang.org/x/crypto/ed25519"
+)
+
+// AlgEdDSA is the JWS algorithm of Edwards curve signatures (RFC 8037).
+const AlgEdDSA = "EdDSA"
+
+// Algs are the algorithms of the keys provided by this package.
+var Algs = []string{jose.AlgES256, jose.AlgES384, AlgEdDSA}
+
+// Supported reports whether keys for alg are provided by this package.
+func Supported(alg string) bool {
+	for _, a := range Algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+type PrivateKey struct {
+	KeyID string
+	Alg   string
+
+	// PrivateKey is an *ecdsa.PrivateKey for ES256 and ES384, and an
+	// ed25519.PrivateKey for EdDSA.
+	PrivateKey crypto.Signer
+}
+
+// GeneratePrivateKey generates a key for signing with alg.
+func GeneratePrivateKey(alg string) (*PrivateKey, error) {
+	var pk crypto.Signer
+	switch alg {
+	case jose.AlgES256, jose.AlgES384:
+		k, err := ecdsa.GenerateKey(curve(alg), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pk = k
+	case AlgEdDSA:
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pk = k
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	keyID := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, keyID); err != nil {
+		return nil, err
+	}
+
+	k := PrivateKey{
+		KeyID:      hex.EncodeToString(keyID),
+		Alg:        alg,
+		PrivateKey: pk,
+	}
+
+	return &k, nil
+}
+
+func (k *PrivateKey) ID() string {
+	return k.KeyID
+}
+
+func (k *PrivateKey) Signer() jose.Signer {
+	return &signer{
+		verifier: verifier{
+			keyID:     k.KeyID,
+			alg:       k.Alg,
+			publicKey: k.PrivateKey.Public(),
+		},
+		privateKey: k.PrivateKey,
+	}
+}
+
+func (k *PrivateKey) JWK() JWK {
+	return newJWK(k.KeyID, k.Alg, k.PrivateKey.Public())
+}
+
+// PrivateKeySet holds the keys of every algorithm, the newest key of each
+// algorithm first. It implements go-oidc's key.KeySet, so it can be stored
+// and synced like dex's RS256 keys.
+type PrivateKeySet struct {
+	keys      []*PrivateKey
+	expiresAt time.Time
+}
+
+func NewPrivateKeySet(keys []*PrivateKey, exp time.Time) *PrivateKeySet {
+	return &PrivateKeySet{
+		keys:      keys,
+		expiresAt: exp.UTC(),
+	}
+}
+
+func (s *PrivateKeySet) Keys() []*PrivateKey {
+	return s.keys
+}
+
+func (s *PrivateKeySet) ExpiresAt() time.Time {
+	return s.expiresAt
+}
+
+// Active returns the key to sign with alg, or nil if there is none.
+func (s *PrivateKeySet) Active(alg string) *PrivateKey {
+	for _, k := range s.keys {
+		if k.Alg == alg {
+			return k
+		}
+	}
+	return nil
+}
+
+func curve(alg string) elliptic.Curve {
+	if alg == jose.AlgES384 {
+		return elliptic.P384()
+	}
+	return elliptic.P256()
+}
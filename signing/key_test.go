@@ -0,0 +1,210 @@
+package signing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+)
+
+func TestSignerVerify(t *testing.T) {
+	tests := []struct {
+		alg string
+
+		wantType  string
+		wantCurve string
+		wantLen   int
+	}{
+		{jose.AlgES256, "EC", "P-256", 64},
+		{jose.AlgES384, "EC", "P-384", 96},
+		{AlgEdDSA, "OKP", "Ed25519", 64},
+	}
+
+	for i, tt := range tests {
+		k, err := GeneratePrivateKey(tt.alg)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error generating key: %v", i, err)
+		}
+		s := k.Signer()
+		if s.Alg() != tt.alg || s.ID() != k.ID() {
+			t.Errorf("case %d: want alg=%q id=%q, got alg=%q id=%q", i, tt.alg, k.ID(), s.Alg(), s.ID())
+		}
+
+		data := []byte("header.payload")
+		sig, err := s.Sign(data)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error signing: %v", i, err)
+		}
+		if len(sig) != tt.wantLen {
+			t.Errorf("case %d: want signature length %d, got %d", i, tt.wantLen, len(sig))
+		}
+
+		jwk := k.JWK()
+		if jwk.Type != tt.wantType || jwk.Curve != tt.wantCurve || jwk.Alg != tt.alg || jwk.Use != "sig" {
+			t.Errorf("case %d: unexpected JWK %#v", i, jwk)
+		}
+		v, err := jwk.Verifier()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating verifier: %v", i, err)
+		}
+		if err := v.Verify(sig, data); err != nil {
+			t.Errorf("case %d: unexpected error verifying signature: %v", i, err)
+		}
+		if err := v.Verify(sig, []byte("header.tampered")); err == nil {
+			t.Errorf("case %d: tampered data verified", i)
+		}
+
+		// Another key must not verify the signature.
+		other, err := GeneratePrivateKey(tt.alg)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error generating key: %v", i, err)
+		}
+		v, err = other.JWK().Verifier()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error creating verifier: %v", i, err)
+		}
+		if err := v.Verify(sig, data); err == nil {
+			t.Errorf("case %d: signature verified with another key", i)
+		}
+	}
+}
+
+func TestJWKVerifierInvalid(t *testing.T) {
+	es256, err := GeneratePrivateKey(jose.AlgES256)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	tests := []JWK{
+		// curve does not match the alg
+		func() JWK {
+			jwk := es256.JWK()
+			jwk.Alg = jose.AlgES384
+			return jwk
+		}(),
+		// point is not on the curve
+		func() JWK {
+			jwk := es256.JWK()
+			jwk.Y = jwk.X
+			return jwk
+		}(),
+		// RSA keys are go-oidc's
+		{Type: "RSA", Alg: jose.AlgRS256},
+		{Type: "OKP", Alg: AlgEdDSA, Curve: "Ed25519", X: "AQAB"},
+	}
+
+	for i, jwk := range tests {
+		if _, err := jwk.Verifier(); err == nil {
+			t.Errorf("case %d: want error, got nil", i)
+		}
+	}
+}
+
+func TestKeyRotatorRotate(t *testing.T) {
+	repo := NewPrivateKeySetRepo()
+	r := NewKeyRotator(repo, time.Hour, jose.AlgES256, AlgEdDSA)
+
+	var active []string
+	for i := 0; i < 3; i++ {
+		if err := r.Rotate(); err != nil {
+			t.Fatalf("rotation %d: unexpected error: %v", i, err)
+		}
+		pks, err := r.privateKeySet()
+		if err != nil {
+			t.Fatalf("rotation %d: unexpected error: %v", i, err)
+		}
+		active = append(active, pks.Active(jose.AlgES256).ID())
+	}
+
+	pks, err := r.privateKeySet()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	count := make(map[string]int)
+	for _, k := range pks.Keys() {
+		count[k.Alg]++
+	}
+	if count[jose.AlgES256] != 2 || count[AlgEdDSA] != 2 || len(pks.Keys()) != 4 {
+		t.Errorf("want 2 keys of each algorithm, got %v", count)
+	}
+
+	// The newest key is active, and the previous one is kept.
+	var ids []string
+	for _, k := range pks.Keys() {
+		if k.Alg == jose.AlgES256 {
+			ids = append(ids, k.ID())
+		}
+	}
+	if ids[0] != active[2] || ids[1] != active[1] {
+		t.Errorf("want ES256 keys %v, got %v", []string{active[2], active[1]}, ids)
+	}
+
+	if err := r.Healthy(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestKeyRotatorNextRotation(t *testing.T) {
+	repo := NewPrivateKeySetRepo()
+	r := NewKeyRotator(repo, time.Hour, jose.AlgES256)
+
+	if d, err := r.nextRotation(); err != nil || d != 0 {
+		t.Errorf("without keys: want rotation now, got %v, %v", d, err)
+	}
+	if err := r.Rotate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d, err := r.nextRotation(); err != nil || d <= 0 || d > 30*time.Minute {
+		t.Errorf("want rotation after half the TTL, got %v, %v", d, err)
+	}
+
+	// Newly configured algorithms are given keys right away.
+	r.algs = append(r.algs, AlgEdDSA)
+	if d, err := r.nextRotation(); err != nil || d != 0 {
+		t.Errorf("with a new algorithm: want rotation now, got %v, %v", d, err)
+	}
+}
+
+func TestKeyManager(t *testing.T) {
+	m := NewKeyManager()
+	if _, err := m.Signer(jose.AlgES256); err != key.ErrorNoKeys {
+		t.Errorf("without keys: want err=%v, got %v", key.ErrorNoKeys, err)
+	}
+
+	es256, err := GeneratePrivateKey(jose.AlgES256)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	if err := m.Set(NewPrivateKeySet([]*PrivateKey{es256}, time.Now().Add(time.Minute))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := m.Signer(AlgEdDSA); err != ErrorNoSigningKey {
+		t.Errorf("want err=%v, got %v", ErrorNoSigningKey, err)
+	}
+
+	s, err := m.Signer(jose.AlgES256)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jwt, err := jose.NewSignedJWT(jose.Claims{"sub": "elroy"}, s)
+	if err != nil {
+		t.Fatalf("unexpected error signing JWT: %v", err)
+	}
+	if ok, err := m.VerifySignature(*jwt); err != nil || !ok {
+		t.Errorf("want signature verified, got %t, %v", ok, err)
+	}
+
+	// Tokens whose header claims another algorithm are not verified.
+	jwt.Header[jose.HeaderKeyAlgorithm] = AlgEdDSA
+	if ok, err := m.VerifySignature(*jwt); err != nil || ok {
+		t.Errorf("want signature not verified, got %t, %v", ok, err)
+	}
+
+	if err := m.Set(NewPrivateKeySet([]*PrivateKey{es256}, time.Now().Add(-time.Minute))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Healthy(); err != key.ErrorPrivateKeysExpired {
+		t.Errorf("with expired keys: want err=%v, got %v", key.ErrorPrivateKeysExpired, err)
+	}
+}
@@ -0,0 +1,117 @@
+package signing
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/jonboulle/clockwork"
+)
+
+var (
+	ErrorNoSigningKey = errors.New("no signing key for algorithm")
+)
+
+// KeyManager holds the keys dex currently signs with. Like go-oidc's
+// key.PrivateKeyManager, it is a key.WritableKeySetRepo, to be kept up to date
+// by a key.KeySetSyncer.
+type KeyManager struct {
+	mu     sync.RWMutex
+	keySet *PrivateKeySet
+	clock  clockwork.Clock
+}
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{clock: clockwork.NewRealClock()}
+}
+
+func (m *KeyManager) Set(ks key.KeySet) error {
+	pks, ok := ks.(*PrivateKeySet)
+	if !ok {
+		return errors.New("unable to cast to PrivateKeySet")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keySet = pks
+	return nil
+}
+
+func (m *KeyManager) ExpiresAt() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.keySet == nil {
+		return m.clock.Now().UTC()
+	}
+	return m.keySet.ExpiresAt()
+}
+
+// Signer returns a signer with the active key of alg.
+func (m *KeyManager) Signer(alg string) (jose.Signer, error) {
+	if err := m.Healthy(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k := m.keySet.Active(alg)
+	if k == nil {
+		return nil, ErrorNoSigningKey
+	}
+	return k.Signer(), nil
+}
+
+func (m *KeyManager) JWKs() ([]JWK, error) {
+	if err := m.Healthy(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := m.keySet.Keys()
+	jwks := make([]JWK, len(keys))
+	for i, k := range keys {
+		jwks[i] = k.JWK()
+	}
+	return jwks, nil
+}
+
+// VerifySignature reports whether the JWT is signed with one of the keys.
+func (m *KeyManager) VerifySignature(jwt jose.JWT) (bool, error) {
+	jwks, err := m.JWKs()
+	if err != nil {
+		return false, err
+	}
+
+	alg := jwt.Header[jose.HeaderKeyAlgorithm]
+	kid, _ := jwt.KeyID()
+	for _, jwk := range jwks {
+		if jwk.Alg != alg || (kid != "" && jwk.ID != kid) {
+			continue
+		}
+		v, err := jwk.Verifier()
+		if err != nil {
+			return false, err
+		}
+		if v.Verify(jwt.Signature, []byte(jwt.Data())) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *KeyManager) Healthy() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.keySet == nil {
+		return key.ErrorNoKeys
+	}
+	if m.clock.Now().UTC().After(m.keySet.ExpiresAt()) {
+		return key.ErrorPrivateKeysExpired
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package signing
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc/key"
+)
+
+// NewPrivateKeySetRepo returns an in-memory repo of a PrivateKeySet.
+func NewPrivateKeySetRepo() key.PrivateKeySetRepo {
+	return &memPrivateKeySetRepo{}
+}
+
+type memPrivateKeySetRepo struct {
+	mu  sync.RWMutex
+	pks *PrivateKeySet
+}
+
+func (r *memPrivateKeySetRepo) Set(ks key.KeySet) error {
+	pks, ok := ks.(*PrivateKeySet)
+	if !ok {
+		return errors.New("unable to cast to PrivateKeySet")
+	} else if pks == nil {
+		return errors.New("nil KeySet")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pks = pks
+	return nil
+}
+
+func (r *memPrivateKeySetRepo) Get() (key.KeySet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.pks == nil {
+		return nil, key.ErrorNoKeys
+	}
+	return key.KeySet(r.pks), nil
+}
@@ -0,0 +1,157 @@
+package signing
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/key"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/pkg/log"
+	ptime "github.com/coreos/dex/pkg/time"
+)
+
+// KeyRotator periodically replaces the keys in a repo, like go-oidc's
+// key.PrivateKeyRotator does for RS256 keys. Each rotation generates a key for
+// every algorithm, and keeps the previous key of each algorithm so tokens
+// signed before the rotation can still be verified.
+type KeyRotator struct {
+	repo        key.PrivateKeySetRepo
+	algs        []string
+	generateKey func(alg string) (*PrivateKey, error)
+	clock       clockwork.Clock
+	keep        int
+	ttl         time.Duration
+}
+
+// NewKeyRotator returns a rotator of keys for algs, whose keys are valid for
+// ttl. Keys are rotated once half of ttl has elapsed.
+func NewKeyRotator(repo key.PrivateKeySetRepo, ttl time.Duration, algs ...string) *KeyRotator {
+	return &KeyRotator{
+		repo: repo,
+		algs: algs,
+		ttl:  ttl,
+
+		keep:        2,
+		generateKey: GeneratePrivateKey,
+		clock:       clockwork.NewRealClock(),
+	}
+}
+
+func (r *KeyRotator) Healthy() error {
+	pks, err := r.privateKeySet()
+	if err != nil {
+		return err
+	}
+
+	if r.clock.Now().After(pks.ExpiresAt()) {
+		return key.ErrorPrivateKeysExpired
+	}
+
+	return nil
+}
+
+func (r *KeyRotator) privateKeySet() (*PrivateKeySet, error) {
+	ks, err := r.repo.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	pks, ok := ks.(*PrivateKeySet)
+	if !ok {
+		return nil, errors.New("unable to cast to PrivateKeySet")
+	}
+	return pks, nil
+}
+
+func (r *KeyRotator) nextRotation() (time.Duration, error) {
+	pks, err := r.privateKeySet()
+	if err == key.ErrorNoKeys {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Algorithms without a key yet are given one right away.
+	for _, alg := range r.algs {
+		if pks.Active(alg) == nil {
+			return 0, nil
+		}
+	}
+
+	idealRotationTime := pks.ExpiresAt().Add(-r.ttl / 2)
+	if d := idealRotationTime.Sub(r.clock.Now()); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+// Rotate generates a key for every algorithm, and stores them in the repo in
+// front of the previous keys.
+func (r *KeyRotator) Rotate() error {
+	var keys []*PrivateKey
+	for _, alg := range r.algs {
+		k, err := r.generateKey(alg)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+
+	pks, err := r.privateKeySet()
+	if err != nil && err != key.ErrorNoKeys {
+		return err
+	}
+	if pks != nil {
+		kept := make(map[string]int)
+		for _, k := range keys {
+			kept[k.Alg]++
+		}
+		for _, k := range pks.Keys() {
+			if kept[k.Alg] == 0 || kept[k.Alg] >= r.keep {
+				// Keys of algorithms no longer rotated are dropped.
+				continue
+			}
+			kept[k.Alg]++
+			keys = append(keys, k)
+		}
+	}
+
+	return r.repo.Set(NewPrivateKeySet(keys, r.clock.Now().Add(r.ttl)))
+}
+
+func (r *KeyRotator) Run() chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		for {
+			var nextRotation time.Duration
+			var sleep time.Duration
+			var err error
+			for {
+				if nextRotation, err = r.nextRotation(); err == nil {
+					break
+				}
+				sleep = ptime.ExpBackoff(sleep, time.Minute)
+				log.Errorf("Error getting next signing key rotation, retrying in %v: %v", sleep, err)
+				time.Sleep(sleep)
+			}
+
+			select {
+			case <-r.clock.After(nextRotation):
+				if err := r.Rotate(); err != nil {
+					log.Errorf("Signing key rotation failed, retrying in %v: %v", time.Minute, err)
+					select {
+					case <-r.clock.After(time.Minute):
+					case <-stop:
+						return
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
@@ -0,0 +1,82 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"math/big"
+
+	"github.com/coreos/go-oidc/jose"
+	"golang.org/x/crypto/ed25519"
+)
+
+// verifier implements jose.Verifier for ES256, ES384 and EdDSA.
+type verifier struct {
+	keyID     string
+	alg       string
+	publicKey crypto.PublicKey
+}
+
+func (v *verifier) ID() string {
+	return v.keyID
+}
+
+func (v *verifier) Alg() string {
+	return v.alg
+}
+
+func (v *verifier) Verify(sig []byte, data []byte) error {
+	switch pub := v.publicKey.(type) {
+	case *ecdsa.PublicKey:
+		// ECDSA signatures are the concatenation of R and S, each padded to
+		// the size of the curve (RFC 7518 Section 3.4).
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest(v.alg, data), r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	return errors.New("unsupported public key")
+}
+
+// signer implements jose.Signer for ES256, ES384 and EdDSA.
+type signer struct {
+	verifier
+	privateKey crypto.Signer
+}
+
+func (s *signer) Sign(data []byte) ([]byte, error) {
+	switch pk := s.privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, pk, digest(s.alg, data))
+		if err != nil {
+			return nil, err
+		}
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		return append(padBytes(r, size), padBytes(ss, size)...), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(pk, data), nil
+	}
+	return nil, errors.New("unsupported private key")
+}
+
+func digest(alg string, data []byte) []byte {
+	h := crypto.SHA256
+	if alg == jose.AlgES384 {
+		h = crypto.SHA384
+	}
+	hh := h.New()
+	hh.Write(data)
+	return hh.Sum(nil)
+}
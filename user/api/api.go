@@ -9,8 +9,10 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
+	"github.com/coreos/dex/grant"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/refresh"
 	schema "github.com/coreos/dex/schema/workerschema"
@@ -24,6 +26,7 @@ var (
 		user.ErrorDuplicateEmail: ErrorDuplicateEmail,
 		user.ErrorInvalidEmail:   ErrorInvalidEmail,
 		client.ErrorNotFound:     ErrorInvalidClient,
+		grant.ErrorNotFound:      ErrorResourceNotFound,
 	}
 
 	ErrorInvalidEmail  = newError("invalid_email", "invalid email.", http.StatusBadRequest)
@@ -90,6 +93,8 @@ type UsersAPI struct {
 	localConnectorID string
 	clientManager    *clientmanager.ClientManager
 	refreshRepo      refresh.RefreshTokenRepo
+	accessTokenRepo  accesstoken.AccessTokenRepo
+	grantRepo        grant.GrantRepo
 	emailer          Emailer
 	allowClientCreds bool
 }
@@ -105,10 +110,12 @@ type Creds struct {
 }
 
 // TODO(ericchiang): Don't pass a dbMap. See #385.
-func NewUsersAPI(userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, refreshRepo refresh.RefreshTokenRepo, emailer Emailer, localConnectorID string, allowClientCreds bool) *UsersAPI {
+func NewUsersAPI(userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, refreshRepo refresh.RefreshTokenRepo, accessTokenRepo accesstoken.AccessTokenRepo, grantRepo grant.GrantRepo, emailer Emailer, localConnectorID string, allowClientCreds bool) *UsersAPI {
 	return &UsersAPI{
 		userManager:      userManager,
 		refreshRepo:      refreshRepo,
+		accessTokenRepo:  accessTokenRepo,
+		grantRepo:        grantRepo,
 		clientManager:    clientManager,
 		localConnectorID: localConnectorID,
 		emailer:          emailer,
@@ -303,13 +310,78 @@ func (u *UsersAPI) ListClientsWithRefreshTokens(creds Creds, userID string) ([]*
 }
 
 // RevokeClient revokes all refresh tokens issued to this client for the
-// authenticiated user.
+// authenticiated user, along with the access tokens issued with them.
 func (u *UsersAPI) RevokeRefreshTokensForClient(creds Creds, userID, clientID string) error {
 	// Users must either be an admin or be requesting data associated with their own account.
 	if !creds.User.Admin && (creds.User.ID != userID) {
 		return ErrorUnauthorized
 	}
-	return u.refreshRepo.RevokeTokensForClient(userID, clientID)
+	return u.revokeTokensForClient(userID, clientID)
+}
+
+// revokeTokensForClient revokes the refresh tokens and access tokens issued
+// to the client for the user.
+func (u *UsersAPI) revokeTokensForClient(userID, clientID string) error {
+	if err := u.refreshRepo.RevokeTokensForClient(userID, clientID); err != nil {
+		return err
+	}
+	return u.accessTokenRepo.RevokeTokensForClient(userID, clientID)
+}
+
+// ListGrants returns the clients the authenticated user has approved scopes
+// for on the consent page.
+func (u *UsersAPI) ListGrants(creds Creds, userID string) ([]*schema.Grant, error) {
+	// Users must either be an admin or be requesting data associated with their own account.
+	if !creds.User.Admin && (creds.User.ID != userID) {
+		return nil, ErrorUnauthorized
+	}
+	grants, err := u.grantRepo.List(userID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	urlToString := func(u *url.URL) string {
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+
+	list := make([]*schema.Grant, len(grants))
+	for i, g := range grants {
+		list[i] = &schema.Grant{
+			ClientID:  g.ClientID,
+			Scopes:    g.Scope,
+			CreatedAt: g.CreatedAt.UTC().Format(time.RFC3339),
+			UpdatedAt: g.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		// The client may have been deleted since the grant was made.
+		cli, err := u.clientManager.Get(g.ClientID)
+		if err == client.ErrorNotFound {
+			continue
+		} else if err != nil {
+			return nil, mapError(err)
+		}
+		list[i].ClientName = cli.Metadata.ClientName
+		list[i].ClientURI = urlToString(cli.Metadata.ClientURI)
+		list[i].LogoURI = urlToString(cli.Metadata.LogoURI)
+	}
+	return list, nil
+}
+
+// RevokeGrant removes the grant of the authenticated user to the client, so
+// the consent page is shown again the next time the client asks for the
+// scopes. The refresh tokens and access tokens issued to the client for the
+// user are revoked as well.
+func (u *UsersAPI) RevokeGrant(creds Creds, userID, clientID string) error {
+	// Users must either be an admin or be requesting data associated with their own account.
+	if !creds.User.Admin && (creds.User.ID != userID) {
+		return ErrorUnauthorized
+	}
+	if err := u.grantRepo.Delete(userID, clientID); err != nil {
+		return mapError(err)
+	}
+	return u.revokeTokensForClient(userID, clientID)
 }
 
 func (u *UsersAPI) Authorize(creds Creds) bool {
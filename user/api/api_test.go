@@ -11,10 +11,12 @@ import (
 	"github.com/jonboulle/clockwork"
 	"github.com/kylelemons/godebug/pretty"
 
+	"github.com/coreos/dex/accesstoken"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/grant"
 	schema "github.com/coreos/dex/schema/workerschema"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/dex/user/manager"
@@ -225,13 +227,25 @@ func makeTestFixtures(clientCredsFlag bool) (*UsersAPI, *testEmailer) {
 	}
 	refreshRepo := db.NewRefreshTokenRepo(dbMap)
 	for _, token := range refreshTokens {
-		if _, err := refreshRepo.Create(token.userID, token.clientID, "local", []string{"openid"}); err != nil {
+		if _, err := refreshRepo.Create(token.userID, token.clientID, "local", []string{"openid"}, nil); err != nil {
 			panic("Failed to create refresh token: " + err.Error())
 		}
 	}
 
+	// Used in TestRevokeGrant test.
+	grantRepo := db.NewGrantRepo(dbMap)
+	if err := grantRepo.Set(grant.Grant{
+		UserID:    "ID-1",
+		ClientID:  goodClientID,
+		Scope:     []string{"openid", "offline_access"},
+		CreatedAt: clock.Now(),
+		UpdatedAt: clock.Now(),
+	}); err != nil {
+		panic("Failed to create grant: " + err.Error())
+	}
+
 	emailer := &testEmailer{}
-	api := NewUsersAPI(mgr, clientManager, refreshRepo, emailer, "local", clientCredsFlag)
+	api := NewUsersAPI(mgr, clientManager, refreshRepo, db.NewAccessTokenRepo(dbMap), grantRepo, emailer, "local", clientCredsFlag)
 	return api, emailer
 
 }
@@ -780,3 +794,100 @@ func TestRevokeRefreshToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRevokeGrant(t *testing.T) {
+	tests := []struct {
+		creds    Creds
+		userID   string
+		clientID string
+		before   []string // clientIDs expected before the change.
+		wantErr  error
+	}{
+		{
+			creds:    Creds{User: user.User{ID: "ID-1"}},
+			userID:   "ID-1",
+			clientID: goodClientID,
+			before:   []string{goodClientID},
+		},
+		{
+			// An admin may revoke grants of other users.
+			creds:    goodCreds,
+			userID:   "ID-1",
+			clientID: goodClientID,
+			before:   []string{goodClientID},
+		},
+		{
+			creds:    Creds{User: user.User{ID: "ID-2"}},
+			userID:   "ID-1",
+			clientID: goodClientID,
+			wantErr:  ErrorUnauthorized,
+		},
+		{
+			creds:    Creds{User: user.User{ID: "ID-2"}},
+			userID:   "ID-2",
+			clientID: goodClientID,
+			before:   []string{},
+			wantErr:  ErrorResourceNotFound,
+		},
+	}
+
+	for i, tt := range tests {
+		api, _ := makeTestFixtures(false)
+		tok, err := api.accessTokenRepo.Create(accesstoken.AccessToken{
+			UserID:    tt.userID,
+			ClientID:  tt.clientID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("case %d: failed to create access token: %v", i, err)
+		}
+
+		grants, err := api.ListGrants(tt.creds, tt.userID)
+		if err != nil {
+			if err != tt.wantErr {
+				t.Errorf("case %d: list grants failed: %v", i, err)
+			}
+			continue
+		}
+		clientIDs := make([]string, len(grants))
+		for j, g := range grants {
+			clientIDs[j] = g.ClientID
+		}
+		if diff := pretty.Compare(tt.before, clientIDs); diff != "" {
+			t.Errorf("case %d: before exp!=got: %s", i, diff)
+		}
+
+		err = api.RevokeGrant(tt.creds, tt.userID, tt.clientID)
+		if err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		grants, err = api.ListGrants(tt.creds, tt.userID)
+		if err != nil {
+			t.Errorf("case %d: list grants failed: %v", i, err)
+			continue
+		}
+		if len(grants) != 0 {
+			t.Errorf("case %d: want no grants after revoking, got %d", i, len(grants))
+		}
+
+		// Revoking the grant also revokes the client's refresh tokens.
+		clients, err := api.ListClientsWithRefreshTokens(tt.creds, tt.userID)
+		if err != nil {
+			t.Errorf("case %d: list clients failed: %v", i, err)
+			continue
+		}
+		if len(clients) != 0 {
+			t.Errorf("case %d: want no clients with refresh tokens, got %d", i, len(clients))
+		}
+
+		// And the access tokens issued to it.
+		if _, err := api.accessTokenRepo.Get(tok); err != accesstoken.ErrorInvalidToken {
+			t.Errorf("case %d: want access token revoked, got err=%v", i, err)
+		}
+	}
+}
@@ -139,6 +139,27 @@ func (m *UserManager) SetDisplayName(usr user.User, displayName string) error {
 	return nil
 }
 
+// SetProfile replaces the profile of the user with the one a connector
+// reported.
+func (m *UserManager) SetProfile(usr user.User, profile user.Profile) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	usr.Profile = profile
+	if err = m.userRepo.Update(tx, usr); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // RegisterWithRemoteIdentity creates new user and attaches the given remote identity.
 func (m *UserManager) RegisterWithRemoteIdentity(email string, emailVerified bool, rid user.RemoteIdentity) (string, error) {
 	tx, err := m.begin()
@@ -0,0 +1,32 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// PairwiseSubject returns the subject identifier of the user for the clients
+// of a sector: a hash of the sector identifier, the user's ID and a salt
+// which keeps the identifier from being computed outside of dex (OpenID
+// Connect Core 1.0 Section 8.1).
+func PairwiseSubject(sector, userID string, salt []byte) string {
+	h := sha256.New()
+	h.Write([]byte(sector))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write(salt)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// PairwiseSubjectRepo remembers the users pairwise subject identifiers were
+// issued for, since the identifiers can't be mapped back to users otherwise.
+type PairwiseSubjectRepo interface {
+	// Get returns the ID of the user sub identifies to the clients of the
+	// sector, or ErrorNotFound.
+	Get(sector, sub string) (string, error)
+
+	// Set records that sub identifies the user to the clients of the
+	// sector. Setting the same subject again is a no-op.
+	Set(sector, sub, userID string) error
+}
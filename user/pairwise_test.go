@@ -0,0 +1,23 @@
+package user
+
+import "testing"
+
+func TestPairwiseSubject(t *testing.T) {
+	salt := []byte("salt")
+	sub := PairwiseSubject("client.example.com", "user1", salt)
+	if sub != PairwiseSubject("client.example.com", "user1", salt) {
+		t.Errorf("pairwise subject is not stable")
+	}
+
+	for i, other := range []string{
+		PairwiseSubject("other.example.com", "user1", salt),
+		PairwiseSubject("client.example.com", "user2", salt),
+		PairwiseSubject("client.example.com", "user1", []byte("other")),
+		// the sector and user ID are not simply concatenated
+		PairwiseSubject("client.example.comuser", "1", salt),
+	} {
+		if other == sub {
+			t.Errorf("case %d: want another subject than %q", i, sub)
+		}
+	}
+}
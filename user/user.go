@@ -85,6 +85,37 @@ type User struct {
 	Disabled bool
 
 	CreatedAt time.Time
+
+	// Profile is what the connector the user last logged in through knows
+	// about them.
+	Profile Profile
+}
+
+// Profile holds the standard claims of the "profile" scope which connectors
+// learn about users from upstream identity providers, beyond their display
+// name.
+type Profile struct {
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+}
+
+// AddToClaims adds the known attributes of the profile to the given Claims.
+// http://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+func (p Profile) AddToClaims(claims jose.Claims) {
+	for name, v := range map[string]string{
+		"given_name":         p.GivenName,
+		"family_name":        p.FamilyName,
+		"preferred_username": p.PreferredUsername,
+		"picture":            p.Picture,
+		"locale":             p.Locale,
+	} {
+		if v != "" {
+			claims.Add(name, v)
+		}
+	}
 }
 
 type UserFilter struct {